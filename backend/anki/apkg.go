@@ -0,0 +1,534 @@
+// Package anki reads and writes Anki deck packages (.apkg): a zip holding
+// the collection as a SQLite database (schema 11, which every Anki version
+// since 2.1 imports) and a media index.
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deck is a deck of front/back and cloze cards.
+type Deck struct {
+	Name  string
+	Cards []Card
+}
+
+// Card is one card. IDs and GUID are Anki's; zero values are filled in on
+// export. Front and Back are plain text.
+//
+// Cards of a cloze note have Cloze set to the deletion number they ask for,
+// the cloze text in Front and the note's extra field in Back. Cloze cards
+// with the same GUID and text are exported as one note.
+type Card struct {
+	ID       int64
+	NoteID   int64
+	GUID     string // Identifies the note across imports, so re-imports update it
+	Front    string
+	Back     string
+	Cloze    int
+	Tags     []string
+	Schedule *Schedule // nil for cards that were never studied
+}
+
+// Schedule is the review state of a studied card.
+type Schedule struct {
+	Ease        float64 // 2.5 = 250%
+	Interval    int     // Days
+	Repetitions int
+	Lapses      int
+	Due         time.Time
+}
+
+// ErrNewFormat is returned for packages only holding a collection in the
+// compressed format of Anki 2.1.50+, which older versions can't read either.
+var ErrNewFormat = errors.New(`package only has the newer Anki collection format: export it again with "Support older Anki versions" checked`)
+
+const (
+	// The note types exports use, so repeated imports share them
+	modelID        = 1700000000001
+	clozeModelID   = 1700000000002
+	fieldSeparator = "\x1f"
+	// Anki's own defaults
+	defaultEase = 2.5
+	newCard     = 0
+	learning    = 1
+	review      = 2
+	relearning  = 3
+)
+
+const schema = `CREATE TABLE col (
+    id              integer primary key,
+    crt             integer not null,
+    mod             integer not null,
+    scm             integer not null,
+    ver             integer not null,
+    dty             integer not null,
+    usn             integer not null,
+    ls              integer not null,
+    conf            text not null,
+    models          text not null,
+    decks           text not null,
+    dconf           text not null,
+    tags            text not null
+);
+CREATE TABLE notes (
+    id              integer primary key,
+    guid            text not null,
+    mid             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    tags            text not null,
+    flds            text not null,
+    sfld            integer not null,
+    csum            integer not null,
+    flags           integer not null,
+    data            text not null
+);
+CREATE TABLE cards (
+    id              integer primary key,
+    nid             integer not null,
+    did             integer not null,
+    ord             integer not null,
+    mod             integer not null,
+    usn             integer not null,
+    type            integer not null,
+    queue           integer not null,
+    due             integer not null,
+    ivl             integer not null,
+    factor          integer not null,
+    reps            integer not null,
+    lapses          integer not null,
+    left            integer not null,
+    odue            integer not null,
+    odid            integer not null,
+    flags           integer not null,
+    data            text not null
+);
+CREATE TABLE revlog (
+    id              integer primary key,
+    cid             integer not null,
+    usn             integer not null,
+    ease            integer not null,
+    ivl             integer not null,
+    lastIvl         integer not null,
+    factor          integer not null,
+    time            integer not null,
+    type            integer not null
+);
+CREATE TABLE graves (
+    usn             integer not null,
+    oid             integer not null,
+    type            integer not null
+)`
+
+const modelCSS = ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n"
+
+// toHTML escapes card text for a note field.
+func toHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+var (
+	lineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+	tag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// fieldText turns the HTML of a note field into plain text.
+func fieldText(s string) string {
+	s = lineBreak.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(tag.ReplaceAllString(s, ""))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// checksum is Anki's note checksum: the first 8 hex digits of the SHA-1 of
+// the first field's text.
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(fieldText(field)))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// guid makes a note GUID from an ID, in the base91 alphabet Anki uses.
+func guid(id int64) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_`{|}~"
+	var sb strings.Builder
+	for v := uint64(id); ; v /= uint64(len(alphabet)) {
+		sb.WriteByte(alphabet[v%uint64(len(alphabet))])
+		if v < uint64(len(alphabet)) {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Write builds a package holding deck, as of now.
+func Write(deck Deck, now time.Time) ([]byte, error) {
+	crt := dayStart(now)
+	nowMs := now.UnixMilli()
+	deckID := nowMs
+
+	var notes, cards []row
+	usedNotes, usedCards := map[int64]bool{}, map[int64]bool{}
+	clozeNotes := map[string]int64{}
+	for i, c := range deck.Cards {
+		// Fill in missing or clashing IDs from the clock, the way Anki does
+		cardID := c.ID
+		for cardID <= 0 || usedCards[cardID] {
+			cardID = nowMs + int64(i)
+			nowMs++
+		}
+		usedCards[cardID] = true
+
+		ord, key := 0, ""
+		if c.Cloze > 0 {
+			ord, key = c.Cloze-1, c.GUID+fieldSeparator+c.Front
+		}
+		noteID, ok := clozeNotes[key]
+		if !ok || key == "" {
+			noteID = c.NoteID
+			for noteID <= 0 || usedNotes[noteID] {
+				noteID = nowMs + int64(i)
+				nowMs++
+			}
+			usedNotes[noteID] = true
+			if key != "" {
+				clozeNotes[key] = noteID
+			}
+			notes = append(notes, noteRow(noteID, c, now))
+		}
+
+		kind, queue, due, ivl, factor, reps, lapses := newCard, newCard, int64(i+1), 0, 0, 0, 0
+		if s := c.Schedule; s != nil {
+			kind, queue = review, review
+			due = int64(dayStart(s.Due).Sub(crt).Hours() / 24)
+			ivl, factor, reps, lapses = max(s.Interval, 1), int(s.Ease*1000), s.Repetitions, s.Lapses
+		}
+		cards = append(cards, row{cardID, []interface{}{
+			nil, noteID, deckID, int64(ord), now.Unix(), int64(-1), int64(kind), int64(queue), due,
+			int64(ivl), int64(factor), int64(reps), int64(lapses), int64(0), int64(0), int64(0), int64(0), "",
+		}})
+	}
+	sortRows(notes)
+	sortRows(cards)
+
+	col, err := collectionRow(deck.Name, deckID, crt, now)
+	if err != nil {
+		return nil, err
+	}
+	tables := []table{{name: "col", rows: []row{col}}, {name: "notes", rows: notes}, {name: "cards", rows: cards}, {name: "revlog"}, {name: "graves"}}
+	for i, create := range strings.Split(schema, ";\n") {
+		tables[i].create = create
+	}
+	db, err := writeDatabase(tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string][]byte{"collection.anki2": db, "media": []byte("{}")} {
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// noteRow is the note of card c.
+func noteRow(id int64, c Card, now time.Time) row {
+	if c.GUID == "" {
+		c.GUID = guid(id)
+	}
+	tags := ""
+	if len(c.Tags) > 0 {
+		tags = " " + strings.Join(c.Tags, " ") + " "
+	}
+	model := modelID
+	if c.Cloze > 0 {
+		model = clozeModelID
+	}
+	front := toHTML(c.Front)
+	return row{id, []interface{}{
+		nil, c.GUID, int64(model), now.Unix(), int64(-1), tags,
+		front + fieldSeparator + toHTML(c.Back), c.Front, checksum(front), int64(0), "",
+	}}
+}
+
+func sortRows(rows []row) {
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+}
+
+// collectionRow is the col row: the note type, deck and deck options the
+// cards use, as JSON.
+func collectionRow(deckName string, deckID int64, crt, now time.Time) (row, error) {
+	mod := now.Unix()
+	model := func(id int64, name string, kind int, fields []string, qfmt, afmt string) map[string]interface{} {
+		template := "Card 1"
+		if kind == 1 {
+			template = "Cloze"
+		}
+		var flds []map[string]interface{}
+		for i, field := range fields {
+			flds = append(flds, map[string]interface{}{"name": field, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}})
+		}
+		return map[string]interface{}{
+			"id": id, "name": name, "type": kind, "mod": mod, "usn": -1, "sortf": 0,
+			"did": deckID, "tags": []string{}, "vers": []int{}, "css": modelCSS, "flds": flds,
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"tmpls": []map[string]interface{}{{
+				"name": template, "ord": 0, "did": nil, "bqfmt": "", "bafmt": "", "qfmt": qfmt, "afmt": afmt,
+			}},
+			"req": []interface{}{[]interface{}{0, "all", []int{0}}},
+		}
+	}
+	models := map[string]interface{}{
+		strconv.Itoa(modelID): model(modelID, "TutorGenX Basic", 0, []string{"Front", "Back"},
+			"{{Front}}", "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}"),
+		strconv.Itoa(clozeModelID): model(clozeModelID, "TutorGenX Cloze", 1, []string{"Text", "Back Extra"},
+			"{{cloze:Text}}", "{{cloze:Text}}<br>\n{{Back Extra}}"),
+	}
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "mod": mod, "usn": -1, "desc": "", "dyn": 0, "conf": 1, "collapsed": false,
+			"extendNew": 10, "extendRev": 50, "newToday": []int{0, 0}, "revToday": []int{0, 0},
+			"lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	dconf := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0,
+			"replayq": true, "dyn": false,
+			"new":   map[string]interface{}{"delays": []float64{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500, "order": 1, "perDay": 20, "bury": true, "separate": true},
+			"rev":   map[string]interface{}{"perDay": 100, "ease4": 1.3, "fuzz": 0.05, "maxIvl": 36500, "bury": true, "minSpace": 1, "ivlFct": 1},
+			"lapse": map[string]interface{}{"delays": []float64{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+		},
+	}
+	conf := map[string]interface{}{
+		"nextPos": 1, "estTimes": true, "activeDecks": []int64{1}, "sortType": "noteFld", "timeLim": 0,
+		"sortBackwards": false, "addToCur": true, "curDeck": 1, "newBury": true, "newSpread": 0,
+		"dueCounts": true, "curModel": strconv.Itoa(modelID), "collapseTime": 1200,
+	}
+
+	var encoded [4]string
+	for i, v := range []interface{}{
+		conf,
+		models,
+		map[string]interface{}{"1": deck(1, "Default"), strconv.FormatInt(deckID, 10): deck(deckID, deckName)},
+		dconf,
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return row{}, err
+		}
+		encoded[i] = string(data)
+	}
+	return row{1, []interface{}{
+		nil, crt.Unix(), now.UnixMilli(), now.UnixMilli(), int64(11), int64(0), int64(0), int64(0),
+		encoded[0], encoded[1], encoded[2], encoded[3], "{}",
+	}}, nil
+}
+
+// Read returns the decks of a package, with the cards of each. The reverse
+// card of a two-sided note is read back to front, and cloze cards come with
+// their deletion number; notes of other kinds use their first two fields.
+func Read(data []byte) ([]Deck, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an Anki package: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	// anki21 is what 2.1 writes with "Support older Anki versions"; anki2 is
+	// older still. Newer exports hold only a placeholder anki2 next to anki21b.
+	f := files["collection.anki21"]
+	if f == nil {
+		if files["collection.anki21b"] != nil {
+			return nil, ErrNewFormat
+		}
+		f = files["collection.anki2"]
+	}
+	if f == nil {
+		return nil, fmt.Errorf("not an Anki package: no collection")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	collection, err := io.ReadAll(io.LimitReader(rc, 200<<20))
+	if err != nil {
+		return nil, err
+	}
+	return readCollection(collection)
+}
+
+func readCollection(data []byte) ([]Deck, error) {
+	db, err := openDatabase(data)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := db.tables()
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) ([]row, error) {
+		root, ok := roots[name]
+		if !ok {
+			return nil, fmt.Errorf("collection has no %s table", name)
+		}
+		return db.rows(root)
+	}
+	cols, err := read("col")
+	if err != nil {
+		return nil, err
+	}
+	notes, err := read("notes")
+	if err != nil {
+		return nil, err
+	}
+	cards, err := read("cards")
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 || len(cols[0].values) < 11 {
+		return nil, fmt.Errorf("collection has no settings")
+	}
+
+	col := cols[0].values
+	crt := time.Unix(integer(col[1]), 0)
+	var models map[string]struct {
+		Type int `json:"type"`
+	}
+	var decks map[string]struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal([]byte(text(col[9])), &models)
+	json.Unmarshal([]byte(text(col[10])), &decks)
+
+	type note struct {
+		guid   string
+		fields []string
+		tags   []string
+		cloze  bool
+	}
+	byID := map[int64]note{}
+	for _, r := range notes {
+		if len(r.values) < 7 {
+			return nil, errCorrupt
+		}
+		mid := strconv.FormatInt(integer(r.values[2]), 10)
+		byID[r.id] = note{
+			guid:   text(r.values[1]),
+			fields: strings.Split(text(r.values[6]), fieldSeparator),
+			tags:   strings.Fields(text(r.values[5])),
+			cloze:  models[mid].Type == 1,
+		}
+	}
+
+	var result []Deck
+	index := map[int64]int{}
+	for _, r := range cards {
+		if len(r.values) < 13 {
+			return nil, errCorrupt
+		}
+		v := r.values
+		n, ok := byID[integer(v[1])]
+		if !ok {
+			continue
+		}
+		c := Card{ID: r.id, NoteID: integer(v[1]), GUID: n.guid, Tags: n.tags, Front: fieldText(n.fields[0])}
+		if n.cloze {
+			c.Cloze = int(integer(v[3])) + 1
+		}
+		if len(n.fields) > 1 {
+			c.Back = fieldText(n.fields[1])
+		}
+		if integer(v[3]) == 1 && !n.cloze {
+			c.Front, c.Back = c.Back, c.Front
+		}
+
+		kind, due := integer(v[6]), integer(v[8])
+		if kind == review || kind == relearning || kind == learning {
+			s := &Schedule{Ease: float64(integer(v[10])) / 1000, Interval: int(integer(v[9])), Repetitions: int(integer(v[11])), Lapses: int(integer(v[12]))}
+			if s.Ease == 0 {
+				s.Ease = defaultEase
+			}
+			// Learning cards are due at a timestamp, the rest on a day
+			if due > 1_000_000_000 {
+				s.Due = time.Unix(due, 0)
+			} else {
+				s.Due = crt.AddDate(0, 0, int(due))
+			}
+			c.Schedule = s
+		}
+
+		did := integer(v[2])
+		i, ok := index[did]
+		if !ok {
+			name := decks[strconv.FormatInt(did, 10)].Name
+			if name == "" {
+				name = "Imported deck"
+			}
+			i = len(result)
+			index[did] = i
+			result = append(result, Deck{Name: name})
+		}
+		result[i].Cards = append(result[i].Cards, c)
+	}
+	return result, nil
+}
+
+func integer(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+
+func testDeck() Deck {
+	return Deck{Name: "Biology::Cells", Cards: []Card{
+		{ID: 1600000000001, NoteID: 1500000000001, GUID: "kept-guid", Front: "What is <ATP>?", Back: "The cell's energy currency\n& more", Tags: []string{"bio", "energy"}},
+		{ID: 1600000000002, Front: "Plain card", Back: "No IDs or tags"},
+		{
+			ID: 1600000000003, Front: "Studied card", Back: "Back",
+			Schedule: &Schedule{Ease: 2.3, Interval: 12, Repetitions: 5, Lapses: 1, Due: time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)},
+		},
+		// Two cards of one cloze note, and a clashing card ID
+		{ID: 1600000000004, GUID: "cloze-note", Front: "{{c1::Mitochondria}} make {{c2::ATP}}", Back: "Extra", Cloze: 1, Tags: []string{"cloze"}},
+		{ID: 1600000000004, GUID: "cloze-note", Front: "{{c1::Mitochondria}} make {{c2::ATP}}", Back: "Extra", Cloze: 2, Tags: []string{"cloze"}},
+	}}
+}
+
+func TestWriteRead(t *testing.T) {
+	deck := testDeck()
+	data, err := Write(deck, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decks, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decks) != 1 || decks[0].Name != deck.Name || len(decks[0].Cards) != len(deck.Cards) {
+		t.Fatalf("read %+v", decks)
+	}
+	cards := decks[0].Cards
+
+	ids, notes := map[int64]bool{}, map[int64]bool{}
+	for i, got := range cards {
+		want := deck.Cards[i]
+		if got.Front != want.Front || got.Back != want.Back || got.Cloze != want.Cloze || strings.Join(got.Tags, " ") != strings.Join(want.Tags, " ") {
+			t.Errorf("card %d: got %+v, want %+v", i, got, want)
+		}
+		if ids[got.ID] {
+			t.Errorf("card %d reuses ID %d", i, got.ID)
+		}
+		ids[got.ID] = true
+		if got.GUID == "" {
+			t.Errorf("card %d has no GUID", i)
+		}
+		if want.Cloze == 0 {
+			notes[got.NoteID] = true
+		}
+		if (got.Schedule == nil) != (want.Schedule == nil) {
+			t.Errorf("card %d: schedule %+v, want %+v", i, got.Schedule, want.Schedule)
+		} else if got.Schedule != nil {
+			g, w := *got.Schedule, *want.Schedule
+			if !g.Due.Equal(w.Due) {
+				t.Errorf("card %d: due %v, want %v", i, g.Due, w.Due)
+			}
+			g.Due, w.Due = time.Time{}, time.Time{}
+			if g != w {
+				t.Errorf("card %d: schedule %+v, want %+v", i, g, w)
+			}
+		}
+	}
+	if cards[0].ID != 1600000000001 || cards[0].NoteID != 1500000000001 || cards[0].GUID != "kept-guid" {
+		t.Errorf("IDs not kept: %+v", cards[0])
+	}
+	if cards[3].ID != 1600000000004 || cards[4].ID == cards[3].ID {
+		t.Errorf("clashing card IDs: %d, %d", cards[3].ID, cards[4].ID)
+	}
+	if cards[3].NoteID != cards[4].NoteID || cards[3].GUID != "cloze-note" || notes[cards[3].NoteID] {
+		t.Errorf("cloze cards are not one note of their own: %+v, %+v", cards[3], cards[4])
+	}
+	if len(notes) != 3 {
+		t.Errorf("front/back cards share notes: %v", notes)
+	}
+
+	// Exporting what was imported changes nothing
+	again, err := Write(decks[0], now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decks2, err := Read(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decks2, decks) {
+		t.Errorf("second round trip changed the deck:\n%+v\n%+v", decks2, decks)
+	}
+}
+
+// TestWriteReadLarge spreads the tables over interior and overflow pages.
+func TestWriteReadLarge(t *testing.T) {
+	deck := Deck{Name: "Large"}
+	for i := 0; i < 3000; i++ {
+		back := fmt.Sprintf("answer %d", i)
+		if i%100 == 0 {
+			back = strings.Repeat(back+" ", 2000) // Several pages long
+		}
+		deck.Cards = append(deck.Cards, Card{Front: fmt.Sprintf("question %d", i), Back: strings.TrimSpace(back)})
+	}
+	data, err := Write(deck, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decks, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decks) != 1 || len(decks[0].Cards) != len(deck.Cards) {
+		t.Fatalf("read %d decks", len(decks))
+	}
+	for i, c := range decks[0].Cards {
+		if c.Front != deck.Cards[i].Front || c.Back != deck.Cards[i].Back {
+			t.Fatalf("card %d: got %q / %.40q", i, c.Front, c.Back)
+		}
+	}
+}
+
+// TestWriteSQLite checks the collection with SQLite itself, when it is installed.
+func TestWriteSQLite(t *testing.T) {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	data, err := Write(testDeck(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("collection.anki2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, _ := io.ReadAll(f)
+	path := filepath.Join(t.TempDir(), "collection.anki2")
+	if err := os.WriteFile(path, collection, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(sqlite, path, "PRAGMA integrity_check; SELECT count(*) FROM notes; SELECT group_concat(ord) FROM cards;").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if got := string(out); got != "ok\n4\n0,0,0,0,1\n" {
+		t.Errorf("sqlite3 says %q", got)
+	}
+}
+
+func TestReadNewFormat(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"collection.anki2", "collection.anki21b"} {
+		zw.Create(name)
+	}
+	zw.Close()
+	if _, err := Read(buf.Bytes()); err != ErrNewFormat {
+		t.Errorf("got %v, want ErrNewFormat", err)
+	}
+}
@@ -0,0 +1,539 @@
+package anki
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Just enough of the SQLite file format (https://www.sqlite.org/fileformat.html)
+// to write a database of plain tables and to read tables back, so packages
+// can be handled without cgo or a database driver. Indexes are neither
+// written nor read; SQLite and Anki work without them.
+
+const (
+	pageSize        = 4096
+	leafTablePage   = 0x0d
+	interiorTablePg = 0x05
+	sqliteHeader    = "SQLite format 3\x00"
+)
+
+var errCorrupt = errors.New("malformed database")
+
+// table is a table to write: its CREATE statement and rows in rowid order.
+// Values are nil, int64, float64, string or []byte.
+type table struct {
+	name   string
+	create string
+	rows   []row
+}
+
+type row struct {
+	id     int64
+	values []interface{}
+}
+
+func putVarint(b []byte, v uint64) []byte {
+	if v > 0x00ffffffffffffff {
+		// 9 bytes: 8 groups of 7 bits, then the last 8 bits whole
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [9]byte
+	n := 0
+	for {
+		buf[n] = byte(v&0x7f) | 0x80
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	buf[0] &= 0x7f
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, buf[i])
+	}
+	return b
+}
+
+// varint reads a varint, returning 0 bytes read if b is too short.
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// encodeRecord encodes values in the SQLite record format.
+func encodeRecord(values []interface{}) ([]byte, error) {
+	var types []uint64
+	var body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int:
+			t, b := encodeInt(int64(v))
+			types, body = append(types, t), append(body, b...)
+		case int64:
+			t, b := encodeInt(v)
+			types, body = append(types, t), append(body, b...)
+		case float64:
+			types = append(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types = append(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		case []byte:
+			types = append(types, uint64(12+2*len(v)))
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("unsupported value %T", v)
+		}
+	}
+	var header []byte
+	for _, t := range types {
+		header = putVarint(header, t)
+	}
+	// The header size counts itself
+	size := len(header) + 1
+	if size > 127 {
+		size = len(header) + len(putVarint(nil, uint64(len(header)+2)))
+	}
+	record := putVarint(nil, uint64(size))
+	record = append(record, header...)
+	return append(record, body...), nil
+}
+
+func encodeInt(v int64) (uint64, []byte) {
+	switch {
+	case v == 0:
+		return 8, nil
+	case v == 1:
+		return 9, nil
+	case v >= -128 && v <= 127:
+		return 1, []byte{byte(v)}
+	case v >= -32768 && v <= 32767:
+		return 2, binary.BigEndian.AppendUint16(nil, uint16(v))
+	case v >= -8388608 && v <= 8388607:
+		b := binary.BigEndian.AppendUint32(nil, uint32(v))
+		return 3, b[1:]
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return 4, binary.BigEndian.AppendUint32(nil, uint32(v))
+	case v >= -1<<47 && v < 1<<47:
+		b := binary.BigEndian.AppendUint64(nil, uint64(v))
+		return 5, b[2:]
+	}
+	return 6, binary.BigEndian.AppendUint64(nil, uint64(v))
+}
+
+// decodeRecord decodes a record into nil, int64, float64, string and []byte values.
+func decodeRecord(b []byte) ([]interface{}, error) {
+	headerSize, n := varint(b)
+	if n == 0 || headerSize > uint64(len(b)) || headerSize < uint64(n) {
+		return nil, errCorrupt
+	}
+	header, body := b[n:headerSize], b[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		t, n := varint(header)
+		if n == 0 {
+			return nil, errCorrupt
+		}
+		header = header[n:]
+		size := 0
+		switch {
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6, t == 7:
+			size = 8
+		case t >= 12:
+			if (t-12)/2 > uint64(len(body)) {
+				return nil, errCorrupt
+			}
+			size = int((t - 12) / 2)
+		}
+		if size > len(body) {
+			return nil, errCorrupt
+		}
+		data := body[:size]
+		body = body[size:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t >= 1 && t <= 6:
+			// Sign-extend big-endian integers of any width
+			v := int64(int8(data[0]))
+			for _, c := range data[1:] {
+				v = v<<8 | int64(c)
+			}
+			values = append(values, v)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t >= 12 && t%2 == 0:
+			values = append(values, append([]byte(nil), data...))
+		case t >= 13:
+			values = append(values, string(data))
+		default:
+			return nil, errCorrupt
+		}
+	}
+	return values, nil
+}
+
+// maxLocal is how much of a table leaf cell's payload stays on its page, the
+// rest spills to overflow pages.
+func maxLocal(usable, payload int) int {
+	x := usable - 35
+	if payload <= x {
+		return payload
+	}
+	m := (usable-12)*32/255 - 23
+	k := m + (payload-m)%(usable-4)
+	if k <= x {
+		return k
+	}
+	return m
+}
+
+// writer lays out pages; page n is pages[n-1].
+type writer struct {
+	pages [][]byte
+}
+
+func (w *writer) alloc() (int, []byte) {
+	page := make([]byte, pageSize)
+	w.pages = append(w.pages, page)
+	return len(w.pages), page
+}
+
+// leafCell builds a table leaf cell, writing the overflow of large payloads.
+func (w *writer) leafCell(id int64, payload []byte) []byte {
+	cell := putVarint(nil, uint64(len(payload)))
+	cell = putVarint(cell, uint64(id))
+	local := maxLocal(pageSize, len(payload))
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell
+	}
+	rest := payload[local:]
+	first, _ := w.alloc()
+	cell = binary.BigEndian.AppendUint32(cell, uint32(first))
+	for n := first; len(rest) > 0; {
+		page := w.pages[n-1]
+		chunk := min(len(rest), pageSize-4)
+		copy(page[4:], rest[:chunk])
+		rest = rest[chunk:]
+		if len(rest) > 0 {
+			next, _ := w.alloc()
+			binary.BigEndian.PutUint32(page, uint32(next))
+			n = next
+		}
+	}
+	return cell
+}
+
+// fill writes a b-tree page at offset (100 on page 1) holding cells.
+func fill(page []byte, offset int, kind byte, cells [][]byte, right int) {
+	headerSize := 8
+	if kind == interiorTablePg {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], uint32(right))
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	end := len(page)
+	ptr := offset + headerSize
+	for _, cell := range cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(page[ptr:], uint16(end))
+		ptr += 2
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(end%65536))
+}
+
+type child struct {
+	page  int
+	maxID int64
+}
+
+// maxChildren is how many children an interior page always has room for:
+// each takes a page number and a rowid varint of at most 9 bytes, plus a
+// cell pointer.
+const maxChildren = (pageSize-12)/(4+9+2) + 1
+
+func (w *writer) cells(rows []row) ([][]byte, error) {
+	var cells [][]byte
+	for _, r := range rows {
+		payload, err := encodeRecord(r.values)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, w.leafCell(r.id, payload))
+	}
+	return cells, nil
+}
+
+// writeTree writes the rows of a table as a b-tree and returns its root page.
+func (w *writer) writeTree(rows []row) (int, error) {
+	cells, err := w.cells(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	// Pack the leaves, then interior levels over them until one page is left
+	var level []child
+	for start := 0; ; {
+		used, end := 8, start
+		for end < len(cells) && used+len(cells[end])+2 <= pageSize {
+			used += len(cells[end]) + 2
+			end++
+		}
+		n, page := w.alloc()
+		fill(page, 0, leafTablePage, cells[start:end], 0)
+		maxID := int64(0)
+		if end > start {
+			maxID = rows[end-1].id
+		}
+		level = append(level, child{n, maxID})
+		if start = end; start >= len(cells) {
+			break
+		}
+	}
+	for len(level) > 1 {
+		// Spread the children evenly so no page is left with a single one
+		groups := (len(level) + maxChildren - 1) / maxChildren
+		var next []child
+		for g := 0; g < groups; g++ {
+			group := level[g*len(level)/groups : (g+1)*len(level)/groups]
+			var data [][]byte
+			for _, c := range group[:len(group)-1] {
+				cell := binary.BigEndian.AppendUint32(nil, uint32(c.page))
+				data = append(data, putVarint(cell, uint64(c.maxID)))
+			}
+			last := group[len(group)-1]
+			n, page := w.alloc()
+			fill(page, 0, interiorTablePg, data, last.page)
+			next = append(next, child{n, last.maxID})
+		}
+		level = next
+	}
+	return level[0].page, nil
+}
+
+// writeDatabase builds a SQLite database holding tables.
+func writeDatabase(tables []table) ([]byte, error) {
+	w := &writer{}
+	w.alloc() // Page 1: header and schema
+	var schema []row
+	for i, t := range tables {
+		root, err := w.writeTree(t.rows)
+		if err != nil {
+			return nil, err
+		}
+		schema = append(schema, row{int64(i + 1), []interface{}{"table", t.name, t.name, int64(root), t.create}})
+	}
+	cells, err := w.cells(schema)
+	if err != nil {
+		return nil, err
+	}
+	used := 100 + 8
+	for _, cell := range cells {
+		used += len(cell) + 2
+	}
+	if used > pageSize {
+		return nil, fmt.Errorf("schema doesn't fit on the first page")
+	}
+	fill(w.pages[0], 100, leafTablePage, cells, 0)
+
+	h := w.pages[0]
+	copy(h, sqliteHeader)
+	binary.BigEndian.PutUint16(h[16:], pageSize)
+	h[18], h[19] = 1, 1 // Rollback journal
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1)                    // Change counter
+	binary.BigEndian.PutUint32(h[28:], uint32(len(w.pages))) // Pages
+	binary.BigEndian.PutUint32(h[40:], 1)                    // Schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4)                    // Schema format
+	binary.BigEndian.PutUint32(h[56:], 1)                    // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1)
+	binary.BigEndian.PutUint32(h[96:], 3045000)
+
+	out := make([]byte, 0, len(w.pages)*pageSize)
+	for _, page := range w.pages {
+		out = append(out, page...)
+	}
+	return out, nil
+}
+
+// database is a SQLite file opened for reading.
+type database struct {
+	data     []byte
+	pageSize int
+	usable   int
+}
+
+func openDatabase(data []byte) (*database, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteHeader {
+		return nil, fmt.Errorf("not a SQLite database")
+	}
+	size := int(binary.BigEndian.Uint16(data[16:]))
+	if size == 1 {
+		size = 65536
+	}
+	if size < 512 || size&(size-1) != 0 {
+		return nil, errCorrupt
+	}
+	if enc := binary.BigEndian.Uint32(data[56:]); enc != 0 && enc != 1 {
+		return nil, fmt.Errorf("only UTF-8 databases are supported")
+	}
+	return &database{data: data, pageSize: size, usable: size - int(data[20])}, nil
+}
+
+func (db *database) page(n int) ([]byte, error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, errCorrupt
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// rows reads every row of the table b-tree rooted at root, in rowid order.
+func (db *database) rows(root int) ([]row, error) {
+	var rows []row
+	visited := map[int]bool{}
+	var walk func(n, depth int) error
+	walk = func(n, depth int) error {
+		if visited[n] || depth > 20 {
+			return errCorrupt
+		}
+		visited[n] = true
+		page, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		offset := 0
+		if n == 1 {
+			offset = 100
+		}
+		kind := page[offset]
+		count := int(binary.BigEndian.Uint16(page[offset+3:]))
+		headerSize := 8
+		if kind == interiorTablePg {
+			headerSize = 12
+		} else if kind != leafTablePage {
+			return fmt.Errorf("page %d is not a table page", n)
+		}
+		if offset+headerSize+2*count > len(page) {
+			return errCorrupt
+		}
+
+		for i := 0; i < count; i++ {
+			ptr := int(binary.BigEndian.Uint16(page[offset+headerSize+2*i:]))
+			if ptr >= len(page) {
+				return errCorrupt
+			}
+			cell := page[ptr:]
+			if kind == interiorTablePg {
+				if len(cell) < 4 {
+					return errCorrupt
+				}
+				if err := walk(int(binary.BigEndian.Uint32(cell)), depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			r, err := db.leafRow(cell)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, r)
+		}
+		if kind == interiorTablePg {
+			return walk(int(binary.BigEndian.Uint32(page[offset+8:])), depth+1)
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+	return rows, nil
+}
+
+func (db *database) leafRow(cell []byte) (row, error) {
+	size, n := varint(cell)
+	if n == 0 || size > uint64(len(db.data)) {
+		return row{}, errCorrupt
+	}
+	id, m := varint(cell[n:])
+	if m == 0 {
+		return row{}, errCorrupt
+	}
+	cell = cell[n+m:]
+	local := maxLocal(db.usable, int(size))
+	if local > len(cell) {
+		return row{}, errCorrupt
+	}
+	payload := append([]byte(nil), cell[:local]...)
+	if local < int(size) {
+		if len(cell) < local+4 {
+			return row{}, errCorrupt
+		}
+		next := int(binary.BigEndian.Uint32(cell[local:]))
+		for pages := 0; len(payload) < int(size); pages++ {
+			page, err := db.page(next)
+			if err != nil || pages > len(db.data)/db.pageSize {
+				return row{}, errCorrupt
+			}
+			chunk := min(int(size)-len(payload), db.usable-4)
+			payload = append(payload, page[4:4+chunk]...)
+			next = int(binary.BigEndian.Uint32(page))
+		}
+	}
+	values, err := decodeRecord(payload)
+	return row{int64(id), values}, err
+}
+
+// tables maps the name of every table to its root page.
+func (db *database) tables() (map[string]int, error) {
+	schema, err := db.rows(1)
+	if err != nil {
+		return nil, err
+	}
+	roots := map[string]int{}
+	for _, r := range schema {
+		if len(r.values) < 4 || r.values[0] != "table" {
+			continue
+		}
+		name, _ := r.values[1].(string)
+		root, _ := r.values[3].(int64)
+		roots[name] = int(root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,84 @@
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	values := []interface{}{
+		nil, int64(0), int64(1), int64(-1), int64(300), int64(-70000), int64(1 << 30),
+		int64(1 << 40), int64(math.MinInt64), math.Pi, "", "text ✓", []byte{0, 1, 2},
+	}
+	record, err := encodeRecord(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("got %#v", got)
+	}
+
+	for _, v := range []uint64{0, 127, 128, 1 << 20, 1<<56 - 1, 1 << 56, math.MaxUint64} {
+		b := putVarint(nil, v)
+		if got, n := varint(b); got != v || n != len(b) {
+			t.Errorf("varint(%d) = %d, %d bytes of %d", v, got, n, len(b))
+		}
+	}
+}
+
+// collection is the SQLite database of a written package.
+func collection(t testing.TB) []byte {
+	data, err := Write(testDeck(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("collection.anki2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// FuzzReadCollection feeds damaged databases to the reader, which has to
+// fail cleanly rather than panic or loop.
+func FuzzReadCollection(f *testing.F) {
+	db := collection(f)
+	f.Add(db)
+	f.Add(db[:100])
+	f.Add(db[:len(db)/2])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := openDatabase(data); err != nil {
+			return
+		}
+		readCollection(data)
+	})
+}
+
+func TestReadDamagedCollection(t *testing.T) {
+	db := collection(t)
+	// Flip every byte of the first pages in turn
+	for i := 0; i < min(len(db), 3*pageSize); i++ {
+		damaged := append([]byte(nil), db...)
+		damaged[i] ^= 0xff
+		readCollection(damaged)
+	}
+	for _, n := range []int{0, 99, 100, pageSize, len(db) - 1} {
+		readCollection(db[:n])
+	}
+}
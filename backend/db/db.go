@@ -20,7 +20,23 @@ func ConnectDB() {
 	}
 	DB = db
 
-	db.AutoMigrate(&models.User{}, &models.Roadmap{}, &models.RoadmapWeek{}, &models.Content{}, &models.FlashcardSet{}, &models.QuizSet{})
+	if err := Migrate(db); err != nil {
+		log.Fatal("Failed to migrate:", err)
+	}
 
 	fmt.Println("✅ Database connected and User table migrated!")
 }
+
+// Migrate creates or updates the tables and moves legacy data into them.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.User{}, &models.Roadmap{}, &models.RoadmapWeek{}, &models.Content{}, &models.FlashcardSet{}, &models.QuizSet{}, &models.QuizAttempt{}, &models.QuizAttemptAnswer{}, &models.Card{}, &models.CardReview{}, &models.RoadmapTopic{}, &models.RoadmapVersion{}, &models.Job{}, &models.JobChunk{}, &models.Document{}, &models.DocumentPage{}, &models.DocumentOutlineEntry{}, &models.DocumentPassage{}, &models.ChatSession{}, &models.ChatMessage{}, &models.Mastery{}, &models.BankQuestion{}, &models.AdaptiveQuiz{}); err != nil {
+		return err
+	}
+	if err := migrateFlashcardCards(db); err != nil {
+		return fmt.Errorf("migrating flashcards: %w", err)
+	}
+	if err := migrateRoadmapTopics(db); err != nil {
+		return fmt.Errorf("migrating roadmap topics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"tutor_genX/models"
+
+	"gorm.io/gorm"
+)
+
+// migrateFlashcardCards moves cards stored as a JSON string on FlashcardSet
+// into the cards table. Sets that already have cards are left alone.
+func migrateFlashcardCards(db *gorm.DB) error {
+	var sets []models.FlashcardSet
+	err := db.Where("flashcards <> '' AND NOT EXISTS (SELECT 1 FROM cards WHERE cards.flashcard_set_id = flashcard_sets.id)").
+		Find(&sets).Error
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		var legacy struct {
+			Flashcards []struct {
+				Front string `json:"front"`
+				Back  string `json:"back"`
+			} `json:"flashcards"`
+		}
+		if err := json.Unmarshal([]byte(set.Flashcards), &legacy); err != nil {
+			log.Printf("Skipping flashcard set %d: %v", set.ID, err)
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, fc := range legacy.Flashcards {
+				card := models.Card{FlashcardSetID: set.ID, Position: i, Front: fc.Front, Back: fc.Back}
+				if err := tx.Create(&card).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&set).Update("flashcards", "").Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRoadmapTopics converts the legacy roadmap_weeks.topics and
+// roadmap_weeks.progress JSON columns into roadmap_topics rows, then drops
+// the old columns. Completed topics get the week's last update as their
+// completion time since the real time was never recorded. A week whose JSON
+// can't be read aborts the migration, leaving the old columns in place.
+func migrateRoadmapTopics(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("roadmap_weeks", "topics") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var weeks []struct {
+			ID        uint
+			Topics    string
+			Progress  string
+			UpdatedAt time.Time
+		}
+		if err := tx.Table("roadmap_weeks").Select("id, COALESCE(topics, '') AS topics, COALESCE(progress, '') AS progress, updated_at").Find(&weeks).Error; err != nil {
+			return err
+		}
+
+		for _, week := range weeks {
+			var titles []string
+			var progress []bool
+			if week.Topics != "" {
+				if err := json.Unmarshal([]byte(week.Topics), &titles); err != nil {
+					// Keep the old columns until the week is fixed by hand
+					return fmt.Errorf("topics of roadmap week %d: %w", week.ID, err)
+				}
+			}
+			if week.Progress != "" {
+				if err := json.Unmarshal([]byte(week.Progress), &progress); err != nil {
+					return fmt.Errorf("progress of roadmap week %d: %w", week.ID, err)
+				}
+			}
+
+			for i, title := range titles {
+				topic := models.RoadmapTopic{WeekID: week.ID, Order: i, Title: title}
+				if i < len(progress) && progress[i] {
+					completedAt := week.UpdatedAt
+					topic.CompletedAt = &completedAt
+				}
+				if err := tx.Create(&topic).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Migrator().DropColumn(&models.RoadmapWeek{}, "topics"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.RoadmapWeek{}, "progress")
+	})
+}
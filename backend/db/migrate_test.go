@@ -0,0 +1,136 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tutor_genX/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB opens an empty SQLite database.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return database
+}
+
+func TestMigrateFlashcardCards(t *testing.T) {
+	database := openTestDB(t)
+	if err := Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	legacy := models.FlashcardSet{UserEmail: "a@example.com", Flashcards: `{"flashcards": [{"front": "Q1", "back": "A1"}, {"front": "Q2", "back": "A2"}]}`}
+	broken := models.FlashcardSet{UserEmail: "a@example.com", Flashcards: `{"flashcards": [`}
+	database.Create(&legacy)
+	database.Create(&broken)
+
+	// Running the migration again is harmless
+	for i := 0; i < 2; i++ {
+		if err := Migrate(database); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cards []models.Card
+	database.Order("position").Find(&cards, "flashcard_set_id = ?", legacy.ID)
+	if len(cards) != 2 || cards[0].Front != "Q1" || cards[1].Back != "A2" || cards[1].Position != 1 {
+		t.Errorf("cards %+v", cards)
+	}
+	database.First(&legacy, legacy.ID)
+	database.First(&broken, broken.ID)
+	if legacy.Flashcards != "" || broken.Flashcards == "" {
+		t.Errorf("legacy JSON left as %q and %q", legacy.Flashcards, broken.Flashcards)
+	}
+}
+
+// legacyRoadmapWeek is a roadmap week before topics got their own table.
+type legacyRoadmapWeek struct {
+	gorm.Model
+	RoadmapID uint
+	Week      int
+	Title     string
+	Topics    string
+	Progress  string
+}
+
+func (legacyRoadmapWeek) TableName() string { return "roadmap_weeks" }
+
+func TestMigrateRoadmapTopics(t *testing.T) {
+	database := openTestDB(t)
+	// The weeks table as it was, with topics and progress as JSON
+	if err := database.AutoMigrate(&legacyRoadmapWeek{}); err != nil {
+		t.Fatal(err)
+	}
+	updated := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	database.Create(&legacyRoadmapWeek{Model: gorm.Model{UpdatedAt: updated}, RoadmapID: 1, Week: 1, Title: "Basics",
+		Topics: `["Syntax","Types","Functions"]`, Progress: `[true,false]`})
+	database.Create(&legacyRoadmapWeek{RoadmapID: 1, Week: 2, Title: "Empty"})
+
+	if err := Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	if database.Migrator().HasColumn("roadmap_weeks", "topics") || database.Migrator().HasColumn("roadmap_weeks", "progress") {
+		t.Error("the legacy columns are still there")
+	}
+	var topics []models.RoadmapTopic
+	database.Order("week_id, sort_order").Find(&topics)
+	if len(topics) != 3 || topics[0].Title != "Syntax" || topics[2].Title != "Functions" || topics[2].Order != 2 {
+		t.Fatalf("topics %+v", topics)
+	}
+	if topics[0].CompletedAt == nil || !topics[0].CompletedAt.Equal(updated) || topics[1].CompletedAt != nil || topics[2].CompletedAt != nil {
+		t.Errorf("progress %v, %v, %v", topics[0].CompletedAt, topics[1].CompletedAt, topics[2].CompletedAt)
+	}
+
+	// Once the columns are gone the migration does nothing
+	if err := Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	database.Model(&models.RoadmapTopic{}).Count(&count)
+	if count != 3 {
+		t.Errorf("%d topics after migrating twice", count)
+	}
+}
+
+func TestMigrateRoadmapTopicsMalformed(t *testing.T) {
+	database := openTestDB(t)
+	if err := database.AutoMigrate(&legacyRoadmapWeek{}); err != nil {
+		t.Fatal(err)
+	}
+	database.Create(&legacyRoadmapWeek{RoadmapID: 1, Week: 1, Title: "Fine", Topics: `["Syntax"]`})
+	database.Create(&legacyRoadmapWeek{RoadmapID: 1, Week: 2, Title: "Broken", Topics: `["Types"`})
+
+	// Nothing is migrated and the old columns stay until the week is fixed
+	if err := Migrate(database); err == nil {
+		t.Fatal("migrated a malformed week")
+	}
+	var count int64
+	database.Model(&models.RoadmapTopic{}).Count(&count)
+	if count != 0 || !database.Migrator().HasColumn("roadmap_weeks", "topics") {
+		t.Errorf("%d topics migrated", count)
+	}
+
+	database.Model(&legacyRoadmapWeek{}).Where("week = ?", 2).Update("topics", `["Types"]`)
+	if err := Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	database.Model(&models.RoadmapTopic{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d topics after fixing the week", count)
+	}
+}
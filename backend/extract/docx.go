@@ -0,0 +1,189 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// headingStyle matches the names Word gives its heading styles.
+var headingStyle = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// extractDOCX reads a Word document. Headings are the paragraphs in heading
+// styles (or with an outline level). The document is split into pages where
+// Word last laid out a page break, or at its top-level headings if it was
+// never laid out.
+func extractDOCX(data []byte) (Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, err
+	}
+	var body, styles []byte
+	for _, f := range archive.File {
+		switch f.Name {
+		case "word/document.xml":
+			body, err = readZipFile(f)
+		case "word/styles.xml":
+			styles, err = readZipFile(f)
+		}
+		if err != nil {
+			return Document{}, err
+		}
+	}
+	if body == nil {
+		return Document{}, errors.New("not a Word document")
+	}
+
+	blocks, paged, err := docxBlocks(body, docxHeadingStyles(styles))
+	if err != nil {
+		return Document{}, err
+	}
+	doc, _ := layout(blocks, !paged)
+	return doc, nil
+}
+
+// docxHeadingStyles maps the IDs of heading styles to their level.
+func docxHeadingStyles(styles []byte) map[string]int {
+	levels := map[string]int{"Title": 1}
+	for i := 1; i <= 9; i++ {
+		levels["Heading"+strconv.Itoa(i)] = i
+	}
+	if styles == nil {
+		return levels
+	}
+	var parsed struct {
+		Styles []struct {
+			ID      string     `xml:"styleId,attr"`
+			Name    docxValue  `xml:"name"`
+			Outline *docxValue `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	if xml.Unmarshal(styles, &parsed) != nil {
+		return levels
+	}
+	for _, style := range parsed.Styles {
+		if m := headingStyle.FindStringSubmatch(style.Name.Val); m != nil {
+			levels[style.ID], _ = strconv.Atoi(m[1])
+		} else if strings.EqualFold(style.Name.Val, "title") {
+			levels[style.ID] = 1
+		} else if style.Outline != nil {
+			if n, err := strconv.Atoi(style.Outline.Val); err == nil && n < 9 {
+				levels[style.ID] = n + 1
+			}
+		}
+	}
+	return levels
+}
+
+type docxValue struct {
+	Val string `xml:"val,attr"`
+}
+
+// docxBlocks reads the paragraphs of a document body. Table rows become
+// paragraphs with their cells separated by " | ". It reports whether the
+// document has page breaks.
+func docxBlocks(body []byte, headingLevels map[string]int) (blocks []block, paged bool, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var text strings.Builder
+	heading, tables, inText := 0, 0, false
+	flush := func() {
+		if s := collapse(text.String()); s != "" {
+			blocks = append(blocks, block{heading: heading, text: s})
+		}
+		text.Reset()
+	}
+	pageBreak := func() {
+		flush()
+		blocks = append(blocks, block{pageBreak: true})
+		paged = true
+	}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				if tables == 0 {
+					flush()
+					heading = 0
+				}
+			case "pStyle":
+				if tables == 0 {
+					heading = headingLevels[xmlAttr(t, "val")]
+				}
+			case "outlineLvl":
+				if n, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && n < 9 && tables == 0 {
+					heading = n + 1
+				}
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString(" ")
+			case "br", "cr":
+				if xmlAttr(t, "type") == "page" && tables == 0 {
+					pageBreak()
+				} else {
+					text.WriteString(" ")
+				}
+			case "lastRenderedPageBreak":
+				if tables == 0 {
+					pageBreak()
+				}
+			case "tbl":
+				if tables == 0 {
+					flush()
+					heading = 0
+				}
+				tables++
+			case "tc":
+				if strings.TrimSpace(text.String()) != "" {
+					text.WriteString(" | ")
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if tables > 0 {
+					text.WriteString(" ")
+				} else {
+					flush()
+					heading = 0
+				}
+			case "tr":
+				if tables == 1 {
+					flush()
+				}
+			case "tbl":
+				tables--
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	flush()
+	return blocks, paged, nil
+}
+
+func xmlAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package extract
+
+import (
+	"fmt"
+	"testing"
+)
+
+// docx is a Word document with body as the content of its <w:body>.
+func docx(t *testing.T, body, styles string) []byte {
+	t.Helper()
+	files := []string{
+		"[Content_Types].xml", "<Types/>",
+		"word/document.xml", `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`,
+	}
+	if styles != "" {
+		files = append(files, "word/styles.xml", `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`+styles+`</w:styles>`)
+	}
+	return zipped(t, files...)
+}
+
+// para is a paragraph in the given style, "" for none.
+func para(style string, runs ...string) string {
+	p := "<w:p>"
+	if style != "" {
+		p += `<w:pPr><w:pStyle w:val="` + style + `"/></w:pPr>`
+	}
+	for _, r := range runs {
+		p += "<w:r><w:t xml:space=\"preserve\">" + r + "</w:t></w:r>"
+	}
+	return p + "</w:p>"
+}
+
+func TestDOCX(t *testing.T) {
+	for name, tt := range map[string]struct {
+		body, styles string
+		want         Document
+	}{
+		"headings": {
+			para("", "Intro ", "text.") + para("Heading1", "One") + para("", "First.") + para("Heading2", "One.a") + para("Title", "Two") + para("", "Last."),
+			"",
+			Document{
+				Pages:   []string{"Intro text.", "One\n\nFirst.\n\nOne.a", "Two\n\nLast."},
+				Outline: []Heading{{1, "One", 2}, {2, "One.a", 2}, {1, "Two", 3}},
+			},
+		},
+		"custom styles": {
+			para("Kop1", "Een") + para("Chapter", "Twee") + para("Plain", "Tekst.") +
+				`<w:p><w:pPr><w:outlineLvl w:val="1"/></w:pPr><w:r><w:t>Drie</w:t></w:r></w:p>`,
+			`<w:style w:styleId="Kop1"><w:name w:val="heading 1"/></w:style>` +
+				`<w:style w:styleId="Chapter"><w:name w:val="Chapter"/><w:pPr><w:outlineLvl w:val="0"/></w:pPr></w:style>` +
+				`<w:style w:styleId="Plain"><w:name w:val="Normal"/></w:style>`,
+			Document{
+				Pages:   []string{"Een", "Twee\n\nTekst.\n\nDrie"},
+				Outline: []Heading{{1, "Een", 1}, {1, "Twee", 2}, {2, "Drie", 2}},
+			},
+		},
+		"page breaks": {
+			para("Heading1", "One") + para("", "First.") +
+				`<w:p><w:r><w:t>Split</w:t><w:tab/><w:t>here</w:t><w:br w:type="page"/><w:t>over.</w:t></w:r></w:p>` +
+				`<w:p><w:r><w:lastRenderedPageBreak/><w:t>Line</w:t><w:br/><w:t>break.</w:t></w:r></w:p>` + para("Heading1", "Two"),
+			"",
+			Document{
+				Pages:   []string{"One\n\nFirst.\n\nSplit here", "over.", "Line break.\n\nTwo"},
+				Outline: []Heading{{1, "One", 1}, {1, "Two", 3}},
+			},
+		},
+		"tables": {
+			para("", "Before.") + `<w:tbl><w:tr><w:tc>` + para("Heading1", "a") + `</w:tc><w:tc>` + para("", "b") + para("", "c") + `</w:tc></w:tr>` +
+				`<w:tr><w:tc>` + para("", "1") + `</w:tc><w:tc>` + para("", "2") + `</w:tc></w:tr></w:tbl>` + para("", "After."),
+			"",
+			Document{Pages: []string{"Before.\n\na | b c\n\n1 | 2\n\nAfter."}},
+		},
+	} {
+		doc, err := extractDOCX(docx(t, tt.body, tt.styles))
+		if err != nil || fmt.Sprintf("%q", doc) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%s:\n got %q, %v\nwant %q", name, doc, err, tt.want)
+		}
+	}
+
+	if _, err := extractDOCX(zipped(t, "word/other.xml", "")); err == nil {
+		t.Error("a zip without a document")
+	}
+	if _, err := extractDOCX(docx(t, "<w:p>", "")); err == nil {
+		t.Error("a broken document")
+	}
+}
@@ -0,0 +1,196 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		Path string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		TOC   string `xml:"toc,attr"`
+		Items []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type ncxPoint struct {
+	Label  string     `xml:"navLabel>text"`
+	Src    string     `xml:"content>src,attr"`
+	Points []ncxPoint `xml:"navPoint"`
+}
+
+// extractEPUB reads an EPUB book, one page per chapter of its reading order.
+// The outline is the book's table of contents (the EPUB 3 navigation document
+// or the EPUB 2 NCX), or the chapters' headings when it has neither.
+func extractEPUB(data []byte) (Document, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	read := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, errors.New("EPUB is missing " + name)
+		}
+		return readZipFile(f)
+	}
+
+	content, err := read("META-INF/container.xml")
+	if err != nil {
+		return Document{}, err
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(content, &container); err != nil || len(container.Rootfiles) == 0 {
+		return Document{}, errors.New("EPUB has no package document")
+	}
+	opfPath := container.Rootfiles[0].Path
+	if content, err = read(opfPath); err != nil {
+		return Document{}, err
+	}
+	var pkg epubPackage
+	if err := xml.Unmarshal(content, &pkg); err != nil {
+		return Document{}, err
+	}
+
+	// Manifest hrefs are relative to the package document
+	base := path.Dir(opfPath)
+	resolve := func(dir, href string) string {
+		href, _, _ = strings.Cut(href, "#")
+		return path.Join(dir, unescapeHref(href))
+	}
+	hrefs := map[string]string{}
+	var navPath, ncxPath string
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = resolve(base, item.Href)
+		if strings.Contains(" "+item.Properties+" ", " nav ") {
+			navPath = hrefs[item.ID]
+		}
+		if item.ID == pkg.Spine.TOC || item.MediaType == "application/x-dtbncx+xml" && ncxPath == "" {
+			ncxPath = hrefs[item.ID]
+		}
+	}
+
+	var blocks []block
+	for _, item := range pkg.Spine.Items {
+		chapter, ok := hrefs[item.IDRef]
+		if !ok {
+			continue
+		}
+		content, err := read(chapter)
+		if err != nil {
+			return Document{}, err
+		}
+		chapterBlocks, err := htmlBlocks(content)
+		if err != nil {
+			return Document{}, err
+		}
+		blocks = append(blocks, block{pageBreak: true, anchor: chapter})
+		blocks = append(blocks, chapterBlocks...)
+	}
+	doc, anchors := layout(blocks, false)
+
+	var toc []Heading
+	if content, err := read(navPath); navPath != "" && err == nil {
+		toc = navHeadings(content, path.Dir(navPath), anchors, resolve)
+	}
+	if content, err := read(ncxPath); len(toc) == 0 && ncxPath != "" && err == nil {
+		var ncx struct {
+			Points []ncxPoint `xml:"navMap>navPoint"`
+		}
+		if xml.Unmarshal(content, &ncx) == nil {
+			var walk func(points []ncxPoint, level int)
+			walk = func(points []ncxPoint, level int) {
+				for _, p := range points {
+					toc = append(toc, Heading{Level: level, Title: collapse(p.Label), Page: anchors[resolve(path.Dir(ncxPath), p.Src)]})
+					walk(p.Points, level+1)
+				}
+			}
+			walk(ncx.Points, 1)
+		}
+	}
+	if len(toc) > 0 {
+		doc.Outline = toc
+	}
+	return doc, nil
+}
+
+// navHeadings reads the table of contents of an EPUB 3 navigation document:
+// the nested lists of links in its <nav epub:type="toc">.
+func navHeadings(content []byte, dir string, anchors map[string]int, resolve func(dir, href string) string) []Heading {
+	root, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	var toc []Heading
+	var walk func(n *html.Node, level int, inTOC bool)
+	walk = func(n *html.Node, level int, inTOC bool) {
+		if n.DataAtom == atom.Nav {
+			for _, attr := range n.Attr {
+				if attr.Key == "epub:type" || attr.Key == "type" || attr.Key == "role" {
+					inTOC = strings.Contains(attr.Val, "toc")
+				}
+			}
+		}
+		if inTOC && n.DataAtom == atom.Ol {
+			level++
+		}
+		if inTOC && n.DataAtom == atom.A {
+			for _, attr := range n.Attr {
+				if attr.Key == "href" {
+					toc = append(toc, Heading{Level: level, Title: collapse(nodeText(n)), Page: anchors[resolve(dir, attr.Val)]})
+				}
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, level, inTOC)
+		}
+	}
+	walk(root, 0, false)
+	return toc
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+		sb.WriteString(" ")
+	}
+	return sb.String()
+}
+
+// unescapeHref undoes the percent-encoding of a relative link.
+func unescapeHref(href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		return unescaped
+	}
+	return href
+}
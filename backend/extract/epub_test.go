@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"fmt"
+	"testing"
+)
+
+const container = `<?xml version="1.0"?><container xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`
+
+// chapter is an XHTML chapter with body as its <body>.
+func chapter(body string) string {
+	return `<?xml version="1.0" encoding="utf-8"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>x</title></head><body>` + body + `</body></html>`
+}
+
+// epub is a book of the two chapters text/one.xhtml and "text/chapter two.xhtml",
+// plus the extra files.
+func epub(t *testing.T, manifest, spineTOC string, extra ...string) []byte {
+	t.Helper()
+	opf := `<?xml version="1.0"?><package xmlns="http://www.idpf.org/2007/opf" version="3.0"><manifest>
+<item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+<item id="two" href="text/chapter%20two.xhtml" media-type="application/xhtml+xml"/>` + manifest + `</manifest>
+<spine` + spineTOC + `><itemref idref="one"/><itemref idref="missing"/><itemref idref="two"/></spine></package>`
+	files := append([]string{
+		"mimetype", EPUB,
+		"META-INF/container.xml", container,
+		"OEBPS/content.opf", opf,
+		"OEBPS/text/one.xhtml", chapter(`<h1>Cells</h1><p>Cells are small.</p><h2 id="parts">Parts</h2><p>They have parts.</p>`),
+		"OEBPS/text/chapter two.xhtml", chapter(`<h1>Energy</h1><p>ATP is energy.</p>`),
+	}, extra...)
+	return zipped(t, files...)
+}
+
+func TestEPUB(t *testing.T) {
+	pages := []string{"Cells\n\nCells are small.\n\nParts\n\nThey have parts.", "Energy\n\nATP is energy."}
+	for name, tt := range map[string]struct {
+		data    []byte
+		outline []Heading
+	}{
+		"navigation document": {
+			epub(t, `<item id="nav" href="nav.xhtml" properties="nav" media-type="application/xhtml+xml"/>`, "",
+				"OEBPS/nav.xhtml", chapter(`<nav epub:type="landmarks"><ol><li><a href="text/one.xhtml">Start</a></li></ol></nav>
+<nav epub:type="toc"><ol><li><a href="text/one.xhtml">1. <em>Cells</em></a><ol><li><a href="text/one.xhtml#parts">Parts</a></li></ol></li>
+<li><a href="text/chapter%20two.xhtml">2. Energy</a></li></ol></nav>`)),
+			[]Heading{{1, "1. Cells", 1}, {2, "Parts", 1}, {1, "2. Energy", 2}},
+		},
+		"NCX": {
+			epub(t, `<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`, ` toc="ncx"`,
+				"OEBPS/toc.ncx", `<ncx><navMap><navPoint><navLabel><text>Cells</text></navLabel><content src="text/one.xhtml"/>
+<navPoint><navLabel><text>Parts</text></navLabel><content src="text/one.xhtml#parts"/></navPoint></navPoint>
+<navPoint><navLabel><text>Energy</text></navLabel><content src="text/chapter%20two.xhtml"/></navPoint></navMap></ncx>`),
+			[]Heading{{1, "Cells", 1}, {2, "Parts", 1}, {1, "Energy", 2}},
+		},
+		"no table of contents": {
+			epub(t, "", ""),
+			[]Heading{{1, "Cells", 1}, {2, "Parts", 1}, {1, "Energy", 2}},
+		},
+	} {
+		doc, err := extractEPUB(tt.data)
+		want := Document{Pages: pages, Outline: tt.outline}
+		if err != nil || fmt.Sprintf("%q", doc) != fmt.Sprintf("%q", want) {
+			t.Errorf("%s:\n got %q, %v\nwant %q", name, doc, err, want)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"no container":     zipped(t, "mimetype", EPUB),
+		"no package":       zipped(t, "mimetype", EPUB, "META-INF/container.xml", "<container/>"),
+		"missing chapter":  zipped(t, "mimetype", EPUB, "META-INF/container.xml", container, "OEBPS/content.opf", `<package><manifest><item id="a" href="a.xhtml"/></manifest><spine><itemref idref="a"/></spine></package>`),
+		"not a zip at all": []byte("PK"),
+	} {
+		if _, err := extractEPUB(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package extract turns uploaded files into text. Each supported format has
+// an Extractor, picked by the MIME type sniffed from the file's content, and
+// all of them produce the same Document: text split into pages, paragraphs
+// separated by blank lines and headings on lines of their own, plus an outline.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Supported MIME types.
+const (
+	PDF      = "application/pdf"
+	EPUB     = "application/epub+zip"
+	DOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	Markdown = "text/markdown"
+	HTML     = "text/html"
+	Text     = "text/plain"
+)
+
+// ErrUnsupported is returned for files of a type no extractor handles.
+var ErrUnsupported = errors.New("unsupported file type")
+
+// Document is the text of a file. Formats without pages are split into
+// sections at their top-level headings instead (EPUBs into chapters), which
+// stand in for pages.
+type Document struct {
+	Pages   []string
+	Outline []Heading
+}
+
+// Heading is an entry of a document's outline, in reading order.
+type Heading struct {
+	Level int // 1 for top-level entries
+	Title string
+	Page  int // 1-based, 0 when unknown
+}
+
+// An Extractor reads the text of a file of one type.
+type Extractor func(data []byte) (Document, error)
+
+var extractors = map[string]Extractor{
+	PDF:      extractPDF,
+	EPUB:     extractEPUB,
+	DOCX:     extractDOCX,
+	Markdown: extractMarkdown,
+	HTML:     extractHTML,
+	Text:     extractText,
+}
+
+// Register makes Extract use e for files of mimeType.
+func Register(mimeType string, e Extractor) {
+	extractors[mimeType] = e
+}
+
+// Extract sniffs the type of a file and reads its text.
+func Extract(data []byte, filename string) (Document, string, error) {
+	mimeType := Sniff(data, filename)
+	extractor, ok := extractors[mimeType]
+	if !ok {
+		return Document{}, mimeType, fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+	}
+	doc, err := extractor(data)
+	return doc, mimeType, err
+}
+
+// Sniff tells the MIME type of a file from its content. The file name is only
+// used to tell Markdown and HTML from plain text.
+func Sniff(data []byte, filename string) string {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return PDF
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return sniffZip(data)
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch {
+	case detected == HTML:
+		return HTML
+	case detected == "text/xml" && (ext == ".html" || ext == ".htm" || ext == ".xhtml"):
+		return HTML
+	case detected != Text:
+		return detected
+	case ext == ".md" || ext == ".markdown" || ext == ".mdown" || ext == ".mkd":
+		return Markdown
+	case ext == ".html" || ext == ".htm" || ext == ".xhtml":
+		return HTML
+	}
+	return Text
+}
+
+// sniffZip tells EPUBs and Word documents from other zip files.
+func sniffZip(data []byte) string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "application/zip"
+	}
+	for _, f := range archive.File {
+		switch f.Name {
+		case "mimetype":
+			if content, err := readZipFile(f); err == nil && strings.TrimSpace(string(content)) == EPUB {
+				return EPUB
+			}
+		case "word/document.xml":
+			return DOCX
+		}
+	}
+	return "application/zip"
+}
+
+// Extension is the usual file extension for mimeType.
+func Extension(mimeType string) string {
+	switch mimeType {
+	case PDF:
+		return ".pdf"
+	case EPUB:
+		return ".epub"
+	case DOCX:
+		return ".docx"
+	case Markdown:
+		return ".md"
+	case HTML:
+		return ".html"
+	}
+	return ".txt"
+}
+
+// maxZipFile guards against zip bombs.
+const maxZipFile = 64 << 20
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxZipFile+1))
+	if err == nil && len(data) > maxZipFile {
+		err = fmt.Errorf("%s is too large", f.Name)
+	}
+	return data, err
+}
+
+// block is a paragraph, a heading or a page break of a document being read.
+type block struct {
+	heading   int // Heading level, 0 for a paragraph
+	text      string
+	pageBreak bool
+	anchor    string // Names the page a break starts, for links into it
+}
+
+// layout puts blocks into pages. When split is set the document has no pages
+// of its own and a new one starts at each top-level heading. It returns the
+// page each anchor starts.
+func layout(blocks []block, split bool) (Document, map[string]int) {
+	top := 0
+	for _, b := range blocks {
+		if b.heading > 0 && (top == 0 || b.heading < top) {
+			top = b.heading
+		}
+	}
+
+	var doc Document
+	anchors := map[string]int{}
+	var page []string
+	newPage := func() {
+		if len(page) > 0 {
+			doc.Pages = append(doc.Pages, strings.Join(page, "\n\n"))
+			page = nil
+		}
+	}
+	for _, b := range blocks {
+		text := strings.TrimSpace(b.text)
+		switch {
+		case b.pageBreak:
+			newPage()
+			if b.anchor != "" {
+				anchors[b.anchor] = len(doc.Pages) + 1
+			}
+			continue
+		case text == "":
+			continue
+		case b.heading > 0:
+			if split && b.heading == top {
+				newPage()
+			}
+			doc.Outline = append(doc.Outline, Heading{Level: b.heading - top + 1, Title: text, Page: len(doc.Pages) + 1})
+		}
+		page = append(page, text)
+	}
+	newPage()
+	return doc, anchors
+}
+
+// collapse joins the words of s with single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
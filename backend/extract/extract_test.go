@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// zipped packs name, content pairs into a zip file, in order.
+func zipped(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		f, err := w.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[i+1]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"notes.txt", []byte("%PDF-1.4 whatever"), PDF},
+		{"book.zip", zipped(t, "mimetype", EPUB, "META-INF/container.xml", "<container/>"), EPUB},
+		{"report", zipped(t, "[Content_Types].xml", "<Types/>", "word/document.xml", "<document/>"), DOCX},
+		{"photos.zip", zipped(t, "a.jpg", "jpeg"), "application/zip"},
+		{"page.txt", []byte("<!DOCTYPE html><p>Hi</p>"), HTML},
+		{"page.xhtml", []byte(`<?xml version="1.0"?><html><p>Hi</p></html>`), HTML},
+		{"page.htm", []byte("Hi"), HTML},
+		{"README.md", []byte("# Plants"), Markdown},
+		{"notes.MARKDOWN", []byte("# Plants"), Markdown},
+		{"notes", []byte("# Plants"), Text},
+		{"picture.md", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+	} {
+		if got := Sniff(tt.data, tt.name); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	doc, mimeType, err := Extract([]byte("Leaves are green.\n\nRoots are not."), "plants.txt")
+	if err != nil || mimeType != Text || len(doc.Pages) != 1 || doc.Pages[0] != "Leaves are green.\n\nRoots are not." {
+		t.Errorf("got %+v, %q, %v", doc, mimeType, err)
+	}
+	if _, mimeType, err := Extract(zipped(t, "a.jpg", "jpeg"), "photos.zip"); !errors.Is(err, ErrUnsupported) || mimeType != "application/zip" {
+		t.Errorf("zip: %q, %v", mimeType, err)
+	}
+	if Extension(DOCX) != ".docx" || Extension("image/png") != ".txt" {
+		t.Error("Extension")
+	}
+}
+
+func TestText(t *testing.T) {
+	for name, tt := range map[string]struct {
+		data  string
+		pages []string
+	}{
+		"paragraphs":   {"  One.\r\n\r\n\n\nTwo\nlines.  \n", []string{"One.\n\nTwo\nlines."}},
+		"form feeds":   {"Page one.\f\fPage two.\f", []string{"Page one.", "Page two."}},
+		"byte order":   {"\xef\xbb\xbfHi.", []string{"Hi."}},
+		"utf-16":       {"\xff\xfeH\x00i\x00", []string{"Hi"}},
+		"utf-16 big":   {"\xfe\xff\x00H\x00i", []string{"Hi"}},
+		"invalid utf8": {"Caf\xe9", []string{"Caf�"}},
+		"blank":        {" \n\f\n", nil},
+	} {
+		doc, _ := extractText([]byte(tt.data))
+		if fmt.Sprintf("%q", doc.Pages) != fmt.Sprintf("%q", tt.pages) {
+			t.Errorf("%s: got %q, want %q", name, doc.Pages, tt.pages)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	blocks := []block{
+		{text: "Before the first heading."},
+		{heading: 2, text: "One"},
+		{text: "  "},
+		{heading: 3, text: "One point one"},
+		{text: "Text."},
+		{heading: 2, text: "Two"},
+		{pageBreak: true, anchor: "end"},
+		{text: "The end."},
+	}
+	doc, anchors := layout(blocks, true)
+	want := Document{
+		Pages:   []string{"Before the first heading.", "One\n\nOne point one\n\nText.", "Two", "The end."},
+		Outline: []Heading{{1, "One", 2}, {2, "One point one", 2}, {1, "Two", 3}},
+	}
+	if fmt.Sprintf("%q", doc) != fmt.Sprintf("%q", want) || anchors["end"] != 4 {
+		t.Errorf("got %q, anchors %v", doc, anchors)
+	}
+
+	// Without split, headings stay on the page they are on
+	doc, _ = layout(blocks, false)
+	if len(doc.Pages) != 2 || doc.Outline[2].Page != 1 {
+		t.Errorf("unsplit %q", doc)
+	}
+}
@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// extractHTML reads a web page, split into sections at its top-level headings.
+func extractHTML(data []byte) (Document, error) {
+	blocks, err := htmlBlocks(data)
+	if err != nil {
+		return Document{}, err
+	}
+	doc, _ := layout(blocks, true)
+	return doc, nil
+}
+
+// skipped elements have no text worth studying.
+var skipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Math: true, atom.Nav: true, atom.Button: true, atom.Select: true, atom.Iframe: true,
+}
+
+// blockElements start a paragraph of their own.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true, atom.Aside: true,
+	atom.Header: true, atom.Footer: true, atom.Blockquote: true, atom.Li: true, atom.Dt: true, atom.Dd: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Caption: true, atom.Table: true, atom.Tr: true,
+	atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Hr: true, atom.Br: true, atom.Address: true,
+}
+
+var headingLevels = map[atom.Atom]int{atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6}
+
+// htmlBlocks reads the paragraphs and headings of an HTML or XHTML page.
+// Table rows become paragraphs with their cells separated by " | ".
+func htmlBlocks(data []byte) ([]block, error) {
+	root, err := html.Parse(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []block
+	var text strings.Builder
+	heading := 0
+	flush := func() {
+		if s := collapse(text.String()); s != "" {
+			blocks = append(blocks, block{heading: heading, text: s})
+		}
+		text.Reset()
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if skipped[n.DataAtom] {
+				return
+			}
+		}
+
+		level, isHeading := headingLevels[n.DataAtom]
+		switch {
+		case isHeading:
+			flush()
+			heading = level
+		case n.DataAtom == atom.Pre:
+			flush()
+			var code strings.Builder
+			preText(n, &code)
+			if s := strings.Trim(code.String(), "\n"); strings.TrimSpace(s) != "" {
+				blocks = append(blocks, block{text: s})
+			}
+			return
+		case blockElements[n.DataAtom]:
+			flush()
+			if n.DataAtom == atom.Li {
+				text.WriteString("- ")
+			}
+		case n.DataAtom == atom.Td || n.DataAtom == atom.Th:
+			if strings.TrimSpace(text.String()) != "" {
+				text.WriteString(" | ")
+			}
+		case n.DataAtom == atom.Img:
+			for _, attr := range n.Attr {
+				if attr.Key == "alt" && strings.TrimSpace(attr.Val) != "" {
+					text.WriteString(" " + attr.Val + " ")
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if isHeading || blockElements[n.DataAtom] {
+			flush()
+			heading = 0
+		}
+	}
+	walk(root)
+	flush()
+	return blocks, nil
+}
+
+// preText collects preformatted text as it is, line breaks included.
+func preText(n *html.Node, sb *strings.Builder) {
+	if n.Type == html.TextNode {
+		sb.WriteString(n.Data)
+	}
+	if n.DataAtom == atom.Br {
+		sb.WriteString("\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		preText(c, sb)
+	}
+}
@@ -0,0 +1,44 @@
+package extract
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	for name, tt := range map[string]struct {
+		html string
+		want Document
+	}{
+		"headings": {
+			`<html><head><title>Skip</title><style>p{}</style></head><body>
+<nav><a href="/">Home</a></nav>
+<p>Intro <b>text</b>.</p>
+<h2>One</h2><p>First<br>line.</p><h3>One.a</h3><div>More <span>here</span></div>
+<h2>Two</h2><script>alert(1)</script><p>Last.</p></body></html>`,
+			Document{
+				Pages:   []string{"Intro text.", "One\n\nFirst\n\nline.\n\nOne.a\n\nMore here", "Two\n\nLast."},
+				Outline: []Heading{{1, "One", 2}, {2, "One.a", 2}, {1, "Two", 3}},
+			},
+		},
+		"lists and tables": {
+			`<ul><li>one</li><li>two <em>words</em></li></ul>
+<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td></td><td>3</td></tr></table>
+<p><img src="leaf.png" alt="A leaf"> is green</p>`,
+			Document{Pages: []string{"- one\n\n- two words\n\na | b\n\n1 | | 3\n\nA leaf is green"}},
+		},
+		"preformatted": {
+			"<p>Run:</p><pre>\nfunc main() {\n  x := 1<br>}\n</pre>",
+			Document{Pages: []string{"Run:\n\nfunc main() {\n  x := 1\n}"}},
+		},
+		"entities": {
+			"\xef\xbb\xbf<p>Salt &amp; pepper&nbsp;&lt;3</p>",
+			Document{Pages: []string{"Salt & pepper <3"}},
+		},
+	} {
+		doc, err := extractHTML([]byte(tt.html))
+		if err != nil || fmt.Sprintf("%q", doc) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", name, doc, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	atxHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextLine    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	thematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fence         = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	listItem      = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+	tableRule     = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdImage       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\](?:\([^)]*\)|\[[^\]]*\])`)
+	mdEmphasis    = regexp.MustCompile(`(\*\*|__|\*|~~)([^*_~\s](?:.*?[^*_~\s])?)(\*\*|__|\*|~~)`)
+	mdCode        = regexp.MustCompile("```(.+?)```|``(.+?)``|`([^`]+)`") // Closed by as many backticks as it opens with
+	mdCodeMark    = regexp.MustCompile("\x00(\\d+)\x00")
+	mdTag         = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	linkReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s`)
+)
+
+// extractMarkdown reads a Markdown file, split into sections at its
+// top-level headings. Formatting is dropped, leaving the text of links and
+// the alt text of images; code blocks are kept as they are.
+func extractMarkdown(data []byte) (Document, error) {
+	text := strings.ReplaceAll(decodeText(data), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	// Front matter
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if t := strings.TrimSpace(lines[i]); t == "---" || t == "..." {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	var blocks []block
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, block{text: markdownInline(strings.Join(paragraph, " "))})
+			paragraph = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if m := fence.FindStringSubmatch(line); m != nil {
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, block{text: strings.Join(code, "\n")})
+			continue
+		}
+		switch {
+		case trimmed == "":
+			flush()
+		case atxHeading.MatchString(line):
+			flush()
+			m := atxHeading.FindStringSubmatch(line)
+			blocks = append(blocks, block{heading: len(m[1]), text: markdownInline(m[2])})
+		case setextLine.MatchString(line) && len(paragraph) > 0:
+			level := 1
+			if strings.Contains(trimmed, "-") {
+				level = 2
+			}
+			blocks = append(blocks, block{heading: level, text: markdownInline(strings.Join(paragraph, " "))})
+			paragraph = nil
+		case thematicBreak.MatchString(line):
+			flush()
+		case tableRule.MatchString(line) && strings.Contains(line, "|"), linkReference.MatchString(line):
+			continue
+		case strings.HasPrefix(trimmed, ">"):
+			paragraph = append(paragraph, strings.TrimSpace(strings.TrimLeft(trimmed, "> ")))
+		case listItem.MatchString(line):
+			flush()
+			paragraph = append(paragraph, "- "+listItem.ReplaceAllString(line, ""))
+		case strings.HasPrefix(trimmed, "|"):
+			// Each table row on its own
+			flush()
+			paragraph = append(paragraph, strings.Trim(trimmed, "| "))
+			flush()
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+
+	doc, _ := layout(blocks, true)
+	return doc, nil
+}
+
+// markdownInline strips inline formatting from Markdown text. Code spans are
+// kept as they are, so they're swapped for placeholders while the rest is
+// stripped.
+func markdownInline(s string) string {
+	var code []string
+	s = mdCode.ReplaceAllStringFunc(s, func(m string) string {
+		parts := mdCode.FindStringSubmatch(m)
+		code = append(code, parts[1]+parts[2]+parts[3])
+		return fmt.Sprintf("\x00%d\x00", len(code)-1)
+	})
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdTag.ReplaceAllString(s, "")
+	for {
+		stripped := mdEmphasis.ReplaceAllStringFunc(s, func(m string) string {
+			parts := mdEmphasis.FindStringSubmatch(m)
+			if parts[1] != parts[3] {
+				return m
+			}
+			return parts[2]
+		})
+		if stripped == s {
+			break
+		}
+		s = stripped
+	}
+	s = mdCodeMark.ReplaceAllStringFunc(s, func(m string) string {
+		i, _ := strconv.Atoi(mdCodeMark.FindStringSubmatch(m)[1])
+		return code[i]
+	})
+	return collapse(s)
+}
@@ -0,0 +1,62 @@
+package extract
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMarkdownInline(t *testing.T) {
+	for s, want := range map[string]string{
+		"**Bold** and *italic* and __strong__ ~~gone~~": "Bold and italic and strong gone",
+		"***both*** and **~~struck~~**":                 "both and struck",
+		"a * b * c":                                     "a * b * c",
+		"**unclosed":                                    "**unclosed",
+		"[Link](https://example.com) and [ref][1]":      "Link and ref",
+		"![A leaf](leaf.png) is green":                  "A leaf is green",
+		"Use <kbd>Ctrl</kbd> and <br/> then":            "Use Ctrl and then",
+		"Call `run` now":                                "Call run now",
+		"Run `a *b* c` or `<div>` and ``x `y` z``":      "Run a *b* c or <div> and x `y` z",
+		"**Use `[x](y)`** and *`__init__`*":             "Use [x](y) and __init__",
+		"  spaced \t out ":                              "spaced out",
+	} {
+		if got := markdownInline(s); got != want {
+			t.Errorf("%q: got %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	for name, tt := range map[string]struct {
+		markdown string
+		want     Document
+	}{
+		"headings": {
+			"Intro *text*.\n\n# One #\nFirst\nparagraph.\n\n## One.a\n\nMore.\n\nTwo\n===\n\nLast.",
+			Document{
+				Pages:   []string{"Intro text.", "One\n\nFirst paragraph.\n\nOne.a\n\nMore.", "Two\n\nLast."},
+				Outline: []Heading{{1, "One", 2}, {2, "One.a", 2}, {1, "Two", 3}},
+			},
+		},
+		"front matter": {
+			"---\ntitle: Plants\n---\n## Leaves\nGreen.",
+			Document{Pages: []string{"Leaves\n\nGreen."}, Outline: []Heading{{1, "Leaves", 1}}},
+		},
+		"code blocks": {
+			"Run it:\n\n```go\nfunc main() {\n\t**x** = 1\n}\n```\n\n~~~\n# not a heading\n~~~",
+			Document{Pages: []string{"Run it:\n\nfunc main() {\n\t**x** = 1\n}\n\n# not a heading"}},
+		},
+		"lists, quotes and tables": {
+			"- one\n- two\n  continued\n1. three\n\n> quoted\n> text\n\n| a | b |\n|---|:-:|\n| 1 | 2 |\n\n***\n[1]: https://example.com\nend",
+			Document{Pages: []string{"- one\n\n- two continued\n\n- three\n\nquoted text\n\na | b\n\n1 | 2\n\nend"}},
+		},
+		"setext under a paragraph only": {
+			"Title\n-----\n\n---\n\nText",
+			Document{Pages: []string{"Title\n\nText"}, Outline: []Heading{{1, "Title", 1}}},
+		},
+	} {
+		doc, err := extractMarkdown([]byte(tt.markdown))
+		if err != nil || fmt.Sprintf("%q", doc) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", name, doc, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF reads a PDF page by page, rebuilding the layout of each page
+// from the glyph positions. The outline is the PDF's bookmarks, or the
+// headings found in the text when it has none.
+func extractPDF(data []byte) (Document, error) {
+	pages, outline, err := extractPages(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, err
+	}
+	texts, headings := pdfText(pages)
+	if len(outline) == 0 {
+		outline = headings
+	}
+	return Document{Pages: texts, Outline: outline}, nil
+}
+
+// maxOutlineEntries guards against outlines whose Next links loop.
+const maxOutlineEntries = 5000
+
+// Extract the glyphs of each page of a PDF, laid out, along with its outline
+func extractPages(f io.ReaderAt, size int64) (pages []pdfPage, outline []Heading, err error) {
+	// The PDF library panics on some malformed files
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("malformed PDF: %v", rec)
+		}
+	}()
+
+	r, err := pdf.NewReader(f, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	totalPage := r.NumPage()
+	pageNumbers := make(map[string]int) // Page dictionary -> page number, to resolve bookmarks
+	for pageIndex := 1; pageIndex <= totalPage; pageIndex++ {
+		p := r.Page(pageIndex)
+		if p.V.IsNull() {
+			pages = append(pages, pdfPage{})
+			continue
+		}
+		pageNumbers[p.V.String()] = pageIndex
+
+		// The library ends each TJ with a newline put through the font's
+		// encoding, which some fonts (TeX's) turn into a real character
+		newlines := map[string]string{}
+		for _, name := range p.Fonts() {
+			if f := p.Font(name); f.Encoder() != nil {
+				base := f.BaseFont()
+				newlines[base[strings.Index(base, "+")+1:]] = f.Encoder().Decode("\n")
+			}
+		}
+		var glyphs []glyph
+		var prev pdf.Text
+		for _, t := range p.Content().Text {
+			if t.S == newlines[t.Font] {
+				continue
+			}
+			// A ligature decodes to more letters than it has glyphs: the library
+			// shifts the letters along and puts the last one, with no width,
+			// where the string ends. It belongs with the glyph before.
+			if t.W == 0 && prev.W > 0 && t.Y == prev.Y && math.Abs(t.X-(prev.X+prev.W)) < 0.01 && len(glyphs) > 0 {
+				glyphs[len(glyphs)-1].text += ligatures.Replace(t.S)
+				continue
+			}
+			prev = t
+			if g, ok := newGlyph(t.S, t.X, t.Y, t.W, t.FontSize, t.Font); ok {
+				glyphs = append(glyphs, g)
+			}
+		}
+		pages = append(pages, layoutPage(glyphs))
+	}
+
+	named := namedDestinations(r)
+	var walk func(first pdf.Value, level int)
+	walk = func(first pdf.Value, level int) {
+		for item := first; item.Kind() == pdf.Dict && len(outline) < maxOutlineEntries; item = item.Key("Next") {
+			dest := item.Key("Dest")
+			if dest.IsNull() {
+				dest = item.Key("A").Key("D")
+			}
+			if dest.Kind() == pdf.Name || dest.Kind() == pdf.String {
+				dest = named[destName(dest)]
+			}
+			if dest.Kind() == pdf.Dict {
+				dest = dest.Key("D")
+			}
+			page := 0
+			if dest.Kind() == pdf.Array && dest.Len() > 0 {
+				page = pageNumbers[dest.Index(0).String()]
+			}
+			outline = append(outline, Heading{
+				Level: level,
+				Title: strings.TrimSpace(item.Key("Title").Text()),
+				Page:  page,
+			})
+			walk(item.Key("First"), level+1)
+		}
+	}
+	walk(r.Trailer().Key("Root").Key("Outlines").Key("First"), 1)
+
+	return pages, outline, nil
+}
+
+func destName(v pdf.Value) string {
+	if v.Kind() == pdf.Name {
+		return v.Name()
+	}
+	return v.RawString()
+}
+
+// namedDestinations collects the named destinations bookmarks can point to,
+// from both the old /Dests dictionary and the /Names name tree.
+func namedDestinations(r *pdf.Reader) map[string]pdf.Value {
+	root := r.Trailer().Key("Root")
+	named := make(map[string]pdf.Value)
+
+	dests := root.Key("Dests")
+	for _, key := range dests.Keys() {
+		named[key] = dests.Key(key)
+	}
+
+	var walk func(node pdf.Value, depth int)
+	walk = func(node pdf.Value, depth int) {
+		if depth > 32 || len(named) > 100000 {
+			return
+		}
+		names := node.Key("Names")
+		for i := 0; i+1 < names.Len(); i += 2 {
+			named[destName(names.Index(i))] = names.Index(i + 1)
+		}
+		kids := node.Key("Kids")
+		for i := 0; i < kids.Len(); i++ {
+			walk(kids.Index(i), depth+1)
+		}
+	}
+	walk(root.Key("Names").Key("Dests"), 0)
+	return named
+}
@@ -0,0 +1,116 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// minWordScore is the lowest acceptable word score of a sample PDF.
+const minWordScore = 0.98
+
+// TestPDFGolden measures how well PDF text is extracted. Each sample PDF in
+// testdata/pdf has a .txt file next to it with the text it should give:
+// paragraphs separated by blank lines, headings and table rows (cells
+// separated by " | ") as paragraphs of their own, code with its line breaks
+// and indentation, and no page numbers or running headers.
+//
+// Two scores are logged for each file: the F1 score of the words, in order,
+// and the share of expected paragraphs extracted exactly. With -v the
+// paragraphs that differ are logged too.
+func TestPDFGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/pdf/*.pdf")
+	if err != nil || len(files) == 0 {
+		t.Fatal("no sample PDFs in testdata/pdf")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			golden, err := os.ReadFile(strings.TrimSuffix(file, ".pdf") + ".txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, _, err := Extract(data, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Join(doc.Pages, "\n\n")
+
+			words := wordScore(strings.Fields(string(golden)), strings.Fields(got))
+			found, missing := paragraphScore(paragraphs(string(golden)), paragraphs(got))
+			t.Logf("words %.3f, paragraphs %.3f", words, found)
+			if testing.Verbose() {
+				for _, p := range missing {
+					t.Logf("missing: %q", p)
+				}
+			}
+			if words < minWordScore {
+				t.Errorf("word score %.3f is below %.2f", words, minWordScore)
+			}
+		})
+	}
+}
+
+func paragraphs(text string) []string {
+	var result []string
+	for _, p := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if p = strings.Trim(p, "\n"); strings.TrimSpace(p) != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// wordScore is the F1 score of the longest common subsequence of words.
+func wordScore(want, got []string) float64 {
+	if len(want) == 0 || len(got) == 0 {
+		return 0
+	}
+	// One row of the LCS table at a time
+	prev := make([]int, len(got)+1)
+	cur := make([]int, len(got)+1)
+	for i := range want {
+		for j := range got {
+			switch {
+			case want[i] == got[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	common := float64(prev[len(got)])
+	if common == 0 {
+		return 0
+	}
+	precision, recall := common/float64(len(got)), common/float64(len(want))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// paragraphScore is the share of wanted paragraphs found exactly, and the
+// ones that weren't.
+func paragraphScore(want, got []string) (float64, []string) {
+	extracted := map[string]int{}
+	for _, p := range got {
+		extracted[p]++
+	}
+	var missing []string
+	for _, p := range want {
+		if extracted[p] > 0 {
+			extracted[p]--
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	if len(want) == 0 {
+		return 0, nil
+	}
+	return float64(len(want)-len(missing)) / float64(len(want)), missing
+}
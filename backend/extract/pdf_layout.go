@@ -0,0 +1,567 @@
+package extract
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The text of a PDF is a list of glyphs with positions, in no particular
+// order and usually without spaces. The layout is rebuilt from the geometry:
+// glyphs close together on a baseline make spans (words, or table cells),
+// spans on a baseline make lines, gutters split pages into columns read one
+// after the other, aligned spans on consecutive lines make tables, and the
+// spacing, indentation and fonts of the lines tell paragraphs, headings and
+// code apart.
+
+// glyph is a character drawn on a page. Coordinates are in points, y
+// increasing up the page.
+type glyph struct {
+	text          string
+	x, y, w, size float64
+	font          string
+}
+
+// span is a run of glyphs on one baseline with no wide gap.
+type span struct {
+	text            string
+	x0, x1, y, size float64
+	mono, bold      bool
+}
+
+// line is the spans on one baseline, left to right.
+type line struct {
+	spans           []*span
+	x0, x1, y, size float64
+	mono, bold      bool
+}
+
+func (l *line) text() string {
+	parts := make([]string, len(l.spans))
+	for i, s := range l.spans {
+		parts[i] = s.text
+	}
+	return strings.Join(parts, " ")
+}
+
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st")
+
+var (
+	monoFont = regexp.MustCompile(`(?i)courier|mono|consola|menlo|monaco|inconsolata|typewriter|cmtt|sftt|code`)
+	boldFont = regexp.MustCompile(`(?i)bold|black|heavy|semibold|demi|cmbx|sfbx`)
+)
+
+// wide reports whether r is a full-width character, set without spaces.
+func wide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0x3000 && r <= 0x303f || r >= 0xff00 && r <= 0xffef
+}
+
+// newGlyph cleans up a character read from a page. Glyphs with no width
+// (fonts without metrics) are given a typical one.
+func newGlyph(text string, x, y, w, size float64, font string) (glyph, bool) {
+	text = ligatures.Replace(text)
+	r, _ := utf8.DecodeRuneInString(text)
+	size = math.Abs(size)
+	if text == "" || r == utf8.RuneError || unicode.IsControl(r) || size < 1 {
+		return glyph{}, false
+	}
+	if w <= 0 {
+		w = 0.5 * size
+		if wide(r) {
+			w = size
+		}
+	}
+	return glyph{text: text, x: x, y: y, w: w, size: size, font: font}, true
+}
+
+// spans joins glyphs, in the order they were drawn, into spans. A space is
+// put between glyphs further apart than a narrow space; in monospaced text
+// the gap is kept as that many spaces.
+func spans(glyphs []glyph) []*span {
+	var result []*span
+	var cur *span
+	var last glyph
+	spaces := 0
+	for _, g := range glyphs {
+		if strings.TrimSpace(g.text) == "" {
+			spaces++
+			continue
+		}
+		if cur != nil {
+			size := math.Min(g.size, cur.size)
+			gap := g.x - cur.x1
+			if math.Abs(g.y-cur.y) < 0.5*size && gap > -0.5*size && (gap < 1.5*size || cur.mono && gap < 4*size) {
+				switch {
+				case cur.mono:
+					n := int(math.Round(gap / (0.6 * size)))
+					cur.text += strings.Repeat(" ", max(n, spaces))
+				case spaces > 0 || gap > 0.15*size:
+					if !(wide(lastRune(last.text)) && wide(firstRune(g.text)) && spaces == 0) {
+						cur.text += " "
+					}
+				}
+				cur.text += g.text
+				cur.x1 = math.Max(cur.x1, g.x+g.w)
+				cur.size = math.Max(cur.size, g.size)
+				last, spaces = g, 0
+				continue
+			}
+		}
+		cur = &span{text: g.text, x0: g.x, x1: g.x + g.w, y: g.y, size: g.size, mono: monoFont.MatchString(g.font), bold: boldFont.MatchString(g.font)}
+		result = append(result, cur)
+		last, spaces = g, 0
+	}
+	return result
+}
+
+// lines groups spans by baseline, top to bottom.
+func lines(spans []*span) []*line {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].y != spans[j].y {
+			return spans[i].y > spans[j].y
+		}
+		return spans[i].x0 < spans[j].x0
+	})
+	var result []*line
+	var cur *line
+	for _, s := range spans {
+		if cur == nil || cur.y-s.y > 0.4*math.Min(cur.size, s.size) {
+			cur = &line{y: s.y, x0: s.x0, x1: s.x1, mono: true, bold: true}
+			result = append(result, cur)
+		}
+		cur.spans = append(cur.spans, s)
+	}
+	for _, l := range result {
+		sort.SliceStable(l.spans, func(i, j int) bool { return l.spans[i].x0 < l.spans[j].x0 })
+		l.refresh()
+	}
+	return result
+}
+
+func (l *line) refresh() {
+	l.x0, l.x1, l.size, l.mono, l.bold = math.Inf(1), math.Inf(-1), 0, true, true
+	for _, s := range l.spans {
+		l.x0 = math.Min(l.x0, s.x0)
+		l.x1 = math.Max(l.x1, s.x1)
+		l.size = math.Max(l.size, s.size)
+		l.mono = l.mono && s.mono
+		l.bold = l.bold && s.bold
+	}
+}
+
+// columns splits lines into blocks read one after the other: the columns of
+// a page, left to right, with lines spanning the columns (titles, figure
+// captions) read where they are.
+func columns(ls []*line, depth int) [][]*line {
+	at, ok := gutter(ls)
+	if !ok || depth > 3 {
+		return [][]*line{ls}
+	}
+	var blocks [][]*line
+	var full, left, right []*line
+	flushColumns := func() {
+		if len(left) > 0 {
+			blocks = append(blocks, columns(left, depth+1)...)
+		}
+		if len(right) > 0 {
+			blocks = append(blocks, columns(right, depth+1)...)
+		}
+		left, right = nil, nil
+	}
+	for _, l := range ls {
+		if crosses(l, at) {
+			flushColumns()
+			full = append(full, l)
+			continue
+		}
+		if len(full) > 0 {
+			blocks = append(blocks, full)
+			full = nil
+		}
+		l, r := splitLine(l, at)
+		if l != nil {
+			left = append(left, l)
+		}
+		if r != nil {
+			right = append(right, r)
+		}
+	}
+	flushColumns()
+	if len(full) > 0 {
+		blocks = append(blocks, full)
+	}
+	return blocks
+}
+
+func crosses(l *line, at float64) bool {
+	for _, s := range l.spans {
+		if s.x0 < at && s.x1 > at {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLine(l *line, at float64) (left, right *line) {
+	for _, s := range l.spans {
+		side := &left
+		if s.x0 >= at {
+			side = &right
+		}
+		if *side == nil {
+			*side = &line{y: l.y}
+		}
+		(*side).spans = append((*side).spans, s)
+	}
+	for _, part := range []*line{left, right} {
+		if part != nil {
+			part.refresh()
+		}
+	}
+	return left, right
+}
+
+// gutter finds a vertical strip no line of text crosses (bar a few spanning
+// ones) with full lines of text on both sides, as between columns, and
+// returns where the fewest lines cross it. Strips between the short cells of
+// a table don't count.
+func gutter(ls []*line) (at float64, ok bool) {
+	if len(ls) < 6 {
+		return 0, false
+	}
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	var sizes []float64
+	for _, l := range ls {
+		minX, maxX = math.Min(minX, l.x0), math.Max(maxX, l.x1)
+		sizes = append(sizes, l.size)
+	}
+	width := maxX - minX
+	size := median(sizes)
+	allowed := max(2, len(ls)/8)
+
+	// Count the lines covering each point across the page
+	cover := make([]int, int(width)+1)
+	for _, l := range ls {
+		covered := make([]bool, len(cover))
+		for _, s := range l.spans {
+			for x := int(s.x0 - minX); x < int(s.x1-minX) && x < len(cover); x++ {
+				covered[max(x, 0)] = true
+			}
+		}
+		for x, c := range covered {
+			if c {
+				cover[x]++
+			}
+		}
+	}
+	best0, best1 := 0, 0
+	for x := int(0.2 * width); x < int(0.8*width); x++ {
+		if cover[x] > allowed {
+			continue
+		}
+		end := x
+		for end < len(cover) && cover[end] <= allowed {
+			end++
+		}
+		if end-x > best1-best0 {
+			best0, best1 = x, end
+		}
+		x = end
+	}
+	if float64(best1-best0) < size {
+		return 0, false
+	}
+	fewest := best0
+	for x := best0; x < best1; x++ {
+		if cover[x] < cover[fewest] || cover[x] == cover[fewest] && x-best0 <= (best1-best0)/2 {
+			fewest = x
+		}
+	}
+	at = minX + float64(fewest) + 0.5
+
+	// Both sides need enough lines that mostly fill their column
+	var leftFill, rightFill []float64
+	for _, l := range ls {
+		if crosses(l, at) {
+			continue
+		}
+		left, right := splitLine(l, at)
+		if left != nil {
+			leftFill = append(leftFill, (left.x1-left.x0)/(at-minX))
+		}
+		if right != nil {
+			rightFill = append(rightFill, (right.x1-right.x0)/(maxX-at))
+		}
+	}
+	if len(leftFill) < 3 || len(rightFill) < 3 || mean(leftFill) < 0.6 || mean(rightFill) < 0.6 {
+		return 0, false
+	}
+	return at, true
+}
+
+// tableRows marks the lines of a block that are rows of a table: runs of
+// lines with several short spans lined up with the spans of the line above.
+func tableRows(block []*line) []bool {
+	rows := make([]bool, len(block))
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, l := range block {
+		minX, maxX = math.Min(minX, l.x0), math.Max(maxX, l.x1)
+	}
+	cells := func(l *line) bool {
+		if len(l.spans) < 2 || l.mono {
+			return false
+		}
+		if len(l.spans) == 2 {
+			for _, s := range l.spans {
+				if s.x1-s.x0 > 0.4*(maxX-minX) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for i := 1; i < len(block); i++ {
+		if cells(block[i-1]) && cells(block[i]) && aligned(block[i-1], block[i]) {
+			rows[i-1], rows[i] = true, true
+		}
+	}
+	return rows
+}
+
+// aligned reports whether most spans of b start, end or are centred where a
+// span of a is.
+func aligned(a, b *line) bool {
+	tolerance := 0.3 * math.Max(a.size, b.size)
+	matches := 0
+	for _, s := range b.spans {
+		for _, t := range a.spans {
+			if math.Abs(s.x0-t.x0) < tolerance || math.Abs(s.x1-t.x1) < tolerance || math.Abs((s.x0+s.x1)/2-(t.x0+t.x1)/2) < tolerance {
+				matches++
+				break
+			}
+		}
+	}
+	return matches >= 2 && 2*matches >= min(len(a.spans), len(b.spans))
+}
+
+var pageNumber = regexp.MustCompile(`(?i)^(page\s+)?[0-9ivxlc]+(\s*(/|of)\s*[0-9]+)?$`)
+
+// pdfPage is a page with its lines read into blocks.
+type pdfPage struct {
+	blocks [][]*line
+	first  *line // The top and bottom lines, where page numbers are
+	last   *line
+}
+
+func layoutPage(glyphs []glyph) pdfPage {
+	ls := lines(spans(glyphs))
+	if len(ls) == 0 {
+		return pdfPage{}
+	}
+	return pdfPage{blocks: columns(ls, 0), first: ls[0], last: ls[len(ls)-1]}
+}
+
+// pdfText writes out pages read into blocks, returning their text and the
+// headings found. Body text is in the most used font size. Headings are
+// lines in a larger size, or short bold lines, ranked by size.
+func pdfText(pages []pdfPage) ([]string, []Heading) {
+	sizeUse := map[float64]int{}
+	for _, page := range pages {
+		for _, block := range page.blocks {
+			for _, l := range block {
+				for _, s := range l.spans {
+					sizeUse[math.Round(s.size*2)/2] += utf8.RuneCountInString(s.text)
+				}
+			}
+		}
+	}
+	body := 0.0
+	for size, n := range sizeUse {
+		if n > sizeUse[body] || n == sizeUse[body] && size < body {
+			body = size
+		}
+	}
+	headingSize := func(l *line) float64 {
+		text := l.text()
+		switch {
+		case l.mono || utf8.RuneCountInString(text) > 120:
+			return 0
+		case l.size >= 1.15*body:
+			return math.Round(l.size*2) / 2
+		case l.bold && len(strings.Fields(text)) <= 12 && !strings.ContainsAny(text[len(text)-1:], ".,;"):
+			return body
+		}
+		return 0
+	}
+	var headingSizes []float64
+	for _, page := range pages {
+		for _, block := range page.blocks {
+			for _, l := range block {
+				if size := headingSize(l); size > 0 && !containsSize(headingSizes, size) {
+					headingSizes = append(headingSizes, size)
+				}
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(headingSizes)))
+
+	texts := make([]string, len(pages))
+	var headings []Heading
+	for number, page := range pages {
+		var paragraphs []string
+		for _, block := range page.blocks {
+			for _, p := range blockParagraphs(block, page, headingSize) {
+				if p.heading > 0 {
+					level := 1
+					for level < len(headingSizes) && headingSizes[level-1] > p.heading {
+						level++
+					}
+					headings = append(headings, Heading{Level: level, Title: p.text, Page: number + 1})
+				}
+				paragraphs = append(paragraphs, p.text)
+			}
+		}
+		texts[number] = strings.Join(paragraphs, "\n\n")
+	}
+	return texts, headings
+}
+
+type paragraph struct {
+	text    string
+	heading float64 // Size of the heading, 0 for body text
+}
+
+// blockParagraphs joins the lines of a block into paragraphs. A paragraph
+// ends at a wider gap than usual between lines, an indented line, a short
+// line ending a sentence, or a change of font.
+func blockParagraphs(block []*line, page pdfPage, headingSize func(*line) float64) []paragraph {
+	rows := tableRows(block)
+	left, right := math.Inf(1), math.Inf(-1)
+	var gaps []float64
+	for i, l := range block {
+		left, right = math.Min(left, l.x0), math.Max(right, l.x1)
+		if i > 0 && math.Abs(block[i-1].size-l.size) < 0.5 {
+			gaps = append(gaps, (block[i-1].y-l.y)/l.size)
+		}
+	}
+	leading := math.Min(median(gaps), 1.5)
+	if leading <= 0 {
+		leading = 1.2
+	}
+
+	var result []paragraph
+	var cur []*line
+	var curHeading float64
+	flush := func() {
+		if len(cur) > 0 {
+			result = append(result, paragraph{text: joinLines(cur), heading: curHeading})
+		}
+		cur, curHeading = nil, 0
+	}
+	for i, l := range block {
+		if (l == page.first || l == page.last) && pageNumber.MatchString(l.text()) {
+			continue
+		}
+		if rows[i] {
+			flush()
+			cells := make([]string, len(l.spans))
+			for j, s := range l.spans {
+				cells[j] = s.text
+			}
+			result = append(result, paragraph{text: strings.Join(cells, " | ")})
+			continue
+		}
+		heading := headingSize(l)
+		if len(cur) > 0 {
+			prev := cur[len(cur)-1]
+			gap := (prev.y - l.y) / l.size
+			text := prev.text()
+			newParagraph := heading != curHeading || prev.mono != l.mono ||
+				gap > 1.3*leading+0.1 ||
+				!l.mono && l.x0-left > l.size && prev.x0-left < 0.5*l.size ||
+				!l.mono && prev.x1 < right-0.15*(right-left) && strings.ContainsAny(text[len(text)-1:], ".!?:")
+			if newParagraph {
+				flush()
+			}
+		}
+		cur = append(cur, l)
+		curHeading = heading
+	}
+	flush()
+	return result
+}
+
+// joinLines joins the lines of a paragraph, keeping the line breaks and
+// indentation of code and joining words hyphenated across lines.
+func joinLines(ls []*line) string {
+	if ls[0].mono {
+		left := math.Inf(1)
+		for _, l := range ls {
+			left = math.Min(left, l.x0)
+		}
+		var sb strings.Builder
+		for i, l := range ls {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(strings.Repeat(" ", int(math.Round((l.x0-left)/(0.6*l.size)))))
+			sb.WriteString(l.text())
+		}
+		return sb.String()
+	}
+	text := ls[0].text()
+	for _, l := range ls[1:] {
+		next := l.text()
+		last, _ := utf8.DecodeLastRuneInString(strings.TrimSuffix(text, "-"))
+		first := firstRune(next)
+		switch {
+		case strings.HasSuffix(text, "-") && unicode.IsLetter(last) && unicode.IsLower(first):
+			text = strings.TrimSuffix(text, "-") + next
+		case wide(lastRune(text)) || wide(first):
+			text += next
+		default:
+			text += " " + next
+		}
+	}
+	return text
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+func containsSize(sizes []float64, size float64) bool {
+	for _, s := range sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func mean(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
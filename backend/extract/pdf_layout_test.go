@@ -0,0 +1,124 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// typeset draws text as glyphs from x along the baseline y, the way PDFs do:
+// one glyph per character, half the font size wide, and no glyphs for spaces.
+func typeset(x, y, size float64, font, text string) []glyph {
+	var glyphs []glyph
+	for _, r := range text {
+		w := 0.5 * size
+		if font == "Courier" {
+			w = 0.6 * size
+		}
+		if r != ' ' {
+			g, _ := newGlyph(string(r), x, y, w, size, font)
+			glyphs = append(glyphs, g)
+		}
+		x += w
+	}
+	return glyphs
+}
+
+func spanTexts(glyphs []glyph) string {
+	var texts []string
+	for _, s := range spans(glyphs) {
+		texts = append(texts, s.text)
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestSpans(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		glyphs []glyph
+		want   string
+	}{
+		{"words", typeset(72, 700, 10, "Times", "Plants make glucose."), "Plants make glucose."},
+		{"cells", append(typeset(72, 700, 10, "Times", "Leaf"), typeset(200, 700, 10, "Times", "Green")...), "Leaf|Green"},
+		{"lines", append(typeset(72, 700, 10, "Times", "One"), typeset(72, 688, 10, "Times", "Two")...), "One|Two"},
+		{"ligatures", typeset(72, 700, 10, "Times", "ﬁnd the ﬂow"), "find the flow"},
+		{"full width", typeset(72, 700, 10, "MS-Mincho", "植物は 光"), "植物は光"},
+		{"code", typeset(72, 700, 10, "Courier", "x :=   1"), "x :=   1"},
+	} {
+		if got := spanTexts(tt.glyphs); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if _, ok := newGlyph("\n", 0, 0, 5, 10, "Times"); ok {
+		t.Error("a control character is a glyph")
+	}
+	if g, _ := newGlyph("a", 0, 0, 0, 10, "Times"); g.w != 5 {
+		t.Errorf("a glyph without a width is %v wide", g.w)
+	}
+}
+
+// page lays out lines of text, one after the other from the top, each given
+// as size, font and text. A line starting with tabs is indented.
+func page(x float64, ls ...string) []glyph {
+	var glyphs []glyph
+	y := 750.0
+	for _, l := range ls {
+		var size float64
+		var font string
+		fmt.Sscanf(l, "%g %s", &size, &font)
+		text := l[strings.Index(l, font)+len(font)+1:]
+		indent := float64(utf8.RuneCountInString(text) - utf8.RuneCountInString(strings.TrimLeft(text, "\t")))
+		y -= 1.2 * size
+		glyphs = append(glyphs, typeset(x+indent*2*size, y, size, font, strings.TrimLeft(text, "\t"))...)
+	}
+	return glyphs
+}
+
+func TestPDFText(t *testing.T) {
+	first := layoutPage(page(72,
+		"18 Times Cells",
+		"10 Times Every living thing is made of cells, the small units that carry out",
+		"10 Times the work of life. Plants use photo-",
+		"10 Times synthesis to make glucose.",
+		"10 Times\tA new paragraph starts indented and runs on for a while",
+		"10 Times like this one does.",
+		"10 Times-Bold Parts of a cell",
+		"10 Times The nucleus holds the genes of the cell and the rest.",
+		"10 Times 1",
+	))
+	second := layoutPage(page(72,
+		"10 Courier func main() {",
+		"10 Courier \tgrow()",
+		"10 Courier }",
+	))
+	texts, headings := pdfText([]pdfPage{first, second})
+	want := []string{
+		"Cells\n\n" +
+			"Every living thing is made of cells, the small units that carry out the work of life. Plants use photosynthesis to make glucose.\n\n" +
+			"A new paragraph starts indented and runs on for a while like this one does.\n\n" +
+			"Parts of a cell\n\n" +
+			"The nucleus holds the genes of the cell and the rest.",
+		"func main() {\n   grow()\n}",
+	}
+	if fmt.Sprintf("%q", texts) != fmt.Sprintf("%q", want) {
+		t.Errorf("got  %q\nwant %q", texts, want)
+	}
+	if fmt.Sprint(headings) != fmt.Sprint([]Heading{{1, "Cells", 1}, {2, "Parts of a cell", 1}}) {
+		t.Errorf("headings %+v", headings)
+	}
+}
+
+func TestPDFColumns(t *testing.T) {
+	var left, right []string
+	for i := 0; i < 8; i++ {
+		left = append(left, fmt.Sprintf("10 Times Left column line %d of text here", i))
+		right = append(right, fmt.Sprintf("10 Times Right column line %d of text here", i))
+	}
+	glyphs := append(page(72, left...), page(320, right...)...)
+	texts, _ := pdfText([]pdfPage{layoutPage(glyphs)})
+	if !strings.HasPrefix(texts[0], "Left column line 0 of text here Left column line 1") ||
+		strings.Index(texts[0], "Left column line 7") > strings.Index(texts[0], "Right column line 0") {
+		t.Errorf("got %q", texts[0])
+	}
+}
@@ -0,0 +1,49 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// extractText reads a plain text file. Form feeds, which text exports of
+// paged documents put between pages, start new pages.
+func extractText(data []byte) (Document, error) {
+	var doc Document
+	for _, page := range strings.Split(decodeText(data), "\f") {
+		var paragraphs []string
+		for _, p := range strings.Split(strings.ReplaceAll(page, "\r\n", "\n"), "\n\n") {
+			if p = strings.TrimSpace(p); p != "" {
+				paragraphs = append(paragraphs, p)
+			}
+		}
+		if len(paragraphs) > 0 {
+			doc.Pages = append(doc.Pages, strings.Join(paragraphs, "\n\n"))
+		}
+	}
+	return doc, nil
+}
+
+// decodeText reads UTF-8 text, or UTF-16 text starting with a byte order mark.
+func decodeText(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		text := string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+		if !utf8.ValidString(text) {
+			text = strings.ToValidUTF8(text, "�")
+		}
+		return text
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
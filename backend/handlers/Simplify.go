@@ -5,13 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"tutor_genX/db"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
@@ -138,6 +136,10 @@ func Simplify(w http.ResponseWriter, r *http.Request) {
 		// Content entry exists. Check if the simplified explanation is already saved.
 		if content.SimplifiedExplanation != "" {
 			// Found in cache, return immediately
+			if wantsStream(r) {
+				sendStreamed(w, SimplifiedResponse{SimplifiedExplanation: content.SimplifiedExplanation})
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(SimplifiedResponse{SimplifiedExplanation: content.SimplifiedExplanation})
 			return
@@ -149,14 +151,6 @@ func Simplify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 4. Content not in cache: proceed with generation
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
 
 	prompt := fmt.Sprintf(`You are a learning specialist. Rewrite the provided explanation for a 12-year-old audience while preserving ALL key information.
 
@@ -185,28 +179,26 @@ Original Explanation: %s
 
 Provide simplified version:`, req.Topic, req.Explanation)
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
-
-	if err != nil {
-		http.Error(w, "Failed to generate content: "+err.Error(), http.StatusInternalServerError)
-		return
+	var simplified string
+	var stream *eventStream
+	if wantsStream(r) {
+		var err error
+		if stream, err = newEventStream(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if simplified, ok = streamCompletion(r.Context(), stream, prompt); !ok {
+			return
+		}
+	} else {
+		var err error
+		if simplified, err = complete(context.Background(), prompt); err != nil {
+			http.Error(w, "Failed to generate content: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	// 5. Extract simplified content
-	simplified := resp.Choices[0].Message.Content
-
-	// 6. Save the new simplified content to the database
+	// 5. Save the new simplified content to the database
 	if result.Error == gorm.ErrRecordNotFound {
 		// No entry exists yet, create a new one with the simplified explanation
 		newContent := models.Content{
@@ -221,6 +213,10 @@ Provide simplified version:`, req.Topic, req.Explanation)
 	}
 
 	// 7. Write JSON response
+	if stream != nil {
+		stream.send("done", SimplifiedResponse{SimplifiedExplanation: simplified})
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(SimplifiedResponse{
 		SimplifiedExplanation: simplified,
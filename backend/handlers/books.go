@@ -8,12 +8,10 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 )
 
 // BookSearchRequest defines the structure for the incoming request body.
@@ -52,16 +50,6 @@ func BookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Received book search request for goal: %s", req.Goal)
 
-	// Setup Groq
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
 	// A more robust prompt to extract keywords from a conversational goal
 	prompt := fmt.Sprintf(`Your task is to extract a concise, 2-5 word book search query from a user's learning goal. Ignore conversational filler. Respond with ONLY the search query.
 For example:
@@ -81,24 +69,16 @@ Query: "Data Science machine learning"
 Goal: "%s"
 Query:`, req.Goal)
 
-	// Call Groq
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleUser, Content: prompt},
-			},
-		},
-	)
+	// Call the model
+	reply, err := complete(context.Background(), prompt)
 
 	var searchTerm string
-	if err != nil || len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+	if err != nil || reply == "" {
 		log.Printf("AI search term generation failed: %v. Falling back to original goal.", err)
 		searchTerm = req.Goal // Fallback to the original goal
 	} else {
 		// Clean up the AI response
-		searchTerm = strings.TrimSpace(resp.Choices[0].Message.Content)
+		searchTerm = strings.TrimSpace(reply)
 		searchTerm = strings.Trim(searchTerm, "\"")
 		log.Printf("AI generated search term: %s", searchTerm)
 	}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/segment"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+var errUnknownChapter = errors.New("the document has no such chapter")
+
+// chapter is a top-level part of a document, from one chapter heading to the
+// next.
+type chapter struct {
+	Number    int // 1-based
+	Title     string
+	FirstPage int
+	LastPage  int
+	sections  []segment.Section
+}
+
+// chunks splits the chapter into prompt sized chunks.
+func (c chapter) chunks() []string {
+	return chunkTexts(segment.Split(c.sections, chunking))
+}
+
+// documentSource loads a document's pages and outline.
+func documentSource(doc models.Document) ([]segment.Page, []models.DocumentOutlineEntry) {
+	var pages []models.DocumentPage
+	var outline []models.DocumentOutlineEntry
+	if doc.ID != 0 {
+		db.DB.Where("document_id = ?", doc.ID).Order("number").Find(&pages)
+		db.DB.Where("document_id = ?", doc.ID).Order("position").Find(&outline)
+	}
+	sectionPages := make([]segment.Page, len(pages))
+	for i, page := range pages {
+		sectionPages[i] = segment.Page{Number: page.Number, Text: page.Text}
+	}
+	return sectionPages, outline
+}
+
+func outlineHeadings(outline []models.DocumentOutlineEntry) []segment.Heading {
+	headings := make([]segment.Heading, len(outline))
+	for i, entry := range outline {
+		headings[i] = segment.Heading{Title: entry.Title, Page: entry.Page}
+	}
+	return headings
+}
+
+// chapterEntries picks the outline entries that start chapters: those of the
+// shallowest level with at least two entries, so a lone title entry above the
+// chapters is passed over. Entries with no page are left out.
+func chapterEntries(outline []models.DocumentOutlineEntry) []models.DocumentOutlineEntry {
+	byLevel := map[int][]models.DocumentOutlineEntry{}
+	for _, entry := range outline {
+		if entry.Page > 0 {
+			byLevel[entry.Level] = append(byLevel[entry.Level], entry)
+		}
+	}
+	level := 0
+	for l, entries := range byLevel {
+		if len(entries) >= 2 && (level == 0 || l < level) {
+			level = l
+		}
+	}
+	return byLevel[level]
+}
+
+// documentChapters splits a document into chapters following its outline:
+// the PDF's bookmarks or, without them, the headings found in its text.
+// Documents with no pages or fewer than two chapters have none. Text before
+// the first chapter (title page, contents) is in no chapter.
+func documentChapters(doc models.Document) []chapter {
+	pages, outline := documentSource(doc)
+	return splitChapters(pages, outline)
+}
+
+func splitChapters(pages []segment.Page, outline []models.DocumentOutlineEntry) []chapter {
+	entries := chapterEntries(outline)
+	if len(pages) == 0 || len(entries) < 2 {
+		return nil
+	}
+	chapters := make([]chapter, len(entries))
+	for i, entry := range entries {
+		chapters[i] = chapter{Number: i + 1, Title: entry.Title, FirstPage: entry.Page, LastPage: entry.Page}
+	}
+
+	// Cut at every heading, so chunks still follow the sections within chapters
+	current := -1
+	for _, section := range segment.Sections(pages, outlineHeadings(outline)) {
+		if section.NewHeading {
+			for i := current + 1; i < len(chapters); i++ {
+				if chapters[i].Title == section.Heading && section.Page >= chapters[i].FirstPage {
+					current = i
+					break
+				}
+			}
+		}
+		if current < 0 {
+			continue
+		}
+		c := &chapters[current]
+		c.sections = append(c.sections, section)
+		c.LastPage = max(c.LastPage, section.Page)
+	}
+	return chapters
+}
+
+// findChapter returns chapter number n of a document.
+func findChapter(doc models.Document, n int) (chapter, error) {
+	chapters := documentChapters(doc)
+	if n < 1 || n > len(chapters) {
+		return chapter{}, fmt.Errorf("%w: %d", errUnknownChapter, n)
+	}
+	return chapters[n-1], nil
+}
+
+// ChapterCoverage is a chapter of a document and what has been made from it.
+type ChapterCoverage struct {
+	Number         int    `json:"number"`
+	Title          string `json:"title"`
+	FirstPage      int    `json:"first_page"`
+	LastPage       int    `json:"last_page"`
+	QuizSetID      *uint  `json:"quiz_set_id,omitempty"`
+	Questions      int    `json:"questions"` // In the chapter's own quiz
+	FlashcardSetID *uint  `json:"flashcard_set_id,omitempty"`
+	Cards          int    `json:"cards"`
+	CardsStudied   int    `json:"cards_studied"` // Reviewed at least once
+	// DocumentQuestions counts the questions of the whole-document quiz
+	// whose source is in the chapter.
+	DocumentQuestions int  `json:"document_questions"`
+	Covered           bool `json:"covered"` // Has any questions or cards
+}
+
+// DocumentChapters is a document's chapters, with its whole-document sets.
+type DocumentChapters struct {
+	DocumentID     uint              `json:"document_id"`
+	QuizSetID      *uint             `json:"quiz_set_id,omitempty"`
+	FlashcardSetID *uint             `json:"flashcard_set_id,omitempty"`
+	Covered        int               `json:"covered"` // Chapters with questions or cards
+	Chapters       []ChapterCoverage `json:"chapters"`
+}
+
+// GetDocumentChapters lists a document's chapters with the quizzes and
+// flashcards generated from each, and how much of each the whole-document
+// quiz covers.
+func GetDocumentChapters(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var doc models.Document
+	if err := db.DB.Omit("text").First(&doc, "id = ? AND user_email = ?", mux.Vars(r)["id"], userEmail).Error; err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	var quizSets []models.QuizSet
+	var flashcardSets []models.FlashcardSet
+	if err := db.DB.Where("user_email = ? AND document_id = ?", userEmail, doc.ID).Order("id").Find(&quizSets).Error; err != nil {
+		http.Error(w, "Failed to fetch quizzes", http.StatusInternalServerError)
+		return
+	}
+	if err := db.DB.Where("user_email = ? AND document_id = ?", userEmail, doc.ID).Order("id").Find(&flashcardSets).Error; err != nil {
+		http.Error(w, "Failed to fetch flashcards", http.StatusInternalServerError)
+		return
+	}
+
+	result := DocumentChapters{DocumentID: doc.ID, Chapters: []ChapterCoverage{}}
+	chapters := documentChapters(doc)
+	for _, c := range chapters {
+		result.Chapters = append(result.Chapters, ChapterCoverage{Number: c.Number, Title: c.Title, FirstPage: c.FirstPage, LastPage: c.LastPage})
+	}
+
+	// The first set of each chapter (or of the whole document) counts
+	for i := range quizSets {
+		set := &quizSets[i]
+		var quiz QuizResponse
+		json.Unmarshal([]byte(set.Quiz), &quiz)
+		switch {
+		case set.Chapter == 0 && result.QuizSetID == nil:
+			result.QuizSetID = &set.ID
+			for _, q := range quiz.Quiz {
+				if q.Source == nil {
+					continue
+				}
+				if n := chapterOfPage(chapters, q.Source.Page); n > 0 {
+					result.Chapters[n-1].DocumentQuestions++
+				}
+			}
+		case set.Chapter > 0 && set.Chapter <= len(result.Chapters) && result.Chapters[set.Chapter-1].QuizSetID == nil:
+			result.Chapters[set.Chapter-1].QuizSetID = &set.ID
+			result.Chapters[set.Chapter-1].Questions = len(quiz.Quiz)
+		}
+	}
+	for i := range flashcardSets {
+		set := &flashcardSets[i]
+		switch {
+		case set.Chapter == 0 && result.FlashcardSetID == nil:
+			result.FlashcardSetID = &set.ID
+		case set.Chapter > 0 && set.Chapter <= len(result.Chapters) && result.Chapters[set.Chapter-1].FlashcardSetID == nil:
+			var cards, studied int64
+			if err := db.DB.Model(&models.Card{}).Where("flashcard_set_id = ?", set.ID).Count(&cards).Error; err != nil {
+				http.Error(w, "Failed to count flashcards", http.StatusInternalServerError)
+				return
+			}
+			if err := db.DB.Model(&models.CardReview{}).Where("user_email = ? AND card_id IN (?)", userEmail,
+				db.DB.Model(&models.Card{}).Select("id").Where("flashcard_set_id = ?", set.ID)).Count(&studied).Error; err != nil {
+				http.Error(w, "Failed to count reviews", http.StatusInternalServerError)
+				return
+			}
+			result.Chapters[set.Chapter-1].FlashcardSetID = &set.ID
+			result.Chapters[set.Chapter-1].Cards = int(cards)
+			result.Chapters[set.Chapter-1].CardsStudied = int(studied)
+		}
+	}
+
+	for i := range result.Chapters {
+		c := &result.Chapters[i]
+		c.Covered = c.Questions > 0 || c.Cards > 0 || c.DocumentQuestions > 0
+		if c.Covered {
+			result.Covered++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// chapterOfPage is the number of the chapter page is in, the later one when
+// a chapter starts part way down it, or 0.
+func chapterOfPage(chapters []chapter, page int) int {
+	n := 0
+	for _, c := range chapters {
+		if page > 0 && c.FirstPage <= page {
+			n = c.Number
+		}
+	}
+	if n > 0 && page > chapters[n-1].LastPage {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/segment"
+
+	"github.com/gorilla/mux"
+)
+
+// biologyBook is a document with a contents page and two chapters, "Cells"
+// and "Plants", under a lone "Biology" bookmark.
+func biologyBook(t *testing.T) models.Document {
+	t.Helper()
+	doc := models.Document{UserEmail: testUser, ContentHash: "biology", FileName: "biology.pdf", Text: "Biology"}
+	db.DB.Create(&doc)
+	db.DB.Create([]models.DocumentPage{
+		{DocumentID: doc.ID, Number: 1, Text: "Contents\nCells 2\nPlants 3"},
+		{DocumentID: doc.ID, Number: 2, Text: "Cells\nCells are the units of life. Every cell has a membrane."},
+		{DocumentID: doc.ID, Number: 3, Text: "Plants\n" + plantText},
+	})
+	db.DB.Create([]models.DocumentOutlineEntry{
+		{DocumentID: doc.ID, Position: 0, Level: 1, Title: "Biology", Page: 1},
+		{DocumentID: doc.ID, Position: 1, Level: 2, Title: "Cells", Page: 2},
+		{DocumentID: doc.ID, Position: 2, Level: 2, Title: "Plants", Page: 3},
+		{DocumentID: doc.ID, Position: 3, Level: 3, Title: "Index", Page: 0},
+	})
+	return doc
+}
+
+func TestSplitChapters(t *testing.T) {
+	pages := []segment.Page{{Number: 1, Text: "Title page"}, {Number: 2, Text: "One\nText."}, {Number: 3, Text: "More text.\nTwo\nEnd."}, {Number: 4, Text: "The end."}}
+	outline := []models.DocumentOutlineEntry{
+		{Level: 1, Title: "Book", Page: 1},
+		{Level: 2, Title: "One", Page: 2},
+		{Level: 3, Title: "One.a", Page: 3},
+		{Level: 2, Title: "Two", Page: 3},
+	}
+	chapters := splitChapters(pages, outline)
+	if len(chapters) != 2 {
+		t.Fatalf("chapters %+v", chapters)
+	}
+	if c := chapters[0]; c.Number != 1 || c.Title != "One" || c.FirstPage != 2 || c.LastPage != 3 || len(c.sections) != 2 {
+		t.Errorf("chapter 1 %+v", c)
+	}
+	if c := chapters[1]; c.Title != "Two" || c.FirstPage != 3 || c.LastPage != 4 || !strings.HasPrefix(c.sections[0].Text, "Two") {
+		t.Errorf("chapter 2 %+v", c)
+	}
+
+	// Page 3 has the end of chapter 1 and the start of chapter 2
+	for page, want := range map[int]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 2, 5: 0} {
+		if got := chapterOfPage(chapters, page); got != want {
+			t.Errorf("page %d is in chapter %d, want %d", page, got, want)
+		}
+	}
+
+	if got := splitChapters(pages, outline[:2]); got != nil {
+		t.Errorf("one chapter %+v", got)
+	}
+	if got := splitChapters(nil, outline); got != nil {
+		t.Errorf("no pages %+v", got)
+	}
+}
+
+func TestDocumentChapters(t *testing.T) {
+	provider := setupHandlers(t, quizReply, quizReply, flashcardReply)
+	doc := biologyBook(t)
+
+	// A quiz of the whole document, one of the plants chapter and cards for the cells chapter
+	var whole, plants PublicQuizResponse
+	decode(t, post(t, GenerateQuizFromPdf, QuizRequest2{DocumentID: doc.ID}), &whole)
+	decode(t, post(t, GenerateQuizFromPdf, QuizRequest2{DocumentID: doc.ID, Chapter: 2}), &plants)
+	var cells FlashcardResponse
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{DocumentID: doc.ID, Chapter: 1}), &cells)
+
+	calls := provider.Calls()
+	if len(calls) != 3 || strings.Contains(calls[1][0].Content, "membrane") || !strings.Contains(calls[2][0].Content, "membrane") || strings.Contains(calls[2][0].Content, "glucose") {
+		t.Fatalf("%d calls", len(calls))
+	}
+	var deck models.FlashcardSet
+	db.DB.Where("document_id = ?", doc.ID).First(&deck)
+	if deck.Chapter != 1 || deck.Title != "biology.pdf - Cells" {
+		t.Errorf("deck %+v", deck)
+	}
+	db.DB.Create(&models.CardReview{UserEmail: testUser, CardID: cells.Flashcards[0].ID})
+
+	var got DocumentChapters
+	decode(t, serve(GetDocumentChapters, mux.SetURLVars(get(t, "/documents/"+itoa(doc.ID)+"/chapters"), map[string]string{"id": itoa(doc.ID)})), &got)
+	if got.QuizSetID == nil || *got.QuizSetID != whole.QuizSetID || got.FlashcardSetID != nil || got.Covered != 2 || len(got.Chapters) != 2 {
+		t.Fatalf("chapters %+v", got)
+	}
+	if c := got.Chapters[0]; c.Title != "Cells" || c.FirstPage != 2 || c.LastPage != 2 || *c.FlashcardSetID != deck.ID || c.Cards != 2 || c.CardsStudied != 1 || c.DocumentQuestions != 0 {
+		t.Errorf("cells %+v", c)
+	}
+	if c := got.Chapters[1]; *c.QuizSetID != plants.QuizSetID || c.Questions != 3 || c.DocumentQuestions != 3 || c.FlashcardSetID != nil || !c.Covered {
+		t.Errorf("plants %+v", c)
+	}
+
+	// The chapter's deck can be studied on its own
+	other := createDeck(t, testUser, "other")
+	var due []DueCard
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due?set_id="+itoa(deck.ID))), &due)
+	if len(due) != 2 || due[0].FlashcardSetID != deck.ID || due[1].FlashcardSetID != deck.ID {
+		t.Errorf("due %+v", due)
+	}
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due")), &due)
+	if len(due) != 3 || due[2].FlashcardSetID != other.ID {
+		t.Errorf("due everywhere %+v", due)
+	}
+
+	if w := post(t, GenerateQuizFromPdf, QuizRequest2{DocumentID: doc.ID, Chapter: 3}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown chapter: status %d", w.Code)
+	}
+	if w := post(t, SubmitJob, GenerationRequest{Kind: quizJob, PDFtext: plantText, Chapter: 1}); w.Code != http.StatusBadRequest {
+		t.Errorf("chapter without a document: status %d", w.Code)
+	}
+	if w := serve(GetDueFlashcards, get(t, "/flashcards/due?set_id=x")); w.Code != http.StatusBadRequest {
+		t.Errorf("bad set_id: status %d", w.Code)
+	}
+	if w := serve(GetDocumentChapters, mux.SetURLVars(get(t, "/"), map[string]string{"id": "99"})); w.Code != http.StatusNotFound {
+		t.Errorf("missing document: status %d", w.Code)
+	}
+}
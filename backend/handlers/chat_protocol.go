@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Every chatbot websocket frame, in both directions, is a ChatEnvelope.
+// Frames the server sends in answer to a client frame carry its ID.
+//
+// Client to server:
+//   - "auth"    AuthPayload, first frame when the token was not in the URL
+//   - "message" UserMessagePayload
+//   - "cancel"  CancelPayload, stops the reply being generated
+//
+// Server to client:
+//   - "session" SessionPayload, the conversation a message was added to
+//   - "typing"  TypingPayload, around each reply
+//   - "delta"   DeltaPayload, a piece of the reply
+//   - "done"    DonePayload, the complete reply
+//   - "error"   ErrorPayload
+const ChatProtocolVersion = 1
+
+type ChatEnvelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Frame types
+const (
+	frameAuth    = "auth"
+	frameMessage = "message"
+	frameCancel  = "cancel"
+	frameSession = "session"
+	frameTyping  = "typing"
+	frameDelta   = "delta"
+	frameDone    = "done"
+	frameError   = "error"
+)
+
+// Error codes
+const (
+	errCodeUnauthorized       = "unauthorized"
+	errCodeBadRequest         = "bad_request"
+	errCodeUnsupportedVersion = "unsupported_version"
+	errCodeSessionNotFound    = "session_not_found"
+	errCodeBusy               = "busy"
+	errCodeCancelled          = "cancelled"
+	errCodeUnavailable        = "unavailable"
+	errCodeGenerationFailed   = "generation_failed"
+	errCodeInternal           = "internal"
+)
+
+type AuthPayload struct {
+	Token string `json:"token"`
+}
+
+type UserMessagePayload struct {
+	Text      string `json:"text"`
+	SessionID uint   `json:"session_id,omitempty"` // Continue this session instead of the current one
+	Context   struct {
+		Topic       string `json:"topic"`
+		Explanation string `json:"explanation"`
+	} `json:"context"`
+}
+
+type CancelPayload struct {
+	MessageID string `json:"message_id,omitempty"` // Defaults to whatever reply is in progress
+}
+
+type SessionPayload struct {
+	SessionID uint `json:"session_id"`
+}
+
+type TypingPayload struct {
+	Active bool `json:"active"`
+}
+
+type DeltaPayload struct {
+	Text string `json:"text"`
+}
+
+type DonePayload struct {
+	Text      string     `json:"text"`
+	SessionID uint       `json:"session_id"`
+	Sources   []Citation `json:"sources,omitempty"` // Passages of the user's documents the reply cites
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	chatWriteWait      = 10 * time.Second
+	chatPongWait       = 60 * time.Second
+	chatPingPeriod     = chatPongWait * 9 / 10
+	chatMaxMessageSize = 64 << 10
+)
+
+// chatConn serializes writes to a websocket; gorilla allows one writer at a time.
+type chatConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *chatConn) send(frameType, id string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(chatWriteWait))
+	return c.conn.WriteJSON(ChatEnvelope{V: ChatProtocolVersion, Type: frameType, ID: id, Payload: data})
+}
+
+func (c *chatConn) sendError(id, code, message string) error {
+	return c.send(frameError, id, ErrorPayload{Code: code, Message: message})
+}
+
+// read returns the next frame, rejecting other protocol versions.
+func (c *chatConn) read() (ChatEnvelope, error) {
+	var env ChatEnvelope
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return env, err
+	}
+	if err := json.Unmarshal(data, &env); err != nil || env.Type == "" {
+		return env, errBadFrame{errCodeBadRequest, "frames must be JSON envelopes with a type"}
+	}
+	if env.V != ChatProtocolVersion {
+		return env, errBadFrame{errCodeUnsupportedVersion, "this server speaks protocol version 1"}
+	}
+	return env, nil
+}
+
+// errBadFrame is a frame the client got wrong; the connection stays open.
+type errBadFrame struct {
+	code    string
+	message string
+}
+
+func (e errBadFrame) Error() string { return e.message }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const (
+	chatHistoryTokens     = 3000 // Budget for the turns replayed to the model
+	chatExplanationLength = 6000 // Characters of the studied explanation sent along
+)
+
+// estimateTokens is a rough count, about four characters per token.
+func estimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+// chatHistory returns the turns of a session that fit the token budget,
+// oldest first. Older turns that no longer fit are folded into the
+// session's rolling summary first.
+func chatHistory(ctx context.Context, session *models.ChatSession) ([]models.ChatMessage, error) {
+	var messages []models.ChatMessage
+	if err := db.DB.Where("session_id = ? AND id > ?", session.ID, session.SummarizedThrough).Order("id ASC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	start, used := len(messages), 0
+	for start > 0 {
+		tokens := estimateTokens(messages[start-1].Content)
+		// The newest turn (the question being asked) is always kept
+		if start < len(messages) && used+tokens > chatHistoryTokens {
+			break
+		}
+		used += tokens
+		start--
+	}
+	if start == 0 {
+		return messages, nil
+	}
+
+	summary, err := summarizeTurns(ctx, session.Summary, messages[:start])
+	if err != nil {
+		return nil, err
+	}
+	session.Summary = summary
+	session.SummarizedThrough = messages[start-1].ID
+	err = db.DB.Model(session).Updates(map[string]interface{}{
+		"summary":            session.Summary,
+		"summarized_through": session.SummarizedThrough,
+	}).Error
+	return messages[start:], err
+}
+
+// summarizeTurns extends a conversation summary with more turns.
+func summarizeTurns(ctx context.Context, summary string, turns []models.ChatMessage) (string, error) {
+	var transcript strings.Builder
+	for _, turn := range turns {
+		speaker := "Student"
+		if turn.Role == llm.RoleAssistant {
+			speaker = "TutorBot"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, turn.Content)
+	}
+	if summary == "" {
+		summary = "(nothing yet)"
+	}
+
+	prompt := fmt.Sprintf(`You keep a running summary of a tutoring conversation between a student and TutorBot.
+Update the summary with the new turns below. Keep what the student is studying, what they asked, what they struggled with and what was already explained.
+Write at most 200 words of plain text. Reply with the summary only.
+
+Summary so far:
+%s
+
+New turns:
+%s`, summary, transcript.String())
+	return complete(ctx, prompt)
+}
+
+// chatPrompt builds the conversation sent to the model for the next reply,
+// grounded in the passages retrieved from the user's documents.
+func chatPrompt(session *models.ChatSession, explanation string, sources []Citation, history []models.ChatMessage) []llm.Message {
+	var system strings.Builder
+	system.WriteString("You are TutorBot, a helpful AI assistant for the TutorGenX learning platform. Respond in a helpful and concise manner.")
+	if session.Topic != "" {
+		fmt.Fprintf(&system, "\nThe user is currently studying the topic: %q.", session.Topic)
+	}
+	if explanation != "" {
+		explanation = truncate(explanation, chatExplanationLength)
+		fmt.Fprintf(&system, "\nHere is the explanation they are looking at:\n%s\nKeep your answers directly related to the topic and explanation.", explanation)
+	}
+	if session.Summary != "" {
+		fmt.Fprintf(&system, "\nSummary of the earlier conversation:\n%s", session.Summary)
+	}
+	if grounding := groundingPrompt(sources); grounding != "" {
+		fmt.Fprintf(&system, "\n\n%s", grounding)
+	}
+
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: system.String()}}
+	for _, turn := range history {
+		messages = append(messages, llm.Message{Role: turn.Role, Content: turn.Content})
+	}
+	return messages
+}
+
+// GetChatSessions lists the user's TutorBot sessions, most recently active
+// first, optionally only those about ?topic=.
+func GetChatSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := db.DB.Where("user_email = ?", claims["email"].(string))
+	if topic := r.URL.Query().Get("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	sessions := []models.ChatSession{}
+	if err := query.Order("updated_at desc").Find(&sessions).Error; err != nil {
+		http.Error(w, "Failed to fetch chat sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetChatSession returns a session with all of its messages, to resume it.
+func GetChatSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var session models.ChatSession
+	err := db.DB.Preload("Messages", orderBy("id")).
+		First(&session, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error
+	if err != nil {
+		http.Error(w, "Chat session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// DeleteChatSession deletes a session and its messages.
+func DeleteChatSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var session models.ChatSession
+	if err := db.DB.First(&session, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error; err != nil {
+		http.Error(w, "Chat session not found", http.StatusNotFound)
+		return
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", session.ID).Delete(&models.ChatMessage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&session).Error
+	})
+	if err != nil {
+		http.Error(w, "Failed to delete chat session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Chat session deleted"})
+}
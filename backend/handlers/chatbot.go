@@ -4,103 +4,273 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+	"tutor_genX/utils"
 
 	"github.com/gorilla/websocket"
-	"github.com/sashabaranov/go-openai"
 )
 
+// Browsers send an Origin header; other clients (scripts, tests) don't
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		return true
+		origin := r.Header.Get("Origin")
+		return origin == "" || utils.OriginAllowed(origin)
 	},
 }
 
-// Struct to hold the incoming message from the frontend
-type ChatMessage struct {
-	Message string `json:"message"`
-	Context struct {
-		Topic       string `json:"topic"`
-		Explanation string `json:"explanation"`
-	} `json:"context"`
+// authTimeout is how long a client has to send its auth frame.
+const authTimeout = 10 * time.Second
+
+// authenticateSocket returns the email of the user behind the connection,
+// from ?token= or an "auth" frame.
+func authenticateSocket(c *chatConn, r *http.Request) (string, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		c.conn.SetReadDeadline(time.Now().Add(authTimeout))
+		env, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		var auth AuthPayload
+		if env.Type != frameAuth || json.Unmarshal(env.Payload, &auth) != nil {
+			return "", errors.New("expected an auth frame")
+		}
+		token = auth.Token
+	}
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		return "", err
+	}
+	return claims["email"].(string), nil
+}
+
+// chatSession picks the session a message belongs to: the one it names, the
+// connection's current one if the topic is unchanged, or a new one.
+func chatSession(userEmail string, current *models.ChatSession, msg UserMessagePayload) (*models.ChatSession, bool, error) {
+	if msg.SessionID != 0 {
+		if current != nil && current.ID == msg.SessionID {
+			return current, false, nil
+		}
+		var session models.ChatSession
+		if err := db.DB.First(&session, "id = ? AND user_email = ?", msg.SessionID, userEmail).Error; err != nil {
+			return nil, false, err
+		}
+		return &session, true, nil
+	}
+	if current != nil && current.Topic == msg.Context.Topic {
+		return current, false, nil
+	}
+
+	title := truncate(msg.Text, 60)
+	session := models.ChatSession{UserEmail: userEmail, Topic: msg.Context.Topic, Title: title}
+	return &session, true, db.DB.Create(&session).Error
+}
+
+// chatReply is the reply being generated on a connection.
+type chatReply struct {
+	id     string
+	cancel context.CancelFunc
 }
 
 func HandleChatbot(w http.ResponseWriter, r *http.Request) {
+	// Reject a bad ?token= before upgrading, so the client gets a plain 401
+	if token := r.URL.Query().Get("token"); token != "" {
+		if _, err := utils.ParseToken(token); err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Error upgrading to WebSocket:", err)
 		return
 	}
 	defer conn.Close()
+	c := &chatConn{conn: conn}
+	conn.SetReadLimit(chatMaxMessageSize)
+
+	userEmail, err := authenticateSocket(c, r)
+	if err != nil {
+		c.sendError("", errCodeUnauthorized, "Unauthorized")
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"), time.Now().Add(chatWriteWait))
+		return
+	}
 
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		log.Println("GROQ_API_KEY not set in .env")
-		conn.WriteMessage(websocket.TextMessage, []byte("Chatbot is currently unavailable."))
+	if llmProvider == nil {
+		log.Println("LLM provider not configured")
+		c.sendError("", errCodeUnavailable, "Chatbot is currently unavailable.")
 		return
 	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
 
-	for {
-		_, p, err := conn.ReadMessage()
+	// ?session_id= resumes a conversation
+	var current *models.ChatSession
+	if id, err := strconv.ParseUint(r.URL.Query().Get("session_id"), 10, 64); err == nil {
+		current, _, err = chatSession(userEmail, nil, UserMessagePayload{SessionID: uint(id)})
 		if err != nil {
-			log.Println("Error reading message:", err)
-			break
+			c.sendError("", errCodeSessionNotFound, "Chat session not found")
+			return
 		}
+		c.send(frameSession, "", SessionPayload{SessionID: current.ID})
+	}
 
-		var msg ChatMessage
-		if err := json.Unmarshal(p, &msg); err != nil {
-			log.Println("Error unmarshaling message:", err)
-			continue
+	// Keepalive: the client has to answer pings or the read loop times out
+	conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+	ctx, cancel := context.WithCancel(r.Context())
+	var replies sync.WaitGroup
+	defer replies.Wait()
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(chatPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(chatWriteWait)); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		log.Printf("Received message: %s with topic: %s", msg.Message, msg.Context.Topic)
-
-		// Create a context-aware prompt
-		var prompt string
-		if msg.Context.Topic != "" && msg.Context.Explanation != "" {
-			prompt = fmt.Sprintf(
-				`You are TutorBot, a helpful AI assistant for the TutorGenX learning platform.
-				The user is currently studying the topic: "%s".
-				Here is the explanation they are looking at: "%s".
-				Based on this context, answer the user's question: "%s".
-				Keep your answer concise and directly related to the provided topic and explanation.`,
-				msg.Context.Topic, msg.Context.Explanation, msg.Message,
-			)
-		} else {
-			prompt = fmt.Sprintf(
-				`You are TutorBot, a helpful AI assistant for the TutorGenX learning platform.
-				A user asked: "%s".
-				Respond in a helpful and concise manner.`,
-				msg.Message,
-			)
+	// One reply at a time. It is generated beside the read loop so a cancel
+	// frame (or the connection closing) can stop it.
+	var mu sync.Mutex
+	var reply *chatReply
+	for {
+		env, err := c.read()
+		var bad errBadFrame
+		if errors.As(err, &bad) {
+			c.sendError(env.ID, bad.code, bad.message)
+			continue
 		}
-
-		resp, err := client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model: "llama-3.3-70b-versatile",
-				Messages: []openai.ChatCompletionMessage{
-					{Role: openai.ChatMessageRoleUser, Content: prompt},
-				},
-			},
-		)
 		if err != nil {
-			log.Println("Error from Groq API:", err)
-			conn.WriteMessage(websocket.TextMessage, []byte("Sorry, I had trouble generating a response."))
-			continue
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Error reading message:", err)
+			}
+			return
+		}
+
+		switch env.Type {
+		case frameMessage:
+			var msg UserMessagePayload
+			if err := json.Unmarshal(env.Payload, &msg); err != nil || strings.TrimSpace(msg.Text) == "" {
+				c.sendError(env.ID, errCodeBadRequest, "message frames need a non-empty text")
+				continue
+			}
+			mu.Lock()
+			busy := reply != nil
+			mu.Unlock()
+			if busy {
+				c.sendError(env.ID, errCodeBusy, "Wait for the current reply or cancel it first")
+				continue
+			}
+
+			session, started, err := chatSession(userEmail, current, msg)
+			if err != nil {
+				c.sendError(env.ID, errCodeSessionNotFound, "Chat session not found")
+				continue
+			}
+			current = session
+			if started {
+				c.send(frameSession, env.ID, SessionPayload{SessionID: session.ID})
+			}
+
+			replyCtx, stop := context.WithCancel(ctx)
+			mu.Lock()
+			reply = &chatReply{id: env.ID, cancel: stop}
+			mu.Unlock()
+			replies.Add(1)
+			go func(id string) {
+				defer replies.Done()
+				answerChat(replyCtx, c, id, session, msg)
+				stop()
+				mu.Lock()
+				reply = nil
+				mu.Unlock()
+			}(env.ID)
+
+		case frameCancel:
+			var req CancelPayload
+			json.Unmarshal(env.Payload, &req)
+			mu.Lock()
+			if reply != nil && (req.MessageID == "" || req.MessageID == reply.id) {
+				reply.cancel()
+			}
+			mu.Unlock()
+
+		case frameAuth:
+			c.sendError(env.ID, errCodeBadRequest, "Already authenticated")
+
+		default:
+			c.sendError(env.ID, errCodeBadRequest, "Unknown frame type "+strconv.Quote(env.Type))
 		}
+	}
+}
+
+// answerChat saves the user's message, streams the reply and saves it once
+// it is complete. A cancelled or failed reply is thrown away with the message.
+func answerChat(ctx context.Context, c *chatConn, id string, session *models.ChatSession, msg UserMessagePayload) {
+	c.send(frameTyping, id, TypingPayload{Active: true})
+	defer c.send(frameTyping, id, TypingPayload{Active: false})
+
+	question := models.ChatMessage{SessionID: session.ID, Role: llm.RoleUser, Content: msg.Text}
+	if err := db.DB.Create(&question).Error; err != nil {
+		log.Println("Error saving chat message:", err)
+		c.sendError(id, errCodeInternal, "Failed to save your message")
+		return
+	}
+	history, err := chatHistory(ctx, session)
+	if err != nil {
+		log.Println("Error loading chat history:", err)
+		history = []models.ChatMessage{question}
+	}
 
-		aiResponse := resp.Choices[0].Message.Content
+	// Look up the passages of the user's documents relevant to the question
+	sources, err := retrieve(ctx, session.UserEmail, session.Topic+"\n"+msg.Text, nil)
+	if err != nil {
+		log.Println("Failed to search documents:", err)
+	}
 
-		if err := conn.WriteMessage(websocket.TextMessage, []byte(aiResponse)); err != nil {
-			log.Println("Error writing message:", err)
-			break
+	aiResponse, err := llm.Stream(ctx, llmProvider, chatPrompt(session, msg.Context.Explanation, sources, history), func(delta string) error {
+		return c.send(frameDelta, id, DeltaPayload{Text: delta})
+	})
+	if ctx.Err() != nil || err != nil {
+		// Unanswered questions aren't kept, so a retry doesn't ask twice
+		if err := db.DB.Unscoped().Delete(&question).Error; err != nil {
+			log.Println("Error discarding chat message:", err)
 		}
 	}
+	if ctx.Err() != nil {
+		c.sendError(id, errCodeCancelled, "Reply cancelled")
+		return
+	}
+	if err != nil {
+		log.Println("Error from LLM provider:", err)
+		c.sendError(id, errCodeGenerationFailed, "Sorry, I had trouble generating a response.")
+		return
+	}
+
+	answer := models.ChatMessage{SessionID: session.ID, Role: llm.RoleAssistant, Content: aiResponse}
+	if err := db.DB.Create(&answer).Error; err != nil {
+		log.Println("Error saving chat message:", err)
+	}
+	db.DB.Model(session).Update("updated_at", answer.CreatedAt)
+
+	c.send(frameDone, id, DonePayload{Text: aiResponse, SessionID: session.ID, Sources: citedSources(aiResponse, sources)})
 }
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// dialChat starts the chatbot on a test server and connects to it with query.
+func dialChat(t *testing.T, query string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(HandleChatbot))
+	t.Cleanup(server.Close)
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws"+query, nil)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial: %v (status %d)", err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendFrame(t *testing.T, conn *websocket.Conn, frameType, id string, payload interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(payload)
+	if err := conn.WriteJSON(ChatEnvelope{V: ChatProtocolVersion, Type: frameType, ID: id, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) ChatEnvelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var env ChatEnvelope
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// readUntil reads frames up to and including the first of type frameType,
+// and returns them all.
+func readUntil(t *testing.T, conn *websocket.Conn, frameType string) []ChatEnvelope {
+	t.Helper()
+	var frames []ChatEnvelope
+	for {
+		env := readFrame(t, conn)
+		frames = append(frames, env)
+		if env.Type == frameType {
+			return frames
+		}
+	}
+}
+
+// readError reads up to the next error frame and returns its payload.
+func readError(t *testing.T, conn *websocket.Conn) ErrorPayload {
+	t.Helper()
+	frames := readUntil(t, conn, frameError)
+	var e ErrorPayload
+	json.Unmarshal(frames[len(frames)-1].Payload, &e)
+	return e
+}
+
+func chatMessage(text, topic string) UserMessagePayload {
+	msg := UserMessagePayload{Text: text}
+	msg.Context.Topic = topic
+	return msg
+}
+
+func TestChatbot(t *testing.T) {
+	setupHandlers(t, "Plants make glucose from light.")
+	conn := dialChat(t, "?token="+testToken(t))
+
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("What is photosynthesis?", "Photosynthesis"))
+	frames := readUntil(t, conn, frameDone)
+	var session SessionPayload
+	var text strings.Builder
+	for _, env := range frames {
+		if env.ID != "m1" || env.V != ChatProtocolVersion {
+			t.Errorf("frame %s has ID %q, version %d", env.Type, env.ID, env.V)
+		}
+		switch env.Type {
+		case frameSession:
+			json.Unmarshal(env.Payload, &session)
+		case frameDelta:
+			var delta DeltaPayload
+			json.Unmarshal(env.Payload, &delta)
+			text.WriteString(delta.Text)
+		}
+	}
+	var typing TypingPayload
+	json.Unmarshal(frames[1].Payload, &typing)
+	if frames[0].Type != frameSession || frames[1].Type != frameTyping || !typing.Active || session.SessionID == 0 {
+		t.Errorf("frames %+v", frames)
+	}
+	var done DonePayload
+	json.Unmarshal(frames[len(frames)-1].Payload, &done)
+	if done.Text != "Plants make glucose from light." || text.String() != done.Text || done.SessionID != session.SessionID {
+		t.Errorf("streamed %q, done %+v", text.String(), done)
+	}
+	env := readFrame(t, conn)
+	json.Unmarshal(env.Payload, &typing)
+	if env.Type != frameTyping || typing.Active {
+		t.Errorf("after done: %+v", env)
+	}
+
+	var saved models.ChatSession
+	db.DB.Preload("Messages").First(&saved, session.SessionID)
+	if saved.UserEmail != testUser || saved.Title != "What is photosynthesis?" || len(saved.Messages) != 2 {
+		t.Errorf("saved %+v", saved)
+	}
+}
+
+func TestChatbotResume(t *testing.T) {
+	provider := setupHandlers(t, "In the chloroplasts.")
+	session := models.ChatSession{UserEmail: testUser, Topic: "Photosynthesis"}
+	db.DB.Create(&session)
+	db.DB.Create(&[]models.ChatMessage{
+		{SessionID: session.ID, Role: llm.RoleUser, Content: "What is photosynthesis?"},
+		{SessionID: session.ID, Role: llm.RoleAssistant, Content: "Plants make glucose from light."},
+	})
+
+	conn := dialChat(t, "?token="+testToken(t)+"&session_id="+itoa(session.ID))
+	var resumed SessionPayload
+	if env := readFrame(t, conn); env.Type != frameSession || json.Unmarshal(env.Payload, &resumed) != nil || resumed.SessionID != session.ID {
+		t.Fatalf("resumed %+v", env)
+	}
+
+	// The earlier turns are replayed, and no new session is started
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Where does it happen?", "Photosynthesis"))
+	for _, env := range readUntil(t, conn, frameDone) {
+		if env.Type == frameSession {
+			t.Error("a new session was started")
+		}
+	}
+	history := provider.Calls()[0]
+	if len(history) != 4 || history[1].Content != "What is photosynthesis?" || history[2].Role != llm.RoleAssistant || history[3].Content != "Where does it happen?" {
+		t.Errorf("prompt %+v", history)
+	}
+
+	// Another topic starts another session
+	readUntil(t, conn, frameTyping)
+	sendFrame(t, conn, frameMessage, "m2", chatMessage("What is a goroutine?", "Goroutines"))
+	if env := readFrame(t, conn); env.Type != frameSession {
+		t.Errorf("new topic: %+v", env)
+	}
+	readUntil(t, conn, frameDone)
+}
+
+func TestChatbotAuth(t *testing.T) {
+	setupHandlers(t, "Hello!")
+
+	// A token in an auth frame
+	conn := dialChat(t, "")
+	sendFrame(t, conn, frameAuth, "", AuthPayload{Token: testToken(t)})
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Hi", ""))
+	readUntil(t, conn, frameDone)
+	sendFrame(t, conn, frameAuth, "a2", AuthPayload{Token: testToken(t)})
+	if e := readError(t, conn); e.Code != errCodeBadRequest {
+		t.Errorf("second auth frame: %+v", e)
+	}
+
+	// A bad token in the frame gets an error and the connection is closed
+	conn = dialChat(t, "")
+	sendFrame(t, conn, frameAuth, "", AuthPayload{Token: "nope"})
+	if e := readError(t, conn); e.Code != errCodeUnauthorized {
+		t.Errorf("bad token: %+v", e)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("after a bad token: %v", err)
+	}
+
+	// A bad token in the URL is refused before upgrading
+	server := httptest.NewServer(http.HandlerFunc(HandleChatbot))
+	defer server.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token=nope", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("bad token in the URL: %v", err)
+	}
+
+	// Someone else's session can't be resumed
+	theirs := models.ChatSession{UserEmail: "someone@example.com", Topic: "Secrets"}
+	db.DB.Create(&theirs)
+	conn = dialChat(t, "?token="+testToken(t)+"&session_id="+itoa(theirs.ID))
+	if e := readError(t, conn); e.Code != errCodeSessionNotFound {
+		t.Errorf("their session: %+v", e)
+	}
+}
+
+func TestChatbotOrigin(t *testing.T) {
+	setupHandlers(t, "Hello!")
+	t.Setenv("ALLOWED_ORIGINS", "https://tutor.example.com")
+	server := httptest.NewServer(http.HandlerFunc(HandleChatbot))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + testToken(t)
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}}); err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("other origin: %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://tutor.example.com"}})
+	if err != nil {
+		t.Fatalf("allowed origin: %v", err)
+	}
+	defer conn.Close()
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Hi", ""))
+	readUntil(t, conn, frameDone)
+}
+
+func TestChatbotBadFrames(t *testing.T) {
+	setupHandlers(t, "Hello!")
+	conn := dialChat(t, "?token="+testToken(t))
+
+	for _, tt := range []struct {
+		frame interface{}
+		code  string
+	}{
+		{"not an envelope", errCodeBadRequest},
+		{ChatEnvelope{V: 2, Type: frameMessage, ID: "a"}, errCodeUnsupportedVersion},
+		{ChatEnvelope{V: 1, Type: "shout", ID: "b"}, errCodeBadRequest},
+		{ChatEnvelope{V: 1, Type: frameMessage, ID: "c", Payload: json.RawMessage(`{"text": " "}`)}, errCodeBadRequest},
+		{ChatEnvelope{V: 1, Type: frameMessage, ID: "d", Payload: json.RawMessage(`{"text": "Hi", "session_id": 99}`)}, errCodeSessionNotFound},
+	} {
+		conn.WriteJSON(tt.frame)
+		env := readFrame(t, conn)
+		var e ErrorPayload
+		json.Unmarshal(env.Payload, &e)
+		if env.Type != frameError || e.Code != tt.code {
+			t.Errorf("%+v: got %+v", tt.frame, env)
+		}
+	}
+
+	// The connection is still usable
+	sendFrame(t, conn, frameMessage, "e", chatMessage("Hi", ""))
+	readUntil(t, conn, frameDone)
+
+	// A frame over the size limit closes it
+	conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", chatMaxMessageSize+1)))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+				t.Errorf("oversized frame: %v", err)
+			}
+			break
+		}
+	}
+}
+
+// blockingProvider replies only once its context is done.
+type blockingProvider struct {
+	started chan struct{}
+}
+
+func (p blockingProvider) Complete(ctx context.Context, messages []llm.Message) (string, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+type failingProvider struct{}
+
+func (failingProvider) Complete(ctx context.Context, messages []llm.Message) (string, error) {
+	return "", errors.New("rate limited")
+}
+
+func TestChatbotCancel(t *testing.T) {
+	setupHandlers(t)
+	provider := blockingProvider{started: make(chan struct{}, 1)}
+	UseLLM(provider, nil)
+	conn := dialChat(t, "?token="+testToken(t))
+
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Tell me everything", ""))
+	<-provider.started
+	// One reply at a time
+	sendFrame(t, conn, frameMessage, "m2", chatMessage("And more", ""))
+	if e := readError(t, conn); e.Code != errCodeBusy {
+		t.Errorf("second message: %+v", e)
+	}
+
+	// Cancelling another message does nothing
+	sendFrame(t, conn, frameCancel, "", CancelPayload{MessageID: "m2"})
+	sendFrame(t, conn, frameCancel, "", CancelPayload{MessageID: "m1"})
+	frames := readUntil(t, conn, frameError)
+	var e ErrorPayload
+	json.Unmarshal(frames[len(frames)-1].Payload, &e)
+	if e.Code != errCodeCancelled || frames[len(frames)-1].ID != "m1" {
+		t.Errorf("after cancel: %+v", frames)
+	}
+	readUntil(t, conn, frameTyping)
+
+	// Neither the question nor a partial answer is kept
+	var messages int64
+	db.DB.Unscoped().Model(&models.ChatMessage{}).Count(&messages)
+	if messages != 0 {
+		t.Errorf("%d messages saved", messages)
+	}
+}
+
+func TestChatbotProviderError(t *testing.T) {
+	setupHandlers(t)
+	UseLLM(failingProvider{}, nil)
+	conn := dialChat(t, "?token="+testToken(t))
+
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Hi", ""))
+	if e := readError(t, conn); e.Code != errCodeGenerationFailed {
+		t.Errorf("got %+v", e)
+	}
+	readUntil(t, conn, frameTyping)
+	var messages int64
+	db.DB.Unscoped().Model(&models.ChatMessage{}).Count(&messages)
+	if messages != 0 {
+		t.Errorf("%d messages saved", messages)
+	}
+
+	// Without a provider the chatbot says so and hangs up
+	UseLLM(nil, nil)
+	conn = dialChat(t, "?token="+testToken(t))
+	if e := readError(t, conn); e.Code != errCodeUnavailable {
+		t.Errorf("no provider: %+v", e)
+	}
+}
+
+func TestChatHistory(t *testing.T) {
+	provider := setupHandlers(t, "They talked about leaves.")
+	session := models.ChatSession{UserEmail: testUser, Topic: "Photosynthesis"}
+	db.DB.Create(&session)
+	var turns []models.ChatMessage
+	for i := 0; i < 5; i++ {
+		turn := models.ChatMessage{SessionID: session.ID, Role: llm.RoleUser, Content: strings.Repeat("leaf ", 800)}
+		db.DB.Create(&turn)
+		turns = append(turns, turn)
+	}
+
+	// Only the two newest turns fit the budget; the others are summarized
+	history, err := chatHistory(t.Context(), &session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].ID != turns[3].ID || session.Summary != "They talked about leaves." || session.SummarizedThrough != turns[2].ID {
+		t.Errorf("%d turns kept, session %+v", len(history), session)
+	}
+	var saved models.ChatSession
+	db.DB.First(&saved, session.ID)
+	if saved.Summary != session.Summary || saved.SummarizedThrough != session.SummarizedThrough {
+		t.Errorf("saved %+v", saved)
+	}
+	if prompt := chatPrompt(&session, "", nil, history); !strings.Contains(prompt[0].Content, "They talked about leaves.") || len(prompt) != 3 {
+		t.Errorf("prompt %+v", prompt)
+	}
+
+	// Summarized turns aren't summarized again
+	if history, _ := chatHistory(t.Context(), &saved); len(history) != 2 || len(provider.Calls()) != 1 {
+		t.Errorf("%d turns, %d calls", len(history), len(provider.Calls()))
+	}
+
+	// The newest turn is kept even when it alone is over the budget
+	long := models.ChatMessage{SessionID: session.ID, Role: llm.RoleUser, Content: strings.Repeat("leaf ", 4000)}
+	db.DB.Create(&long)
+	if history, _ := chatHistory(t.Context(), &saved); len(history) != 1 || history[0].ID != long.ID {
+		t.Errorf("long turn: %d turns", len(history))
+	}
+}
+
+// onSession runs handler on the chat session with the given id.
+func onSession(t *testing.T, handler http.HandlerFunc, id uint) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(handler, mux.SetURLVars(get(t, "/chat-sessions/"+itoa(id)), map[string]string{"id": itoa(id)}))
+}
+
+func TestChatSessions(t *testing.T) {
+	setupHandlers(t)
+	older := models.ChatSession{UserEmail: testUser, Topic: "Photosynthesis", Title: "Older"}
+	newer := models.ChatSession{UserEmail: testUser, Topic: "Goroutines", Title: "Newer"}
+	theirs := models.ChatSession{UserEmail: "someone@example.com", Topic: "Photosynthesis"}
+	db.DB.Create(&older)
+	db.DB.Create(&newer)
+	db.DB.Create(&theirs)
+	db.DB.Model(&older).Update("updated_at", newer.UpdatedAt.Add(-time.Minute))
+	db.DB.Create(&[]models.ChatMessage{
+		{SessionID: older.ID, Role: llm.RoleUser, Content: "Where?"},
+		{SessionID: older.ID, Role: llm.RoleAssistant, Content: "In leaves."},
+	})
+
+	var sessions []models.ChatSession
+	decode(t, serve(GetChatSessions, get(t, "/chat-sessions")), &sessions)
+	if len(sessions) != 2 || sessions[0].ID != newer.ID || sessions[1].ID != older.ID {
+		t.Errorf("sessions %+v", sessions)
+	}
+	decode(t, serve(GetChatSessions, get(t, "/chat-sessions?topic=Photosynthesis")), &sessions)
+	if len(sessions) != 1 || sessions[0].ID != older.ID {
+		t.Errorf("by topic %+v", sessions)
+	}
+
+	var session models.ChatSession
+	decode(t, onSession(t, GetChatSession, older.ID), &session)
+	if len(session.Messages) != 2 || session.Messages[0].Content != "Where?" || session.Messages[1].Content != "In leaves." {
+		t.Errorf("messages %+v", session.Messages)
+	}
+
+	for name, handler := range map[string]http.HandlerFunc{"get": GetChatSession, "delete": DeleteChatSession} {
+		if w := onSession(t, handler, theirs.ID); w.Code != http.StatusNotFound {
+			t.Errorf("%s their session: status %d", name, w.Code)
+		}
+	}
+
+	var deleted map[string]string
+	decode(t, onSession(t, DeleteChatSession, older.ID), &deleted)
+	var count int64
+	db.DB.Model(&models.ChatMessage{}).Where("session_id = ?", older.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d messages left", count)
+	}
+	if w := onSession(t, GetChatSession, older.ID); w.Code != http.StatusNotFound {
+		t.Errorf("after delete: status %d", w.Code)
+	}
+}
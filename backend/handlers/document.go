@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+// normalizeText collapses whitespace so the same document hashes the same
+// however it was extracted or sent.
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// contentHash is the identity of a document: the SHA-256 of its normalized text.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(normalizeText(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// saveDocument finds the user's document with this text or creates it.
+// Metadata the stored document is missing is filled in from meta.
+func saveDocument(userEmail, text string, meta models.Document) (models.Document, error) {
+	doc := models.Document{UserEmail: userEmail, ContentHash: contentHash(text)}
+	if meta.SizeBytes == 0 {
+		meta.SizeBytes = int64(len(text))
+	}
+	err := db.DB.Where(&doc).Attrs(models.Document{
+		FileName:  meta.FileName,
+		PageCount: meta.PageCount,
+		SizeBytes: meta.SizeBytes,
+		Text:      text,
+	}).FirstOrCreate(&doc).Error
+	if err != nil {
+		return doc, err
+	}
+
+	missing := map[string]interface{}{}
+	if doc.FileName == "" && meta.FileName != "" {
+		missing["file_name"] = meta.FileName
+	}
+	if doc.PageCount == 0 && meta.PageCount > 0 {
+		missing["page_count"] = meta.PageCount
+		missing["size_bytes"] = meta.SizeBytes
+	}
+	if len(missing) > 0 {
+		err = db.DB.Model(&doc).Updates(missing).Error
+	}
+	return doc, err
+}
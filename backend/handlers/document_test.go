@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+func TestContentHash(t *testing.T) {
+	a := contentHash("Plants make\tglucose.\n\nFrom light. ")
+	if b := contentHash("  Plants make glucose. From light."); a != b {
+		t.Errorf("whitespace changed the hash: %s, %s", a, b)
+	}
+	if b := contentHash("Plants make glucose. From light!"); a == b {
+		t.Error("different text, same hash")
+	}
+	if len(a) != 64 {
+		t.Errorf("hash %q", a)
+	}
+}
+
+func TestSaveDocument(t *testing.T) {
+	setupHandlers(t)
+	first, err := saveDocument(testUser, "Plants make glucose.", models.Document{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SizeBytes != int64(len("Plants make glucose.")) || first.FileName != "" {
+		t.Errorf("first %+v", first)
+	}
+
+	// The same text again is the same document, and gains the missing metadata
+	again, err := saveDocument(testUser, "Plants  make glucose.", models.Document{FileName: "plants.pdf", PageCount: 3, SizeBytes: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB.First(&again, again.ID)
+	if again.ID != first.ID || again.FileName != "plants.pdf" || again.PageCount != 3 || again.SizeBytes != 2048 {
+		t.Errorf("again %+v", again)
+	}
+
+	// Known metadata isn't overwritten
+	renamed, _ := saveDocument(testUser, "Plants make glucose.", models.Document{FileName: "other.pdf"})
+	if renamed.FileName != "plants.pdf" {
+		t.Errorf("renamed to %q", renamed.FileName)
+	}
+
+	theirs, _ := saveDocument("someone@example.com", "Plants make glucose.", models.Document{})
+	if theirs.ID == first.ID {
+		t.Error("two users share a document")
+	}
+}
+
+func TestGenerationKeyedByDocument(t *testing.T) {
+	provider := setupHandlers(t, flashcardReply)
+	// The same first 50 bytes, then different text
+	intro := strings.Repeat("Chapter one. ", 5)
+	var a, b FlashcardResponse
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: intro + "Plants make glucose."}), &a)
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: intro + "Cells divide."}), &b)
+	if len(provider.Calls()) != 2 || a.Flashcards[0].ID == b.Flashcards[0].ID {
+		t.Errorf("%d calls, cards %d and %d", len(provider.Calls()), a.Flashcards[0].ID, b.Flashcards[0].ID)
+	}
+
+	// Reformatted text, or the document by ID, reuses the set
+	var doc models.Document
+	db.DB.First(&doc, "content_hash = ?", contentHash(intro+"Cells divide."))
+	var c FlashcardResponse
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: strings.ReplaceAll(intro, " ", "\n") + "Cells divide."}), &c)
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{DocumentID: doc.ID}), &c)
+	if len(provider.Calls()) != 2 || c.Flashcards[0].ID != b.Flashcards[0].ID {
+		t.Errorf("%d calls, card %d", len(provider.Calls()), c.Flashcards[0].ID)
+	}
+
+	var set models.FlashcardSet
+	db.DB.First(&set, "document_id = ?", doc.ID)
+	if set.ID == 0 {
+		t.Error("the set is not linked to its document")
+	}
+
+	// Someone else's document can't be used
+	theirs, _ := saveDocument("someone@example.com", "Secret notes.", models.Document{})
+	if w := post(t, GenerateFlashcards, FlashcardRequest{DocumentID: theirs.ID}); w.Code != http.StatusNotFound {
+		t.Errorf("their document: status %d", w.Code)
+	}
+	if w := post(t, SubmitJob, GenerationRequest{Kind: quizJob, DocumentID: 999}); w.Code != http.StatusNotFound {
+		t.Errorf("unknown document: status %d", w.Code)
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"tutor_genX/db"
+	"tutor_genX/llm"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
@@ -30,6 +30,23 @@ type ExamplesResponse struct {
 	Examples []Example `json:"examples"`
 }
 
+// Validate checks there is at least one example and each has a title and explanation.
+func (e ExamplesResponse) Validate() error {
+	var problems llm.ValidationError
+	if len(e.Examples) == 0 {
+		problems.Addf("\"examples\" must contain at least one example")
+	}
+	for i, example := range e.Examples {
+		if strings.TrimSpace(example.Title) == "" {
+			problems.Addf("example %d has an empty \"title\"", i+1)
+		}
+		if strings.TrimSpace(example.Explanation) == "" {
+			problems.Addf("example %d has an empty \"explanation\"", i+1)
+		}
+	}
+	return problems.Err()
+}
+
 func GenerateExamples(w http.ResponseWriter, r *http.Request) {
 	//jwt validation
 	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
@@ -63,6 +80,10 @@ func GenerateExamples(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			// Found in cache, return immediately
+			if wantsStream(r) {
+				sendStreamed(w, cachedExamples)
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(cachedExamples)
 			return
@@ -75,15 +96,6 @@ func GenerateExamples(w http.ResponseWriter, r *http.Request) {
 
 	//content not in cache proceed to geenrate:
 
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
 	prompt := fmt.Sprintf(`
 You are an expert educator.
 
@@ -116,28 +128,31 @@ Explanation:
 %s
 `, req.Topic, req.Explanation)
 
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
-
-	if err != nil {
-		http.Error(w, "Failed to generate quiz: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	var generatedExamples ExamplesResponse
-	err = json.Unmarshal([]byte(resp.Choices[0].Message.Content), &generatedExamples)
-	if err != nil {
-		http.Error(w, "Failed to parse examples", http.StatusInternalServerError)
+	var stream *eventStream
+	if wantsStream(r) {
+		// The raw JSON is streamed as it is written; the "done" event carries
+		// the validated examples, repaired by a second request if need be
+		var err error
+		if stream, err = newEventStream(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reply, ok := streamCompletion(r.Context(), stream, prompt)
+		if !ok {
+			return
+		}
+		if llm.DecodeJSON(reply, &generatedExamples) != nil {
+			generatedExamples = ExamplesResponse{}
+			if err := completeJSON(r.Context(), prompt, &generatedExamples); err != nil {
+				if r.Context().Err() == nil {
+					stream.send("error", ErrorEvent{Error: "Failed to generate examples: " + err.Error()})
+				}
+				return
+			}
+		}
+	} else if err := completeJSON(context.Background(), prompt, &generatedExamples); err != nil {
+		http.Error(w, "Failed to generate examples: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -155,6 +170,10 @@ Explanation:
 		db.DB.Model(&content).Where("user_id = ? AND topic = ?", userID, req.Topic).Update("examples", string(examplesJSON))
 	}
 
+	if stream != nil {
+		stream.send("done", generatedExamples)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(generatedExamples)
 
@@ -4,23 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"tutor_genX/db"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
 type ExplainTopicRequest struct {
-	Topic string `json:"topic"`
+	Topic       string `json:"topic"`
+	DocumentIDs []uint `json:"document_ids,omitempty"` // Only ground the explanation in these documents
 }
 
 type ExplainTopicResponse struct {
-	Explanation string `json:"explanation"`
+	Explanation string     `json:"explanation"`
+	Sources     []Citation `json:"sources,omitempty"` // Passages of the user's documents the explanation cites
 }
 
 func ExplainTopicHandler(w http.ResponseWriter, r *http.Request) {
@@ -46,8 +47,16 @@ func ExplainTopicHandler(w http.ResponseWriter, r *http.Request) {
 		// Content entry exists. Check if the explanation is already saved.
 		if content.Explanation != "" {
 			// Found in cache, return immediately
+			cached := ExplainTopicResponse{Explanation: content.Explanation}
+			if content.Sources != "" {
+				json.Unmarshal([]byte(content.Sources), &cached.Sources)
+			}
+			if wantsStream(r) {
+				sendStreamed(w, cached)
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(ExplainTopicResponse{Explanation: content.Explanation})
+			json.NewEncoder(w).Encode(cached)
 			return
 		}
 		// If Explanation is empty, we will proceed to generate it.
@@ -57,17 +66,6 @@ func ExplainTopicHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Groq API setup
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
 	// Prompt
 	prompt := fmt.Sprintf(`Explain the following topic like you're teaching a beginner. Your explanation should be clear, concise, and easy to read.
 
@@ -82,22 +80,39 @@ Use the following Markdown formatting to structure your response:
 
 Topic: %s`, req.Topic)
 
-	// Call Groq
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleUser, Content: prompt},
-			},
-		},
-	)
+	// Ground the explanation in the user's own documents when they cover the topic
+	sources, err := retrieve(r.Context(), userID, req.Topic, req.DocumentIDs)
 	if err != nil {
-		http.Error(w, "Failed to fetch explanation: "+err.Error(), http.StatusInternalServerError)
-		return
+		log.Println("Failed to search documents:", err)
+	}
+	if grounding := groundingPrompt(sources); grounding != "" {
+		prompt += "\n\n" + grounding
+	}
+
+	// Call the model, streaming the reply as it comes when asked to
+	var explanation string
+	var stream *eventStream
+	if wantsStream(r) {
+		if stream, err = newEventStream(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if explanation, ok = streamCompletion(r.Context(), stream, prompt); !ok {
+			return
+		}
+	} else {
+		if explanation, err = complete(context.Background(), prompt); err != nil {
+			http.Error(w, "Failed to fetch explanation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	explanation := resp.Choices[0].Message.Content
+	sources = citedSources(explanation, sources)
+	var sourcesJSON string
+	if len(sources) > 0 {
+		data, _ := json.Marshal(sources)
+		sourcesJSON = string(data)
+	}
 
 	//Save the new explanation to the db
 	if result.Error == gorm.ErrRecordNotFound {
@@ -106,15 +121,21 @@ Topic: %s`, req.Topic)
 			UserID:      userID,
 			Topic:       req.Topic,
 			Explanation: explanation,
+			Sources:     sourcesJSON,
 		}
 		db.DB.Create(&newContent)
 	} else {
-		// Entry exists, update the specific field
-		db.DB.Model(&content).Where("user_id = ? AND topic = ?", userID, req.Topic).Update("explanation", explanation)
+		// Entry exists, update the specific fields
+		db.DB.Model(&content).Where("user_id = ? AND topic = ?", userID, req.Topic).Updates(map[string]interface{}{"explanation": explanation, "sources": sourcesJSON})
 	}
 
+	if stream != nil {
+		stream.send("done", ExplainTopicResponse{Explanation: explanation, Sources: sources})
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ExplainTopicResponse{
 		Explanation: explanation,
+		Sources:     sources,
 	})
 }
@@ -5,34 +5,70 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"tutor_genX/db"
+	"tutor_genX/jobs"
+	"tutor_genX/llm"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
-const flashcardChunkSize = 10000 // A safe chunk size for Groq API
-
 type FlashcardRequest struct {
-	PDFtext  string `json:"pdftext"`
-	FileName string `json:"fileName,omitempty"`
+	PDFtext    string `json:"pdftext"`
+	DocumentID uint   `json:"document_id,omitempty"`
+	FileName   string `json:"fileName,omitempty"`
+	Mode       string `json:"mode,omitempty"` // "cloze" for cloze deletion cards
+	Chapter    int    `json:"chapter,omitempty"`
 }
 
 type Flashcard struct {
+	ID    uint   `json:"id,omitempty"` // Card ID once saved
 	Front string `json:"front"`
 	Back  string `json:"back"`
+	// Cloze cards are sent rendered, with the cloze text they come from
+	Type string `json:"type,omitempty"`
+	Text string `json:"text,omitempty"`
 }
 
 type FlashcardResponse struct {
 	Flashcards []Flashcard `json:"flashcards"`
 }
 
+// Validate checks every card has both a front and a back.
+func (f FlashcardResponse) Validate() error {
+	var problems llm.ValidationError
+	for i, card := range f.Flashcards {
+		if strings.TrimSpace(card.Front) == "" {
+			problems.Addf("flashcard %d has an empty \"front\"", i+1)
+		}
+		if strings.TrimSpace(card.Back) == "" {
+			problems.Addf("flashcard %d has an empty \"back\"", i+1)
+		}
+	}
+	return problems.Err()
+}
+
+// flashcardsFromCards converts saved cards of cardType into the API response shape.
+func flashcardsFromCards(cards []models.Card, cardType string) FlashcardResponse {
+	flashcards := make([]Flashcard, 0, len(cards))
+	for _, card := range cards {
+		if card.Type != cardType {
+			continue
+		}
+		flashcard := Flashcard{ID: card.ID, Type: card.Type}
+		flashcard.Front, flashcard.Back = displayCard(card)
+		if card.Type == clozeCard {
+			flashcard.Text = card.Front
+		}
+		flashcards = append(flashcards, flashcard)
+	}
+	return FlashcardResponse{Flashcards: flashcards}
+}
+
 func GenerateFlashcards(w http.ResponseWriter, r *http.Request) {
 	// JWT validation
 	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
@@ -47,58 +83,51 @@ func GenerateFlashcards(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-
-	title := req.FileName
-	if title == "" {
-		// AI Title Generation Logic would be here
-		if len(req.PDFtext) > 50 {
-			title = req.PDFtext[:50] + "..."
-		} else {
-			title = req.PDFtext
-		}
-	}
-	if req.PDFtext == "" {
+	if req.PDFtext == "" && req.DocumentID == 0 {
 		http.Error(w, "PDF text is required", http.StatusBadRequest)
 		return
 	}
-	// 1. Check for existing content in the database
-	var flashcardSet models.FlashcardSet
-	// Use a hash or a unique identifier from the text as a key to check for cached content
-	result := db.DB.Where("user_email = ? AND pdf_text = ?", userEmail, req.PDFtext[:50]).First(&flashcardSet)
-
-	if result.Error == nil {
-		if flashcardSet.Flashcards != "" {
-			var cachedFlashcards FlashcardResponse
-			if err := json.Unmarshal([]byte(flashcardSet.Flashcards), &cachedFlashcards); err != nil {
-				http.Error(w, "Failed to parse cached flashcards", http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cachedFlashcards)
-			return
-		}
-	} else if result.Error != gorm.ErrRecordNotFound {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if req.Chapter != 0 && req.DocumentID == 0 {
+		http.Error(w, "A chapter needs a document ID", http.StatusBadRequest)
 		return
 	}
 
-	// 2. Content not in cache: proceed with generation
+	kind, cardType := flashcardJob, ""
+	switch req.Mode {
+	case "", "basic":
+	case clozeCard:
+		kind, cardType = clozeFlashcardJob, clozeCard
+	default:
+		http.Error(w, `Unknown mode: use "basic" or "cloze"`, http.StatusBadRequest)
+		return
+	}
 
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
+	// Runs as a job so chunks are processed by the worker pool; the job is
+	// cancelled if the client goes away
+	job, ok := runGeneration(w, r, userEmail, GenerationRequest{Kind: kind, PDFtext: req.PDFtext, DocumentID: req.DocumentID, FileName: req.FileName, Chapter: req.Chapter})
+	if !ok {
 		return
 	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
 
-	var allFlashcards []Flashcard
+	var flashcardSet models.FlashcardSet
+	if err := db.DB.Preload("Cards", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).First(&flashcardSet, *job.ResultID).Error; err != nil {
+		http.Error(w, "Failed to fetch flashcards", http.StatusInternalServerError)
+		return
+	}
 
-	textChunks := chunkText(req.PDFtext, flashcardChunkSize)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flashcardsFromCards(flashcardSet.Cards, cardType))
+}
 
-	for _, chunk := range textChunks {
-		prompt := fmt.Sprintf(`You are a flashcard generator. Create exactly 3-5 flashcards based ONLY on the provided text.
+// flashcardPrompt asks for cards on chunk, other than the existing ones.
+func flashcardPrompt(chunk string, existing []string) string {
+	avoid := ""
+	if len(existing) > 0 {
+		avoid = "\nThe deck already has cards for these questions. Do NOT repeat them, cover something else from the text:\n- " + strings.Join(existing, "\n- ") + "\n"
+	}
+	return fmt.Sprintf(`You are a flashcard generator. Create exactly 3-5 flashcards based ONLY on the provided text.
 
 STRICT REQUIREMENTS:
 1. Base flashcards ONLY on facts explicitly mentioned in the text.
@@ -115,64 +144,88 @@ OUTPUT FORMAT (JSON only, no markdown or extra text):
     }
   ]
 }
-
+%s
 text: %s
 
-Generate flashcards now:`, chunk)
-
-		resp, err := client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model: "llama-3.3-70b-versatile",
-				Messages: []openai.ChatCompletionMessage{
-					{Role: openai.ChatMessageRoleUser, Content: prompt},
-				},
-			},
-		)
-
-		if err != nil {
-			fmt.Printf("Error generating flashcards for a chunk: %v\n", err)
-			continue
-		}
-
-		var generatedFlashcards FlashcardResponse
-		responseContent := strings.TrimSpace(resp.Choices[0].Message.Content)
-
-		if strings.Contains(responseContent, `"flashcards": []`) {
-			continue
-		}
+Generate flashcards now:`, avoid, chunk)
+}
 
-		if err := json.Unmarshal([]byte(responseContent), &generatedFlashcards); err != nil {
-			fmt.Printf("Error parsing flashcard JSON for a chunk: %v\n", err)
-			continue
+// cachedFlashcardSet finds a set already generated from the same document
+// (or chapter of it, 0 for the whole document), and whether it has cards of
+// cardType ("" for front/back, or cloze).
+func cachedFlashcardSet(userEmail string, documentID uint, chapter int, cardType string) (models.FlashcardSet, bool, error) {
+	var flashcardSet models.FlashcardSet
+	err := db.DB.Preload("Cards", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("user_email = ? AND document_id = ? AND chapter = ?", userEmail, documentID, chapter).First(&flashcardSet).Error
+	if err == gorm.ErrRecordNotFound {
+		return flashcardSet, false, nil
+	}
+	if err != nil {
+		return flashcardSet, false, err
+	}
+	for _, card := range flashcardSet.Cards {
+		if card.Type == cardType {
+			return flashcardSet, true, nil
 		}
-
-		allFlashcards = append(allFlashcards, generatedFlashcards.Flashcards...)
 	}
+	return flashcardSet, false, nil
+}
 
-	if len(allFlashcards) == 0 {
-		http.Error(w, "Insufficient content for flashcard generation", http.StatusBadRequest)
-		return
+// saveGeneratedCards adds the cards made by a job to the deck of its
+// document (or chapter), creating the deck if there is none. cards gets the position the
+// first new card goes at.
+func saveGeneratedCards(job *models.Job, cards func(position int) []models.Card) (uint, error) {
+	flashcardSet, _, err := cachedFlashcardSet(job.UserEmail, job.DocumentID, job.Chapter, "")
+	if err != nil {
+		return 0, err
 	}
-
-	finalResponse := FlashcardResponse{Flashcards: allFlashcards}
-	flashcardsJSON, _ := json.Marshal(finalResponse)
-
-	// 2. Save the new flashcards to the database
-	if result.Error == gorm.ErrRecordNotFound {
-		newFlashcardSet := models.FlashcardSet{
-			UserEmail:  userEmail,
-			Title:      title,
-			PDFText:    req.PDFtext[:50],
-			Flashcards: string(flashcardsJSON),
+	newCards := cards(len(flashcardSet.Cards))
+	if len(newCards) == 0 {
+		return 0, errInsufficientContent
+	}
+	if flashcardSet.ID == 0 {
+		flashcardSet = models.FlashcardSet{
+			UserEmail:  job.UserEmail,
+			Title:      job.Title,
+			DocumentID: jobDocument(job),
+			Chapter:    job.Chapter,
+			Cards:      newCards,
 		}
-		db.DB.Create(&newFlashcardSet)
+		err = db.DB.Create(&flashcardSet).Error
 	} else {
-		db.DB.Model(&flashcardSet).Where("user_email = ? AND pdf_text = ?", userEmail, req.PDFtext[:50]).Update("flashcards", string(flashcardsJSON))
+		err = db.DB.Model(&flashcardSet).Association("Cards").Append(newCards)
 	}
+	return flashcardSet.ID, err
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(finalResponse)
+// flashcardKind generates cards chunk by chunk and saves them as one set.
+var flashcardKind = jobs.Kind{
+	Chunk: func(ctx context.Context, job *models.Job, chunk models.JobChunk) (string, int, error) {
+		var generated FlashcardResponse
+		if err := completeJSON(ctx, flashcardPrompt(chunk.Text, nil), &generated); err != nil {
+			return "", 0, err
+		}
+		output, err := json.Marshal(generated)
+		return string(output), len(generated.Flashcards), err
+	},
+	Finish: func(job *models.Job, outputs []string) (uint, error) {
+		var flashcards []Flashcard
+		for _, output := range outputs {
+			var generated FlashcardResponse
+			if err := json.Unmarshal([]byte(output), &generated); err != nil {
+				return 0, err
+			}
+			flashcards = append(flashcards, generated.Flashcards...)
+		}
+		return saveGeneratedCards(job, func(position int) []models.Card {
+			var cards []models.Card
+			for _, fc := range flashcards {
+				cards = append(cards, models.Card{Position: position + len(cards), Front: fc.Front, Back: fc.Back})
+			}
+			return cards
+		})
+	},
 }
 
 func DeleteAllFlashcards(w http.ResponseWriter, r *http.Request) {
@@ -184,7 +237,12 @@ func DeleteAllFlashcards(w http.ResponseWriter, r *http.Request) {
 	}
 	userEmail := claims["email"].(string)
 
-	// Delete all flashcard sets for this user
+	// Delete the cards first, then all flashcard sets for this user
+	userSets := db.DB.Model(&models.FlashcardSet{}).Select("id").Where("user_email = ?", userEmail)
+	if err := db.DB.Where("flashcard_set_id IN (?)", userSets).Delete(&models.Card{}).Error; err != nil {
+		http.Error(w, "Failed to delete flashcards", http.StatusInternalServerError)
+		return
+	}
 	if err := db.DB.Where("user_email = ?", userEmail).Delete(&models.FlashcardSet{}).Error; err != nil {
 		http.Error(w, "Failed to delete flashcards", http.StatusInternalServerError)
 		return
@@ -215,6 +273,10 @@ func DeleteFlashcard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := db.DB.Where("flashcard_set_id = ?", flashcardSet.ID).Delete(&models.Card{}).Error; err != nil {
+		http.Error(w, "Failed to delete flashcard", http.StatusInternalServerError)
+		return
+	}
 	if err := db.DB.Delete(&flashcardSet).Error; err != nil {
 		http.Error(w, "Failed to delete flashcard", http.StatusInternalServerError)
 		return
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tutor_genX/jobs"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+)
+
+const (
+	clozeCard         = "cloze"
+	clozeFlashcardJob = "cloze_flashcards"
+)
+
+// clozeDeletion matches {{c1::answer}} and {{c1::answer::hint}}.
+var clozeDeletion = regexp.MustCompile(`(?s)\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ClozeNote is a generated cloze text, which becomes one card per deletion number.
+type ClozeNote struct {
+	Text  string `json:"text"`
+	Extra string `json:"extra,omitempty"`
+}
+
+type ClozeResponse struct {
+	Cards []ClozeNote `json:"cards"`
+}
+
+// Validate checks every text has well-formed deletions.
+func (c ClozeResponse) Validate() error {
+	var problems llm.ValidationError
+	if len(c.Cards) == 0 {
+		problems.Addf(`"cards" must contain at least one card`)
+	}
+	for i, card := range c.Cards {
+		if err := checkCloze(card.Text); err != "" {
+			problems.Addf("card %d: %s", i+1, err)
+		}
+	}
+	return problems.Err()
+}
+
+// checkCloze says what is wrong with a cloze text, if anything.
+func checkCloze(text string) string {
+	matches := clozeDeletion.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return `"text" has no {{c1::...}} deletions`
+	}
+	for _, m := range matches {
+		if deletionNumber(m) < 1 {
+			return fmt.Sprintf("deletion %q must be numbered from c1", m[0])
+		}
+		if strings.TrimSpace(m[2]) == "" {
+			return fmt.Sprintf("deletion %q is empty", m[0])
+		}
+	}
+	if strings.Contains(clozeDeletion.ReplaceAllString(text, ""), "{{c") {
+		return `"text" has a malformed deletion, use {{c1::answer}}`
+	}
+	return ""
+}
+
+// deletionNumber reads the number of a deletion, so {{c01::...}} is card 1 too.
+func deletionNumber(m []string) int {
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// clozeNumbers lists the deletion numbers of a cloze text in order.
+func clozeNumbers(text string) []int {
+	var numbers []int
+	seen := map[int]bool{}
+	for _, m := range clozeDeletion.FindAllStringSubmatch(text, -1) {
+		n := deletionNumber(m)
+		if n > 0 && !seen[n] {
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// clozeCards makes the cards of a cloze text, one per deletion number.
+func clozeCards(text, extra, tags string) []models.Card {
+	var cards []models.Card
+	for _, n := range clozeNumbers(text) {
+		cards = append(cards, models.Card{Type: clozeCard, Cloze: n, Front: text, Back: extra, Tags: tags})
+	}
+	return cards
+}
+
+// renderCloze shows the card for deletion n: the question has those
+// deletions blanked (or their hint shown), the answer the full text plus the
+// extra notes. Other deletions are shown as plain text on both sides.
+func renderCloze(text, extra string, n int) (question, answer string) {
+	question = clozeDeletion.ReplaceAllStringFunc(text, func(m string) string {
+		parts := clozeDeletion.FindStringSubmatch(m)
+		if deletionNumber(parts) != n {
+			return parts[2]
+		}
+		if parts[3] != "" {
+			return "[" + parts[3] + "]"
+		}
+		return "[...]"
+	})
+	answer = clozeDeletion.ReplaceAllString(text, "$2")
+	if strings.TrimSpace(extra) != "" {
+		answer += "\n\n" + extra
+	}
+	return question, answer
+}
+
+// clozeAnswers is what has to be recalled on the card for deletion n.
+func clozeAnswers(text string, n int) []string {
+	var answers []string
+	for _, m := range clozeDeletion.FindAllStringSubmatch(text, -1) {
+		if deletionNumber(m) == n {
+			answers = append(answers, m[2])
+		}
+	}
+	return answers
+}
+
+// checkClozeAnswers reports whether typed answers match the deletions of a
+// card, in order.
+func checkClozeAnswers(expected, given []string) bool {
+	if len(expected) != len(given) {
+		return false
+	}
+	for i := range expected {
+		if normalizeAnswer(expected[i]) != normalizeAnswer(given[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// displayCard returns the sides of a card as shown to the learner.
+func displayCard(card models.Card) (front, back string) {
+	if card.Type == clozeCard {
+		return renderCloze(card.Front, card.Back, card.Cloze)
+	}
+	return card.Front, card.Back
+}
+
+func clozePrompt(chunk string) string {
+	return fmt.Sprintf(`You are a flashcard generator. Create exactly 3-5 cloze deletion cards based ONLY on the provided text.
+
+STRICT REQUIREMENTS:
+1. Each card is one sentence stating a fact explicitly mentioned in the text.
+2. Hide the key terms of the sentence as deletions: {{c1::term}}. A sentence can have several deletions; number them {{c1::...}}, {{c2::...}}, ... so each is asked on its own card, or give two the same number to ask them together.
+3. Only hide terms a learner should recall (names, terms, numbers), never filler words, and leave enough of the sentence to make the answer clear.
+4. "extra" is optional: a short note shown with the answer.
+5. Do not add any external knowledge not present in the text.
+
+OUTPUT FORMAT (JSON only, no markdown or extra text):
+{
+  "cards": [
+    {
+      "text": "The {{c1::mitochondria}} is the powerhouse of the cell, producing {{c2::ATP}}.",
+      "extra": "Optional note shown with the answer."
+    }
+  ]
+}
+
+text: %s
+
+Generate cloze cards now:`, chunk)
+}
+
+// clozeFlashcardKind generates cloze cards chunk by chunk and adds them to
+// the document's deck, next to any front/back cards it has.
+var clozeFlashcardKind = jobs.Kind{
+	Chunk: func(ctx context.Context, job *models.Job, chunk models.JobChunk) (string, int, error) {
+		var generated ClozeResponse
+		if err := completeJSON(ctx, clozePrompt(chunk.Text), &generated); err != nil {
+			return "", 0, err
+		}
+		output, err := json.Marshal(generated)
+		return string(output), len(generated.Cards), err
+	},
+	Finish: func(job *models.Job, outputs []string) (uint, error) {
+		var notes []ClozeNote
+		for _, output := range outputs {
+			var generated ClozeResponse
+			if err := json.Unmarshal([]byte(output), &generated); err != nil {
+				return 0, err
+			}
+			notes = append(notes, generated.Cards...)
+		}
+		return saveGeneratedCards(job, func(position int) []models.Card {
+			var cards []models.Card
+			for _, note := range notes {
+				for _, card := range clozeCards(note.Text, note.Extra, "") {
+					card.Position = position + len(cards)
+					cards = append(cards, card)
+				}
+			}
+			return cards
+		})
+	},
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+const clozeReply = `{"cards": [
+	{"text": "Plants make {{c1::glucose}} from {{c2::light::energy}}.", "extra": "Photosynthesis"},
+	{"text": "It happens in {{c1::chloroplasts}}."}
+]}`
+
+func TestCheckCloze(t *testing.T) {
+	for text, problem := range map[string]string{
+		"The {{c1::cell}} and {{c2::ATP::energy}}": "",
+		"No deletions":                    "no {{c1::...}}",
+		"The {{c0::cell}}":                "numbered from c1",
+		"The {{c1:: }}":                   "empty",
+		"The {{c1::cell}} and {{c2:ATP}}": "malformed",
+	} {
+		if got := checkCloze(text); (problem == "") != (got == "") || !strings.Contains(got, problem) {
+			t.Errorf("%q: got %q, want %q", text, got, problem)
+		}
+	}
+}
+
+func TestClozeCards(t *testing.T) {
+	text := "The {{c2::mitochondria}} makes {{c1::ATP}}, {{c2::the cell's}} energy."
+	cards := clozeCards(text, "Extra", "bio")
+	if len(cards) != 2 || cards[0].Cloze != 1 || cards[1].Cloze != 2 || cards[1].Type != clozeCard || cards[1].Tags != "bio" {
+		t.Fatalf("cards %+v", cards)
+	}
+
+	question, answer := renderCloze(text, "Extra", 2)
+	if question != "The [...] makes ATP, [...] energy." || answer != "The mitochondria makes ATP, the cell's energy.\n\nExtra" {
+		t.Errorf("rendered %q / %q", question, answer)
+	}
+	if question, _ := renderCloze("Made from {{c1::light::energy}}", "", 1); question != "Made from [energy]" {
+		t.Errorf("hint rendered as %q", question)
+	}
+	// Zero-padded numbers are the same deletions
+	padded := "The {{c01::cell}} and {{c02::ATP}}"
+	if question, _ := renderCloze(padded, "", 1); question != "The [...] and ATP" || strings.Join(clozeAnswers(padded, 2), "|") != "ATP" || len(clozeCards(padded, "", "")) != 2 {
+		t.Errorf("zero-padded rendered as %q", question)
+	}
+
+	answers := clozeAnswers(text, 2)
+	if strings.Join(answers, "|") != "mitochondria|the cell's" {
+		t.Errorf("answers %q", answers)
+	}
+	if !checkClozeAnswers(answers, []string{" Mitochondria", "the cell's"}) || checkClozeAnswers(answers, []string{"mitochondria"}) {
+		t.Error("checkClozeAnswers")
+	}
+}
+
+func TestGenerateClozeFlashcards(t *testing.T) {
+	provider := setupHandlers(t, flashcardReply, clozeReply)
+	text := strings.Repeat("Plants make glucose from light in chloroplasts. ", 10)
+
+	var basic, cloze FlashcardResponse
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, FileName: "plants.pdf"}), &basic)
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, FileName: "plants.pdf", Mode: clozeCard}), &cloze)
+	if len(basic.Flashcards) != 2 || len(cloze.Flashcards) != 3 {
+		t.Fatalf("%d basic and %d cloze cards", len(basic.Flashcards), len(cloze.Flashcards))
+	}
+	if c := cloze.Flashcards[1]; c.Type != clozeCard || c.Front != "Plants make glucose from [energy]." || c.Text != "Plants make {{c1::glucose}} from {{c2::light::energy}}." {
+		t.Errorf("card %+v", c)
+	}
+
+	// Both kinds go to the document's one deck, and each is served from it
+	var decks []models.FlashcardSet
+	db.DB.Preload("Cards").Find(&decks)
+	if len(decks) != 1 || len(decks[0].Cards) != 5 {
+		t.Fatalf("decks %+v", decks)
+	}
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, Mode: clozeCard}), &cloze)
+	if len(cloze.Flashcards) != 3 || len(provider.Calls()) != 2 {
+		t.Errorf("%d cards after %d calls", len(cloze.Flashcards), len(provider.Calls()))
+	}
+
+	if w := post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, Mode: "essay"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown mode: status %d", w.Code)
+	}
+}
+
+func TestReviewClozeCard(t *testing.T) {
+	setupHandlers(t)
+	deck := models.FlashcardSet{UserEmail: testUser, Title: "Cells", Cards: clozeCards("The {{c1::mitochondria}} makes {{c2::ATP}}.", "", "")}
+	db.DB.Create(&deck)
+
+	var due []DueCard
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due")), &due)
+	if len(due) != 2 || due[1].Front != "The mitochondria makes [...]." || due[1].Back != "The mitochondria makes ATP." || due[1].Cloze != 2 || due[1].Text == "" {
+		t.Fatalf("due %+v", due)
+	}
+
+	// A wrong typed answer is a lapse whatever the grade
+	var review ReviewResponse
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: deck.Cards[0].ID, Grade: grade(5), Answers: []string{"nucleus"}}), &review)
+	if review.Correct == nil || *review.Correct || review.Expected[0] != "mitochondria" || review.Repetitions != 0 {
+		t.Errorf("wrong answer %+v", review)
+	}
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: deck.Cards[1].ID, Grade: grade(4), Answers: []string{"atp"}}), &review)
+	if review.Correct == nil || !*review.Correct || review.Repetitions != 1 {
+		t.Errorf("right answer %+v", review)
+	}
+}
+
+func TestEditClozeCard(t *testing.T) {
+	setupHandlers(t)
+	deck := createDeck(t, testUser, "basic")
+	id := itoa(deck.ID)
+
+	var got models.FlashcardSet
+	decode(t, onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Type: clozeCard, Front: "{{c1::ATP}} and {{c2::DNA}}"}), &got)
+	if len(got.Cards) != 3 || got.Cards[2].Cloze != 2 {
+		t.Fatalf("added %+v", got.Cards)
+	}
+	if w := onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Type: clozeCard, Front: "no deletions"}); w.Code != http.StatusBadRequest {
+		t.Errorf("no deletions: status %d", w.Code)
+	}
+
+	// A new text edits every card made from it: c2 goes, c3 comes
+	text := "{{c1::ATP}} and {{c3::RNA}}"
+	decode(t, onDeck(t, UpdateCard, map[string]string{"id": id, "cardId": itoa(got.Cards[1].ID)}, UpdateCardRequest{Front: &text}), &got)
+	if len(got.Cards) != 3 || got.Cards[1].Front != text || got.Cards[1].Cloze != 1 || got.Cards[2].Cloze != 3 || fronts(got) == "misnumbered" {
+		t.Errorf("edited %+v", got.Cards)
+	}
+}
@@ -0,0 +1,708 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"tutor_genX/db"
+	"tutor_genX/jobs"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// moreFlashcardJob adds cards to an existing deck. The deck is the job's
+// ResultID from the start.
+const moreFlashcardJob = "more_flashcards"
+
+type UpdateDeckRequest struct {
+	Title *string   `json:"title"`
+	Tags  *[]string `json:"tags"`
+}
+
+type AddCardRequest struct {
+	Type     string   `json:"type"` // "cloze" for a cloze text in front, with an optional note in back
+	Front    string   `json:"front"`
+	Back     string   `json:"back"`
+	Tags     []string `json:"tags"`
+	Position int      `json:"position"` // 1-based position to insert at, 0 appends
+}
+
+type UpdateCardRequest struct {
+	Front    *string   `json:"front"`
+	Back     *string   `json:"back"`
+	Tags     *[]string `json:"tags"`
+	Position *int      `json:"position"` // 1-based
+}
+
+type MergeDecksRequest struct {
+	FlashcardSetIDs []uint `json:"flashcard_set_ids"` // The first deck is kept, the others are merged into it
+	Title           string `json:"title"`
+}
+
+type SplitDeckRequest struct {
+	Tags []string `json:"tags"` // Defaults to every tag in the deck
+}
+
+// DuplicateCard is a card dropped from a merge because the kept deck already
+// had the same card.
+type DuplicateCard struct {
+	CardID      uint   `json:"card_id"`
+	Front       string `json:"front"`
+	DuplicateOf uint   `json:"duplicate_of"`
+}
+
+// joinTags cleans up tags and stores them space separated, the way Anki
+// does: spaces inside a tag become underscores and repeats are dropped.
+func joinTags(tags []string) string {
+	var kept []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), "_")
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		kept = append(kept, tag)
+	}
+	return strings.Join(kept, " ")
+}
+
+// hasTag reports whether tags (space separated) include tag, ignoring case.
+func hasTag(tags, tag string) bool {
+	for _, t := range strings.Fields(tags) {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// cardKey is what two cards share when they are duplicates: the same words
+// on both sides, ignoring case and punctuation, and for cloze cards the same
+// deletion asked for.
+func cardKey(front, back string, cloze int) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}), " ")
+	}
+	return normalize(front) + "\x00" + normalize(back) + "\x00" + strconv.Itoa(cloze)
+}
+
+// loadDeck fetches a user's flashcard set with its cards in order.
+func loadDeck(tx *gorm.DB, id interface{}, userEmail string) (models.FlashcardSet, error) {
+	var deck models.FlashcardSet
+	err := tx.Preload("Cards", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC, id ASC")
+	}).First(&deck, "id = ? AND user_email = ?", id, userEmail).Error
+	return deck, err
+}
+
+// mutateDeck runs edit inside a transaction on the caller's deck and responds
+// with the updated deck.
+func mutateDeck(w http.ResponseWriter, r *http.Request, edit func(tx *gorm.DB, deck *models.FlashcardSet) error) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+	deckID := mux.Vars(r)["id"]
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		deck, err := loadDeck(tx, deckID, userEmail)
+		if err != nil {
+			return err
+		}
+		return edit(tx, &deck)
+	})
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+
+	deck, err := loadDeck(db.DB, deckID, userEmail)
+	if err != nil {
+		http.Error(w, "Failed to fetch flashcard set", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+func writeDeckError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Flashcard set not found", http.StatusNotFound)
+	case errors.Is(err, errBadEdit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to update flashcards: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// findCard returns the card with the given ID from a loaded deck and its index.
+func findCard(deck *models.FlashcardSet, cardIDStr string) (int, error) {
+	cardID, err := strconv.ParseUint(cardIDStr, 10, 64)
+	if err != nil {
+		return 0, badEdit("invalid card id")
+	}
+	for i := range deck.Cards {
+		if deck.Cards[i].ID == uint(cardID) {
+			return i, nil
+		}
+	}
+	return 0, badEdit("card %d is not in this deck", cardID)
+}
+
+// renumberCards gives cards positions 0..n-1 in the given order.
+func renumberCards(tx *gorm.DB, cards []models.Card) error {
+	for i, card := range cards {
+		if card.Position == i {
+			continue
+		}
+		if err := tx.Model(&models.Card{}).Where("id = ?", card.ID).Update("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCards removes cards together with everyone's review state for them.
+func deleteCards(tx *gorm.DB, cardIDs []uint) error {
+	if len(cardIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("card_id IN ?", cardIDs).Delete(&models.CardReview{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Card{}, cardIDs).Error
+}
+
+// GetFlashcardSet returns one deck with its cards, only those tagged ?tag= if given.
+func GetFlashcardSet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deck, err := loadDeck(db.DB, mux.Vars(r)["id"], claims["email"].(string))
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		cards := []models.Card{}
+		for _, card := range deck.Cards {
+			if hasTag(card.Tags, tag) {
+				cards = append(cards, card)
+			}
+		}
+		deck.Cards = cards
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deck)
+}
+
+// UpdateFlashcardSet renames a deck and/or replaces its tags.
+func UpdateFlashcardSet(w http.ResponseWriter, r *http.Request) {
+	var req UpdateDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	mutateDeck(w, r, func(tx *gorm.DB, deck *models.FlashcardSet) error {
+		updates := map[string]interface{}{}
+		if req.Title != nil {
+			title := strings.TrimSpace(*req.Title)
+			if title == "" {
+				return badEdit("deck title cannot be empty")
+			}
+			updates["title"] = title
+		}
+		if req.Tags != nil {
+			updates["tags"] = joinTags(*req.Tags)
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(deck).Updates(updates).Error
+	})
+}
+
+// AddCard adds a card to a deck, at the end unless a position is given. A
+// cloze text adds one card per deletion number.
+func AddCard(w http.ResponseWriter, r *http.Request) {
+	var req AddCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Front) == "" {
+		http.Error(w, "Invalid request: front is required", http.StatusBadRequest)
+		return
+	}
+
+	mutateDeck(w, r, func(tx *gorm.DB, deck *models.FlashcardSet) error {
+		position := req.Position
+		if position == 0 {
+			position = len(deck.Cards) + 1
+		}
+		if position < 1 || position > len(deck.Cards)+1 {
+			return badEdit("position must be between 1 and %d", len(deck.Cards)+1)
+		}
+
+		front, back, tags := strings.TrimSpace(req.Front), strings.TrimSpace(req.Back), joinTags(req.Tags)
+		var added []models.Card
+		switch req.Type {
+		case "":
+			if back == "" {
+				return badEdit("back is required")
+			}
+			added = []models.Card{{Front: front, Back: back, Tags: tags}}
+		case clozeCard:
+			if problem := checkCloze(front); problem != "" {
+				return badEdit("%s", problem)
+			}
+			added = clozeCards(front, back, tags)
+		default:
+			return badEdit(`unknown card type %q, use "cloze" or leave it out`, req.Type)
+		}
+		for i := range added {
+			added[i].FlashcardSetID = deck.ID
+			added[i].Position = position - 1 + i
+		}
+		if err := tx.Create(&added).Error; err != nil {
+			return err
+		}
+		cards := append(deck.Cards[:position-1:position-1], added...)
+		return renumberCards(tx, append(cards, deck.Cards[position-1:]...))
+	})
+}
+
+// updateClozeNote applies updates to a cloze card and the other cards made
+// from the same text. A new text adds cards for new deletion numbers and
+// deletes those whose number is gone.
+func updateClozeNote(tx *gorm.DB, deck *models.FlashcardSet, card models.Card, updates map[string]interface{}) error {
+	text := card.Front
+	if front, ok := updates["front"].(string); ok {
+		if problem := checkCloze(front); problem != "" {
+			return badEdit("%s", problem)
+		}
+		text = front
+	}
+	numbers := map[int]bool{}
+	for _, n := range clozeNumbers(text) {
+		numbers[n] = true
+	}
+
+	var kept, stale []uint
+	have := map[int]bool{}
+	for _, sibling := range deck.Cards {
+		if sibling.Type != clozeCard || sibling.Front != card.Front {
+			continue
+		}
+		if numbers[sibling.Cloze] && !have[sibling.Cloze] {
+			have[sibling.Cloze] = true
+			kept = append(kept, sibling.ID)
+		} else {
+			stale = append(stale, sibling.ID)
+		}
+	}
+	if len(kept) > 0 {
+		if err := tx.Model(&models.Card{}).Where("id IN ?", kept).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	if err := deleteCards(tx, stale); err != nil {
+		return err
+	}
+
+	back, tags := card.Back, card.Tags
+	if v, ok := updates["back"].(string); ok {
+		back = v
+	}
+	if v, ok := updates["tags"].(string); ok {
+		tags = v
+	}
+	for _, added := range clozeCards(text, back, tags) {
+		if have[added.Cloze] {
+			continue
+		}
+		added.FlashcardSetID = deck.ID
+		added.Position = len(deck.Cards)
+		if err := tx.Create(&added).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateCard edits a card's sides or tags, or moves it within its deck.
+// Review progress is kept. Editing a cloze card edits every card of its text.
+func UpdateCard(w http.ResponseWriter, r *http.Request) {
+	var req UpdateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	mutateDeck(w, r, func(tx *gorm.DB, deck *models.FlashcardSet) error {
+		i, err := findCard(deck, mux.Vars(r)["cardId"])
+		if err != nil {
+			return err
+		}
+		card := deck.Cards[i]
+
+		updates := map[string]interface{}{}
+		for column, side := range map[string]*string{"front": req.Front, "back": req.Back} {
+			if side == nil {
+				continue
+			}
+			// A cloze card's back is an optional note
+			if strings.TrimSpace(*side) == "" && (column == "front" || card.Type != clozeCard) {
+				return badEdit("card %s cannot be empty", column)
+			}
+			updates[column] = strings.TrimSpace(*side)
+		}
+		if req.Tags != nil {
+			updates["tags"] = joinTags(*req.Tags)
+		}
+		if card.Type == clozeCard && len(updates) > 0 {
+			if err := updateClozeNote(tx, deck, card, updates); err != nil {
+				return err
+			}
+			// Cards may have come and gone, continue with the deck as it is now
+			if *deck, err = loadDeck(tx, deck.ID, deck.UserEmail); err != nil {
+				return err
+			}
+			if i, err = findCard(deck, mux.Vars(r)["cardId"]); err != nil {
+				return renumberCards(tx, deck.Cards)
+			}
+		} else if len(updates) > 0 {
+			if err := tx.Model(&card).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if req.Position == nil {
+			return renumberCards(tx, deck.Cards)
+		}
+		position := *req.Position
+		if position < 1 || position > len(deck.Cards) {
+			return badEdit("position must be between 1 and %d", len(deck.Cards))
+		}
+		card = deck.Cards[i]
+		rest := append(deck.Cards[:i:i], deck.Cards[i+1:]...)
+		cards := append(rest[:position-1:position-1], card)
+		return renumberCards(tx, append(cards, rest[position-1:]...))
+	})
+}
+
+// DeleteCard removes one card from a deck.
+func DeleteCard(w http.ResponseWriter, r *http.Request) {
+	mutateDeck(w, r, func(tx *gorm.DB, deck *models.FlashcardSet) error {
+		i, err := findCard(deck, mux.Vars(r)["cardId"])
+		if err != nil {
+			return err
+		}
+		if err := deleteCards(tx, []uint{deck.Cards[i].ID}); err != nil {
+			return err
+		}
+		return renumberCards(tx, append(deck.Cards[:i:i], deck.Cards[i+1:]...))
+	})
+}
+
+// MergeFlashcardSets moves the cards of several decks into the first one and
+// deletes the others. Cards the merged deck already has are dropped (their
+// tags are kept on the remaining copy) and listed in "duplicates".
+func MergeFlashcardSets(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req MergeDecksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.FlashcardSetIDs) < 2 {
+		http.Error(w, "Invalid request: at least two flashcard_set_ids are required", http.StatusBadRequest)
+		return
+	}
+
+	duplicates := []DuplicateCard{}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var decks []models.FlashcardSet
+		seen := map[uint]bool{}
+		for _, id := range req.FlashcardSetIDs {
+			if seen[id] {
+				return badEdit("flashcard set %d is listed twice", id)
+			}
+			seen[id] = true
+			deck, err := loadDeck(tx, id, userEmail)
+			if err != nil {
+				return err
+			}
+			decks = append(decks, deck)
+		}
+
+		target := decks[0]
+		kept := map[string]int{} // Card key to index in cards
+		var cards []models.Card
+		var dropped []uint
+		var tags []string
+		for _, deck := range decks {
+			tags = append(tags, deck.Tags)
+			for _, card := range deck.Cards {
+				key := cardKey(card.Front, card.Back, card.Cloze)
+				if i, ok := kept[key]; ok {
+					cards[i].Tags = joinTags(strings.Fields(cards[i].Tags + " " + card.Tags))
+					duplicates = append(duplicates, DuplicateCard{CardID: card.ID, Front: card.Front, DuplicateOf: cards[i].ID})
+					dropped = append(dropped, card.ID)
+					continue
+				}
+				kept[key] = len(cards)
+				cards = append(cards, card)
+			}
+		}
+
+		if err := deleteCards(tx, dropped); err != nil {
+			return err
+		}
+		for i, card := range cards {
+			err := tx.Model(&models.Card{}).Where("id = ?", card.ID).
+				Updates(map[string]interface{}{"flashcard_set_id": target.ID, "position": i, "tags": card.Tags}).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, deck := range decks[1:] {
+			if err := tx.Delete(&deck).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{"tags": joinTags(strings.Fields(strings.Join(tags, " ")))}
+		if title := strings.TrimSpace(req.Title); title != "" {
+			updates["title"] = title
+		}
+		return tx.Model(&target).Updates(updates).Error
+	})
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+
+	deck, err := loadDeck(db.DB, req.FlashcardSetIDs[0], userEmail)
+	if err != nil {
+		http.Error(w, "Failed to fetch flashcard set", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"flashcard_set": deck,
+		"duplicates":    duplicates,
+	})
+}
+
+// SplitFlashcardSet moves the cards of a deck into one new deck per tag. A
+// card tagged more than once goes to the first of its tags in the list;
+// untagged cards stay behind, and the deck is deleted if none do.
+func SplitFlashcardSet(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req SplitDeckRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ids []uint
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		deck, err := loadDeck(tx, mux.Vars(r)["id"], userEmail)
+		if err != nil {
+			return err
+		}
+		tags := strings.Fields(joinTags(req.Tags))
+		if len(tags) == 0 {
+			var all []string
+			for _, card := range deck.Cards {
+				all = append(all, strings.Fields(card.Tags)...)
+			}
+			tags = strings.Fields(joinTags(all))
+		}
+		if len(tags) == 0 {
+			return badEdit("the deck's cards have no tags to split by")
+		}
+
+		groups := make([][]models.Card, len(tags))
+		var rest []models.Card
+	cards:
+		for _, card := range deck.Cards {
+			for i, tag := range tags {
+				if hasTag(card.Tags, tag) {
+					groups[i] = append(groups[i], card)
+					continue cards
+				}
+			}
+			rest = append(rest, card)
+		}
+
+		for i, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			// Not linked to the document, so generation keeps adding to the original deck
+			split := models.FlashcardSet{
+				UserEmail: userEmail,
+				Title:     deck.Title + " - " + tags[i],
+				Tags:      joinTags(append(strings.Fields(deck.Tags), tags[i])),
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return err
+			}
+			for position, card := range group {
+				err := tx.Model(&models.Card{}).Where("id = ?", card.ID).
+					Updates(map[string]interface{}{"flashcard_set_id": split.ID, "position": position}).Error
+				if err != nil {
+					return err
+				}
+			}
+			ids = append(ids, split.ID)
+		}
+
+		if len(rest) == 0 {
+			return tx.Delete(&deck).Error
+		}
+		ids = append([]uint{deck.ID}, ids...)
+		return renumberCards(tx, rest)
+	})
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+
+	decks := []models.FlashcardSet{}
+	for _, id := range ids {
+		deck, err := loadDeck(db.DB, id, userEmail)
+		if err != nil {
+			http.Error(w, "Failed to fetch flashcard sets", http.StatusInternalServerError)
+			return
+		}
+		decks = append(decks, deck)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decks)
+}
+
+// GenerateMoreFlashcards starts a job adding new cards to a deck from the
+// document (or chapter) it was made from. The cards already in the deck are kept and the
+// model is asked not to repeat them; the job is returned right away.
+func GenerateMoreFlashcards(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var deck models.FlashcardSet
+	if err := db.DB.First(&deck, "id = ? AND user_email = ?", mux.Vars(r)["id"], userEmail).Error; err != nil {
+		http.Error(w, "Flashcard set not found", http.StatusNotFound)
+		return
+	}
+	if deck.DocumentID == nil {
+		http.Error(w, "This deck wasn't generated from a document", http.StatusBadRequest)
+		return
+	}
+	var doc models.Document
+	if err := db.DB.First(&doc, "id = ? AND user_email = ?", *deck.DocumentID, userEmail).Error; err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	chunks := documentChunks(doc)
+	if deck.Chapter > 0 {
+		c, err := findChapter(doc, deck.Chapter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		chunks = c.chunks()
+	}
+
+	job := models.Job{UserEmail: userEmail, Kind: moreFlashcardJob, Title: deck.Title, DocumentID: doc.ID, Chapter: deck.Chapter, ResultID: &deck.ID}
+	if err := jobManager.Submit(&job, chunks); err != nil {
+		http.Error(w, "Failed to start generation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job.Chunks = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// maxAvoidCards caps how many existing cards are listed in the prompt.
+const maxAvoidCards = 100
+
+// moreFlashcardKind generates cards for a deck that has some already, and
+// appends those it doesn't have.
+var moreFlashcardKind = jobs.Kind{
+	Chunk: func(ctx context.Context, job *models.Job, chunk models.JobChunk) (string, int, error) {
+		var fronts []string
+		if err := db.DB.Model(&models.Card{}).Where("flashcard_set_id = ?", *job.ResultID).
+			Order("position ASC").Limit(maxAvoidCards).Pluck("front", &fronts).Error; err != nil {
+			return "", 0, err
+		}
+		var generated FlashcardResponse
+		if err := completeJSON(ctx, flashcardPrompt(chunk.Text, fronts), &generated); err != nil {
+			return "", 0, err
+		}
+		output, err := json.Marshal(generated)
+		return string(output), len(generated.Flashcards), err
+	},
+	Finish: func(job *models.Job, outputs []string) (uint, error) {
+		deck, err := loadDeck(db.DB, *job.ResultID, job.UserEmail)
+		if err != nil {
+			return 0, err
+		}
+		seen := map[string]bool{}
+		for _, card := range deck.Cards {
+			seen[cardKey(card.Front, card.Back, card.Cloze)] = true
+		}
+
+		var cards []models.Card
+		for _, output := range outputs {
+			var generated FlashcardResponse
+			if err := json.Unmarshal([]byte(output), &generated); err != nil {
+				return 0, err
+			}
+			for _, fc := range generated.Flashcards {
+				if key := cardKey(fc.Front, fc.Back, 0); !seen[key] {
+					seen[key] = true
+					cards = append(cards, models.Card{Position: len(deck.Cards) + len(cards), Front: fc.Front, Back: fc.Back})
+				}
+			}
+		}
+		if len(cards) == 0 {
+			return deck.ID, nil
+		}
+		return deck.ID, db.DB.Model(&deck).Association("Cards").Append(cards)
+	},
+}
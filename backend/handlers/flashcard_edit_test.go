@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+)
+
+// onDeck sends body to handler as a request on the deck (and card) in vars.
+func onDeck(t *testing.T, handler http.HandlerFunc, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	r := request(t, body)
+	if body == nil {
+		r = get(t, "/flashcard-sets/"+vars["id"])
+	}
+	return serve(handler, mux.SetURLVars(r, vars))
+}
+
+func fronts(deck models.FlashcardSet) string {
+	var out []string
+	for i, card := range deck.Cards {
+		if card.Position != i {
+			return "misnumbered"
+		}
+		out = append(out, card.Front)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestJoinTags(t *testing.T) {
+	if got := joinTags([]string{" cell  biology ", "ATP", "atp", "", "cell_biology"}); got != "cell_biology ATP" {
+		t.Errorf("got %q", got)
+	}
+	if !hasTag("cell_biology ATP", "atp") || hasTag("cell_biology", "cell") {
+		t.Error("hasTag")
+	}
+	if cardKey("What is ATP?", "Energy!", 0) != cardKey("what is  atp", "energy", 0) {
+		t.Error("cardKey minds case and punctuation")
+	}
+}
+
+func TestEditCards(t *testing.T) {
+	setupHandlers(t)
+	deck := createDeck(t, testUser, "a", "b", "c")
+	id := itoa(deck.ID)
+	db.DB.Create(&models.CardReview{UserEmail: testUser, CardID: deck.Cards[1].ID, IntervalDays: 6})
+
+	var got models.FlashcardSet
+	decode(t, onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Front: " x ", Back: "y", Tags: []string{"new tag"}, Position: 2}), &got)
+	if fronts(got) != "a,x,b,c" || got.Cards[1].Tags != "new_tag" {
+		t.Fatalf("added: %+v", got.Cards)
+	}
+	decode(t, onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Front: "z", Back: "z"}), &got)
+	if fronts(got) != "a,x,b,c,z" {
+		t.Errorf("appended: %s", fronts(got))
+	}
+
+	// Moving and editing a card keeps its review
+	b := itoa(deck.Cards[1].ID)
+	front, position := "b2", 5
+	decode(t, onDeck(t, UpdateCard, map[string]string{"id": id, "cardId": b}, UpdateCardRequest{Front: &front, Position: &position}), &got)
+	if fronts(got) != "a,x,c,z,b2" {
+		t.Errorf("moved: %s", fronts(got))
+	}
+	var reviews int64
+	db.DB.Model(&models.CardReview{}).Where("card_id = ?", deck.Cards[1].ID).Count(&reviews)
+	if reviews != 1 {
+		t.Error("editing the card lost its review")
+	}
+
+	// Deleting it takes the review with it
+	decode(t, onDeck(t, DeleteCard, map[string]string{"id": id, "cardId": b}, map[string]string{}), &got)
+	db.DB.Model(&models.CardReview{}).Count(&reviews)
+	if fronts(got) != "a,x,c,z" || reviews != 0 {
+		t.Errorf("deleted: %s, %d reviews", fronts(got), reviews)
+	}
+
+	title, tags := " Cell biology ", []string{"bio", "Bio"}
+	decode(t, onDeck(t, UpdateFlashcardSet, map[string]string{"id": id}, UpdateDeckRequest{Title: &title, Tags: &tags}), &got)
+	if got.Title != "Cell biology" || got.Tags != "bio" {
+		t.Errorf("deck %q tagged %q", got.Title, got.Tags)
+	}
+
+	// Only the cards with the tag
+	r := get(t, "/flashcard-sets/"+id+"?tag=NEW_TAG")
+	decode(t, serve(GetFlashcardSet, mux.SetURLVars(r, map[string]string{"id": id})), &got)
+	if len(got.Cards) != 1 || got.Cards[0].Front != "x" {
+		t.Errorf("tagged: %+v", got.Cards)
+	}
+
+	empty, zero := " ", 0
+	theirs := models.FlashcardSet{UserEmail: "someone@example.com", Cards: []models.Card{{Front: "q", Back: "a"}}}
+	db.DB.Create(&theirs)
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"empty title":  onDeck(t, UpdateFlashcardSet, map[string]string{"id": id}, UpdateDeckRequest{Title: &empty}),
+		"empty back":   onDeck(t, UpdateCard, map[string]string{"id": id, "cardId": itoa(deck.Cards[0].ID)}, UpdateCardRequest{Back: &empty}),
+		"bad position": onDeck(t, UpdateCard, map[string]string{"id": id, "cardId": itoa(deck.Cards[0].ID)}, UpdateCardRequest{Position: &zero}),
+		"far position": onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Front: "q", Back: "a", Position: 9}),
+		"no back":      onDeck(t, AddCard, map[string]string{"id": id}, AddCardRequest{Front: "q"}),
+		"other's card": onDeck(t, DeleteCard, map[string]string{"id": id, "cardId": itoa(theirs.Cards[0].ID)}, map[string]string{}),
+		"other's deck": onDeck(t, DeleteCard, map[string]string{"id": itoa(theirs.ID), "cardId": itoa(theirs.Cards[0].ID)}, map[string]string{}),
+		"missing deck": onDeck(t, GetFlashcardSet, map[string]string{"id": "99"}, nil),
+	} {
+		want := http.StatusBadRequest
+		if name == "other's deck" || name == "missing deck" {
+			want = http.StatusNotFound
+		}
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", name, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestMergeFlashcardSets(t *testing.T) {
+	setupHandlers(t)
+	first := createDeck(t, testUser, "ATP", "DNA")
+	second := createDeck(t, testUser, "RNA", "atp")
+	third := createDeck(t, testUser, "Ribosome")
+	db.DB.Model(&second.Cards[1]).Update("tags", "energy")
+
+	var got struct {
+		Deck       models.FlashcardSet `json:"flashcard_set"`
+		Duplicates []DuplicateCard     `json:"duplicates"`
+	}
+	decode(t, post(t, MergeFlashcardSets, MergeDecksRequest{FlashcardSetIDs: []uint{first.ID, second.ID, third.ID}, Title: "All cells"}), &got)
+	if got.Deck.ID != first.ID || got.Deck.Title != "All cells" || fronts(got.Deck) != "ATP,DNA,RNA,Ribosome" {
+		t.Fatalf("merged %+v", got.Deck)
+	}
+	// The duplicate is dropped, and its tags kept on the copy that stays
+	if len(got.Duplicates) != 1 || got.Duplicates[0].CardID != second.Cards[1].ID || got.Duplicates[0].DuplicateOf != first.Cards[0].ID || got.Deck.Cards[0].Tags != "energy" {
+		t.Errorf("duplicates %+v, tags %q", got.Duplicates, got.Deck.Cards[0].Tags)
+	}
+	var decks int64
+	db.DB.Model(&models.FlashcardSet{}).Count(&decks)
+	if decks != 1 {
+		t.Errorf("%d decks left", decks)
+	}
+
+	if w := post(t, MergeFlashcardSets, MergeDecksRequest{FlashcardSetIDs: []uint{first.ID}}); w.Code != http.StatusBadRequest {
+		t.Errorf("one deck: status %d", w.Code)
+	}
+	if w := post(t, MergeFlashcardSets, MergeDecksRequest{FlashcardSetIDs: []uint{first.ID, first.ID}}); w.Code != http.StatusBadRequest {
+		t.Errorf("same deck twice: status %d", w.Code)
+	}
+	if w := post(t, MergeFlashcardSets, MergeDecksRequest{FlashcardSetIDs: []uint{first.ID, second.ID}}); w.Code != http.StatusNotFound {
+		t.Errorf("merged deck: status %d", w.Code)
+	}
+}
+
+func TestSplitFlashcardSet(t *testing.T) {
+	setupHandlers(t)
+	deck := createDeck(t, testUser, "ATP", "DNA", "RNA", "Wall")
+	for i, tags := range []string{"energy", "genes", "genes energy", ""} {
+		db.DB.Model(&deck.Cards[i]).Update("tags", tags)
+	}
+	doc, _ := saveDocument(testUser, "Cells make energy.", models.Document{FileName: "cells.pdf"})
+	db.DB.Model(&deck).Update("document_id", doc.ID)
+	id := itoa(deck.ID)
+
+	// Untagged cards stay behind
+	var decks []models.FlashcardSet
+	decode(t, onDeck(t, SplitFlashcardSet, map[string]string{"id": id}, SplitDeckRequest{Tags: []string{"genes"}}), &decks)
+	if len(decks) != 2 || fronts(decks[0]) != "ATP,Wall" || decks[1].Title != "Deck - genes" || fronts(decks[1]) != "DNA,RNA" || decks[1].Tags != "genes" {
+		t.Fatalf("split %+v", decks)
+	}
+	// Only the original deck stays linked to the document
+	if decks[0].DocumentID == nil || decks[1].DocumentID != nil {
+		t.Errorf("linked to %v and %v", decks[0].DocumentID, decks[1].DocumentID)
+	}
+
+	// With nothing left, the deck goes
+	db.DB.Model(&models.Card{}).Where("front = ?", "Wall").Update("tags", "plants")
+	decode(t, onDeck(t, SplitFlashcardSet, map[string]string{"id": id}, map[string]string{}), &decks)
+	if len(decks) != 2 || fronts(decks[0]) != "ATP" || fronts(decks[1]) != "Wall" {
+		t.Errorf("split by every tag %+v", decks)
+	}
+	if w := onDeck(t, GetFlashcardSet, map[string]string{"id": id}, nil); w.Code != http.StatusNotFound {
+		t.Errorf("emptied deck: status %d", w.Code)
+	}
+
+	untagged := createDeck(t, testUser, "a")
+	if w := onDeck(t, SplitFlashcardSet, map[string]string{"id": itoa(untagged.ID)}, map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("no tags: status %d", w.Code)
+	}
+}
+
+func TestGenerateMoreFlashcards(t *testing.T) {
+	// One card is new, the other the deck already has
+	provider := setupHandlers(t, `{"flashcards": [{"front": "What do plants make?", "back": "glucose!"}, {"front": "What do roots take up?", "back": "Water"}]}`)
+	doc := models.Document{UserEmail: testUser, ContentHash: "plants", FileName: "plants.pdf", Text: "Plants make glucose. Roots take up water."}
+	db.DB.Create(&doc)
+	deck := models.FlashcardSet{UserEmail: testUser, Title: "Plants", DocumentID: &doc.ID, Cards: []models.Card{{Front: "What do plants make?", Back: "Glucose"}}}
+	db.DB.Create(&deck)
+
+	w := onDeck(t, GenerateMoreFlashcards, map[string]string{"id": itoa(deck.ID)}, map[string]string{})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var job models.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	for deadline := time.Now().Add(5 * time.Second); job.Status != models.JobSucceeded; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %+v", job)
+		}
+		db.DB.First(&job, job.ID)
+	}
+	if *job.ResultID != deck.ID || !strings.Contains(provider.Calls()[0][0].Content, "- What do plants make?") {
+		t.Errorf("job %+v", job)
+	}
+	got, _ := loadDeck(db.DB, deck.ID, testUser)
+	if fronts(got) != "What do plants make?,What do roots take up?" {
+		t.Errorf("cards %s", fronts(got))
+	}
+
+	notFromDocument := createDeck(t, testUser, "a")
+	if w := onDeck(t, GenerateMoreFlashcards, map[string]string{"id": itoa(notFromDocument.ID)}, map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("no document: status %d", w.Code)
+	}
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tutor_genX/anki"
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/srs"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Columns of exported CSV/TSV decks. Imports only need front and back.
+// cloze is the deletion number of a cloze card, whose front is the cloze text.
+var deckColumns = []string{"front", "back", "tags", "id", "due", "interval", "ease", "repetitions", "lapses", "cloze"}
+
+const unknownDeckFormat = "Unknown format: use apkg, csv or tsv"
+
+// exportGUID is the note GUID of a card made here, stable so that exporting
+// the deck again updates the notes already in Anki instead of duplicating them.
+func exportGUID(card models.Card) string {
+	if card.GUID != "" {
+		return card.GUID
+	}
+	return fmt.Sprintf("tgx%d", card.ID)
+}
+
+// writeDeckText writes cards as CSV or, with a tab separator, as a TSV file
+// with the header lines Anki's text import reads.
+func writeDeckText(cards []models.Card, reviews map[uint]models.CardReview, separator rune) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = separator
+	if separator == '\t' {
+		buf.WriteString("#separator:tab\n#html:false\n#tags column:3\n")
+		buf.WriteString("#columns:" + strings.Join(deckColumns, "\t") + "\n")
+	} else {
+		w.Write(deckColumns)
+	}
+	for _, card := range cards {
+		id := card.ExternalID
+		if id == "" {
+			id = strconv.FormatUint(uint64(card.ID), 10)
+		}
+		record := []string{card.Front, card.Back, card.Tags, id, "", "", "", "", "", ""}
+		if card.Type == clozeCard {
+			record[9] = strconv.Itoa(card.Cloze)
+		}
+		if review, ok := reviews[card.ID]; ok {
+			record[4] = review.DueAt.UTC().Format(time.RFC3339)
+			record[5] = strconv.Itoa(review.IntervalDays)
+			record[6] = strconv.FormatFloat(review.EaseFactor, 'f', -1, 64)
+			record[7] = strconv.Itoa(review.Repetitions)
+			record[8] = strconv.Itoa(review.Lapses)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseDeckText reads cards from CSV or TSV. A header row (or Anki's
+// "#columns:" line) names the columns; without one they are front, back and
+// tags. Review columns, when filled in, become the card's schedule.
+func parseDeckText(data []byte, separator rune) ([]anki.Card, []string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	columns := []string{"front", "back", "tags"}
+	header, tagsColumn := false, 0
+	// Anki's text exports start with #key:value lines
+	for bytes.HasPrefix(data, []byte("#")) {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		data = rest
+		key, value, _ := strings.Cut(strings.TrimSpace(string(line[1:])), ":")
+		switch strings.ToLower(key) {
+		case "separator":
+			switch strings.ToLower(value) {
+			case "tab":
+				separator = '\t'
+			case "comma":
+				separator = ','
+			case "semicolon":
+				separator = ';'
+			case "pipe":
+				separator = '|'
+			case "space":
+				separator = ' '
+			default:
+				if len(value) == 1 {
+					separator = rune(value[0])
+				}
+			}
+		case "columns":
+			columns = strings.Split(value, string(separator))
+			header = true
+		case "tags column":
+			tagsColumn, _ = strconv.Atoi(value)
+		}
+	}
+	if !header && tagsColumn > 3 {
+		columns = make([]string, tagsColumn)
+		columns[0], columns[1], columns[tagsColumn-1] = "front", "back", "tags"
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = separator
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	first := 1
+	if !header && len(rows) > 0 {
+		names := map[string]bool{}
+		for _, name := range rows[0] {
+			names[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+		if names["front"] && names["back"] {
+			columns = rows[0]
+			first = 2
+			rows = rows[1:]
+		}
+	}
+	index := map[string]int{}
+	for i, name := range columns {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	var cards []anki.Card
+	var skipped []string
+	for n, record := range rows {
+		get := func(column string) string {
+			if i, ok := index[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		card := anki.Card{Front: get("front"), Back: get("back"), Tags: strings.Fields(get("tags")), GUID: get("guid")}
+		card.Cloze, _ = strconv.Atoi(get("cloze"))
+		if card.Front == "" || (card.Back == "" && card.Cloze == 0 && checkCloze(card.Front) != "") {
+			skipped = append(skipped, fmt.Sprintf("row %d: needs both a front and a back", n+first))
+			continue
+		}
+		card.ID, _ = strconv.ParseInt(get("id"), 10, 64)
+		if due, err := time.Parse(time.RFC3339, get("due")); err == nil {
+			s := &anki.Schedule{Due: due}
+			s.Interval, _ = strconv.Atoi(get("interval"))
+			s.Ease, _ = strconv.ParseFloat(get("ease"), 64)
+			s.Repetitions, _ = strconv.Atoi(get("repetitions"))
+			s.Lapses, _ = strconv.Atoi(get("lapses"))
+			card.Schedule = s
+		}
+		cards = append(cards, card)
+	}
+	return cards, skipped, nil
+}
+
+// importedCards makes the cards of an imported one. A cloze text without a
+// deletion number, as CSV files have it, becomes one card per deletion.
+func importedCards(c anki.Card) []models.Card {
+	front, back, tags := strings.TrimSpace(c.Front), strings.TrimSpace(c.Back), strings.Join(c.Tags, " ")
+	var cards []models.Card
+	switch {
+	case front == "":
+		return nil
+	case c.Cloze > 0:
+		cards = []models.Card{{Type: clozeCard, Cloze: c.Cloze, Front: front, Back: back, Tags: tags}}
+	case checkCloze(front) == "":
+		cards = clozeCards(front, back, tags)
+	case back != "":
+		cards = []models.Card{{Front: front, Back: back, Tags: tags}}
+	}
+	for i := range cards {
+		cards[i].GUID = c.GUID
+		if c.ID != 0 && len(cards) == 1 {
+			cards[i].ExternalID = strconv.FormatInt(c.ID, 10)
+		}
+	}
+	return cards
+}
+
+// ExportFlashcards downloads a deck (?flashcard_set_id=) as an Anki package
+// or as CSV or TSV (?format=apkg|csv|tsv), with the user's review state.
+func ExportFlashcards(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	query := r.URL.Query()
+	format := strings.ToLower(query.Get("format"))
+	if format != "apkg" && format != "csv" && format != "tsv" {
+		http.Error(w, unknownDeckFormat, http.StatusBadRequest)
+		return
+	}
+
+	var flashcardSet models.FlashcardSet
+	if err := db.DB.Preload("Cards", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).First(&flashcardSet, "id = ? AND user_email = ?", query.Get("flashcard_set_id"), userEmail).Error; err != nil {
+		http.Error(w, "Flashcard set not found", http.StatusNotFound)
+		return
+	}
+	if len(flashcardSet.Cards) == 0 {
+		http.Error(w, "Flashcard set has no cards to export", http.StatusBadRequest)
+		return
+	}
+
+	cardIDs := make([]uint, 0, len(flashcardSet.Cards))
+	for _, card := range flashcardSet.Cards {
+		cardIDs = append(cardIDs, card.ID)
+	}
+	var stored []models.CardReview
+	if err := db.DB.Where("user_email = ? AND card_id IN ?", userEmail, cardIDs).Find(&stored).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	reviews := make(map[uint]models.CardReview, len(stored))
+	for _, review := range stored {
+		reviews[review.CardID] = review
+	}
+
+	title := flashcardSet.Title
+	if title == "" {
+		title = "Flashcards"
+	}
+	var data []byte
+	var err error
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "apkg":
+		deck := anki.Deck{Name: title}
+		clozeGUIDs := map[string]string{} // The cards of a cloze text make one note
+		for _, card := range flashcardSet.Cards {
+			c := anki.Card{Front: card.Front, Back: card.Back, Tags: strings.Fields(card.Tags), GUID: exportGUID(card)}
+			if card.Type == clozeCard {
+				c.Cloze = card.Cloze
+				if guid, ok := clozeGUIDs[card.Front]; ok {
+					c.GUID = guid
+				}
+				clozeGUIDs[card.Front] = c.GUID
+			}
+			c.ID, _ = strconv.ParseInt(card.ExternalID, 10, 64)
+			if review, ok := reviews[card.ID]; ok {
+				c.Schedule = &anki.Schedule{
+					Ease:        review.EaseFactor,
+					Interval:    review.IntervalDays,
+					Repetitions: review.Repetitions,
+					Lapses:      review.Lapses,
+					Due:         review.DueAt,
+				}
+			}
+			deck.Cards = append(deck.Cards, c)
+		}
+		data, err = anki.Write(deck, time.Now())
+		contentType = "application/octet-stream"
+	case "csv":
+		data, err = writeDeckText(flashcardSet.Cards, reviews, ',')
+	case "tsv":
+		data, err = writeDeckText(flashcardSet.Cards, reviews, '\t')
+		contentType = "text/tab-separated-values; charset=utf-8"
+	}
+	if err != nil {
+		http.Error(w, "Failed to export flashcards: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fileName := strings.Trim(unsafeName.ReplaceAllString(title, "_"), "_")
+	if fileName == "" {
+		fileName = "flashcards"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+"."+format))
+	w.Write(data)
+}
+
+// ImportFlashcards saves the decks of an uploaded Anki package, CSV or TSV
+// file (form field "file") as new flashcard sets, one per deck. Card IDs,
+// tags and review state come along where the file has them.
+func ImportFlashcards(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	if err := r.ParseMultipartForm(50 << 20); err != nil { // 50 MB max, packages can be big
+		http.Error(w, "Error parsing form: file too large or invalid", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error retrieving file: ensure file field is named 'file'", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".apkg", ".colpkg":
+			format = "apkg"
+		case ".csv":
+			format = "csv"
+		case ".tsv", ".txt":
+			format = "tsv"
+		}
+	}
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+
+	var decks []anki.Deck
+	skipped := []string{}
+	switch format {
+	case "apkg":
+		decks, err = anki.Read(data)
+	case "csv", "tsv":
+		separator := ','
+		if format == "tsv" {
+			separator = '\t'
+		}
+		var cards []anki.Card
+		var problems []string
+		cards, problems, err = parseDeckText(data, separator)
+		skipped = append(skipped, problems...)
+		decks = []anki.Deck{{Name: title, Cards: cards}}
+	default:
+		http.Error(w, unknownDeckFormat, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type importedSet struct {
+		ID    uint   `json:"flashcard_set_id"`
+		Title string `json:"title"`
+		Cards int    `json:"cards"`
+	}
+	imported := []importedSet{}
+	total := 0
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, deck := range decks {
+			flashcardSet := models.FlashcardSet{UserEmail: userEmail, Title: deck.Name}
+			// A single deck takes the title given with the upload
+			if len(decks) == 1 {
+				flashcardSet.Title = title
+			}
+			var schedules []*anki.Schedule
+			for _, c := range deck.Cards {
+				cards := importedCards(c)
+				if len(cards) == 0 {
+					skipped = append(skipped, fmt.Sprintf("%s: a card needs both a front and a back", deck.Name))
+					continue
+				}
+				for _, card := range cards {
+					card.Position = len(flashcardSet.Cards)
+					flashcardSet.Cards = append(flashcardSet.Cards, card)
+					if len(cards) == 1 {
+						schedules = append(schedules, c.Schedule)
+					} else {
+						schedules = append(schedules, nil)
+					}
+				}
+			}
+			if len(flashcardSet.Cards) == 0 {
+				continue
+			}
+			if err := tx.Create(&flashcardSet).Error; err != nil {
+				return err
+			}
+
+			var reviews []models.CardReview
+			for i, s := range schedules {
+				if s == nil {
+					continue
+				}
+				ease := s.Ease
+				if ease == 0 {
+					ease = srs.DefaultEase
+				}
+				reviews = append(reviews, models.CardReview{
+					UserEmail:    userEmail,
+					CardID:       flashcardSet.Cards[i].ID,
+					EaseFactor:   ease,
+					IntervalDays: s.Interval,
+					Repetitions:  s.Repetitions,
+					Lapses:       s.Lapses,
+					DueAt:        s.Due,
+				})
+			}
+			if len(reviews) > 0 {
+				if err := tx.Create(&reviews).Error; err != nil {
+					return err
+				}
+			}
+			imported = append(imported, importedSet{flashcardSet.ID, flashcardSet.Title, len(flashcardSet.Cards)})
+			total += len(flashcardSet.Cards)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to save flashcards", http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "No usable cards found", "skipped": skipped})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"flashcard_sets": imported,
+		"imported":       total,
+		"skipped":        skipped,
+		"format":         format,
+	})
+}
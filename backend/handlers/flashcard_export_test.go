@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+// importDeck uploads data as a flashcard file, with the given title.
+func importDeck(t *testing.T, name string, data []byte, title string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if title != "" {
+		form.WriteField("title", title)
+	}
+	part, _ := form.CreateFormFile("file", name)
+	part.Write(data)
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/flashcard-import", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	return serve(ImportFlashcards, r)
+}
+
+type importedDecks struct {
+	Sets []struct {
+		ID    uint   `json:"flashcard_set_id"`
+		Title string `json:"title"`
+		Cards int    `json:"cards"`
+	} `json:"flashcard_sets"`
+	Imported int      `json:"imported"`
+	Skipped  []string `json:"skipped"`
+	Format   string   `json:"format"`
+}
+
+func TestExportImportFlashcards(t *testing.T) {
+	setupHandlers(t)
+	deck := models.FlashcardSet{UserEmail: testUser, Title: "Plants & light", Cards: []models.Card{
+		{Position: 0, Front: "What do plants make?", Back: "Glucose", Tags: "biology leaves"},
+		{Position: 1, Front: "From what?", Back: "Light, water\nand CO2"},
+	}}
+	db.DB.Create(&deck)
+	due := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	db.DB.Create(&models.CardReview{UserEmail: testUser, CardID: deck.Cards[0].ID, EaseFactor: 2.3, IntervalDays: 6, Repetitions: 2, Lapses: 1, DueAt: due})
+
+	for _, format := range []string{"apkg", "csv", "tsv"} {
+		t.Run(format, func(t *testing.T) {
+			w := serve(ExportFlashcards, get(t, "/flashcard-export?format="+format+"&flashcard_set_id="+itoa(deck.ID)))
+			if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="Plants_light.`+format+`"` {
+				t.Fatalf("status %d, headers %v", w.Code, w.Header())
+			}
+
+			var got importedDecks
+			decodeStatus(t, importDeck(t, "plants."+format, w.Body.Bytes(), "Copy"), &got)
+			if got.Imported != 2 || len(got.Sets) != 1 || got.Sets[0].Title != "Copy" || got.Format != format {
+				t.Fatalf("imported %+v", got)
+			}
+			var cards []models.Card
+			db.DB.Where("flashcard_set_id = ?", got.Sets[0].ID).Order("position").Find(&cards)
+			if len(cards) != 2 || cards[0].Tags != "biology leaves" || cards[1].Back != "Light, water\nand CO2" {
+				t.Fatalf("cards %+v", cards)
+			}
+
+			// The review state comes back with the card, the unreviewed card has none
+			var reviews []models.CardReview
+			db.DB.Where("card_id IN ?", []uint{cards[0].ID, cards[1].ID}).Find(&reviews)
+			if len(reviews) != 1 || reviews[0].CardID != cards[0].ID || reviews[0].IntervalDays != 6 || reviews[0].Lapses != 1 || !reviews[0].DueAt.Equal(due) {
+				t.Errorf("reviews %+v", reviews)
+			}
+		})
+	}
+}
+
+func TestImportFlashcardsErrors(t *testing.T) {
+	setupHandlers(t)
+	theirs := models.FlashcardSet{UserEmail: "someone@example.com", Title: "Theirs", Cards: []models.Card{{Front: "a", Back: "b"}}}
+	db.DB.Create(&theirs)
+	for target, code := range map[string]int{
+		"/flashcard-export?format=apkg&flashcard_set_id=" + itoa(theirs.ID): http.StatusNotFound,
+		"/flashcard-export?format=pdf&flashcard_set_id=" + itoa(theirs.ID):  http.StatusBadRequest,
+	} {
+		if w := serve(ExportFlashcards, get(t, target)); w.Code != code {
+			t.Errorf("%s: status %d, want %d", target, w.Code, code)
+		}
+	}
+
+	// Cards without a back are skipped
+	var got importedDecks
+	decodeStatus(t, importDeck(t, "plants.csv", []byte("front,back\nLeaf,Makes glucose\nRoot,\n"), ""), &got)
+	if got.Imported != 1 || len(got.Skipped) != 1 || got.Sets[0].Title != "plants" {
+		t.Errorf("imported %+v", got)
+	}
+	if w := importDeck(t, "empty.csv", []byte("front,back\nRoot,\n"), ""); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "No usable cards") {
+		t.Errorf("no cards: status %d: %s", w.Code, w.Body)
+	}
+	if w := importDeck(t, "broken.apkg", []byte("not a zip"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("broken package: status %d", w.Code)
+	}
+	if w := importDeck(t, "plants.pdf", []byte("%PDF"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/jobs"
+	"tutor_genX/llm"
+	"tutor_genX/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testUser = "learner@example.com"
+
+// setupHandlers points the handlers at a new SQLite database, a jobs manager
+// and a fake provider giving responses, and returns the provider.
+func setupHandlers(t *testing.T, responses ...string) *llm.FakeProvider {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test secret")
+
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	db.DB = database
+
+	provider := &llm.FakeProvider{Responses: responses}
+	UseLLM(provider, nil)
+	manager := jobs.NewManager(jobs.Config{Workers: 2, PerUser: 2})
+	UseJobs(manager)
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		UseLLM(nil, nil)
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return provider
+}
+
+// testToken signs a token for testUser.
+func testToken(t *testing.T) string {
+	t.Helper()
+	token, err := utils.CreateToken(testUser, "Learner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// request builds a POST of body as JSON, signed in as testUser.
+func request(t *testing.T, body interface{}) *http.Request {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	return r
+}
+
+// serve runs handler behind ValidateToken, as the router does.
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	utils.ValidateToken(handler).ServeHTTP(w, r)
+	return w
+}
+
+// post sends body as JSON to handler, signed in as testUser.
+func post(t *testing.T, handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(handler, request(t, body))
+}
+
+// decode reads a JSON response into out, failing unless the status is 200.
+func decode(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+}
+
+func TestHandlersNeedToken(t *testing.T) {
+	setupHandlers(t)
+	for name, handler := range map[string]http.HandlerFunc{
+		"roadmap":     HandleRoadmap,
+		"explain":     ExplainTopicHandler,
+		"quizfrompdf": GenerateQuizFromPdf,
+		"flashcards":  GenerateFlashcards,
+		"jobs":        SubmitJob,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{}`)))
+		if w := serve(handler, r); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without a token: status %d", name, w.Code)
+		}
+	}
+}
+
+// decodeEvent reads the "data: " line of a server-sent event into out.
+func decodeEvent(t *testing.T, data string, out interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), out); err != nil {
+		t.Fatalf("decoding %q: %v", data, err)
+	}
+}
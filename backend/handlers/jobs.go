@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/jobs"
+	"tutor_genX/models"
+	"tutor_genX/segment"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Kinds of generation job
+const (
+	flashcardJob = "flashcards"
+	quizJob      = "quiz"
+)
+
+var errInsufficientContent = errors.New("insufficient content for generation")
+
+// jobManager runs generation jobs. It is injected from main with UseJobs.
+var jobManager *jobs.Manager
+
+// UseJobs registers the generation job kinds on m and makes the handlers use it.
+func UseJobs(m *jobs.Manager) {
+	m.Register(flashcardJob, flashcardKind)
+	m.Register(quizJob, quizKind)
+	m.Register(moreFlashcardJob, moreFlashcardKind)
+	m.Register(clozeFlashcardJob, clozeFlashcardKind)
+	jobManager = m
+}
+
+// chunking sizes the chunks of a document sent to the LLM. It is injected
+// from main with UseChunking to fit the configured model.
+var chunking segment.Options
+
+func UseChunking(opts segment.Options) {
+	chunking = opts
+}
+
+// documentChunks splits a document into prompt sized chunks, following its
+// pages and outline when it has them.
+func documentChunks(doc models.Document) []string {
+	pages, outline := documentSource(doc)
+	if len(pages) > 0 {
+		return chunkTexts(segment.Split(segment.Sections(pages, outlineHeadings(outline)), chunking))
+	}
+	return chunkTexts(segment.SplitText(doc.Text, chunking))
+}
+
+func chunkTexts(chunks []segment.Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+type GenerationRequest struct {
+	Kind       string `json:"kind"` // "flashcards", "cloze_flashcards" or "quiz"
+	PDFtext    string `json:"pdftext"`
+	DocumentID uint   `json:"document_id,omitempty"` // Instead of pdftext, a document already uploaded
+	FileName   string `json:"fileName,omitempty"`
+	Chapter    int    `json:"chapter,omitempty"` // Only this chapter of the document, see GetDocumentChapters
+}
+
+// generationDocument resolves the document a request refers to, storing the
+// text as a new document when it has not been seen before.
+func generationDocument(userEmail string, req GenerationRequest) (models.Document, error) {
+	if req.DocumentID != 0 {
+		var doc models.Document
+		err := db.DB.First(&doc, "id = ? AND user_email = ?", req.DocumentID, userEmail).Error
+		return doc, err
+	}
+	return saveDocument(userEmail, req.PDFtext, models.Document{FileName: req.FileName})
+}
+
+// jobDocument is the document what a job makes links to: none if it was
+// given plain text, or if its document was deleted while it ran.
+func jobDocument(job *models.Job) *uint {
+	if job.DocumentID == 0 {
+		return nil
+	}
+	return &job.DocumentID
+}
+
+// startGeneration submits a job for req. If the result is already cached the
+// job is stored as finished straight away.
+func startGeneration(userEmail string, req GenerationRequest) (models.Job, error) {
+	var job models.Job
+	if req.Kind != flashcardJob && req.Kind != clozeFlashcardJob && req.Kind != quizJob {
+		return job, fmt.Errorf("%w: %q", jobs.ErrUnknownKind, req.Kind)
+	}
+	doc, err := generationDocument(userEmail, req)
+	if err != nil {
+		return job, err
+	}
+	var c chapter
+	if req.Chapter != 0 {
+		if c, err = findChapter(doc, req.Chapter); err != nil {
+			return job, err
+		}
+	}
+
+	title := req.FileName
+	if title == "" {
+		title = doc.FileName
+	}
+	if title == "" {
+		// AI Title Generation Logic would be here
+		title = truncate(doc.Text, 50)
+	}
+	if c.Number > 0 {
+		title += " - " + c.Title
+	}
+	job = models.Job{UserEmail: userEmail, Kind: req.Kind, Title: title, DocumentID: doc.ID, Chapter: c.Number}
+
+	var resultID uint
+	var cached bool
+	switch req.Kind {
+	case flashcardJob, clozeFlashcardJob:
+		cardType := ""
+		if req.Kind == clozeFlashcardJob {
+			cardType = clozeCard
+		}
+		var set models.FlashcardSet
+		set, cached, err = cachedFlashcardSet(userEmail, doc.ID, c.Number, cardType)
+		resultID = set.ID
+	default:
+		var set models.QuizSet
+		set, cached, err = cachedQuizSet(userEmail, doc.ID, c.Number)
+		resultID = set.ID
+	}
+	if err != nil {
+		return job, err
+	}
+	if cached {
+		job.Status = models.JobSucceeded
+		job.ResultID = &resultID
+		return job, db.DB.Create(&job).Error
+	}
+
+	if c.Number > 0 {
+		return job, jobManager.Submit(&job, c.chunks())
+	}
+	return job, jobManager.Submit(&job, documentChunks(doc))
+}
+
+// runGeneration starts a job and waits for it, for the endpoints that answer
+// synchronously. It writes the error response itself and reports whether the
+// job produced a result.
+func runGeneration(w http.ResponseWriter, r *http.Request, userEmail string, req GenerationRequest) (models.Job, bool) {
+	job, err := startGeneration(userEmail, req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return job, false
+		}
+		if errors.Is(err, errUnknownChapter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return job, false
+		}
+		http.Error(w, "Failed to start generation: "+err.Error(), http.StatusInternalServerError)
+		return job, false
+	}
+	if !job.Finished() {
+		job, err = jobManager.Wait(r.Context(), job.ID, userEmail)
+		if err != nil {
+			// The client went away and the job was cancelled, nobody to answer
+			return job, false
+		}
+	}
+
+	switch {
+	case job.Status == models.JobSucceeded:
+		return job, true
+	case job.Status == models.JobCancelled:
+		http.Error(w, "Generation was cancelled", http.StatusConflict)
+	case job.Error == errInsufficientContent.Error():
+		http.Error(w, "Insufficient content for "+req.Kind+" generation", http.StatusBadRequest)
+	default:
+		http.Error(w, "Generation failed: "+job.Error, http.StatusInternalServerError)
+	}
+	return job, false
+}
+
+// SubmitJob starts a generation job and returns it without waiting.
+func SubmitJob(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req GenerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.PDFtext == "" && req.DocumentID == 0 {
+		http.Error(w, "PDF text or a document ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.Chapter != 0 && req.DocumentID == 0 {
+		http.Error(w, "A chapter needs a document ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := startGeneration(userEmail, req)
+	if err != nil {
+		if errors.Is(err, jobs.ErrUnknownKind) || errors.Is(err, errUnknownChapter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to start generation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job.Chunks = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJobs lists the user's jobs, newest first.
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	jobList := []models.Job{}
+	if err := db.DB.Where("user_email = ?", claims["email"].(string)).Order("created_at desc").Limit(50).Find(&jobList).Error; err != nil {
+		http.Error(w, "Failed to fetch jobs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobList)
+}
+
+// loadJob fetches a user's job with the status and errors of its chunks.
+func loadJob(id, userEmail string) (models.Job, error) {
+	var job models.Job
+	err := db.DB.Preload("Chunks", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "job_id", "chunk_index", "status", "items", "error").Order("chunk_index ASC")
+	}).First(&job, "id = ? AND user_email = ?", id, userEmail).Error
+	return job, err
+}
+
+// GetJob returns a job's progress, including per-chunk errors.
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, err := loadJob(mux.Vars(r)["id"], claims["email"].(string))
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// StreamJob pushes the job as a server-sent event every time it changes,
+// until it finishes.
+func StreamJob(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	// Subscribe before loading, so a change made in between isn't missed
+	updates, unsubscribe := jobManager.Subscribe(uint(id))
+	defer unsubscribe()
+
+	job, err := loadJob(idStr, userEmail)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		data, _ := json.Marshal(job)
+		fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+		flusher.Flush()
+		if job.Finished() {
+			return
+		}
+
+		for changed := false; !changed; {
+			select {
+			case <-updates:
+				changed = true
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if job, err = loadJob(idStr, userEmail); err != nil {
+			return
+		}
+	}
+}
+
+// CancelJob stops a queued or running job.
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	if err := jobManager.Cancel(uint(id), claims["email"].(string)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "No running job with that ID", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to cancel job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Job cancelled"})
+}
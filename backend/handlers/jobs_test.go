@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+	"tutor_genX/segment"
+	"tutor_genX/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const flashcardReply = `{"flashcards": [{"front": "What do plants make?", "back": "Glucose"}, {"front": "From what?", "back": "Light"}]}`
+
+func TestGenerateFlashcards(t *testing.T) {
+	provider := setupHandlers(t, flashcardReply)
+	text := strings.Repeat("Plants make glucose from light. ", 10)
+
+	var got FlashcardResponse
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, FileName: "plants.pdf"}), &got)
+	if len(got.Flashcards) != 2 || got.Flashcards[0].ID == 0 || got.Flashcards[1].Back != "Light" {
+		t.Fatalf("flashcards %+v", got)
+	}
+
+	// The same text again is served from the saved set
+	decode(t, post(t, GenerateFlashcards, FlashcardRequest{PDFtext: text, FileName: "plants.pdf"}), &got)
+	if len(got.Flashcards) != 2 || len(provider.Calls()) != 1 {
+		t.Errorf("%d calls for %+v", len(provider.Calls()), got)
+	}
+	var jobList []models.Job
+	db.DB.Order("id").Find(&jobList)
+	if len(jobList) != 2 || jobList[0].Title != "plants.pdf" || jobList[0].ItemsProduced != 2 || jobList[1].Status != models.JobSucceeded {
+		t.Errorf("jobs %+v", jobList)
+	}
+}
+
+func TestGenerateQuizFromPdf(t *testing.T) {
+	setupHandlers(t, quizReply)
+	var quiz PublicQuizResponse
+	decode(t, post(t, GenerateQuizFromPdf, QuizRequest2{PDFtext: plantText, FileName: "plants.pdf"}), &quiz)
+	if len(quiz.Quiz) != 3 || quiz.QuizSetID == 0 {
+		t.Errorf("quiz %+v", quiz)
+	}
+
+	// Each question remembers which chunk of the text it quotes
+	var set models.QuizSet
+	db.DB.First(&set, quiz.QuizSetID)
+	if strings.Count(set.Quiz, `"chunk":1`) != 3 {
+		t.Errorf("saved %s", set.Quiz)
+	}
+}
+
+func TestGenerateFlashcardsWithoutCards(t *testing.T) {
+	// No chunk produced a card, so there is nothing to save
+	setupHandlers(t, `{"flashcards": []}`)
+	w := post(t, GenerateFlashcards, FlashcardRequest{PDFtext: "Too short."})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Insufficient content") {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+// gatedProvider replies with reply once release is closed. If stopped is
+// set, it is signalled when a call gives up because its context ended.
+type gatedProvider struct {
+	reply   string
+	release chan struct{}
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func (p gatedProvider) Complete(ctx context.Context, messages []llm.Message) (string, error) {
+	if p.started != nil {
+		p.started <- struct{}{}
+	}
+	select {
+	case <-p.release:
+		return p.reply, nil
+	case <-ctx.Done():
+		if p.stopped != nil {
+			p.stopped <- struct{}{}
+		}
+		return "", ctx.Err()
+	}
+}
+
+func TestSubmitJob(t *testing.T) {
+	setupHandlers(t)
+	provider := gatedProvider{reply: flashcardReply, release: make(chan struct{})}
+	UseLLM(provider, nil)
+
+	w := post(t, SubmitJob, GenerationRequest{Kind: flashcardJob, PDFtext: "Plants make glucose from light."})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var job models.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.ID == 0 || job.Status != models.JobQueued || job.ChunksTotal != 1 {
+		t.Fatalf("job %+v", job)
+	}
+
+	// The job's progress streams until it finishes
+	server := httptest.NewServer(utils.ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamJob(w, mux.SetURLVars(r, map[string]string{"id": itoa(job.ID)}))
+	})))
+	defer server.Close()
+	r, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := bufio.NewScanner(resp.Body)
+	var statuses []string
+	for events.Scan() {
+		if !strings.HasPrefix(events.Text(), "data: ") {
+			continue
+		}
+		var progress models.Job
+		decodeEvent(t, events.Text(), &progress)
+		statuses = append(statuses, progress.Status)
+		if len(statuses) == 1 {
+			close(provider.release)
+		}
+		if progress.Finished() {
+			break
+		}
+	}
+	if len(statuses) < 2 || statuses[len(statuses)-1] != models.JobSucceeded {
+		t.Errorf("statuses %q", statuses)
+	}
+
+	var listed []models.Job
+	decode(t, serve(GetJobs, get(t, "/jobs")), &listed)
+	if len(listed) != 1 || listed[0].ResultID == nil {
+		t.Errorf("jobs %+v", listed)
+	}
+	var got models.Job
+	decode(t, serve(GetJob, mux.SetURLVars(get(t, "/"), map[string]string{"id": itoa(job.ID)})), &got)
+	if len(got.Chunks) != 1 || got.Chunks[0].Status != models.ChunkDone || got.Chunks[0].Items != 2 {
+		t.Errorf("job %+v", got)
+	}
+
+	if w := post(t, SubmitJob, GenerationRequest{Kind: "poems", PDFtext: "Roses"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown kind: status %d", w.Code)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	setupHandlers(t)
+	provider := gatedProvider{release: make(chan struct{}), started: make(chan struct{}, 1), stopped: make(chan struct{}, 1)}
+	UseLLM(provider, nil)
+
+	var job models.Job
+	json.Unmarshal(post(t, SubmitJob, GenerationRequest{Kind: quizJob, PDFtext: "Plants make glucose from light."}).Body.Bytes(), &job)
+	<-provider.started
+	vars := map[string]string{"id": itoa(job.ID)}
+	if w := serve(CancelJob, mux.SetURLVars(request(t, nil), vars)); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	// The model call in flight is interrupted
+	select {
+	case <-provider.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the model call was not interrupted")
+	}
+	db.DB.First(&job, job.ID)
+	if job.Status != models.JobCancelled {
+		t.Errorf("status %q", job.Status)
+	}
+	if w := serve(CancelJob, mux.SetURLVars(request(t, nil), vars)); w.Code != http.StatusNotFound {
+		t.Errorf("cancelling twice: status %d", w.Code)
+	}
+	if w := serve(GetJob, mux.SetURLVars(get(t, "/"), map[string]string{"id": "999"})); w.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d", w.Code)
+	}
+}
+
+func TestStreamJob(t *testing.T) {
+	setupHandlers(t)
+	done := models.Job{UserEmail: testUser, Kind: quizJob, Status: models.JobSucceeded}
+	theirs := models.Job{UserEmail: "someone@example.com", Kind: quizJob, Status: models.JobRunning}
+	db.DB.Create(&done)
+	db.DB.Create(&theirs)
+
+	// A finished job is sent once and the stream ends
+	w := serve(StreamJob, mux.SetURLVars(get(t, "/"), map[string]string{"id": itoa(done.ID)}))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "event: progress") != 1 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var streamed models.Job
+	decodeEvent(t, strings.Split(w.Body.String(), "\n")[1], &streamed)
+	if streamed.ID != done.ID || streamed.Status != models.JobSucceeded {
+		t.Errorf("streamed %+v", streamed)
+	}
+
+	for _, id := range []string{itoa(theirs.ID), "999", "x"} {
+		if w := serve(StreamJob, mux.SetURLVars(get(t, "/"), map[string]string{"id": id})); w.Code != http.StatusNotFound {
+			t.Errorf("job %s: status %d", id, w.Code)
+		}
+	}
+}
+
+func TestDocumentChunks(t *testing.T) {
+	setupHandlers(t)
+	UseChunking(segment.Options{MaxTokens: 40})
+	t.Cleanup(func() { UseChunking(segment.Options{}) })
+
+	// A chapter starts a new chunk; without pages the text is split as it is
+	doc := models.Document{UserEmail: testUser, ContentHash: "cells", FileName: "cells.pdf", Text: "ignored"}
+	db.DB.Create(&doc)
+	db.DB.Create(&[]models.DocumentPage{
+		{DocumentID: doc.ID, Number: 1, Text: "Cells are the units of life. Every living thing is made of them."},
+		{DocumentID: doc.ID, Number: 2, Text: "Chapter 2\nMitochondria make ATP for the cell."},
+	})
+	db.DB.Create(&models.DocumentOutlineEntry{DocumentID: doc.ID, Level: 1, Title: "Chapter 2", Page: 2})
+	chunks := documentChunks(doc)
+	if len(chunks) != 2 || !strings.HasPrefix(chunks[1], "Chapter 2") {
+		t.Errorf("chunks %q", chunks)
+	}
+	if chunks := documentChunks(models.Document{Text: "One sentence. Another one."}); len(chunks) != 1 || chunks[0] != "One sentence. Another one." {
+		t.Errorf("text chunks %q", chunks)
+	}
+}
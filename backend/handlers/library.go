@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/extract"
+	"tutor_genX/models"
+	"tutor_genX/storage"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// fileStore keeps uploaded files. It is injected from main with UseStorage.
+var fileStore storage.Store
+
+func UseStorage(s storage.Store) {
+	fileStore = s
+}
+
+// receiveDocument reads the uploaded file (the "file" form field, or "pdf" as
+// before other formats were supported) and adds it to the user's library. It
+// writes the error response itself and reports whether it succeeded.
+func receiveDocument(w http.ResponseWriter, r *http.Request, userEmail string) (models.Document, bool) {
+	var doc models.Document
+
+	// Parse form with size limit
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
+		http.Error(w, "Error parsing form: file too large or invalid", http.StatusBadRequest)
+		return doc, false
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		file, header, err = r.FormFile("pdf")
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving file: ensure file field is named 'file'", http.StatusBadRequest)
+		return doc, false
+	}
+	defer file.Close()
+
+	doc, err = ingestDocument(userEmail, file, header)
+	switch {
+	case errors.Is(err, extract.ErrUnsupported):
+		http.Error(w, "Unsupported file type: upload a PDF, EPUB, Word (.docx), Markdown, HTML or text file", http.StatusBadRequest)
+		return doc, false
+	case err != nil:
+		http.Error(w, "Error extracting text from file: "+err.Error(), http.StatusInternalServerError)
+		return doc, false
+	}
+	return doc, true
+}
+
+// ingestDocument extracts an uploaded file page by page, stores the file and
+// saves it as a document. Uploading the same text again returns the existing
+// document.
+func ingestDocument(userEmail string, file multipart.File, header *multipart.FileHeader) (models.Document, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return models.Document{}, err
+	}
+	extracted, mimeType, err := extract.Extract(data, header.Filename)
+	if err != nil {
+		return models.Document{}, err
+	}
+	var pages []models.DocumentPage
+	var texts []string
+	for i, text := range extracted.Pages {
+		pages = append(pages, models.DocumentPage{Number: i + 1, Text: text})
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	var outline []models.DocumentOutlineEntry
+	for i, heading := range extracted.Outline {
+		outline = append(outline, models.DocumentOutlineEntry{Position: i, Level: heading.Level, Title: heading.Title, Page: heading.Page})
+	}
+
+	meta := models.Document{FileName: header.Filename, PageCount: len(pages), SizeBytes: int64(len(data))}
+	doc, err := saveDocument(userEmail, strings.Join(texts, "\n\n"), meta)
+	if err != nil || doc.StorageKey != "" {
+		return doc, err
+	}
+
+	// First upload of this document (it may have been seen as bare text before)
+	key := fmt.Sprintf("documents/%d%s", doc.ID, extract.Extension(mimeType))
+	if err := fileStore.Put(key, bytes.NewReader(data)); err != nil {
+		return doc, err
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentPage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentOutlineEntry{}).Error; err != nil {
+			return err
+		}
+		for i := range pages {
+			pages[i].DocumentID = doc.ID
+		}
+		for i := range outline {
+			outline[i].DocumentID = doc.ID
+		}
+		if len(pages) > 0 {
+			if err := tx.Create(&pages).Error; err != nil {
+				return err
+			}
+		}
+		if len(outline) > 0 {
+			if err := tx.Create(&outline).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&doc).Updates(map[string]interface{}{"storage_key": key, "mime_type": mimeType}).Error
+	})
+	if err == nil {
+		indexInBackground(doc.ID)
+	}
+	return doc, err
+}
+
+// UploadDocument adds a document to the user's library and returns its metadata and outline.
+func UploadDocument(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	doc, ok := receiveDocument(w, r, userEmail)
+	if !ok {
+		return
+	}
+	if err := db.DB.Preload("Outline", orderBy("position")).First(&doc, doc.ID).Error; err != nil {
+		http.Error(w, "Failed to fetch document", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+func orderBy(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(column + " ASC")
+	}
+}
+
+// GetDocuments lists the user's library, newest first.
+func GetDocuments(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	docs := []models.Document{}
+	if err := db.DB.Omit("text").Where("user_email = ?", claims["email"].(string)).Order("created_at desc").Find(&docs).Error; err != nil {
+		http.Error(w, "Failed to fetch documents", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(docs)
+}
+
+// GetDocument returns a document with its outline and the text of each page.
+func GetDocument(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var doc models.Document
+	err := db.DB.Preload("Pages", orderBy("number")).Preload("Outline", orderBy("position")).
+		First(&doc, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// GetDocumentFile downloads the original file.
+func GetDocumentFile(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var doc models.Document
+	if err := db.DB.Omit("text").First(&doc, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error; err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if doc.StorageKey == "" {
+		http.Error(w, "No file was uploaded for this document", http.StatusNotFound)
+		return
+	}
+	file, err := fileStore.Open(doc.StorageKey)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	contentType := doc.MimeType
+	if contentType == "" {
+		contentType = extract.PDF // Uploaded before other formats were supported
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", doc.FileName))
+	io.Copy(w, file)
+}
+
+// DeleteDocument removes a document, its pages, outline, passages and file from the library.
+func DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var doc models.Document
+	if err := db.DB.Omit("text").First(&doc, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error; err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	// Stop what is still generating from it, or it would link what it makes
+	// to a document that's gone
+	var running []uint
+	if err := db.DB.Model(&models.Job{}).Where("document_id = ? AND status IN ?", doc.ID, []string{models.JobQueued, models.JobRunning}).Pluck("id", &running).Error; err != nil {
+		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		return
+	}
+	for _, id := range running {
+		// Not found means it finished in the meantime
+		if err := jobManager.Cancel(id, doc.UserEmail); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Hard delete, so the same file can be uploaded again later
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.DocumentPage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.DocumentOutlineEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.DocumentPassage{}).Error; err != nil {
+			return err
+		}
+		// Quizzes, flashcards and jobs made from it stay, no longer linked to it
+		unlinked := map[string]interface{}{"document_id": nil, "chapter": 0}
+		if err := tx.Model(&models.QuizSet{}).Where("document_id = ?", doc.ID).UpdateColumns(unlinked).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.FlashcardSet{}).Where("document_id = ?", doc.ID).UpdateColumns(unlinked).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Job{}).Where("document_id = ?", doc.ID).UpdateColumns(map[string]interface{}{"document_id": 0, "chapter": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&doc).Error
+	})
+	if err != nil {
+		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+		return
+	}
+	if doc.StorageKey != "" {
+		if err := fileStore.Delete(doc.StorageKey); err != nil {
+			log.Println("Failed to delete stored file:", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Document deleted"})
+}
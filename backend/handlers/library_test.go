@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// testPDF builds a PDF with one page per text and a bookmark, "Chapter 2",
+// pointing at the second page. Its font gives every glyph the same width, so
+// the text can be laid out from the glyph positions.
+func testPDF(texts ...string) []byte {
+	var objects []string
+	kids := ""
+	for i, text := range texts {
+		page, content := 4+2*i, 5+2*i
+		kids += fmt.Sprintf("%d 0 R ", page)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /Font << /F1 3 0 R >> >> >>", content),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len("BT /F1 12 Tf 72 700 Td ("+text+") Tj ET"), "BT /F1 12 Tf 72 700 Td ("+text+") Tj ET"))
+	}
+	outlines, bookmark := 4+2*len(texts), 5+2*len(texts)
+	objects = append([]string{
+		fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Outlines %d 0 R >>", outlines),
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(texts)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /FirstChar 32 /LastChar 126 /Widths [" + strings.Repeat("600 ", 95) + "] >>",
+	}, objects...)
+	objects = append(objects,
+		fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count 1 >>", bookmark, bookmark),
+		fmt.Sprintf("<< /Title (Chapter 2) /Parent %d 0 R /Dest [6 0 R /Fit] >>", outlines))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// upload posts a file to UploadDocument as the "file" form field.
+func upload(t *testing.T, name string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", name)
+	part.Write(data)
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/documents", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	return serve(UploadDocument, r)
+}
+
+// onDocument runs handler on the document with the given id.
+func onDocument(t *testing.T, handler http.HandlerFunc, method string, id uint) *httptest.ResponseRecorder {
+	t.Helper()
+	r := get(t, "/documents/"+itoa(id))
+	r.Method = method
+	return serve(handler, mux.SetURLVars(r, map[string]string{"id": itoa(id)}))
+}
+
+func setupLibrary(t *testing.T) {
+	t.Helper()
+	setupHandlers(t)
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseStorage(store)
+	t.Cleanup(func() { UseStorage(nil) })
+}
+
+func TestUploadDocument(t *testing.T) {
+	setupLibrary(t)
+	pdf := testPDF("Leaves", "Roots")
+
+	w := upload(t, "plants.pdf", pdf)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var doc models.Document
+	decodeStatus(t, w, &doc)
+	if doc.FileName != "plants.pdf" || doc.PageCount != 2 || doc.SizeBytes != int64(len(pdf)) || storageKey(doc.ID) == "" {
+		t.Errorf("uploaded %+v", doc)
+	}
+	if len(doc.Outline) != 1 || doc.Outline[0].Title != "Chapter 2" || doc.Outline[0].Page != 2 || doc.Outline[0].Level != 1 {
+		t.Errorf("outline %+v", doc.Outline)
+	}
+
+	var full models.Document
+	decode(t, onDocument(t, GetDocument, http.MethodGet, doc.ID), &full)
+	if len(full.Pages) != 2 || full.Pages[0].Number != 1 || full.Pages[0].Text != "Leaves" || full.Pages[1].Text != "Roots" {
+		t.Errorf("pages %+v", full.Pages)
+	}
+
+	w = onDocument(t, GetDocumentFile, http.MethodGet, doc.ID)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !bytes.Equal(w.Body.Bytes(), pdf) {
+		t.Errorf("download: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, `"plants.pdf"`) {
+		t.Errorf("Content-Disposition %q", disposition)
+	}
+
+	// The same PDF again is the same document, with its pages stored once
+	var again models.Document
+	decodeStatus(t, upload(t, "copy.pdf", pdf), &again)
+	var pages int64
+	db.DB.Model(&models.DocumentPage{}).Where("document_id = ?", doc.ID).Count(&pages)
+	if again.ID != doc.ID || pages != 2 {
+		t.Errorf("re-upload: document %d, %d pages", again.ID, pages)
+	}
+}
+
+// storageKey reads a document's StorageKey, which isn't served.
+func storageKey(id uint) string {
+	var doc models.Document
+	db.DB.Omit("text").First(&doc, id)
+	return doc.StorageKey
+}
+
+// decodeStatus is decode for handlers answering 201.
+func decodeStatus(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	if w.Code == http.StatusCreated {
+		w.Code = http.StatusOK
+	}
+	decode(t, w, out)
+}
+
+func TestUploadDocumentErrors(t *testing.T) {
+	setupLibrary(t)
+	if w := upload(t, "leaf.pdf", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Unsupported file type") {
+		t.Errorf("image: status %d: %s", w.Code, w.Body)
+	}
+	if w := upload(t, "broken.pdf", []byte("%PDF-1.4 not really")); w.Code != http.StatusInternalServerError {
+		t.Errorf("broken PDF: status %d", w.Code)
+	}
+	r := get(t, "/documents")
+	r.Method = http.MethodPost
+	if w := serve(UploadDocument, r); w.Code != http.StatusBadRequest {
+		t.Errorf("no form: status %d", w.Code)
+	}
+	var count int64
+	db.DB.Model(&models.Document{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d documents saved", count)
+	}
+}
+
+func TestUploadMarkdown(t *testing.T) {
+	setupLibrary(t)
+	notes := []byte("# Leaves\n\nLeaves are **green**.\n\n# Roots\n\nRoots take up [water](https://example.com).")
+
+	var doc models.Document
+	decodeStatus(t, upload(t, "plants.md", notes), &doc)
+	if doc.MimeType != "text/markdown" || doc.PageCount != 2 || !strings.HasSuffix(storageKey(doc.ID), ".md") {
+		t.Errorf("uploaded %+v", doc)
+	}
+	if len(doc.Outline) != 2 || doc.Outline[1].Title != "Roots" || doc.Outline[1].Page != 2 {
+		t.Errorf("outline %+v", doc.Outline)
+	}
+
+	var full models.Document
+	decode(t, onDocument(t, GetDocument, http.MethodGet, doc.ID), &full)
+	if len(full.Pages) != 2 || full.Pages[1].Text != "Roots\n\nRoots take up water." {
+		t.Errorf("pages %+v", full.Pages)
+	}
+	w := onDocument(t, GetDocumentFile, http.MethodGet, doc.ID)
+	if w.Header().Get("Content-Type") != "text/markdown" || !bytes.Equal(w.Body.Bytes(), notes) {
+		t.Errorf("download: %q, %d bytes", w.Header().Get("Content-Type"), w.Body.Len())
+	}
+}
+
+func TestGetDocuments(t *testing.T) {
+	setupLibrary(t)
+	older, _ := saveDocument(testUser, "Older text.", models.Document{FileName: "older.pdf"})
+	db.DB.Model(&older).Update("created_at", older.CreatedAt.Add(-1))
+	newer, _ := saveDocument(testUser, "Newer text.", models.Document{FileName: "newer.pdf"})
+	saveDocument("someone@example.com", "Their text.", models.Document{FileName: "theirs.pdf"})
+
+	var docs []models.Document
+	decode(t, serve(GetDocuments, get(t, "/documents")), &docs)
+	if len(docs) != 2 || docs[0].ID != newer.ID || docs[1].ID != older.ID {
+		t.Fatalf("documents %+v", docs)
+	}
+	if docs[0].Text != "" {
+		t.Error("the list carries the full text")
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	setupLibrary(t)
+	pdf := testPDF("Leaves", "Roots")
+	var doc models.Document
+	decodeStatus(t, upload(t, "plants.pdf", pdf), &doc)
+	key := storageKey(doc.ID)
+	if f, err := fileStore.Open(key); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Close()
+	}
+	quiz := models.QuizSet{UserEmail: testUser, Title: "Plants", DocumentID: &doc.ID, Chapter: 1, Quiz: "{}"}
+	deck := models.FlashcardSet{UserEmail: testUser, Title: "Plants", DocumentID: &doc.ID, Chapter: 1}
+	job := models.Job{UserEmail: testUser, Kind: quizJob, Status: models.JobSucceeded, DocumentID: doc.ID, Chapter: 1}
+	running := models.Job{UserEmail: testUser, Kind: flashcardJob, Status: models.JobRunning, DocumentID: doc.ID}
+	db.DB.Create(&quiz)
+	db.DB.Create(&deck)
+	db.DB.Create(&job)
+	db.DB.Create(&running)
+
+	var deleted map[string]string
+	decode(t, onDocument(t, DeleteDocument, http.MethodDelete, doc.ID), &deleted)
+	for _, model := range []interface{}{&models.Document{}, &models.DocumentPage{}, &models.DocumentOutlineEntry{}} {
+		var count int64
+		db.DB.Unscoped().Model(model).Count(&count)
+		if count != 0 {
+			t.Errorf("%T: %d rows left", model, count)
+		}
+	}
+	if _, err := fileStore.Open(key); err != storage.ErrNotFound {
+		t.Errorf("stored file: %v", err)
+	}
+	if w := onDocument(t, GetDocument, http.MethodGet, doc.ID); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status %d", w.Code)
+	}
+
+	// What was made from it stays, unlinked
+	db.DB.First(&quiz, quiz.ID)
+	db.DB.First(&deck, deck.ID)
+	db.DB.First(&job, job.ID)
+	if quiz.DocumentID != nil || quiz.Chapter != 0 || deck.DocumentID != nil || deck.Chapter != 0 || job.DocumentID != 0 || job.Chapter != 0 {
+		t.Errorf("still linked: quiz %v, deck %v, job %d", quiz.DocumentID, deck.DocumentID, job.DocumentID)
+	}
+	// Jobs still generating from it are cancelled, finished ones left alone
+	db.DB.First(&running, running.ID)
+	if running.Status != models.JobCancelled || job.Status != models.JobSucceeded {
+		t.Errorf("jobs %q and %q", running.Status, job.Status)
+	}
+	// Whatever a job finishing now makes isn't linked to anything
+	quizID, err := quizKind.Finish(&job, []string{quizReply})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deckID, err := saveGeneratedCards(&running, func(int) []models.Card { return []models.Card{{Front: "Leaf", Back: "Makes glucose"}} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newQuiz models.QuizSet
+	var newDeck models.FlashcardSet
+	db.DB.First(&newQuiz, quizID)
+	db.DB.First(&newDeck, deckID)
+	if newQuiz.ID == 0 || newQuiz.DocumentID != nil || newDeck.ID == 0 || newDeck.DocumentID != nil {
+		t.Errorf("made after the delete: quiz %v, deck %v", newQuiz.DocumentID, newDeck.DocumentID)
+	}
+
+	// Deleting frees the text, so it can be uploaded again
+	var again models.Document
+	decodeStatus(t, upload(t, "plants.pdf", pdf), &again)
+	if again.ID == doc.ID || storageKey(again.ID) == "" {
+		t.Errorf("re-upload %+v", again)
+	}
+}
+
+func TestDocumentsNeedOwner(t *testing.T) {
+	setupLibrary(t)
+	theirs, _ := saveDocument("someone@example.com", "Their text.", models.Document{FileName: "theirs.pdf"})
+	for name, handler := range map[string]http.HandlerFunc{
+		"get":    GetDocument,
+		"file":   GetDocumentFile,
+		"delete": DeleteDocument,
+	} {
+		if w := onDocument(t, handler, http.MethodGet, theirs.ID); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d", name, w.Code)
+		}
+	}
+	if err := db.DB.First(&models.Document{}, theirs.ID).Error; err != nil {
+		t.Errorf("their document: %v", err)
+	}
+
+	// A document saved from bare text has no file to download
+	mine, _ := saveDocument(testUser, "My text.", models.Document{})
+	if w := onDocument(t, GetDocumentFile, http.MethodGet, mine.ID); w.Code != http.StatusNotFound {
+		t.Errorf("no file: status %d", w.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+
+	"tutor_genX/llm"
+)
+
+// Providers used by the handlers. They are injected from main with UseLLM so
+// the vendor can be swapped by configuration (or replaced with llm.FakeProvider).
+var (
+	llmProvider     llm.Provider
+	summaryProvider llm.Provider
+)
+
+// UseLLM sets the provider for general generation and the one used for video
+// summaries. A nil summary provider falls back to the general one.
+func UseLLM(general, summary llm.Provider) {
+	llmProvider = general
+	summaryProvider = summary
+	if summaryProvider == nil {
+		summaryProvider = general
+	}
+}
+
+// complete sends a single user prompt to the general provider.
+func complete(ctx context.Context, prompt string) (string, error) {
+	if llmProvider == nil {
+		return "", llm.ErrNotConfigured
+	}
+	return llmProvider.Complete(ctx, []llm.Message{llm.User(prompt)})
+}
+
+// completeJSON sends a prompt to the general provider and decodes the reply
+// into out, re-prompting the model when the JSON is malformed or invalid.
+func completeJSON(ctx context.Context, prompt string, out interface{}) error {
+	return llm.CompleteJSON(ctx, llmProvider, []llm.Message{llm.User(prompt)}, out, llm.DefaultRepairs)
+}
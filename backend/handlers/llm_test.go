@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/llm"
+)
+
+const roadmapReply = `[{"week": 1, "title": "Basics", "topics": ["Syntax", "Types"]}, {"week": 2, "title": "Concurrency", "topics": ["Goroutines"]}]`
+
+func TestHandlersUseInjectedProvider(t *testing.T) {
+	provider := setupHandlers(t, roadmapReply)
+
+	var got struct {
+		Goal    string        `json:"goal"`
+		Roadmap []RoadmapWeek `json:"roadmap"`
+	}
+	decode(t, post(t, HandleRoadmap, RoadmapRequest{Goal: "Learn Go", Motivation: "career", LearningStyle: "practical"}), &got)
+	if got.Goal != "Learn Go" || len(got.Roadmap) != 2 || got.Roadmap[1].Topics[0] != "Goroutines" {
+		t.Errorf("roadmap %+v", got)
+	}
+	calls := provider.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0][0].Content, `"Learn Go"`) {
+		t.Errorf("prompt %+v", calls)
+	}
+
+	// Explanations are generated once and then served from the database
+	setupHandlers(t, "Goroutines are cheap threads.", "something else")
+	for i := 0; i < 2; i++ {
+		var explained ExplainTopicResponse
+		decode(t, post(t, ExplainTopicHandler, ExplainTopicRequest{Topic: "Goroutines"}), &explained)
+		if explained.Explanation != "Goroutines are cheap threads." {
+			t.Errorf("call %d: %q", i, explained.Explanation)
+		}
+	}
+}
+
+func TestHandlersWithoutProvider(t *testing.T) {
+	setupHandlers(t)
+	UseLLM(nil, nil)
+	w := post(t, HandleRoadmap, RoadmapRequest{Goal: "Learn Go"})
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "not configured") {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+
+	// A reply that is not a roadmap is the goal's fault, not the server's
+	provider := setupHandlers(t, "I can't help with that.")
+	if w := post(t, HandleRoadmap, RoadmapRequest{Goal: "Learn Go"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unparsable reply: status %d", w.Code)
+	}
+	if n := len(provider.Calls()); n != 1+llm.DefaultRepairs {
+		t.Errorf("%d calls to the model", n)
+	}
+}
+
+func TestHandleRoadmapRepairs(t *testing.T) {
+	provider := setupHandlers(t,
+		`Here you go: [{"week": 1, "title": "Basics", "topics": ["Syntax"]}, {"week": 3, "title": "", "topics": []}]`,
+		roadmapReply,
+	)
+	var got struct {
+		Roadmap []RoadmapWeek `json:"roadmap"`
+	}
+	decode(t, post(t, HandleRoadmap, RoadmapRequest{Goal: "Learn Go"}), &got)
+	if len(got.Roadmap) != 2 || got.Roadmap[1].Title != "Concurrency" {
+		t.Errorf("roadmap %+v", got.Roadmap)
+	}
+	calls := provider.Calls()
+	repair := calls[len(calls)-1]
+	last := repair[len(repair)-1].Content
+	for _, problem := range []string{`"week": 3`, `week 2 has an empty "title"`, "week 2 has no topics"} {
+		if !strings.Contains(last, problem) {
+			t.Errorf("repair prompt is missing %q:\n%s", problem, last)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Mastery is an Elo rating: every answer is a match between the learner and
+// the question, whose rating comes from its difficulty.
+const (
+	minDifficulty  = 1
+	maxDifficulty  = 5
+	initialRating  = 1000.0 // A new learner, level with a difficulty 3 question
+	difficultyStep = 200.0  // Rating points between difficulty levels
+	targetSuccess  = 0.7    // Adaptive quizzes aim for questions answered right this often
+)
+
+// difficultyRating is the rating of a question. Untagged questions count as medium.
+func difficultyRating(difficulty int) float64 {
+	if difficulty == 0 {
+		difficulty = 3
+	}
+	return initialRating + difficultyStep*float64(difficulty-3)
+}
+
+// expectedScore is the chance a learner with rating answers a question rated questionRating.
+func expectedScore(rating, questionRating float64) float64 {
+	return 1 / (1 + math.Pow(10, (questionRating-rating)/400))
+}
+
+// kFactor moves new estimates quickly and settles them as answers pile up.
+func kFactor(answered int) float64 {
+	if answered < 10 {
+		return 48
+	}
+	return 24
+}
+
+// levelFor is the difficulty a learner with rating is expected to answer
+// right about targetSuccess of the time.
+func levelFor(rating float64) int {
+	questionRating := rating - 400*math.Log10(targetSuccess/(1-targetSuccess))
+	level := int(math.Round((questionRating-initialRating)/difficultyStep)) + 3
+	return max(minDifficulty, min(maxDifficulty, level))
+}
+
+// gradedAnswer is what mastery needs to know about an answered question.
+// Partial credit counts as a partial win.
+type gradedAnswer struct {
+	Difficulty int
+	Concept    string
+	Credit     float64
+}
+
+func normalizeConcept(concept string) string {
+	return strings.ToLower(strings.Join(strings.Fields(concept), " "))
+}
+
+// updateMastery rates the user's answers against the topic and against the
+// concept each question tested.
+func updateMastery(tx *gorm.DB, userEmail, topic string, answers []gradedAnswer) error {
+	rows := map[string]*models.Mastery{}
+	row := func(concept string) (*models.Mastery, error) {
+		if m, ok := rows[concept]; ok {
+			return m, nil
+		}
+		m := &models.Mastery{UserEmail: userEmail, Topic: topic, Concept: concept}
+		if err := tx.Where(m).Attrs(models.Mastery{Rating: initialRating}).FirstOrCreate(m).Error; err != nil {
+			return nil, err
+		}
+		rows[concept] = m
+		return m, nil
+	}
+	rate := func(m *models.Mastery, a gradedAnswer) {
+		if a.Credit >= 1 {
+			m.Correct++
+		}
+		m.Rating += kFactor(m.Answered) * (a.Credit - expectedScore(m.Rating, difficultyRating(a.Difficulty)))
+		m.Answered++
+	}
+
+	for _, a := range answers {
+		overall, err := row("")
+		if err != nil {
+			return err
+		}
+		rate(overall, a)
+		if concept := normalizeConcept(a.Concept); concept != "" {
+			m, err := row(concept)
+			if err != nil {
+				return err
+			}
+			rate(m, a)
+		}
+	}
+	for _, m := range rows {
+		if err := tx.Save(m).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topicMastery returns the user's overall rating on a topic and the rating of
+// each concept seen so far.
+func topicMastery(userEmail, topic string) (float64, map[string]float64, error) {
+	var rows []models.Mastery
+	if err := db.DB.Where("user_email = ? AND topic = ?", userEmail, topic).Find(&rows).Error; err != nil {
+		return 0, nil, err
+	}
+	rating, concepts := initialRating, map[string]float64{}
+	for _, m := range rows {
+		if m.Concept == "" {
+			rating = m.Rating
+		} else {
+			concepts[m.Concept] = m.Rating
+		}
+	}
+	return rating, concepts, nil
+}
+
+// MasteryView is a mastery estimate with the quiz level it maps to.
+type MasteryView struct {
+	models.Mastery
+	Level int `json:"level"`
+}
+
+// GetMastery lists the user's mastery estimates, optionally only for ?topic=.
+// The overall estimate of a topic has no concept.
+func GetMastery(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := db.DB.Where("user_email = ?", claims["email"].(string))
+	if topic := r.URL.Query().Get("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	var rows []models.Mastery
+	if err := query.Order("topic ASC, concept ASC").Find(&rows).Error; err != nil {
+		http.Error(w, "Failed to fetch mastery", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]MasteryView, 0, len(rows))
+	for _, m := range rows {
+		views = append(views, MasteryView{Mastery: m, Level: levelFor(m.Rating)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+func TestLevelFor(t *testing.T) {
+	if p := expectedScore(1000, 1000); p != 0.5 {
+		t.Errorf("even match: %f", p)
+	}
+	if p := expectedScore(1400, 1000); math.Abs(p-10.0/11) > 1e-9 {
+		t.Errorf("400 points ahead: %f", p)
+	}
+	if difficultyRating(0) != difficultyRating(3) || difficultyRating(5)-difficultyRating(1) != 4*difficultyStep {
+		t.Error("difficulty ratings")
+	}
+
+	// A new learner starts just below medium, so they mostly get answers right
+	for rating, want := range map[float64]int{initialRating: 2, 1400: 4, 2500: maxDifficulty, 0: minDifficulty} {
+		if got := levelFor(rating); got != want {
+			t.Errorf("levelFor(%v) = %d, want %d", rating, got, want)
+		}
+	}
+	// At their level a learner succeeds about targetSuccess of the time
+	for rating := 900.0; rating <= 1500; rating += 100 {
+		p := expectedScore(rating, difficultyRating(levelFor(rating)))
+		if p < 0.5 || p > 0.9 {
+			t.Errorf("rating %v: level %d is answered right %.2f of the time", rating, levelFor(rating), p)
+		}
+	}
+}
+
+func TestUpdateMastery(t *testing.T) {
+	setupHandlers(t)
+	answers := []gradedAnswer{
+		{Difficulty: 3, Concept: "Light  Reactions", Credit: 1},
+		{Difficulty: 3, Concept: "light reactions", Credit: 1},
+		{Difficulty: 1, Concept: "Glucose", Credit: 0},
+		{Difficulty: 0, Credit: 1},
+		{Difficulty: 2, Concept: "Glucose", Credit: 0.5},
+	}
+	if err := updateMastery(db.DB, testUser, "Photosynthesis", answers); err != nil {
+		t.Fatal(err)
+	}
+
+	rating, concepts, err := topicMastery(testUser, "Photosynthesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(concepts) != 2 || concepts["light reactions"] <= initialRating || concepts["glucose"] >= initialRating {
+		t.Errorf("concepts %v", concepts)
+	}
+	// Partial credit counts as a partial win
+	want := initialRating
+	for i, a := range answers {
+		want += kFactor(i) * (a.Credit - expectedScore(want, difficultyRating(a.Difficulty)))
+	}
+	if math.Abs(rating-want) > 1e-9 {
+		t.Errorf("rating %f, want %f", rating, want)
+	}
+
+	var overall models.Mastery
+	db.DB.Where("user_email = ? AND topic = ? AND concept = ''", testUser, "Photosynthesis").First(&overall)
+	if overall.Answered != 5 || overall.Correct != 3 {
+		t.Errorf("overall %+v", overall)
+	}
+
+	// Other users and topics start from scratch
+	if rating, concepts, _ := topicMastery("someone@example.com", "Photosynthesis"); rating != initialRating || len(concepts) != 0 {
+		t.Errorf("someone else: %f, %v", rating, concepts)
+	}
+	if kFactor(0) <= kFactor(10) {
+		t.Error("estimates don't settle")
+	}
+}
+
+func TestGetMastery(t *testing.T) {
+	setupHandlers(t)
+	updateMastery(db.DB, testUser, "Photosynthesis", []gradedAnswer{{Difficulty: 3, Concept: "Glucose", Credit: 1}})
+	updateMastery(db.DB, testUser, "Goroutines", []gradedAnswer{{Difficulty: 3, Credit: 0}})
+	updateMastery(db.DB, "someone@example.com", "Photosynthesis", []gradedAnswer{{Difficulty: 3, Credit: 1}})
+
+	var views []MasteryView
+	decode(t, serve(GetMastery, get(t, "/mastery")), &views)
+	if len(views) != 3 || views[0].Topic != "Goroutines" || views[1].Concept != "" || views[2].Concept != "glucose" {
+		t.Fatalf("mastery %+v", views)
+	}
+	for _, v := range views {
+		if v.Level != levelFor(v.Rating) {
+			t.Errorf("%s/%s: level %d for rating %f", v.Topic, v.Concept, v.Level, v.Rating)
+		}
+	}
+	decode(t, serve(GetMastery, get(t, "/mastery?topic=Photosynthesis")), &views)
+	if len(views) != 2 {
+		t.Errorf("by topic %+v", views)
+	}
+}
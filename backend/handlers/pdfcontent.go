@@ -31,6 +31,17 @@ func GetUserQuizzesFromPdf(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Answers stay on the server; attempts are graded by SubmitQuizAttempt.
+	for i := range quizSets {
+		var quiz QuizResponse
+		if err := json.Unmarshal([]byte(quizSets[i].Quiz), &quiz); err != nil {
+			quizSets[i].Quiz = `{"quiz":[]}`
+			continue
+		}
+		publicJSON, _ := json.Marshal(PublicQuizResponse{Quiz: quiz.Public()})
+		quizSets[i].Quiz = string(publicJSON)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(quizSets)
 }
@@ -45,7 +56,9 @@ func GetUserFlashcardsFromPdf(w http.ResponseWriter, r *http.Request) {
 	userEmail := claims["email"].(string)
 
 	var flashcardSets []models.FlashcardSet
-	result := db.DB.Where("user_email = ?", userEmail).Order("created_at desc").Find(&flashcardSets)
+	result := db.DB.Preload("Cards", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("user_email = ?", userEmail).Order("created_at desc").Find(&flashcardSets)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			flashcardSets = []models.FlashcardSet{} // Return empty array instead of 404
@@ -54,6 +67,12 @@ func GetUserFlashcardsFromPdf(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	// Cloze cards are shown like in review, /flashcard-sets/{id} has them as stored
+	for i := range flashcardSets {
+		for j, card := range flashcardSets[i].Cards {
+			flashcardSets[i].Cards[j].Front, flashcardSets[i].Cards[j].Back = displayCard(card)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(flashcardSets)
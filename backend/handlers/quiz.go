@@ -6,31 +6,108 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"tutor_genX/db"
+	"tutor_genX/llm"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
 type QuizRequest struct {
-	Topic       string `json:"topic"`
-	Explanation string `json:"explanation"`
+	Topic       string   `json:"topic"`
+	Explanation string   `json:"explanation"`
+	Types       []string `json:"types,omitempty"` // Question types to use, multiple choice only by default
 }
 
+// QuizQuestion is a question of any type, see quiz_types.go. Which fields
+// are used depends on Type.
 type QuizQuestion struct {
-	Question string   `json:"question"`
-	Options  []string `json:"options"`
-	Answer   string   `json:"answer"` // You might hide this on frontend
+	Type       string   `json:"type,omitempty"` // Empty for multiple choice
+	Question   string   `json:"question"`
+	Options    []string `json:"options,omitempty"`    // Choices, or the scrambled items of an ordering question
+	Answer     string   `json:"answer,omitempty"`     // Never sent to the browser, see Public
+	Answers    []string `json:"answers,omitempty"`    // Correct choices, accepted blanks or the items in order
+	Value      *float64 `json:"value,omitempty"`      // Numeric questions
+	Tolerance  float64  `json:"tolerance,omitempty"`  // Allowed absolute error of a numeric answer
+	Rubric     string   `json:"rubric,omitempty"`     // How to grade a short answer
+	Difficulty int      `json:"difficulty,omitempty"` // 1 (easiest) to 5, 0 if untagged
+	Concept    string   `json:"concept,omitempty"`    // What the question tests
+	// Why the answer is right, why each wrong option is wrong, and the span
+	// of the text the question came from. Only shown once the quiz is graded.
+	Explanation string            `json:"explanation,omitempty"`
+	Distractors map[string]string `json:"distractors,omitempty"`
+	Source      *QuestionSource   `json:"source,omitempty"`
+}
+
+// PublicQuizQuestion is a quiz question as served to the browser, without its answer.
+type PublicQuizQuestion struct {
+	Type       string   `json:"type"`
+	Question   string   `json:"question"`
+	Options    []string `json:"options"`
+	Difficulty int      `json:"difficulty,omitempty"`
+	Concept    string   `json:"concept,omitempty"`
+}
+
+// PublicQuizResponse is what /quiz, /quiz/adaptive and /quizfrompdf return.
+// The ID tells the client what to submit attempts against.
+type PublicQuizResponse struct {
+	Quiz           []PublicQuizQuestion `json:"quiz"`
+	ContentID      uint                 `json:"content_id,omitempty"`
+	QuizVersion    int                  `json:"quiz_version,omitempty"` // Of a topic quiz, sent back with its attempts
+	QuizSetID      uint                 `json:"quiz_set_id,omitempty"`
+	AdaptiveQuizID uint                 `json:"adaptive_quiz_id,omitempty"`
+	Level          int                  `json:"level,omitempty"` // Difficulty an adaptive quiz was aimed at
 }
 
 type QuizResponse struct {
 	Quiz []QuizQuestion `json:"quiz"`
 }
 
+// Validate checks every generated question is well formed for its type, e.g.
+// that a multiple choice question has four distinct options and the answer is
+// one of them.
+func (q QuizResponse) Validate() error {
+	var problems llm.ValidationError
+	for i, question := range q.Quiz {
+		validateQuestion(i+1, question, &problems)
+		// Imported quizzes may have any number of options, generated ones always have 4
+		if questionType(question) == questionMultipleChoice && len(question.Options) != 4 {
+			problems.Addf("question %d must have exactly 4 options, got %d", i+1, len(question.Options))
+		}
+	}
+	return problems.Err()
+}
+
+// prepared fills in what generated questions may leave out, see prepareQuestion.
+func (q QuizResponse) prepared() QuizResponse {
+	for i := range q.Quiz {
+		q.Quiz[i] = prepareQuestion(q.Quiz[i])
+	}
+	return q
+}
+
+// Public strips the answers from every question.
+func (q QuizResponse) Public() []PublicQuizQuestion {
+	questions := make([]PublicQuizQuestion, 0, len(q.Quiz))
+	for _, question := range q.Quiz {
+		options := question.Options
+		if questionType(question) == questionTrueFalse {
+			options = []string{"true", "false"}
+		}
+		questions = append(questions, PublicQuizQuestion{
+			Type:       questionType(question),
+			Question:   question.Question,
+			Options:    options,
+			Difficulty: question.Difficulty,
+			Concept:    question.Concept,
+		})
+	}
+	return questions
+}
+
 func GenerateQuiz(w http.ResponseWriter, r *http.Request) {
 	//jwt validation
 	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
@@ -51,6 +128,11 @@ func GenerateQuiz(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Topic and explanation are required", http.StatusBadRequest)
 		return
 	}
+	types, err := parseQuestionTypes(req.Types)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	//check for exisitng content in the db
 	var content models.Content
 	result := db.DB.Where("user_id = ? AND topic = ?", userID, req.Topic).First(&content)
@@ -63,48 +145,39 @@ func GenerateQuiz(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			//Found in cache,return immediately
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cachedQuiz)
-			return
+			//Found in cache,return immediately, unless it has types the user didn't ask for
+			if onlyTypes(cachedQuiz, types) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(PublicQuizResponse{Quiz: cachedQuiz.Public(), ContentID: content.ID, QuizVersion: content.QuizVersion})
+				return
+			}
 		}
-		// If Quiz is empty, we will proceed to generate it.
+		// If Quiz is empty (or of other types), we will proceed to generate it.
 	} else if result.Error != gorm.ErrRecordNotFound {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	//content not in cache generate it
-	//setup groq
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
+	kind := "multiple choice questions"
+	if !multipleChoiceOnly(types) {
+		kind = "questions"
 	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
-	prompt := fmt.Sprintf(`You are a quiz generator. Create EXACTLY 3-5 multiple choice questions based ONLY on the provided explanation.
+	rules := strings.Split(questionRulesPrompt(types), "\n")
+	prompt := fmt.Sprintf(`You are a quiz generator. Create EXACTLY 3-5 %s based ONLY on the provided explanation.
 
 STRICT REQUIREMENTS:
 1. Base questions ONLY on facts explicitly mentioned in the explanation
-2. Each question must have EXACTLY 4 options (A, B, C, D)
-3. Only ONE option can be correct
-4. Incorrect options must be plausible but clearly wrong
+2. %s
+3. %s
+4. %s
 5. Do not add external knowledge not present in the explanation
 6. Questions must be factual, not opinion-based
+7. Tag each question with its difficulty from 1 (recall of a single fact) to 5 (applying or combining several ideas) and the concept it tests, in a few words
 
-OUTPUT FORMAT (JSON only, no markdown or extra text):
-{
-  "quiz": [
-    {
-      "question": "Clear, specific question based on explanation content?",
-      "options": ["Option A", "Option B", "Option C", "Option D"],
-      "answer": "Option B"
-    }
-  ]
-}
+%s
+
+%s
 
 VALIDATION:
 - If explanation is too short for 3 questions, create fewer but high-quality ones
@@ -113,47 +186,35 @@ VALIDATION:
 Topic: %s
 Explanation: %s
 
-Generate quiz now:`, req.Topic, req.Explanation)
-
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
+Generate quiz now:`, kind, rules[0], rules[1], rules[2], quizFormatPrompt(types, 2), groundingFormatPrompt, req.Topic, req.Explanation)
 
-	if err != nil {
-		http.Error(w, "Failed to generate quiz: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
 	var generatedQuiz QuizResponse
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &generatedQuiz); err != nil {
-		http.Error(w, "Failed to parse quiz", http.StatusInternalServerError)
+	if err := completeGroundedQuiz(context.Background(), prompt, req.Explanation, &generatedQuiz); err != nil {
+		http.Error(w, "Failed to generate quiz: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	generatedQuiz = generatedQuiz.prepared()
 	//save the new quiz to the db
 	quizJSON, _ := json.Marshal(generatedQuiz)
 
 	if result.Error == gorm.ErrRecordNotFound {
 		// No entry exists yet, create a new one
 		newContent := models.Content{
-			UserID: userID,
-			Topic:  req.Topic,
-			Quiz:   string(quizJSON),
+			UserID:      userID,
+			Topic:       req.Topic,
+			Quiz:        string(quizJSON),
+			QuizVersion: 1,
 		}
 		db.DB.Create(&newContent)
+		content = newContent
 	} else {
-		// Entry exists, update the specific field
-		db.DB.Model(&content).Where("user_id = ? AND topic = ?", userID, req.Topic).Update("quiz", string(quizJSON))
+		// Entry exists, update the specific field. A new version, so attempts
+		// at the old questions aren't graded or counted against the new ones
+		content.QuizVersion++
+		db.DB.Model(&content).Where("user_id = ? AND topic = ?", userID, req.Topic).Updates(map[string]interface{}{"quiz": string(quizJSON), "quiz_version": content.QuizVersion})
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(generatedQuiz)
+	json.NewEncoder(w).Encode(PublicQuizResponse{Quiz: generatedQuiz.Public(), ContentID: content.ID, QuizVersion: content.QuizVersion})
 }
 func DeleteAllQuizzes(w http.ResponseWriter, r *http.Request) {
 	// Get user email from JWT claims
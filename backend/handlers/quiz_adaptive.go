@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type AdaptiveQuizRequest struct {
+	Topic string `json:"topic"`
+	// Explanation to write new questions from. Defaults to the one saved for
+	// the topic; only needed when the question bank runs short.
+	Explanation string   `json:"explanation"`
+	Count       int      `json:"count"`
+	Types       []string `json:"types,omitempty"` // Question types to use, multiple choice only by default
+}
+
+const (
+	defaultAdaptiveCount = 5
+	maxAdaptiveCount     = 10
+	bankPromptQuestions  = 30 // Existing questions listed so the model doesn't repeat them
+)
+
+// bankDetails holds the fields of a bank question that depend on its type.
+type bankDetails struct {
+	Answers   []string `json:"answers,omitempty"`
+	Value     *float64 `json:"value,omitempty"`
+	Tolerance float64  `json:"tolerance,omitempty"`
+	Rubric    string   `json:"rubric,omitempty"`
+
+	Explanation string            `json:"explanation,omitempty"`
+	Distractors map[string]string `json:"distractors,omitempty"`
+	Source      *QuestionSource   `json:"source,omitempty"`
+}
+
+func toBankQuestion(userEmail, topic string, q QuizQuestion) models.BankQuestion {
+	options, _ := json.Marshal(q.Options)
+	details, _ := json.Marshal(bankDetails{
+		Answers: q.Answers, Value: q.Value, Tolerance: q.Tolerance, Rubric: q.Rubric,
+		Explanation: q.Explanation, Distractors: q.Distractors, Source: q.Source,
+	})
+	return models.BankQuestion{
+		UserEmail:  userEmail,
+		Topic:      topic,
+		Type:       questionType(q),
+		Question:   q.Question,
+		Options:    string(options),
+		Answer:     q.Answer,
+		Details:    string(details),
+		Difficulty: q.Difficulty,
+		Concept:    q.Concept,
+	}
+}
+
+func fromBankQuestion(b models.BankQuestion) QuizQuestion {
+	q := QuizQuestion{Type: b.Type, Question: b.Question, Answer: b.Answer, Difficulty: b.Difficulty, Concept: b.Concept}
+	json.Unmarshal([]byte(b.Options), &q.Options)
+	var details bankDetails
+	json.Unmarshal([]byte(b.Details), &details)
+	q.Answers, q.Value, q.Tolerance, q.Rubric = details.Answers, details.Value, details.Tolerance, details.Rubric
+	q.Explanation, q.Distractors, q.Source = details.Explanation, details.Distractors, details.Source
+	return q
+}
+
+// bankType is the type of a bank question; questions banked before types existed are multiple choice.
+func bankType(b models.BankQuestion) string {
+	return questionType(QuizQuestion{Type: b.Type})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// usable reports whether a bank question is of one of types and within one
+// level of level.
+func usable(q models.BankQuestion, level int, types []string) bool {
+	return abs(q.Difficulty-level) <= 1 && onlyTypes(QuizResponse{Quiz: []QuizQuestion{{Type: bankType(q)}}}, types)
+}
+
+// pickQuestions chooses up to count usable bank questions: closest to level
+// and least asked first, weak concepts before strong ones, and one question
+// per concept until every concept has had a turn.
+func pickQuestions(bank []models.BankQuestion, level, count int, types []string, concepts map[string]float64) []models.BankQuestion {
+	var candidates []models.BankQuestion
+	for _, q := range bank {
+		if usable(q, level, types) {
+			candidates = append(candidates, q)
+		}
+	}
+	conceptRating := func(q models.BankQuestion) float64 {
+		if rating, ok := concepts[normalizeConcept(q.Concept)]; ok {
+			return rating
+		}
+		return initialRating
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if di, dj := abs(a.Difficulty-level), abs(b.Difficulty-level); di != dj {
+			return di < dj
+		}
+		if a.TimesAsked != b.TimesAsked {
+			return a.TimesAsked < b.TimesAsked
+		}
+		return conceptRating(a) < conceptRating(b)
+	})
+
+	var picked []models.BankQuestion
+	taken := map[uint]bool{}
+	usedConcepts := map[string]bool{}
+	for _, spread := range []bool{true, false} {
+		for _, q := range candidates {
+			if len(picked) == count {
+				return picked
+			}
+			concept := normalizeConcept(q.Concept)
+			if taken[q.ID] || (spread && usedConcepts[concept]) {
+				continue
+			}
+			picked = append(picked, q)
+			taken[q.ID] = true
+			usedConcepts[concept] = true
+		}
+	}
+	return picked
+}
+
+// growBank writes new questions around level into the user's bank for the
+// topic, aimed at the concepts the user is weakest in.
+func growBank(ctx context.Context, userEmail, topic, explanation string, level, count int, types []string, rating float64, concepts map[string]float64, bank []models.BankQuestion) ([]models.BankQuestion, error) {
+	var weak []string
+	for concept, r := range concepts {
+		if r < rating {
+			weak = append(weak, concept)
+		}
+	}
+	sort.Strings(weak)
+	var existing []string
+	seen := map[string]bool{}
+	for _, q := range bank {
+		seen[strings.ToLower(q.Question)] = true
+		if len(existing) < bankPromptQuestions {
+			existing = append(existing, "- "+q.Question)
+		}
+	}
+
+	rules := strings.Split(questionRulesPrompt(types), "\n")
+	prompt := fmt.Sprintf(`You are a quiz generator. Create EXACTLY %d multiple choice questions based ONLY on the provided explanation.
+
+The student is currently at difficulty level %d on a scale from 1 (recall of a single fact) to 5 (applying or combining several ideas).
+Make most questions level %d and the rest one level easier or harder.
+
+STRICT REQUIREMENTS:
+1. Base questions ONLY on facts explicitly mentioned in the explanation
+2. %s
+3. %s
+4. %s
+5. Tag every question with its difficulty (1-5) and the concept it tests, in a few words
+6. Cover different concepts
+`, count, level, level, rules[0], rules[1], rules[2])
+	if len(weak) > 0 {
+		prompt += fmt.Sprintf("7. Favour the concepts the student struggles with: %s\n", strings.Join(weak, ", "))
+	}
+	if len(existing) > 0 {
+		prompt += "\nDo not repeat any of these existing questions:\n" + strings.Join(existing, "\n") + "\n"
+	}
+	prompt += fmt.Sprintf(`
+%s
+
+%s
+
+Topic: %s
+Explanation: %s
+
+Generate quiz now:`, quizFormatPrompt(types, level), groundingFormatPrompt, topic, explanation)
+
+	var generated QuizResponse
+	if err := completeGroundedQuiz(ctx, prompt, explanation, &generated); err != nil {
+		return nil, err
+	}
+
+	var added []models.BankQuestion
+	for _, q := range generated.prepared().Quiz {
+		if seen[strings.ToLower(q.Question)] {
+			continue
+		}
+		seen[strings.ToLower(q.Question)] = true
+		if q.Difficulty == 0 {
+			q.Difficulty = level
+		}
+		added = append(added, toBankQuestion(userEmail, topic, q))
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if err := db.DB.Create(&added).Error; err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// GenerateAdaptiveQuiz serves a quiz at the user's current level on a topic,
+// drawn from their question bank, which grows as it runs out of new questions.
+func GenerateAdaptiveQuiz(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req AdaptiveQuizRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Topic == "" {
+		http.Error(w, "Invalid request: topic is required", http.StatusBadRequest)
+		return
+	}
+	if req.Count <= 0 {
+		req.Count = defaultAdaptiveCount
+	}
+	req.Count = min(req.Count, maxAdaptiveCount)
+	types, err := parseQuestionTypes(req.Types)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rating, concepts, err := topicMastery(userEmail, req.Topic)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	level := levelFor(rating)
+
+	var bank []models.BankQuestion
+	if err := db.DB.Where("user_email = ? AND topic = ?", userEmail, req.Topic).Find(&bank).Error; err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Write more questions when there aren't enough unseen ones at this level
+	fresh := 0
+	for _, q := range bank {
+		if q.TimesAsked == 0 && usable(q, level, types) {
+			fresh++
+		}
+	}
+	var genErr error
+	if fresh < req.Count {
+		explanation := req.Explanation
+		if explanation == "" {
+			var content models.Content
+			if err := db.DB.Where("user_id = ? AND topic = ?", userEmail, req.Topic).First(&content).Error; err == nil {
+				explanation = content.Explanation
+			}
+		}
+		if explanation != "" {
+			added, err := growBank(r.Context(), userEmail, req.Topic, explanation, level, req.Count, types, rating, concepts, bank)
+			if err != nil {
+				log.Println("Failed to generate adaptive questions:", err)
+				genErr = err
+			}
+			bank = append(bank, added...)
+		}
+	}
+
+	picked := pickQuestions(bank, level, req.Count, types, concepts)
+	if len(picked) == 0 {
+		if genErr != nil {
+			http.Error(w, "Failed to generate quiz: "+genErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "No questions at this level yet: an explanation of the topic is needed to write some", http.StatusBadRequest)
+		return
+	}
+
+	var quiz QuizResponse
+	ids := make([]uint, 0, len(picked))
+	for _, q := range picked {
+		quiz.Quiz = append(quiz.Quiz, fromBankQuestion(q))
+		ids = append(ids, q.ID)
+	}
+	quizJSON, _ := json.Marshal(quiz)
+	adaptive := models.AdaptiveQuiz{UserEmail: userEmail, Topic: req.Topic, Level: level, Quiz: string(quizJSON)}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&adaptive).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.BankQuestion{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"times_asked":   gorm.Expr("times_asked + 1"),
+			"last_asked_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		http.Error(w, "Failed to save quiz", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PublicQuizResponse{Quiz: quiz.Public(), AdaptiveQuizID: adaptive.ID, Level: level})
+}
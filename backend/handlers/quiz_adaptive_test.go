@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"gorm.io/gorm"
+)
+
+const adaptiveReply = `{"quiz": [
+	{"question": "What do plants make?", "options": ["Glucose", "Salt", "Iron", "Oil"], "answer": "Glucose", "difficulty": 1, "concept": "Products",
+		"explanation": "Photosynthesis turns light into glucose.",
+		"distractors": {"Salt": "Salt is taken in.", "Iron": "Iron comes from the soil.", "Oil": "Oil isn't made in leaves."},
+		"source": {"quote": "Plants use light to make glucose"}},
+	{"question": "What do they need?", "options": ["Noise", "Light", "Sand", "Wind"], "answer": "Light", "difficulty": 2, "concept": "Inputs",
+		"explanation": "Light is the energy glucose is made from.",
+		"distractors": {"Noise": "Plants can't use sound.", "Sand": "Sand isn't used.", "Wind": "Wind isn't an input."},
+		"source": {"quote": "Plants need light and water"}},
+	{"question": "Where does it happen?", "options": ["Roots", "Bark", "Chloroplasts", "Seeds"], "answer": "Chloroplasts", "difficulty": 2, "concept": "Location",
+		"explanation": "Chloroplasts hold the chlorophyll.",
+		"distractors": {"Roots": "Roots get no light.", "Bark": "Bark is dead tissue.", "Seeds": "Seeds store food."},
+		"source": {"quote": "make glucose in chloroplasts"}},
+	{"question": "What gas do they take in?", "options": ["Helium", "Carbon dioxide", "Neon", "Argon"], "answer": "Carbon dioxide", "difficulty": 3, "concept": "Inputs",
+		"explanation": "The carbon in glucose comes from carbon dioxide.",
+		"distractors": {"Helium": "Helium is inert.", "Neon": "Neon is inert.", "Argon": "Argon is inert."},
+		"source": {"quote": "they take in carbon dioxide"}},
+	{"question": "Why would a plant in the dark starve?", "options": ["No light for glucose", "Too cold", "No soil", "Too wet"], "answer": "No light for glucose", "difficulty": 5, "concept": "Inputs",
+		"explanation": "Without light no glucose is made.",
+		"distractors": {"Too cold": "Darkness isn't cold.", "No soil": "It still has soil.", "Too wet": "Water isn't the problem."},
+		"source": {"quote": "A plant in the dark has no light for glucose and starves."}}
+]}`
+
+func TestPickQuestions(t *testing.T) {
+	bank := []models.BankQuestion{
+		{Model: gorm.Model{ID: 1}, Difficulty: 2, Concept: "a", TimesAsked: 1},
+		{Model: gorm.Model{ID: 2}, Difficulty: 2, Concept: "a"},
+		{Model: gorm.Model{ID: 3}, Difficulty: 3, Concept: "b"},
+		{Model: gorm.Model{ID: 4}, Difficulty: 2, Concept: "c"},
+		{Model: gorm.Model{ID: 5}, Difficulty: 5, Concept: "d"},
+		{Model: gorm.Model{ID: 6}, Difficulty: 1, Concept: "B"},
+		{Model: gorm.Model{ID: 7}, Type: questionTrueFalse, Difficulty: 2, Concept: "e"},
+	}
+	mc := []string{questionMultipleChoice}
+	ids := func(qs []models.BankQuestion) []uint {
+		var out []uint
+		for _, q := range qs {
+			out = append(out, q.ID)
+		}
+		return out
+	}
+	check := func(got []models.BankQuestion, want ...uint) {
+		t.Helper()
+		if g := ids(got); !equalIDs(g, want) {
+			t.Errorf("picked %v, want %v", g, want)
+		}
+	}
+
+	// At the level first, least asked first, the weaker concept first, then one per concept
+	check(pickQuestions(bank, 2, 3, mc, map[string]float64{"b": 900, "c": 1100}), 2, 4, 3)
+	// Once every concept had a turn, concepts repeat; too hard questions never come
+	check(pickQuestions(bank, 2, 10, mc, nil), 2, 4, 3, 1, 6)
+	check(pickQuestions(bank, 5, 10, mc, nil), 5)
+	// Only the asked for types
+	check(pickQuestions(bank, 2, 10, []string{questionTrueFalse}, nil), 7)
+	check(pickQuestions(bank, 2, 2, []string{questionTrueFalse, questionMultipleChoice}, nil), 2, 4)
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGenerateAdaptiveQuiz(t *testing.T) {
+	provider := setupHandlers(t, adaptiveReply)
+
+	w := post(t, GenerateAdaptiveQuiz, AdaptiveQuizRequest{Topic: "Photosynthesis", Explanation: plantText, Count: 3})
+	if strings.Contains(w.Body.String(), `"answer"`) {
+		t.Errorf("served with answers: %s", w.Body)
+	}
+	var quiz PublicQuizResponse
+	decode(t, w, &quiz)
+	if quiz.Level != 2 || quiz.AdaptiveQuizID == 0 || len(quiz.Quiz) != 3 {
+		t.Fatalf("quiz %+v", quiz)
+	}
+	if !strings.Contains(provider.Calls()[0][0].Content, "difficulty level 2") {
+		t.Error("the prompt doesn't name the level")
+	}
+	concepts := map[string]bool{}
+	for _, q := range quiz.Quiz {
+		if q.Difficulty < 1 || q.Difficulty > 3 || q.Concept == "" {
+			t.Errorf("question %+v", q)
+		}
+		concepts[q.Concept] = true
+	}
+	if len(concepts) != 3 {
+		t.Errorf("concepts %v", concepts)
+	}
+
+	// The whole reply went to the bank; the served questions are marked asked
+	var bank []models.BankQuestion
+	db.DB.Where("user_email = ?", testUser).Order("id").Find(&bank)
+	asked := 0
+	for _, q := range bank {
+		asked += q.TimesAsked
+	}
+	if len(bank) != 5 || asked != 3 {
+		t.Errorf("%d bank questions, %d asked", len(bank), asked)
+	}
+
+	// Answering right raises the learner's mastery, and their next level
+	answers := map[string]string{}
+	for _, q := range bank {
+		answers[q.Question] = q.Answer
+	}
+	var selected []SubmittedAnswer
+	for _, q := range quiz.Quiz {
+		selected = append(selected, SubmittedAnswer{Text: answers[q.Question]})
+	}
+	var attempt models.QuizAttempt
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{AdaptiveQuizID: quiz.AdaptiveQuizID, Answers: selected}), &attempt)
+	if attempt.Score != 3 || attempt.AdaptiveQuizID == nil || *attempt.AdaptiveQuizID != quiz.AdaptiveQuizID {
+		t.Errorf("attempt %+v", attempt)
+	}
+	rating, _, _ := topicMastery(testUser, "Photosynthesis")
+	if rating <= initialRating {
+		t.Errorf("rating %f after a perfect quiz", rating)
+	}
+
+	// The bank is short of new questions, but a repeated reply adds nothing
+	decode(t, post(t, GenerateAdaptiveQuiz, AdaptiveQuizRequest{Topic: "Photosynthesis", Explanation: plantText, Count: 3}), &quiz)
+	var count int64
+	db.DB.Model(&models.BankQuestion{}).Count(&count)
+	if len(provider.Calls()) != 2 || count != 5 || len(quiz.Quiz) == 0 {
+		t.Errorf("%d calls, %d bank questions, %d served", len(provider.Calls()), count, len(quiz.Quiz))
+	}
+}
+
+func TestGenerateAdaptiveQuizErrors(t *testing.T) {
+	provider := setupHandlers(t, adaptiveReply)
+
+	// Nothing in the bank and nothing to write questions from
+	if w := post(t, GenerateAdaptiveQuiz, AdaptiveQuizRequest{Topic: "Photosynthesis"}); w.Code != http.StatusBadRequest {
+		t.Errorf("no explanation: status %d", w.Code)
+	}
+	if w := post(t, GenerateAdaptiveQuiz, AdaptiveQuizRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("no topic: status %d", w.Code)
+	}
+	if len(provider.Calls()) != 0 {
+		t.Error("the model was asked anyway")
+	}
+
+	// The saved explanation of the topic is used when none is sent
+	db.DB.Create(&models.Content{UserID: testUser, Topic: "Photosynthesis", Explanation: plantText})
+	var quiz PublicQuizResponse
+	decode(t, post(t, GenerateAdaptiveQuiz, AdaptiveQuizRequest{Topic: "Photosynthesis", Count: 50}), &quiz)
+	if !strings.Contains(provider.Calls()[0][0].Content, plantText) || len(quiz.Quiz) != 4 {
+		t.Errorf("%d questions", len(quiz.Quiz))
+	}
+
+	// Someone else's adaptive quiz can't be answered
+	theirs := models.AdaptiveQuiz{UserEmail: "someone@example.com", Topic: "Photosynthesis", Quiz: adaptiveReply}
+	db.DB.Create(&theirs)
+	if w := post(t, SubmitQuizAttempt, QuizAttemptRequest{AdaptiveQuizID: theirs.ID}); w.Code != http.StatusNotFound {
+		t.Errorf("their quiz: status %d", w.Code)
+	}
+	if w := post(t, SubmitQuizAttempt, QuizAttemptRequest{AdaptiveQuizID: theirs.ID, ContentID: 1}); w.Code != http.StatusBadRequest {
+		t.Errorf("two quizzes: status %d", w.Code)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// QuizAttemptRequest is a submission of a topic quiz (ContentID), a PDF quiz
+// (QuizSetID) or an adaptive quiz (AdaptiveQuizID). Answers holds one answer
+// per question, "" or null if skipped: the selected option text, true/false,
+// the word for a blank, a number, free text, or a list for multi-select
+// (the selected options) and ordering (the items in order) questions.
+// QuizVersion is the quiz_version a topic quiz was served with, if any.
+type QuizAttemptRequest struct {
+	ContentID      uint              `json:"content_id"`
+	QuizVersion    int               `json:"quiz_version"`
+	QuizSetID      uint              `json:"quiz_set_id"`
+	AdaptiveQuizID uint              `json:"adaptive_quiz_id"`
+	Answers        []SubmittedAnswer `json:"answers"`
+	StartedAt      time.Time         `json:"started_at"`
+}
+
+// SubmitQuizAttempt grades an attempt against the stored answers, saves it
+// and, on the first attempt at the quiz, updates the user's mastery of its topic.
+func SubmitQuizAttempt(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req QuizAttemptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	given := 0
+	for _, id := range []uint{req.ContentID, req.QuizSetID, req.AdaptiveQuizID} {
+		if id != 0 {
+			given++
+		}
+	}
+	if given != 1 {
+		http.Error(w, "Exactly one of content_id, quiz_set_id or adaptive_quiz_id is required", http.StatusBadRequest)
+		return
+	}
+
+	attempt := models.QuizAttempt{UserEmail: userEmail}
+	var storedQuiz, topic string
+	switch {
+	case req.ContentID != 0:
+		var content models.Content
+		if err := db.DB.First(&content, "id = ? AND user_id = ?", req.ContentID, userEmail).Error; err != nil {
+			http.Error(w, "Quiz not found", http.StatusNotFound)
+			return
+		}
+		// The quiz may have been regenerated since it was served
+		if req.QuizVersion != 0 && req.QuizVersion != content.QuizVersion {
+			http.Error(w, "The quiz has been regenerated, fetch it again", http.StatusConflict)
+			return
+		}
+		storedQuiz, topic = content.Quiz, content.Topic
+		attempt.ContentID, attempt.QuizVersion = &content.ID, content.QuizVersion
+	case req.QuizSetID != 0:
+		var quizSet models.QuizSet
+		if err := db.DB.First(&quizSet, "id = ? AND user_email = ?", req.QuizSetID, userEmail).Error; err != nil {
+			http.Error(w, "Quiz not found", http.StatusNotFound)
+			return
+		}
+		// PDF quizzes are rated under their title
+		storedQuiz, topic = quizSet.Quiz, quizSet.Title
+		attempt.QuizSetID = &quizSet.ID
+	default:
+		var adaptive models.AdaptiveQuiz
+		if err := db.DB.First(&adaptive, "id = ? AND user_email = ?", req.AdaptiveQuizID, userEmail).Error; err != nil {
+			http.Error(w, "Quiz not found", http.StatusNotFound)
+			return
+		}
+		storedQuiz, topic = adaptive.Quiz, adaptive.Topic
+		attempt.AdaptiveQuizID = &adaptive.ID
+	}
+
+	var quiz QuizResponse
+	if err := json.Unmarshal([]byte(storedQuiz), &quiz); err != nil || len(quiz.Quiz) == 0 {
+		http.Error(w, "Quiz has no questions to grade", http.StatusBadRequest)
+		return
+	}
+	if len(req.Answers) > len(quiz.Quiz) {
+		http.Error(w, "More answers than questions", http.StatusBadRequest)
+		return
+	}
+
+	// Grade every question, unanswered ones count as wrong
+	var graded []gradedAnswer
+	for i, question := range quiz.Quiz {
+		var submitted SubmittedAnswer
+		if i < len(req.Answers) {
+			submitted = req.Answers[i]
+		}
+		credit, feedback, err := gradeQuestion(r.Context(), question, submitted)
+		if err != nil {
+			log.Println("Failed to grade answer:", err)
+			http.Error(w, "Failed to grade short answers, please try again", http.StatusBadGateway)
+			return
+		}
+		correct := credit >= 1
+		if correct {
+			attempt.Score++
+		}
+		attempt.Points += credit
+		answer := models.QuizAttemptAnswer{
+			QuestionIndex: i,
+			Type:          questionType(question),
+			Question:      question.Question,
+			Selected:      submitted.String(),
+			CorrectAnswer: correctAnswer(question),
+			Correct:       correct,
+			Credit:        credit,
+			Feedback:      feedback,
+			Difficulty:    question.Difficulty,
+			Concept:       question.Concept,
+			Explanation:   question.Explanation,
+			WhyWrong:      whyWrong(question, submitted),
+		}
+		if question.Source != nil {
+			answer.SourceQuote, answer.SourcePage = question.Source.Quote, question.Source.Page
+		}
+		attempt.Answers = append(attempt.Answers, answer)
+		graded = append(graded, gradedAnswer{Difficulty: question.Difficulty, Concept: question.Concept, Credit: credit})
+	}
+	attempt.Total = len(quiz.Quiz)
+
+	attempt.SubmittedAt = time.Now()
+	attempt.StartedAt = req.StartedAt
+	if attempt.StartedAt.IsZero() || attempt.StartedAt.After(attempt.SubmittedAt) {
+		attempt.StartedAt = attempt.SubmittedAt
+	}
+	attempt.DurationSeconds = int(attempt.SubmittedAt.Sub(attempt.StartedAt).Seconds())
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the first attempt at these questions rates the user: retakes know the answers
+		var earlier int64
+		err := tx.Model(&models.QuizAttempt{}).Where(&models.QuizAttempt{
+			UserEmail: userEmail, ContentID: attempt.ContentID, QuizSetID: attempt.QuizSetID, AdaptiveQuizID: attempt.AdaptiveQuizID,
+		}).Where("quiz_version = ?", attempt.QuizVersion).Count(&earlier).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		if earlier > 0 {
+			return nil
+		}
+		return updateMastery(tx, userEmail, topic, graded)
+	})
+	if err != nil {
+		http.Error(w, "Failed to save attempt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempt)
+}
+
+// GetQuizAttempts lists the user's attempts at one quiz, newest first.
+// The quiz is chosen with the content_id, quiz_set_id or adaptive_quiz_id query param.
+func GetQuizAttempts(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	query := db.DB.Preload("Answers").Where("user_email = ?", userEmail)
+	if idStr := r.URL.Query().Get("content_id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid content_id", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("content_id = ?", id)
+	} else if idStr := r.URL.Query().Get("quiz_set_id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid quiz_set_id", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("quiz_set_id = ?", id)
+	} else if idStr := r.URL.Query().Get("adaptive_quiz_id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid adaptive_quiz_id", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("adaptive_quiz_id = ?", id)
+	} else {
+		http.Error(w, "Missing content_id, quiz_set_id or adaptive_quiz_id", http.StatusBadRequest)
+		return
+	}
+
+	attempts := []models.QuizAttempt{}
+	if err := query.Order("submitted_at desc").Find(&attempts).Error; err != nil {
+		http.Error(w, "Failed to fetch attempts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempts)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+const quizReply = `{"quiz": [
+	{"question": "What do plants make?", "options": ["Glucose", "Salt", "Iron", "Oil"], "answer": "Glucose",
+		"explanation": "Photosynthesis turns light into glucose.",
+		"distractors": {"Salt": "Plants take salt in, they don't make it.", "Iron": "Iron comes from the soil.", "Oil": "Oil isn't made in leaves."},
+		"source": {"quote": "Plants use light to make glucose"}},
+	{"question": "What do they need?", "options": ["Noise", "Light", "Sand", "Wind"], "answer": "Light",
+		"explanation": "Light is the energy glucose is made from.",
+		"distractors": {"Noise": "Plants can't use sound.", "Sand": "Sand isn't used.", "Wind": "Wind isn't an input."},
+		"source": {"quote": "Plants need light and water"}},
+	{"question": "Where does it happen?", "options": ["Roots", "Bark", "Chloroplasts", "Seeds"], "answer": "Chloroplasts",
+		"explanation": "Chloroplasts hold the chlorophyll.",
+		"distractors": {"Roots": "Roots get no light.", "Bark": "Bark is dead tissue.", "Seeds": "Seeds store food, they don't make it."},
+		"source": {"quote": "make glucose in chloroplasts"}}
+]}`
+
+// plantText is the explanation the quizzes are written from; every reply
+// quotes it.
+const plantText = "Plants use light to make glucose in chloroplasts. Plants need light and water, and they take in carbon dioxide. " +
+	"First they absorb light, then split water, then make glucose. Each glucose molecule has 6 carbon atoms. " +
+	"A plant in the dark has no light for glucose and starves. Chlorophyll reflects green light, so leaves look green."
+
+// get builds a GET of target, signed in as testUser.
+func get(t *testing.T, target string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	return r
+}
+
+func TestSubmitQuizAttempt(t *testing.T) {
+	setupHandlers(t, quizReply)
+
+	w := post(t, GenerateQuiz, QuizRequest{Topic: "Photosynthesis", Explanation: plantText})
+	if strings.Contains(w.Body.String(), `"answer"`) {
+		t.Errorf("the quiz was served with its answers: %s", w.Body)
+	}
+	var quiz PublicQuizResponse
+	decode(t, w, &quiz)
+	if len(quiz.Quiz) != 3 || quiz.ContentID == 0 {
+		t.Fatalf("quiz %+v", quiz)
+	}
+
+	// One right, one wrong, one skipped
+	var attempt models.QuizAttempt
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{ContentID: quiz.ContentID, Answers: textAnswers(" Glucose ", "Wind")}), &attempt)
+	if attempt.Score != 1 || attempt.Total != 3 || len(attempt.Answers) != 3 {
+		t.Fatalf("attempt %+v", attempt)
+	}
+	if a := attempt.Answers[1]; a.Correct || a.Selected != "Wind" || a.CorrectAnswer != "Light" {
+		t.Errorf("wrong answer %+v", a)
+	}
+	if a := attempt.Answers[2]; a.Correct || a.Selected != "" {
+		t.Errorf("skipped answer %+v", a)
+	}
+
+	// Once graded, each answer says why, and where in the text it came from
+	if a := attempt.Answers[1]; a.Explanation != "Light is the energy glucose is made from." || a.WhyWrong != "Wind isn't an input." || a.SourceQuote != "Plants need light and water" {
+		t.Errorf("rationale %+v", a)
+	}
+	if a := attempt.Answers[0]; a.WhyWrong != "" {
+		t.Errorf("a right answer was explained as wrong: %q", a.WhyWrong)
+	}
+	rating, _, _ := topicMastery(testUser, "Photosynthesis")
+	if rating == initialRating {
+		t.Error("the first attempt didn't rate the user")
+	}
+
+	// A retake is graded but doesn't change the rating
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{ContentID: quiz.ContentID, Answers: textAnswers("Glucose", "Light", "Chloroplasts")}), &attempt)
+	if attempt.Score != 3 {
+		t.Errorf("all right: score %d", attempt.Score)
+	}
+	if again, _, _ := topicMastery(testUser, "Photosynthesis"); again != rating {
+		t.Errorf("the retake moved the rating from %v to %v", rating, again)
+	}
+
+	// The history is newest first
+	var attempts []models.QuizAttempt
+	decode(t, serve(GetQuizAttempts, get(t, "/quiz-attempts?content_id="+itoa(quiz.ContentID))), &attempts)
+	if len(attempts) != 2 || attempts[0].Score != 3 || attempts[1].Score != 1 || len(attempts[1].Answers) != 3 {
+		t.Errorf("history %+v", attempts)
+	}
+}
+
+func TestRegeneratedQuizAttempts(t *testing.T) {
+	trueFalseReply := `{"quiz": [{"type": "true_false", "question": "Plants make glucose.", "answer": "True",
+		"explanation": "That is what photosynthesis is for.", "source": {"quote": "Plants use light to make glucose"}}]}`
+	setupHandlers(t, quizReply, trueFalseReply)
+
+	var first PublicQuizResponse
+	decode(t, post(t, GenerateQuiz, QuizRequest{Topic: "Photosynthesis", Explanation: plantText}), &first)
+	var attempt models.QuizAttempt
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{ContentID: first.ContentID, QuizVersion: first.QuizVersion, Answers: textAnswers("Glucose")}), &attempt)
+	rating, _, _ := topicMastery(testUser, "Photosynthesis")
+	if first.QuizVersion != 1 || attempt.QuizVersion != 1 {
+		t.Fatalf("quiz version %d, attempt at %d", first.QuizVersion, attempt.QuizVersion)
+	}
+
+	// Asking for other types writes a new version of the quiz
+	var second PublicQuizResponse
+	decode(t, post(t, GenerateQuiz, QuizRequest{Topic: "Photosynthesis", Explanation: plantText, Types: []string{questionTrueFalse}}), &second)
+	if second.ContentID != first.ContentID || second.QuizVersion != 2 || len(second.Quiz) != 1 {
+		t.Fatalf("regenerated %+v", second)
+	}
+
+	// Answers to the old questions aren't graded against the new ones
+	if w := post(t, SubmitQuizAttempt, QuizAttemptRequest{ContentID: first.ContentID, QuizVersion: 1, Answers: textAnswers("Glucose")}); w.Code != http.StatusConflict {
+		t.Errorf("stale version: status %d", w.Code)
+	}
+
+	// The first attempt at the new questions rates the user again
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{ContentID: first.ContentID, QuizVersion: 2, Answers: textAnswers("true")}), &attempt)
+	if attempt.Score != 1 || attempt.Total != 1 || attempt.QuizVersion != 2 {
+		t.Errorf("attempt at version 2 %+v", attempt)
+	}
+	if again, _, _ := topicMastery(testUser, "Photosynthesis"); again == rating {
+		t.Error("the first attempt at the new version didn't rate the user")
+	}
+
+	// The old attempt keeps the questions it was graded on
+	var attempts []models.QuizAttempt
+	decode(t, serve(GetQuizAttempts, get(t, "/quiz-attempts?content_id="+itoa(first.ContentID))), &attempts)
+	if len(attempts) != 2 || attempts[1].QuizVersion != 1 || attempts[1].Total != 3 || attempts[1].Answers[0].Question != "What do plants make?" {
+		t.Errorf("history %+v", attempts)
+	}
+}
+
+func TestSubmitQuizAttemptErrors(t *testing.T) {
+	setupHandlers(t)
+	mine := models.Content{UserID: testUser, Topic: "Mine", Quiz: quizReply}
+	theirs := models.Content{UserID: "someone@example.com", Topic: "Theirs", Quiz: quizReply}
+	db.DB.Create(&mine)
+	db.DB.Create(&theirs)
+
+	for name, tt := range map[string]struct {
+		req  QuizAttemptRequest
+		code int
+	}{
+		"no quiz":          {QuizAttemptRequest{Answers: textAnswers("Glucose")}, http.StatusBadRequest},
+		"both quizzes":     {QuizAttemptRequest{ContentID: mine.ID, QuizSetID: 1}, http.StatusBadRequest},
+		"someone else's":   {QuizAttemptRequest{ContentID: theirs.ID}, http.StatusNotFound},
+		"too many answers": {QuizAttemptRequest{ContentID: mine.ID, Answers: textAnswers("a", "b", "c", "d")}, http.StatusBadRequest},
+		"missing quiz set": {QuizAttemptRequest{QuizSetID: 99}, http.StatusNotFound},
+	} {
+		if w := post(t, SubmitQuizAttempt, tt.req); w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d: %s", name, w.Code, tt.code, w.Body)
+		}
+	}
+
+	if w := serve(GetQuizAttempts, get(t, "/quiz-attempts")); w.Code != http.StatusBadRequest {
+		t.Errorf("listing without a quiz: status %d", w.Code)
+	}
+}
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CSV, one question per row. Lists (options, answers) are separated by |.
+var csvColumns = []string{"type", "question", "options", "answer", "tolerance", "rubric", "explanation", "difficulty", "concept"}
+
+const csvListSeparator = "|"
+
+func writeCSV(title string, questions []QuizQuestion) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(csvColumns)
+	for _, q := range questions {
+		answer := q.Answer
+		switch questionType(q) {
+		case questionMultiSelect, questionFillBlank, questionOrdering:
+			answer = strings.Join(q.Answers, csvListSeparator)
+		case questionNumeric:
+			answer = strconv.FormatFloat(*q.Value, 'f', -1, 64)
+		}
+		tolerance, difficulty := "", ""
+		if q.Tolerance != 0 {
+			tolerance = strconv.FormatFloat(q.Tolerance, 'f', -1, 64)
+		}
+		if q.Difficulty != 0 {
+			difficulty = strconv.Itoa(q.Difficulty)
+		}
+		w.Write([]string{
+			questionType(q), q.Question, strings.Join(q.Options, csvListSeparator), answer,
+			tolerance, q.Rubric, q.Explanation, difficulty, q.Concept,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseCSV reads questions from a CSV file with a header row naming at least
+// the question and answer columns. The type defaults to multiple choice.
+func parseCSV(data []byte) ([]QuizQuestion, []string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("empty CSV")
+	}
+	index := map[string]int{}
+	for i, name := range rows[0] {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["question"]; !ok {
+		return nil, nil, fmt.Errorf("CSV needs a header row with at least \"question\" and \"answer\" columns")
+	}
+	if _, ok := index["answer"]; !ok {
+		return nil, nil, fmt.Errorf("CSV needs a header row with at least \"question\" and \"answer\" columns")
+	}
+
+	var questions []QuizQuestion
+	var skipped []string
+	for n, row := range rows[1:] {
+		get := func(column string) string {
+			if i, ok := index[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		list := func(column string) []string {
+			var items []string
+			for _, item := range strings.Split(get(column), csvListSeparator) {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items
+		}
+		if strings.Join(row, "") == "" {
+			continue
+		}
+
+		q := QuizQuestion{
+			Type:        get("type"),
+			Question:    get("question"),
+			Options:     list("options"),
+			Rubric:      get("rubric"),
+			Explanation: get("explanation"),
+			Concept:     get("concept"),
+		}
+		if q.Type == "" {
+			q.Type = questionMultipleChoice
+		}
+		q.Difficulty, _ = strconv.Atoi(get("difficulty"))
+		switch q.Type {
+		case questionMultiSelect, questionFillBlank, questionOrdering:
+			q.Answers = list("answer")
+		case questionNumeric:
+			value, err := strconv.ParseFloat(get("answer"), 64)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("row %d: answer %q is not a number", n+2, get("answer")))
+				continue
+			}
+			q.Value = &value
+			q.Tolerance, _ = strconv.ParseFloat(get("tolerance"), 64)
+		default:
+			q.Answer = get("answer")
+		}
+		questions = append(questions, q)
+	}
+	return questions, skipped, nil
+}
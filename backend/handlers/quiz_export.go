@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// quizFormat is a file format quizzes can be exported to and imported from.
+type quizFormat struct {
+	ext         string
+	contentType string
+	write       func(title string, questions []QuizQuestion) ([]byte, error)
+	// parse returns the questions it could read and why it left others out
+	parse func(data []byte) ([]QuizQuestion, []string, error)
+}
+
+var quizFormats = map[string]quizFormat{
+	"moodle": {".xml", "application/xml", writeMoodle, parseMoodle},
+	"gift":   {".gift", "text/plain; charset=utf-8", writeGIFT, parseGIFT},
+	"qti":    {".zip", "application/zip", writeQTI, parseQTI},
+	"csv":    {".csv", "text/csv; charset=utf-8", writeCSV, parseCSV},
+}
+
+const unknownFormat = "Unknown format: use moodle, gift, qti or csv"
+
+var (
+	htmlTag    = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	underscore = regexp.MustCompile(`_{3,}`)
+	unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// plainText turns the HTML other tools put in questions into plain text.
+func plainText(s string) string {
+	return collapseSpaces(html.UnescapeString(htmlTag.ReplaceAllString(s, " ")))
+}
+
+// collapseSpaces tidies text that is already plain, so a "<" in it stays.
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// withBlank makes a short-answer question a fill-in-the-blank one, using the
+// gap it already has if any.
+func withBlank(question string) string {
+	if underscore.MatchString(question) {
+		return underscore.ReplaceAllString(question, blankMarker)
+	}
+	return question + " " + blankMarker
+}
+
+// detectFormat guesses the format of an uploaded quiz from its name and content.
+func detectFormat(fileName string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".zip":
+		return "qti"
+	case ".gift", ".txt":
+		return "gift"
+	case ".csv":
+		return "csv"
+	case ".xml":
+		if bytes.Contains(data, []byte("<quiz")) {
+			return "moodle"
+		}
+		return "qti"
+	}
+	return ""
+}
+
+// ExportQuiz downloads a stored quiz (?content_id=, ?quiz_set_id= or
+// ?adaptive_quiz_id=) as Moodle XML, GIFT, a QTI 2.1 package or CSV (?format=).
+func ExportQuiz(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	query := r.URL.Query()
+	format, ok := quizFormats[strings.ToLower(query.Get("format"))]
+	if !ok {
+		http.Error(w, unknownFormat, http.StatusBadRequest)
+		return
+	}
+
+	var storedQuiz, title string
+	var err error
+	switch {
+	case query.Get("content_id") != "":
+		var content models.Content
+		err = db.DB.First(&content, "id = ? AND user_id = ?", query.Get("content_id"), userEmail).Error
+		storedQuiz, title = content.Quiz, content.Topic
+	case query.Get("quiz_set_id") != "":
+		var quizSet models.QuizSet
+		err = db.DB.First(&quizSet, "id = ? AND user_email = ?", query.Get("quiz_set_id"), userEmail).Error
+		storedQuiz, title = quizSet.Quiz, quizSet.Title
+	case query.Get("adaptive_quiz_id") != "":
+		var adaptive models.AdaptiveQuiz
+		err = db.DB.First(&adaptive, "id = ? AND user_email = ?", query.Get("adaptive_quiz_id"), userEmail).Error
+		storedQuiz, title = adaptive.Quiz, adaptive.Topic
+	default:
+		http.Error(w, "One of content_id, quiz_set_id or adaptive_quiz_id is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Quiz not found", http.StatusNotFound)
+		return
+	}
+
+	var quiz QuizResponse
+	if err := json.Unmarshal([]byte(storedQuiz), &quiz); err != nil || len(quiz.Quiz) == 0 {
+		http.Error(w, "Quiz has no questions to export", http.StatusBadRequest)
+		return
+	}
+	if title == "" {
+		title = "Quiz"
+	}
+	data, err := format.write(title, quiz.Quiz)
+	if err != nil {
+		http.Error(w, "Failed to export quiz: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fileName := strings.Trim(unsafeName.ReplaceAllString(title, "_"), "_")
+	if fileName == "" {
+		fileName = "quiz"
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+format.ext))
+	w.Write(data)
+}
+
+// ImportQuiz saves the questions of an uploaded Moodle XML, GIFT, QTI or CSV
+// file (form field "file") as a new quiz set. The format is taken from the
+// "format" field or guessed from the file; questions that can't be used are
+// listed in "skipped".
+func ImportQuiz(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
+		http.Error(w, "Error parsing form: file too large or invalid", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error retrieving file: ensure file field is named 'file'", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.ToLower(r.FormValue("format"))
+	if name == "" {
+		name = detectFormat(header.Filename, data)
+	}
+	format, ok := quizFormats[name]
+	if !ok {
+		http.Error(w, unknownFormat, http.StatusBadRequest)
+		return
+	}
+	parsed, skipped, err := format.parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keep the questions we can grade
+	var questions []QuizQuestion
+	for i, q := range parsed {
+		q = prepareQuestion(q)
+		var problems llm.ValidationError
+		validateQuestion(i+1, q, &problems)
+		if problems.Err() != nil {
+			skipped = append(skipped, strings.Join(problems.Problems, "; "))
+			continue
+		}
+		questions = append(questions, q)
+	}
+	if skipped == nil {
+		skipped = []string{}
+	}
+	if len(questions) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "No usable questions found", "skipped": skipped})
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+	quizJSON, _ := json.Marshal(QuizResponse{Quiz: questions})
+	quizSet := models.QuizSet{UserEmail: userEmail, Title: title, Quiz: string(quizJSON)}
+	if err := db.DB.Create(&quizSet).Error; err != nil {
+		http.Error(w, "Failed to save quiz", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"quiz_set_id": quizSet.ID,
+		"title":       quizSet.Title,
+		"imported":    len(questions),
+		"skipped":     skipped,
+		"format":      name,
+	})
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+)
+
+// roundTripQuiz has one question of every type, with the characters each
+// format has to escape.
+var roundTripQuiz = []QuizQuestion{
+	{
+		Question:    `Which of {these} is a "noble" gas: ~ = # : & <b>?`,
+		Options:     []string{"Neon {Ne}", "Oxygen = O", "Iron ~ Fe", "Salt, NaCl"},
+		Answer:      "Neon {Ne}",
+		Explanation: "Neon has a full outer shell.",
+		Distractors: map[string]string{"Iron ~ Fe": "Iron is a metal: it #rusts."},
+	},
+	{Type: questionTrueFalse, Question: "Water boils at 100 °C at sea level.", Answer: "true"},
+	{Type: questionTrueFalse, Question: "The Sun orbits the Earth.", Answer: "false"},
+	{
+		Type:     questionMultiSelect,
+		Question: "Which are primes?",
+		Options:  []string{"2", "4", "5", "9"},
+		Answers:  []string{"2", "5"},
+	},
+	{
+		Type:     questionFillBlank,
+		Question: "The powerhouse of the cell is the ___.",
+		Answers:  []string{"mitochondrion", "mitochondria"},
+	},
+	{
+		Type:     questionOrdering,
+		Question: "Put the planets in order from the Sun.",
+		Answers:  []string{"Mercury", "Venus", "Earth", "Mars"},
+	},
+	{Type: questionNumeric, Question: "What is pi to two decimals?", Value: float(3.14), Tolerance: 0.005},
+	{Type: questionNumeric, Question: "How many legs does a spider have?", Value: float(8)},
+	{
+		Type:     questionShortAnswer,
+		Question: "Why is the sky blue?",
+		Answer:   "Air scatters blue light more than red (Rayleigh scattering).",
+		Rubric:   "Mentions scattering; mentions shorter wavelengths.",
+	},
+}
+
+// gradedPart is what grading a question depends on.
+type gradedPart struct {
+	Type, Question, Answer string
+	Options, Answers       []string
+	Value                  *float64
+	Tolerance              float64
+}
+
+func gradedPartOf(q QuizQuestion) gradedPart {
+	g := gradedPart{Type: questionType(q), Question: q.Question, Answer: q.Answer, Value: q.Value, Tolerance: q.Tolerance}
+	g.Options = append(g.Options, q.Options...)
+	g.Answers = append(g.Answers, q.Answers...)
+	switch g.Type {
+	case questionOrdering:
+		g.Options = nil // Scrambled again on import
+	case questionMultiSelect, questionFillBlank:
+		sort.Strings(g.Answers)
+	case questionShortAnswer:
+		g.Answer = "" // Only guides grading by the model
+	}
+	sort.Strings(g.Options)
+	return g
+}
+
+func TestQuizFormatsRoundTrip(t *testing.T) {
+	var original []QuizQuestion
+	for _, q := range roundTripQuiz {
+		original = append(original, prepareQuestion(q))
+	}
+	for name, format := range quizFormats {
+		t.Run(name, func(t *testing.T) {
+			data, err := format.write("Round trip", original)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := detectFormat("quiz"+format.ext, data); got != name {
+				t.Errorf("detected as %q", got)
+			}
+			parsed, skipped, err := format.parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(skipped) > 0 {
+				t.Errorf("skipped %q", skipped)
+			}
+			want := original
+			if name == "gift" {
+				// GIFT has no ordering questions, they are left out
+				want = nil
+				for _, q := range original {
+					if q.Type != questionOrdering {
+						want = append(want, q)
+					}
+				}
+			}
+			if len(parsed) != len(want) {
+				t.Fatalf("read %d questions, want %d", len(parsed), len(want))
+			}
+			for i, q := range parsed {
+				q = prepareQuestion(q)
+				var problems llm.ValidationError
+				validateQuestion(i+1, q, &problems)
+				if err := problems.Err(); err != nil {
+					t.Errorf("question %d: %v", i+1, err)
+				}
+				if got, want := gradedPartOf(q), gradedPartOf(want[i]); !reflect.DeepEqual(got, want) {
+					t.Errorf("question %d:\n got %+v\nwant %+v", i+1, got, want)
+				}
+				if name != "qti" && name != "csv" && i == 0 {
+					if q.Explanation != want[0].Explanation || !reflect.DeepEqual(q.Distractors, want[0].Distractors) {
+						t.Errorf("feedback: got %q %q", q.Explanation, q.Distractors)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseGIFT(t *testing.T) {
+	data := `// From the GIFT documentation
+::Grant::Who's buried in Grant's tomb?{~Grant ~no one =nobody#He's entombed, not buried ~ Napoleon}
+
+Grant was buried in a tomb in New York City.{T#It's a tomb}
+
+::Cats::[html]The <b>cat</b> sat on the {=mat =rug} of the house.
+
+When was Ulysses S. Grant born?{#1822:5}
+
+What is the value of pi (to 3 decimal places)? {#3.141..3.142}
+
+Two primes are {~%50%2 ~%50%3 ~%-100%4}
+
+Match these {=a -> b =c -> d}
+`
+	questions, skipped, err := parseGIFT([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 6 || len(skipped) != 1 {
+		t.Fatalf("read %d questions, skipped %q", len(questions), skipped)
+	}
+
+	if q := questions[0]; q.Type != questionMultipleChoice || q.Answer != "nobody" || len(q.Options) != 4 || q.Options[3] != "Napoleon" {
+		t.Errorf("multiple choice: %+v", q)
+	}
+	if q := questions[1]; q.Type != questionTrueFalse || q.Answer != "true" {
+		t.Errorf("true/false: %+v", q)
+	}
+	if q := questions[2]; q.Type != questionFillBlank || q.Question != "The cat sat on the ___ of the house." || len(q.Answers) != 2 {
+		t.Errorf("fill in the blank: %+v", q)
+	}
+	if q := questions[3]; q.Type != questionNumeric || *q.Value != 1822 || q.Tolerance != 5 {
+		t.Errorf("numeric: %+v", q)
+	}
+	if q := questions[4]; q.Type != questionNumeric || math.Abs(*q.Value-3.1415) > 1e-9 || math.Abs(q.Tolerance-0.0005) > 1e-9 {
+		t.Errorf("numeric range: %+v", q)
+	}
+	if q := questions[5]; q.Type != questionMultiSelect || !reflect.DeepEqual(q.Answers, []string{"2", "3"}) {
+		t.Errorf("multi-select: %+v", q)
+	}
+}
+
+func TestGIFTEscape(t *testing.T) {
+	for _, s := range []string{`plain`, `a ~ b = c # d { e } f : g \ h`, "two\nlines", `\~`} {
+		if got := giftUnescape(giftEscape(s)); got != s {
+			t.Errorf("giftUnescape(giftEscape(%q)) = %q", s, got)
+		}
+		if i := giftIndex(giftEscape(s), "~=#{}:\n"); i >= 0 {
+			t.Errorf("giftEscape(%q) leaves a special character at %d", s, i)
+		}
+	}
+	parts := giftSplit(`=a\=b ~c\~d ~e`, "=~")
+	if !reflect.DeepEqual(parts, []string{`=a\=b `, `~c\~d `, `~e`}) {
+		t.Errorf("giftSplit = %q", parts)
+	}
+}
+
+// importQuiz uploads data as a quiz file, with the given form fields.
+func importQuiz(t *testing.T, name string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for k, v := range fields {
+		form.WriteField(k, v)
+	}
+	part, _ := form.CreateFormFile("file", name)
+	part.Write(data)
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/quiz-import", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+testToken(t))
+	return serve(ImportQuiz, r)
+}
+
+func TestExportImportQuiz(t *testing.T) {
+	setupHandlers(t)
+	mine := models.Content{UserID: testUser, Topic: "Photosynthesis 101", Quiz: quizReply}
+	theirs := models.Content{UserID: "someone@example.com", Topic: "Theirs", Quiz: quizReply}
+	db.DB.Create(&mine)
+	db.DB.Create(&theirs)
+
+	w := serve(ExportQuiz, get(t, "/quiz-export?format=gift&content_id="+itoa(mine.ID)))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="Photosynthesis_101.gift"` {
+		t.Fatalf("status %d, headers %v", w.Code, w.Header())
+	}
+
+	// The export comes back as a quiz set that can be attempted
+	var imported struct {
+		QuizSetID uint     `json:"quiz_set_id"`
+		Title     string   `json:"title"`
+		Imported  int      `json:"imported"`
+		Skipped   []string `json:"skipped"`
+		Format    string   `json:"format"`
+	}
+	decodeStatus(t, importQuiz(t, "plants.gift", w.Body.Bytes(), nil), &imported)
+	if imported.Imported != 3 || len(imported.Skipped) != 0 || imported.Format != "gift" || imported.Title != "plants" {
+		t.Fatalf("imported %+v", imported)
+	}
+	var attempt models.QuizAttempt
+	decode(t, post(t, SubmitQuizAttempt, QuizAttemptRequest{QuizSetID: imported.QuizSetID, Answers: textAnswers("Glucose", "Light", "Roots")}), &attempt)
+	if attempt.Score != 2 {
+		t.Errorf("score %d", attempt.Score)
+	}
+
+	// Questions that can't be graded are skipped, and a file of only those is refused
+	csv := "type,question,options,answer\nmultiple_choice,What do plants make?,Glucose|Salt|Iron|Oil,Glucose\nmultiple_choice,Broken?,a|b,c\n"
+	decodeStatus(t, importQuiz(t, "plants.csv", []byte(csv), map[string]string{"title": "Mine"}), &imported)
+	if imported.Imported != 1 || len(imported.Skipped) != 1 || imported.Title != "Mine" {
+		t.Errorf("imported %+v", imported)
+	}
+	if w := importQuiz(t, "broken.csv", []byte("type,question,options,answer\nmultiple_choice,Broken?,a|b,c\n"), nil); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "skipped") {
+		t.Errorf("nothing usable: status %d: %s", w.Code, w.Body)
+	}
+
+	for target, code := range map[string]int{
+		"/quiz-export?format=gift&content_id=" + itoa(theirs.ID): http.StatusNotFound,
+		"/quiz-export?format=pdf&content_id=" + itoa(mine.ID):    http.StatusBadRequest,
+		"/quiz-export?format=gift":                               http.StatusBadRequest,
+	} {
+		if w := serve(ExportQuiz, get(t, target)); w.Code != code {
+			t.Errorf("%s: status %d, want %d", target, w.Code, code)
+		}
+	}
+	if w := importQuiz(t, "plants.pdf", []byte("%PDF"), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d", w.Code)
+	}
+}
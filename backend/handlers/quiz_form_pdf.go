@@ -6,23 +6,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
 	"tutor_genX/db"
+	"tutor_genX/jobs"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
-const maxChunkSize = 10000
-
 type QuizRequest2 struct {
-	PDFtext  string `json:"pdftext"`
-	FileName string `json:"fileName,omitempty"`
+	PDFtext    string `json:"pdftext"`
+	DocumentID uint   `json:"document_id,omitempty"`
+	FileName   string `json:"fileName,omitempty"`
+	Chapter    int    `json:"chapter,omitempty"`
 }
 
 func GenerateQuizFromPdf(w http.ResponseWriter, r *http.Request) {
@@ -40,57 +38,37 @@ func GenerateQuizFromPdf(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-
-	title := req.FileName
-	if title == "" {
-		// AI Title Generation Logic would be here
-		// For now, we'll use a snippet as a fallback
-		if len(req.PDFtext) > 50 {
-			title = req.PDFtext[:50] + "..."
-		} else {
-			title = req.PDFtext
-		}
-	}
-	if req.PDFtext == "" {
+	if req.PDFtext == "" && req.DocumentID == 0 {
 		http.Error(w, "PDF text is required", http.StatusBadRequest)
 		return
 	}
-	// 1. Check for existing content in the database
-	var quizSet models.QuizSet
-	result := db.DB.Where("user_email = ? AND pdf_text = ? AND title = ?", userEmail, req.PDFtext[:50], title).First(&quizSet)
-	if result.Error == nil {
-		if quizSet.Quiz != "" {
-			var cachedQuiz QuizResponse
-			if err := json.Unmarshal([]byte(quizSet.Quiz), &cachedQuiz); err != nil {
-				http.Error(w, "Failed to parse cached quiz", http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(cachedQuiz)
-			return
-		}
-	} else if result.Error != gorm.ErrRecordNotFound {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	if req.Chapter != 0 && req.DocumentID == 0 {
+		http.Error(w, "A chapter needs a document ID", http.StatusBadRequest)
 		return
 	}
 
-	// 2. Content not in cache: proceed with generation
-
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
+	job, ok := runGeneration(w, r, userEmail, GenerationRequest{Kind: quizJob, PDFtext: req.PDFtext, DocumentID: req.DocumentID, FileName: req.FileName, Chapter: req.Chapter})
+	if !ok {
 		return
 	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
 
-	var allQuizQuestions []QuizQuestion
+	var quizSet models.QuizSet
+	if err := db.DB.First(&quizSet, *job.ResultID).Error; err != nil {
+		http.Error(w, "Failed to fetch quiz", http.StatusInternalServerError)
+		return
+	}
+	var quiz QuizResponse
+	if err := json.Unmarshal([]byte(quizSet.Quiz), &quiz); err != nil {
+		http.Error(w, "Failed to parse cached quiz", http.StatusInternalServerError)
+		return
+	}
 
-	textChunks := chunkText(req.PDFtext, maxChunkSize)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PublicQuizResponse{Quiz: quiz.Public(), QuizSetID: quizSet.ID})
+}
 
-	for _, chunk := range textChunks {
-		prompt := fmt.Sprintf(`You are a quiz generator. Create EXACTLY 3-5 multiple choice questions based ONLY on the provided text.
+func quizPrompt(chunk string) string {
+	return fmt.Sprintf(`You are a quiz generator. Create EXACTLY 3-5 multiple choice questions based ONLY on the provided text.
 
 STRICT REQUIREMENTS:
 1. Base questions ONLY on facts explicitly mentioned in the explanation
@@ -106,7 +84,10 @@ OUTPUT FORMAT (JSON only, no markdown or extra text):
     {
       "question": "Clear, specific question based on explanation content?",
       "options": ["Option A", "Option B", "Option C", "Option D"],
-      "answer": "Option B"
+      "answer": "Option B",
+      "explanation": "Why Option B is correct, according to the text",
+      "distractors": {"Option A": "Why it is wrong", "Option C": "Why it is wrong", "Option D": "Why it is wrong"},
+      "source": {"quote": "The sentence of the text the question was written from, copied word for word"}
     }
   ]
 }
@@ -118,74 +99,68 @@ VALIDATION:
 text: %s
 
 Generate quiz now:`, chunk)
+}
 
-		resp, err := client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model: "llama-3.3-70b-versatile",
-				Messages: []openai.ChatCompletionMessage{
-					{
-						Role:    openai.ChatMessageRoleUser,
-						Content: prompt,
-					},
-				},
-			},
-		)
+// cachedQuizSet finds a quiz already generated from the same document, or
+// chapter of it.
+func cachedQuizSet(userEmail string, documentID uint, chapter int) (models.QuizSet, bool, error) {
+	var quizSet models.QuizSet
+	err := db.DB.Where("user_email = ? AND document_id = ? AND chapter = ?", userEmail, documentID, chapter).First(&quizSet).Error
+	if err == gorm.ErrRecordNotFound {
+		return quizSet, false, nil
+	}
+	return quizSet, err == nil && quizSet.Quiz != "", err
+}
 
-		if err != nil {
-			fmt.Printf("Error generating quiz for a chunk: %v\n", err)
-			continue
+// quizKind generates questions chunk by chunk and saves them as one QuizSet.
+var quizKind = jobs.Kind{
+	Chunk: func(ctx context.Context, job *models.Job, chunk models.JobChunk) (string, int, error) {
+		var generated QuizResponse
+		if err := completeGroundedQuiz(ctx, quizPrompt(chunk.Text), chunk.Text, &generated); err != nil {
+			return "", 0, err
 		}
-
-		var generatedQuiz QuizResponse
-		responseContent := strings.TrimSpace(resp.Choices[0].Message.Content)
-
-		if strings.Contains(responseContent, `"quiz": []`) {
-			// Handle cases where the API explicitly returns an empty quiz
-			continue
+		for _, q := range generated.Quiz {
+			q.Source.Chunk = chunk.Index + 1
 		}
-
-		if err := json.Unmarshal([]byte(responseContent), &generatedQuiz); err != nil {
-			fmt.Printf("Error parsing quiz JSON for a chunk: %v\n", err)
-			continue
+		if job.DocumentID != 0 {
+			var pages []models.DocumentPage
+			if err := db.DB.Where("document_id = ?", job.DocumentID).Order("number").Find(&pages).Error; err == nil {
+				locatePages(&generated, pages)
+			}
 		}
-
-		allQuizQuestions = append(allQuizQuestions, generatedQuiz.Quiz...)
-	}
-
-	if len(allQuizQuestions) == 0 {
-		http.Error(w, "Insufficient content for quiz generation", http.StatusBadRequest)
-		return
-	}
-
-	finalResponse := QuizResponse{Quiz: allQuizQuestions}
-	quizJSON, _ := json.Marshal(finalResponse)
-
-	// 2. Save the new quiz to the database
-	if result.Error == gorm.ErrRecordNotFound {
-		newQuizSet := models.QuizSet{
-			UserEmail: userEmail,
-			Title:     title,
-			PDFText:   req.PDFtext[:50],
-			Quiz:      string(quizJSON),
+		output, err := json.Marshal(generated)
+		return string(output), len(generated.Quiz), err
+	},
+	Finish: func(job *models.Job, outputs []string) (uint, error) {
+		var allQuizQuestions []QuizQuestion
+		for _, output := range outputs {
+			var generated QuizResponse
+			if err := json.Unmarshal([]byte(output), &generated); err != nil {
+				return 0, err
+			}
+			allQuizQuestions = append(allQuizQuestions, generated.Quiz...)
 		}
-		db.DB.Create(&newQuizSet)
-	} else {
-		db.DB.Model(&quizSet).Where("user_email = ? AND pdf_text = ? AND title = ?", userEmail, req.PDFtext[:50], title).Update("quiz", string(quizJSON))
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(finalResponse)
-}
+		if len(allQuizQuestions) == 0 {
+			return 0, errInsufficientContent
+		}
+		quizJSON, _ := json.Marshal(QuizResponse{Quiz: allQuizQuestions})
 
-func chunkText(text string, size int) []string {
-	var chunks []string
-	for i := 0; i < len(text); i += size {
-		end := i + size
-		if end > len(text) {
-			end = len(text)
+		quizSet, _, err := cachedQuizSet(job.UserEmail, job.DocumentID, job.Chapter)
+		if err != nil {
+			return 0, err
 		}
-		chunks = append(chunks, text[i:end])
-	}
-	return chunks
+		if quizSet.ID == 0 {
+			quizSet = models.QuizSet{
+				UserEmail:  job.UserEmail,
+				Title:      job.Title,
+				DocumentID: jobDocument(job),
+				Chapter:    job.Chapter,
+				Quiz:       string(quizJSON),
+			}
+			err = db.DB.Create(&quizSet).Error
+		} else {
+			err = db.DB.Model(&quizSet).Update("quiz", string(quizJSON)).Error
+		}
+		return quizSet.ID, err
+	},
 }
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GIFT, Moodle's plain text question format.
+// https://docs.moodle.org/en/GIFT_format
+
+var giftSpecial = strings.NewReplacer(`\`, `\\`, `~`, `\~`, `=`, `\=`, `#`, `\#`, `{`, `\{`, `}`, `\}`, `:`, `\:`, "\n", `\n`)
+
+func giftEscape(s string) string {
+	return giftSpecial.Replace(s)
+}
+
+func giftUnescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// writeGIFT renders a quiz as GIFT. GIFT has no ordering questions, those
+// are left as comments.
+func writeGIFT(title string, questions []QuizQuestion) ([]byte, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// %s\n$CATEGORY: $course$/%s\n\n", strings.ReplaceAll(title, "\n", " "), giftEscape(strings.ReplaceAll(title, "/", "-")))
+	for i, q := range questions {
+		name := fmt.Sprintf("::Q%d::[plain]", i+1)
+		feedback, feedbackLine := "", ""
+		if q.Explanation != "" {
+			feedback = "####" + giftEscape(q.Explanation)
+			feedbackLine = "\t" + feedback + "\n"
+		}
+		note := func(opt string) string {
+			if why := q.Distractors[opt]; why != "" {
+				return "#" + giftEscape(why)
+			}
+			return ""
+		}
+
+		switch questionType(q) {
+		case questionMultipleChoice:
+			fmt.Fprintf(&sb, "%s%s {\n", name, giftEscape(q.Question))
+			for _, opt := range q.Options {
+				if opt == q.Answer {
+					fmt.Fprintf(&sb, "\t=%s\n", giftEscape(opt))
+				} else {
+					fmt.Fprintf(&sb, "\t~%s%s\n", giftEscape(opt), note(opt))
+				}
+			}
+			fmt.Fprintf(&sb, "%s}\n\n", feedbackLine)
+		case questionMultiSelect:
+			right := map[string]bool{}
+			for _, a := range q.Answers {
+				right[a] = true
+			}
+			weight := strconv.FormatFloat(100/float64(len(q.Answers)), 'f', -1, 64)
+			if len(weight) > 8 {
+				weight = strconv.FormatFloat(100/float64(len(q.Answers)), 'f', 5, 64)
+			}
+			fmt.Fprintf(&sb, "%s%s {\n", name, giftEscape(q.Question))
+			for _, opt := range q.Options {
+				if right[opt] {
+					fmt.Fprintf(&sb, "\t~%%%s%%%s\n", weight, giftEscape(opt))
+				} else {
+					fmt.Fprintf(&sb, "\t~%%-100%%%s%s\n", giftEscape(opt), note(opt))
+				}
+			}
+			fmt.Fprintf(&sb, "%s}\n\n", feedbackLine)
+		case questionTrueFalse:
+			value, _ := parseBool(q.Answer)
+			answer := "FALSE"
+			if value {
+				answer = "TRUE"
+			}
+			fmt.Fprintf(&sb, "%s%s {%s%s}\n\n", name, giftEscape(q.Question), answer, feedback)
+		case questionFillBlank:
+			var accepted []string
+			for _, a := range q.Answers {
+				accepted = append(accepted, "="+giftEscape(a))
+			}
+			before, after, _ := strings.Cut(q.Question, blankMarker)
+			fmt.Fprintf(&sb, "%s%s {%s%s} %s\n\n", name, giftEscape(strings.TrimSpace(before)), strings.Join(accepted, " "), feedback, giftEscape(strings.TrimSpace(after)))
+		case questionNumeric:
+			fmt.Fprintf(&sb, "%s%s {#%s:%s%s}\n\n", name, giftEscape(q.Question),
+				strconv.FormatFloat(*q.Value, 'f', -1, 64), strconv.FormatFloat(q.Tolerance, 'f', -1, 64), feedback)
+		case questionShortAnswer:
+			// Essays have no answer in GIFT, the model answer goes in the feedback
+			feedback = "####" + giftEscape(strings.TrimSpace("Model answer: "+q.Answer+"\n"+q.Explanation))
+			fmt.Fprintf(&sb, "%s%s {%s}\n\n", name, giftEscape(q.Question), feedback)
+		case questionOrdering:
+			fmt.Fprintf(&sb, "// Q%d is an ordering question, which GIFT can't express: %s\n\n", i+1, strings.ReplaceAll(q.Question, "\n", " "))
+		}
+	}
+	return []byte(sb.String()), nil
+}
+
+var (
+	giftTitle  = regexp.MustCompile(`^::(?:[^:\\]|\\.)*::`)
+	giftFormat = regexp.MustCompile(`^\[(html|moodle|plain|markdown)\]`)
+	giftWeight = regexp.MustCompile(`^%(-?[0-9.]+)%`)
+)
+
+// giftIndex finds the first unescaped occurrence of any byte in chars.
+func giftIndex(s, chars string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(chars, s[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// giftSplit cuts s at every unescaped occurrence of sep, keeping the
+// separators at the start of each part.
+func giftSplit(s, seps string) []string {
+	var parts []string
+	for {
+		i := giftIndex(s[min(1, len(s)):], seps)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i+1])
+		s = s[i+1:]
+	}
+}
+
+// parseGIFT reads the questions of a GIFT file. Question types we have no
+// equivalent for are reported in skipped.
+func parseGIFT(data []byte) ([]QuizQuestion, []string, error) {
+	// Questions are separated by blank lines; comments and categories are ignored
+	var blocks []string
+	var current []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "//"), strings.HasPrefix(trimmed, "$CATEGORY:"):
+		case trimmed == "":
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+				current = nil
+			}
+		default:
+			current = append(current, line)
+		}
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+
+	var questions []QuizQuestion
+	var skipped []string
+	for n, block := range blocks {
+		q, err := parseGIFTQuestion(strings.TrimSpace(block))
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("question %d: %v", n+1, err))
+			continue
+		}
+		questions = append(questions, q)
+	}
+	return questions, skipped, nil
+}
+
+func parseGIFTQuestion(block string) (QuizQuestion, error) {
+	var q QuizQuestion
+	block = strings.TrimSpace(giftTitle.ReplaceAllString(block, ""))
+	// Text is HTML unless marked [plain] or [markdown]
+	readText := plainText
+	if m := giftFormat.FindStringSubmatch(block); m != nil {
+		if m[1] == "plain" || m[1] == "markdown" {
+			readText = collapseSpaces
+		}
+		block = strings.TrimSpace(block[len(m[0]):])
+	}
+
+	open := giftIndex(block, "{")
+	if open < 0 {
+		return q, fmt.Errorf("no answers, descriptions aren't supported")
+	}
+	end := giftIndex(block[open:], "}")
+	if end < 0 {
+		return q, fmt.Errorf("unclosed {")
+	}
+	before, body, after := block[:open], block[open+1:open+end], block[open+end+1:]
+	text := giftUnescape(before)
+	if tail := giftUnescape(after); tail != "" {
+		if !strings.ContainsAny(tail[:1], ".,;:!?)") {
+			tail = " " + tail
+		}
+		text = strings.TrimSpace(text + " " + blankMarker + tail)
+	}
+	q.Question = readText(text)
+
+	// General feedback is the explanation
+	feedback := ""
+	if i := strings.Index(body, "####"); i >= 0 && (i == 0 || body[i-1] != '\\') {
+		feedback = giftUnescape(body[i+4:])
+		q.Explanation = readText(feedback)
+		body = body[:i]
+	}
+	body = strings.TrimSpace(body)
+
+	switch strings.ToUpper(body) {
+	case "":
+		q.Type = questionShortAnswer
+		if rest, ok := strings.CutPrefix(feedback, "Model answer: "); ok {
+			answer, explanation, _ := strings.Cut(rest, "\n")
+			q.Answer, q.Explanation = readText(answer), readText(explanation)
+		}
+		return q, nil
+	case "T", "TRUE", "F", "FALSE":
+		q.Type, q.Answer = questionTrueFalse, strconv.FormatBool(strings.HasPrefix(strings.ToUpper(body), "T"))
+		return q, nil
+	}
+	// True/false answers may carry feedback
+	if i := giftIndex(body, "#"); i > 0 {
+		if value, ok := parseBool(body[:i]); ok && !strings.ContainsAny(body[:i], "=~") {
+			q.Type, q.Answer = questionTrueFalse, strconv.FormatBool(value)
+			return q, nil
+		}
+	}
+
+	if strings.HasPrefix(body, "#") {
+		return parseGIFTNumeric(q, body[1:])
+	}
+	if giftIndex(body, ">") >= 0 && strings.Contains(body, "->") {
+		return q, fmt.Errorf("matching questions aren't supported")
+	}
+
+	type giftAnswer struct {
+		text, feedback string
+		weight         float64
+	}
+	var answers []giftAnswer
+	wrong := false
+	for _, part := range giftSplit(body, "=~") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		a := giftAnswer{weight: 100}
+		if part[0] == '~' {
+			a.weight = 0
+			wrong = true
+		} else if part[0] != '=' {
+			return q, fmt.Errorf("can't read answer %q", part)
+		}
+		part = strings.TrimSpace(part[1:])
+		if m := giftWeight.FindStringSubmatch(part); m != nil {
+			a.weight, _ = strconv.ParseFloat(m[1], 64)
+			part = part[len(m[0]):]
+		}
+		if i := giftIndex(part, "#"); i >= 0 {
+			a.feedback = readText(giftUnescape(part[i+1:]))
+			part = part[:i]
+		}
+		a.text = readText(giftUnescape(part))
+		answers = append(answers, a)
+	}
+	if len(answers) == 0 {
+		return q, fmt.Errorf("no answers")
+	}
+
+	if !wrong {
+		// Only right answers: short answer, accepted as typed
+		q.Type = questionFillBlank
+		q.Question = withBlank(q.Question)
+		for _, a := range answers {
+			if a.weight >= 100 {
+				q.Answers = append(q.Answers, a.text)
+			}
+		}
+		return q, nil
+	}
+
+	right := 0
+	for _, a := range answers {
+		if a.weight > 0 {
+			right++
+		}
+	}
+	q.Type = questionMultipleChoice
+	if right > 1 {
+		q.Type = questionMultiSelect
+	}
+	best := 0.0
+	for _, a := range answers {
+		q.Options = append(q.Options, a.text)
+		switch {
+		case q.Type == questionMultiSelect && a.weight > 0:
+			q.Answers = append(q.Answers, a.text)
+		case q.Type == questionMultipleChoice && a.weight > best:
+			q.Answer, best = a.text, a.weight
+		}
+		if a.weight <= 0 && a.feedback != "" {
+			if q.Distractors == nil {
+				q.Distractors = map[string]string{}
+			}
+			q.Distractors[a.text] = a.feedback
+		}
+	}
+	return q, nil
+}
+
+// parseGIFTNumeric reads "value:tolerance", "min..max" or a list of such
+// answers prefixed with =, taking the first full-credit one.
+func parseGIFTNumeric(q QuizQuestion, body string) (QuizQuestion, error) {
+	q.Type = questionNumeric
+	for _, part := range giftSplit(strings.TrimSpace(body), "=") {
+		part = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), "="))
+		if m := giftWeight.FindStringSubmatch(part); m != nil {
+			if weight, _ := strconv.ParseFloat(m[1], 64); weight < 100 {
+				continue
+			}
+			part = part[len(m[0]):]
+		}
+		if i := giftIndex(part, "#"); i >= 0 {
+			part = part[:i]
+		}
+		part = strings.TrimSpace(part)
+		if lo, hi, ok := strings.Cut(part, ".."); ok {
+			low, err1 := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+			high, err2 := strconv.ParseFloat(strings.TrimSpace(hi), 64)
+			if err1 == nil && err2 == nil {
+				value := (low + high) / 2
+				q.Value, q.Tolerance = &value, (high-low)/2
+				return q, nil
+			}
+			continue
+		}
+		value, tolerance, _ := strings.Cut(part, ":")
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+		q.Value = &v
+		if tolerance != "" {
+			q.Tolerance, _ = strconv.ParseFloat(strings.TrimSpace(tolerance), 64)
+		}
+		return q, nil
+	}
+	return q, fmt.Errorf("can't read numeric answer %q", body)
+}
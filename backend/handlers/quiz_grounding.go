@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"tutor_genX/llm"
+	"tutor_genX/models"
+)
+
+// QuestionSource is the span of the source text a question was written from:
+// the topic's explanation, or a chunk of a PDF.
+type QuestionSource struct {
+	Quote string `json:"quote"`
+	Start int    `json:"start"`           // Byte offsets of the quote in the explanation or chunk
+	End   int    `json:"end"`             //
+	Chunk int    `json:"chunk,omitempty"` // 1-based chunk of the PDF text
+	Page  int    `json:"page,omitempty"`  // PDF page the quote is on, when it could be found
+}
+
+// minQuoteLength keeps quotes long enough to pin down a passage.
+const minQuoteLength = 20
+
+// locateQuote finds quote in source, ignoring case and spacing, and returns
+// its byte offsets in source.
+func locateQuote(source, quote string) (int, int, bool) {
+	quote = strings.Trim(strings.TrimSpace(quote), "\"'“”…")
+	want := strings.ToLower(strings.Join(strings.Fields(quote), " "))
+	if len(want) < minQuoteLength {
+		return 0, 0, false
+	}
+
+	// Normalize source the same way, remembering where each byte came from
+	var norm strings.Builder
+	var from []int
+	space := false
+	for i, r := range source {
+		if unicode.IsSpace(r) {
+			space = norm.Len() > 0
+			continue
+		}
+		if space {
+			norm.WriteByte(' ')
+			from = append(from, i)
+			space = false
+		}
+		lower := string(unicode.ToLower(r))
+		norm.WriteString(lower)
+		for range len(lower) {
+			from = append(from, i)
+		}
+	}
+
+	idx := strings.Index(norm.String(), want)
+	if idx < 0 {
+		return 0, 0, false
+	}
+	start, last := from[idx], from[idx+len(want)-1]
+	_, size := utf8.DecodeRuneInString(source[last:])
+	return start, last + size, true
+}
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true, "are": true,
+	"was": true, "were": true, "from": true, "into": true, "its": true, "not": true, "all": true,
+	"any": true, "can": true, "has": true, "have": true, "which": true, "what": true, "when": true,
+	"how": true, "why": true, "who": true, "their": true, "they": true, "them": true, "there": true,
+	"than": true, "then": true, "also": true, "only": true, "each": true, "other": true, "been": true,
+}
+
+// stems are the content words of s, cut to five letters so "compiled" and
+// "compiler" match.
+func stems(s string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		isNumber := strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+		if (len(w) < 3 && !isNumber) || stopWords[w] {
+			continue
+		}
+		if len(w) > 5 {
+			w = w[:5]
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// mentions reports whether quote contains at least half the content words of text.
+func mentions(quote, text string) bool {
+	want := stems(text)
+	if len(want) == 0 {
+		return true
+	}
+	have := map[string]bool{}
+	for _, w := range stems(quote) {
+		have[w] = true
+	}
+	found := 0
+	for _, w := range want {
+		if have[w] {
+			found++
+		}
+	}
+	return 2*found >= len(want)
+}
+
+// supports reports whether a quote backs up the question's answer. Where
+// the answer can't be read off the text (true/false statements, computed
+// numbers) the quote has to be about the question instead.
+func supports(quote string, q QuizQuestion) bool {
+	switch questionType(q) {
+	case questionMultipleChoice, questionShortAnswer:
+		return mentions(quote, q.Answer)
+	case questionMultiSelect, questionOrdering:
+		return mentions(quote, strings.Join(q.Answers, " "))
+	case questionFillBlank:
+		for _, a := range q.Answers {
+			if mentions(quote, a) {
+				return true
+			}
+		}
+		return false
+	default:
+		return mentions(quote, strings.ReplaceAll(q.Question, blankMarker, " "))
+	}
+}
+
+// checkGrounding rejects questions without a rationale, or whose source
+// quote isn't in source or doesn't support the answer. It records where each
+// quote was found.
+func checkGrounding(quiz *QuizResponse, source string) error {
+	var problems llm.ValidationError
+	for i := range quiz.Quiz {
+		q, n := &quiz.Quiz[i], i+1
+		if strings.TrimSpace(q.Explanation) == "" {
+			problems.Addf("question %d needs an \"explanation\" of why the answer is right", n)
+		}
+		switch questionType(*q) {
+		case questionMultipleChoice, questionMultiSelect:
+			right := map[string]bool{q.Answer: true}
+			for _, a := range q.Answers {
+				right[a] = true
+			}
+			for _, opt := range q.Options {
+				if !right[opt] && strings.TrimSpace(q.Distractors[opt]) == "" {
+					problems.Addf("question %d: \"distractors\" must explain why %q is wrong", n, opt)
+				}
+			}
+		}
+
+		if q.Source == nil || strings.TrimSpace(q.Source.Quote) == "" {
+			problems.Addf("question %d needs a \"source\" with a \"quote\" copied from the text", n)
+			continue
+		}
+		start, end, ok := locateQuote(source, q.Source.Quote)
+		if !ok {
+			problems.Addf("question %d: source quote %q must be copied word for word from the text (at least %d characters)", n, q.Source.Quote, minQuoteLength)
+			continue
+		}
+		if !supports(q.Source.Quote, *q) {
+			problems.Addf("question %d: source quote %q doesn't support the answer, quote the passage the answer comes from", n, q.Source.Quote)
+			continue
+		}
+		q.Source.Start, q.Source.End = start, end
+	}
+	return problems.Err()
+}
+
+// completeGroundedQuiz generates a quiz from source and has the model fix
+// any question that isn't grounded in it.
+func completeGroundedQuiz(ctx context.Context, prompt, source string, out *QuizResponse) error {
+	return llm.CompleteJSONChecked(ctx, llmProvider, []llm.Message{llm.User(prompt)}, out, llm.DefaultRepairs, func(candidate interface{}) error {
+		return checkGrounding(candidate.(*QuizResponse), source)
+	})
+}
+
+// locatePages sets the page each question's quote is on.
+func locatePages(quiz *QuizResponse, pages []models.DocumentPage) {
+	for i := range quiz.Quiz {
+		src := quiz.Quiz[i].Source
+		if src == nil {
+			continue
+		}
+		for _, page := range pages {
+			if _, _, ok := locateQuote(page.Text, src.Quote); ok {
+				src.Page = page.Number
+				break
+			}
+		}
+	}
+}
+
+// groundingFormatPrompt describes the rationale fields every generated question carries.
+const groundingFormatPrompt = `Every question object also has:
+- "explanation": why the correct answer is right, in one or two sentences
+- "distractors": for questions with options, an object mapping each wrong option (copied exactly) to why it is wrong
+- "source": {"quote": "the sentence or phrase from the text the question was written from, copied word for word"}`
+
+// whyWrong is the explanation of the wrong options the user picked, if any.
+func whyWrong(q QuizQuestion, a SubmittedAnswer) string {
+	var picks []string
+	switch questionType(q) {
+	case questionMultipleChoice:
+		picks = []string{a.Text}
+	case questionMultiSelect:
+		picks = a.List
+	}
+	var notes []string
+	for _, pick := range picks {
+		if note := q.Distractors[strings.TrimSpace(pick)]; note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return strings.Join(notes, " ")
+}
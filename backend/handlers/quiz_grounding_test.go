@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+)
+
+func TestLocateQuote(t *testing.T) {
+	source := "Plants use light to make glucose.\n  Chlorophyll   reflects GREEN light, so leaves look green."
+	for _, tt := range []struct {
+		quote string
+		want  string // "" if it shouldn't be found
+	}{
+		{"Plants use light to make glucose", "Plants use light to make glucose"},
+		{"chlorophyll reflects green light", "Chlorophyll   reflects GREEN light"},
+		{"“to make glucose. Chlorophyll”", "to make glucose.\n  Chlorophyll"},
+		{"make glucose", ""}, // Too short to pin down a passage
+		{"Plants use heat to make glucose", ""},
+	} {
+		start, end, ok := locateQuote(source, tt.quote)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%q was found at %q", tt.quote, source[start:end])
+			}
+			continue
+		}
+		if !ok || source[start:end] != tt.want {
+			t.Errorf("%q: got %v %q, want %q", tt.quote, ok, source[start:end], tt.want)
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	for _, tt := range []struct {
+		quote string
+		q     QuizQuestion
+		want  bool
+	}{
+		{"Plants use light to make glucose", QuizQuestion{Answer: "Glucose"}, true},
+		{"Plants use light to make glucose", QuizQuestion{Answer: "Chloroplasts"}, false},
+		{"they compile the code first", QuizQuestion{Answer: "A compiler"}, true}, // Same stem
+		{"Plants need light and water", QuizQuestion{Type: questionMultiSelect, Answers: []string{"Light", "Water"}}, true},
+		{"Plants need light and soil", QuizQuestion{Type: questionMultiSelect, Answers: []string{"Light", "Water", "Air"}}, false},
+		{"Plants use light to make glucose", QuizQuestion{Type: questionFillBlank, Question: "Plants make ___.", Answers: []string{"sugar", "glucose"}}, true},
+		{"Plants use light to make glucose", QuizQuestion{Type: questionTrueFalse, Question: "Plants make glucose.", Answer: "true"}, true},
+		{"Each glucose molecule has 6 carbon atoms", QuizQuestion{Type: questionNumeric, Question: "How many carbon atoms are in glucose?"}, true},
+		{"Chlorophyll reflects green light", QuizQuestion{Type: questionNumeric, Question: "How many carbon atoms are in glucose?"}, false},
+	} {
+		if got := supports(tt.quote, tt.q); got != tt.want {
+			t.Errorf("%q for %+v: got %v", tt.quote, tt.q, got)
+		}
+	}
+}
+
+func TestCheckGrounding(t *testing.T) {
+	grounded := func() QuizQuestion {
+		return QuizQuestion{
+			Question: "What do plants make?", Options: []string{"Glucose", "Salt", "Iron", "Oil"}, Answer: "Glucose",
+			Explanation: "Photosynthesis makes glucose.",
+			Distractors: map[string]string{"Salt": "no", "Iron": "no", "Oil": "no"},
+			Source:      &QuestionSource{Quote: "Plants use light to make glucose"},
+		}
+	}
+	quiz := QuizResponse{Quiz: []QuizQuestion{grounded()}}
+	if err := checkGrounding(&quiz, plantText); err != nil {
+		t.Fatal(err)
+	}
+	if src := quiz.Quiz[0].Source; plantText[src.Start:src.End] != src.Quote {
+		t.Errorf("quote found at %d-%d", src.Start, src.End)
+	}
+
+	for problem, change := range map[string]func(q *QuizQuestion){
+		"explanation":            func(q *QuizQuestion) { q.Explanation = " " },
+		`why "Iron" is wrong`:    func(q *QuizQuestion) { delete(q.Distractors, "Iron") },
+		`needs a "source"`:       func(q *QuizQuestion) { q.Source = nil },
+		"copied word for word":   func(q *QuizQuestion) { q.Source.Quote = "Plants use heat to make glucose" },
+		"doesn't support":        func(q *QuizQuestion) { q.Source.Quote = "Chlorophyll reflects green light" },
+		"at least 20 characters": func(q *QuizQuestion) { q.Source.Quote = "make glucose" },
+	} {
+		q := grounded()
+		change(&q)
+		err := checkGrounding(&QuizResponse{Quiz: []QuizQuestion{q}}, plantText)
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("%s: got %v", problem, err)
+		}
+	}
+}
+
+func TestWhyWrong(t *testing.T) {
+	q := QuizQuestion{
+		Type: questionMultiSelect, Options: []string{"Light", "Water", "Salt", "Iron"}, Answers: []string{"Light", "Water"},
+		Distractors: map[string]string{"Salt": "Salt isn't used.", "Iron": "Iron isn't used."},
+	}
+	if got := whyWrong(q, SubmittedAnswer{List: []string{"Light", " Salt", "Iron"}}); got != "Salt isn't used. Iron isn't used." {
+		t.Errorf("got %q", got)
+	}
+	if got := whyWrong(q, SubmittedAnswer{List: []string{"Light", "Water"}}); got != "" {
+		t.Errorf("right answers: got %q", got)
+	}
+}
+
+func TestGenerateQuizUngrounded(t *testing.T) {
+	// The first reply quotes something the explanation doesn't say, so the
+	// model is asked to fix it
+	ungrounded := strings.Replace(quizReply, "Plants need light and water", "Plants need light and soil", 1)
+	provider := setupHandlers(t, ungrounded, quizReply)
+
+	w := post(t, GenerateQuiz, QuizRequest{Topic: "Photosynthesis", Explanation: plantText})
+	if strings.Contains(w.Body.String(), "Light is the energy") {
+		t.Error("the explanations were served before grading")
+	}
+	var quiz PublicQuizResponse
+	decode(t, w, &quiz)
+	calls := provider.Calls()
+	if len(calls) != 2 || !strings.Contains(calls[1][len(calls[1])-1].Content, "word for word") {
+		t.Fatalf("%d calls", len(calls))
+	}
+
+	var content models.Content
+	db.DB.First(&content, quiz.ContentID)
+	if !strings.Contains(content.Quiz, `"start":`) {
+		t.Errorf("the quote's position wasn't saved: %s", content.Quiz)
+	}
+}
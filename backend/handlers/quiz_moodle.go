@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Moodle XML, the question bank format Moodle imports and exports.
+// https://docs.moodle.org/en/Moodle_XML_format
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+type moodleText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswer struct {
+	Fraction  string      `xml:"fraction,attr"`
+	Format    string      `xml:"format,attr,omitempty"`
+	Text      string      `xml:"text"`
+	Feedback  *moodleText `xml:"feedback,omitempty"`
+	Tolerance string      `xml:"tolerance,omitempty"`
+}
+
+type moodleTag struct {
+	Text string `xml:"text"`
+}
+
+type moodleQuestion struct {
+	Type            string         `xml:"type,attr"`
+	Category        *moodleText    `xml:"category,omitempty"`
+	Name            *moodleText    `xml:"name,omitempty"`
+	QuestionText    *moodleText    `xml:"questiontext,omitempty"`
+	GeneralFeedback *moodleText    `xml:"generalfeedback,omitempty"`
+	DefaultGrade    string         `xml:"defaultgrade,omitempty"`
+	Single          string         `xml:"single,omitempty"`
+	ShuffleAnswers  string         `xml:"shuffleanswers,omitempty"`
+	UseCase         string         `xml:"usecase,omitempty"`
+	ResponseFormat  string         `xml:"responseformat,omitempty"`
+	GraderInfo      *moodleText    `xml:"graderinfo,omitempty"`
+	LayoutType      string         `xml:"layouttype,omitempty"` // Ordering questions
+	SelectType      string         `xml:"selecttype,omitempty"`
+	GradingType     string         `xml:"gradingtype,omitempty"`
+	Answers         []moodleAnswer `xml:"answer"`
+	Tags            []moodleTag    `xml:"tags>tag"`
+}
+
+func plainMoodleText(s string) *moodleText {
+	if s == "" {
+		return nil
+	}
+	return &moodleText{Format: "plain_text", Text: s}
+}
+
+// moodleString reads a Moodle text: HTML unless it says it is plain text or Markdown.
+func moodleString(format, s string) string {
+	if format == "plain_text" || format == "markdown" {
+		return collapseSpaces(s)
+	}
+	return plainText(s)
+}
+
+func (t *moodleText) plain() string {
+	if t == nil {
+		return ""
+	}
+	return moodleString(t.Format, t.Text)
+}
+
+func formatFraction(f float64) string {
+	return strconv.FormatFloat(f, 'f', 5, 64)
+}
+
+// writeMoodle renders a quiz as Moodle XML, in a category named after title.
+func writeMoodle(title string, questions []QuizQuestion) ([]byte, error) {
+	quiz := moodleQuiz{Questions: []moodleQuestion{{
+		Type:     "category",
+		Category: &moodleText{Text: "$course$/" + strings.ReplaceAll(title, "/", "-")},
+	}}}
+	for i, q := range questions {
+		m := moodleQuestion{
+			Name:            &moodleText{Text: fmt.Sprintf("Q%d", i+1)},
+			QuestionText:    plainMoodleText(q.Question),
+			GeneralFeedback: plainMoodleText(q.Explanation),
+			DefaultGrade:    "1",
+		}
+		if q.Concept != "" {
+			m.Tags = append(m.Tags, moodleTag{Text: "concept:" + q.Concept})
+		}
+		if q.Difficulty != 0 {
+			m.Tags = append(m.Tags, moodleTag{Text: "difficulty:" + strconv.Itoa(q.Difficulty)})
+		}
+		answer := func(fraction float64, text, feedback string) moodleAnswer {
+			return moodleAnswer{Fraction: formatFraction(fraction), Format: "plain_text", Text: text, Feedback: plainMoodleText(feedback)}
+		}
+
+		switch questionType(q) {
+		case questionMultipleChoice:
+			m.Type, m.Single, m.ShuffleAnswers = "multichoice", "true", "true"
+			for _, opt := range q.Options {
+				if opt == q.Answer {
+					m.Answers = append(m.Answers, answer(100, opt, ""))
+				} else {
+					m.Answers = append(m.Answers, answer(0, opt, q.Distractors[opt]))
+				}
+			}
+		case questionMultiSelect:
+			m.Type, m.Single, m.ShuffleAnswers = "multichoice", "false", "true"
+			right := map[string]bool{}
+			for _, a := range q.Answers {
+				right[a] = true
+			}
+			for _, opt := range q.Options {
+				if right[opt] {
+					m.Answers = append(m.Answers, answer(100/float64(len(q.Answers)), opt, ""))
+				} else {
+					m.Answers = append(m.Answers, answer(-100, opt, q.Distractors[opt]))
+				}
+			}
+		case questionTrueFalse:
+			m.Type = "truefalse"
+			value, _ := parseBool(q.Answer)
+			m.Answers = []moodleAnswer{{Fraction: "100", Text: strconv.FormatBool(value)}, {Fraction: "0", Text: strconv.FormatBool(!value)}}
+		case questionFillBlank:
+			m.Type, m.UseCase = "shortanswer", "0"
+			for _, a := range q.Answers {
+				m.Answers = append(m.Answers, answer(100, a, ""))
+			}
+		case questionNumeric:
+			m.Type = "numerical"
+			m.Answers = []moodleAnswer{{
+				Fraction:  "100",
+				Text:      strconv.FormatFloat(*q.Value, 'f', -1, 64),
+				Tolerance: strconv.FormatFloat(q.Tolerance, 'f', -1, 64),
+			}}
+		case questionOrdering:
+			m.Type, m.LayoutType, m.SelectType, m.GradingType = "ordering", "VERTICAL", "ALL", "ABSOLUTE_POSITION"
+			for _, item := range q.Answers {
+				m.Answers = append(m.Answers, answer(1, item, ""))
+			}
+		case questionShortAnswer:
+			m.Type, m.ResponseFormat = "essay", "editor"
+			info := "Model answer: " + q.Answer
+			if q.Rubric != "" {
+				info += "\n\nRubric: " + q.Rubric
+			}
+			m.GraderInfo = plainMoodleText(info)
+		}
+		quiz.Questions = append(quiz.Questions, m)
+	}
+
+	out, err := xml.MarshalIndent(quiz, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// parseMoodle reads the questions of a Moodle XML file. Question types we
+// have no equivalent for are reported in skipped.
+func parseMoodle(data []byte) ([]QuizQuestion, []string, error) {
+	var quiz moodleQuiz
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return nil, nil, fmt.Errorf("invalid Moodle XML: %w", err)
+	}
+
+	var questions []QuizQuestion
+	var skipped []string
+	n := 0
+	for _, m := range quiz.Questions {
+		if m.Type == "category" || m.Type == "description" {
+			continue
+		}
+		n++
+		q := QuizQuestion{}
+		q.Question, q.Explanation = m.QuestionText.plain(), m.GeneralFeedback.plain()
+		for _, tag := range m.Tags {
+			if concept, ok := strings.CutPrefix(tag.Text, "concept:"); ok {
+				q.Concept = concept
+			} else if level, ok := strings.CutPrefix(tag.Text, "difficulty:"); ok {
+				q.Difficulty, _ = strconv.Atoi(level)
+			}
+		}
+		fraction := func(a moodleAnswer) float64 {
+			f, _ := strconv.ParseFloat(strings.TrimSpace(a.Fraction), 64)
+			return f
+		}
+		text := func(a moodleAnswer) string {
+			return moodleString(a.Format, a.Text)
+		}
+
+		switch m.Type {
+		case "multichoice":
+			q.Type = questionMultipleChoice
+			if m.Single == "false" || m.Single == "0" {
+				q.Type = questionMultiSelect
+			}
+			best := 0.0
+			for _, a := range m.Answers {
+				text := text(a)
+				q.Options = append(q.Options, text)
+				switch f := fraction(a); {
+				case q.Type == questionMultiSelect && f > 0:
+					q.Answers = append(q.Answers, text)
+				case q.Type == questionMultipleChoice && f > best:
+					q.Answer, best = text, f
+				}
+				if note := a.Feedback.plain(); note != "" && fraction(a) <= 0 {
+					if q.Distractors == nil {
+						q.Distractors = map[string]string{}
+					}
+					q.Distractors[text] = note
+				}
+			}
+		case "truefalse":
+			q.Type = questionTrueFalse
+			for _, a := range m.Answers {
+				if fraction(a) > 0 {
+					q.Answer = text(a)
+				}
+			}
+		case "shortanswer":
+			q.Type = questionFillBlank
+			q.Question = withBlank(q.Question)
+			for _, a := range m.Answers {
+				if fraction(a) >= 100 {
+					q.Answers = append(q.Answers, text(a))
+				}
+			}
+		case "numerical":
+			q.Type = questionNumeric
+			for _, a := range m.Answers {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(a.Text), 64); err == nil && fraction(a) >= 100 {
+					q.Value = &v
+					q.Tolerance, _ = strconv.ParseFloat(strings.TrimSpace(a.Tolerance), 64)
+					break
+				}
+			}
+		case "ordering":
+			q.Type = questionOrdering
+			for _, a := range m.Answers {
+				q.Answers = append(q.Answers, text(a))
+			}
+		case "essay":
+			q.Type = questionShortAnswer
+			info := m.GraderInfo.plain()
+			q.Answer, q.Rubric, _ = strings.Cut(strings.TrimPrefix(info, "Model answer: "), " Rubric: ")
+		default:
+			skipped = append(skipped, fmt.Sprintf("question %d: Moodle %q questions aren't supported", n, m.Type))
+			continue
+		}
+		questions = append(questions, q)
+	}
+	return questions, skipped, nil
+}
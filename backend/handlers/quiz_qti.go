@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// IMS QTI 2.1: a zip content package with one assessmentItem per question,
+// listed in imsmanifest.xml.
+// https://www.imsglobal.org/question/qtiv2p1/imsqti_implv2p1.html
+
+const (
+	qtiNamespace = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	qtiTemplates = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/"
+)
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// qtiItem renders one question as an assessmentItem.
+func qtiItem(id string, q QuizQuestion) string {
+	var decl, body, processing strings.Builder
+	choices := func(items []string) {
+		for i, item := range items {
+			fmt.Fprintf(&body, "      <simpleChoice identifier=\"C%d\">%s</simpleChoice>\n", i+1, xmlEscape(item))
+		}
+	}
+	choiceID := func(items []string, item string) string {
+		for i, it := range items {
+			if it == item {
+				return fmt.Sprintf("C%d", i+1)
+			}
+		}
+		return ""
+	}
+	correct := func(values ...string) {
+		decl.WriteString("    <correctResponse>\n")
+		for _, v := range values {
+			fmt.Fprintf(&decl, "      <value>%s</value>\n", xmlEscape(v))
+		}
+		decl.WriteString("    </correctResponse>\n")
+	}
+	template := func(name string) {
+		fmt.Fprintf(&processing, "  <responseProcessing template=\"%s%s\"/>\n", qtiTemplates, name)
+	}
+	prompt := fmt.Sprintf("      <prompt>%s</prompt>\n", xmlEscape(q.Question))
+
+	switch questionType(q) {
+	case questionMultipleChoice, questionTrueFalse, questionMultiSelect:
+		options, answers, cardinality, maxChoices := q.Options, []string{q.Answer}, "single", 1
+		switch questionType(q) {
+		case questionTrueFalse:
+			value, _ := parseBool(q.Answer)
+			options, answers = []string{"true", "false"}, []string{strconv.FormatBool(value)}
+		case questionMultiSelect:
+			answers, cardinality, maxChoices = q.Answers, "multiple", 0
+		}
+		var ids []string
+		for _, a := range answers {
+			ids = append(ids, choiceID(options, a))
+		}
+		fmt.Fprintf(&decl, "  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"%s\" baseType=\"identifier\">\n", cardinality)
+		correct(ids...)
+		decl.WriteString("  </responseDeclaration>\n")
+		fmt.Fprintf(&body, "    <choiceInteraction responseIdentifier=\"RESPONSE\" shuffle=\"%t\" maxChoices=\"%d\">\n%s", questionType(q) != questionTrueFalse, maxChoices, prompt)
+		choices(options)
+		body.WriteString("    </choiceInteraction>\n")
+		template("match_correct")
+	case questionOrdering:
+		var ids []string
+		for _, a := range q.Answers {
+			ids = append(ids, choiceID(q.Options, a))
+		}
+		decl.WriteString("  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"ordered\" baseType=\"identifier\">\n")
+		correct(ids...)
+		decl.WriteString("  </responseDeclaration>\n")
+		fmt.Fprintf(&body, "    <orderInteraction responseIdentifier=\"RESPONSE\" shuffle=\"true\">\n%s", prompt)
+		choices(q.Options)
+		body.WriteString("    </orderInteraction>\n")
+		template("match_correct")
+	case questionFillBlank:
+		decl.WriteString("  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"single\" baseType=\"string\">\n")
+		correct(q.Answers[0])
+		decl.WriteString("    <mapping defaultValue=\"0\">\n")
+		for _, a := range q.Answers {
+			fmt.Fprintf(&decl, "      <mapEntry mapKey=\"%s\" mappedValue=\"1\" caseSensitive=\"false\"/>\n", xmlEscape(a))
+		}
+		decl.WriteString("    </mapping>\n  </responseDeclaration>\n")
+		before, after, _ := strings.Cut(q.Question, blankMarker)
+		fmt.Fprintf(&body, "    <p>%s<textEntryInteraction responseIdentifier=\"RESPONSE\" expectedLength=\"20\"/>%s</p>\n", xmlEscape(before), xmlEscape(after))
+		template("map_response")
+	case questionNumeric:
+		decl.WriteString("  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"single\" baseType=\"float\">\n")
+		correct(strconv.FormatFloat(*q.Value, 'f', -1, 64))
+		decl.WriteString("  </responseDeclaration>\n")
+		fmt.Fprintf(&body, "    <p>%s</p>\n    <p><textEntryInteraction responseIdentifier=\"RESPONSE\" expectedLength=\"10\"/></p>\n", xmlEscape(q.Question))
+		if q.Tolerance == 0 {
+			template("match_correct")
+		} else {
+			t := strconv.FormatFloat(q.Tolerance, 'f', -1, 64)
+			fmt.Fprintf(&processing, `  <responseProcessing>
+    <responseCondition>
+      <responseIf>
+        <equal toleranceMode="absolute" tolerance="%s %s">
+          <variable identifier="RESPONSE"/>
+          <correct identifier="RESPONSE"/>
+        </equal>
+        <setOutcomeValue identifier="SCORE"><baseValue baseType="float">1</baseValue></setOutcomeValue>
+      </responseIf>
+    </responseCondition>
+  </responseProcessing>
+`, t, t)
+		}
+	case questionShortAnswer:
+		decl.WriteString("  <responseDeclaration identifier=\"RESPONSE\" cardinality=\"single\" baseType=\"string\">\n")
+		correct(q.Answer)
+		decl.WriteString("  </responseDeclaration>\n")
+		if q.Rubric != "" {
+			fmt.Fprintf(&body, "    <rubricBlock view=\"scorer\"><p>%s</p></rubricBlock>\n", xmlEscape(q.Rubric))
+		}
+		fmt.Fprintf(&body, "    <extendedTextInteraction responseIdentifier=\"RESPONSE\">\n%s    </extendedTextInteraction>\n", prompt)
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<assessmentItem xmlns="%s" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="%s http://www.imsglobal.org/xsd/qti/qtiv2p1/imsqti_v2p1.xsd" identifier="%s" title="%s" adaptive="false" timeDependent="false">
+%s  <outcomeDeclaration identifier="SCORE" cardinality="single" baseType="float">
+    <defaultValue><value>0</value></defaultValue>
+  </outcomeDeclaration>
+  <itemBody>
+%s  </itemBody>
+%s</assessmentItem>
+`, qtiNamespace, qtiNamespace, id, xmlEscape(id), decl.String(), body.String(), processing.String())
+}
+
+// writeQTI renders a quiz as a QTI 2.1 content package: the items and a test
+// titled title that uses them all.
+func writeQTI(title string, questions []QuizQuestion) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		return err
+	}
+
+	var resources, refs, deps strings.Builder
+	for i, q := range questions {
+		id := fmt.Sprintf("item%03d", i+1)
+		href := "items/" + id + ".xml"
+		if err := write(href, qtiItem(id, q)); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&resources, "    <resource identifier=\"%s\" type=\"imsqti_item_xmlv2p1\" href=\"%s\">\n      <file href=\"%s\"/>\n    </resource>\n", id, href, href)
+		fmt.Fprintf(&refs, "      <assessmentItemRef identifier=\"%s\" href=\"%s\"/>\n", id, href)
+		fmt.Fprintf(&deps, "      <dependency identifierref=\"%s\"/>\n", id)
+	}
+
+	test := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<assessmentTest xmlns="%s" identifier="test" title="%s">
+  <testPart identifier="part1" navigationMode="nonlinear" submissionMode="simultaneous">
+    <assessmentSection identifier="section1" title="%s" visible="true">
+%s    </assessmentSection>
+  </testPart>
+</assessmentTest>
+`, qtiNamespace, xmlEscape(title), xmlEscape(title), refs.String())
+	if err := write("test.xml", test); err != nil {
+		return nil, err
+	}
+	manifest := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1" identifier="manifest">
+  <metadata>
+    <schema>QTIv2.1 Package</schema>
+    <schemaversion>1.0.0</schemaversion>
+  </metadata>
+  <organizations/>
+  <resources>
+    <resource identifier="test" type="imsqti_test_xmlv2p1" href="test.xml">
+      <file href="test.xml"/>
+%s    </resource>
+%s  </resources>
+</manifest>
+`, deps.String(), resources.String())
+	if err := write("imsmanifest.xml", manifest); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xmlNode is a generic XML element, keeping text and child elements in
+// document order, for formats with mixed content like QTI item bodies.
+type xmlNode struct {
+	Name     string // Local name, empty for text
+	Attrs    map[string]string
+	Text     string
+	Children []*xmlNode
+}
+
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name.Local, Attrs: map[string]string{}}
+			for _, a := range t.Attr {
+				n.Attrs[a.Name.Local] = a.Value
+			}
+			top.Children = append(top.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.Children = append(top.Children, &xmlNode{Text: string(t)})
+		}
+	}
+	for _, n := range root.Children {
+		if n.Name != "" {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("no root element")
+}
+
+// all returns the descendants of n named name, in document order.
+func (n *xmlNode) all(name string) []*xmlNode {
+	var found []*xmlNode
+	for _, c := range n.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.all(name)...)
+	}
+	return found
+}
+
+func (n *xmlNode) first(name string) *xmlNode {
+	if found := n.all(name); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// text is the text of n, leaving out the elements named in skip and
+// writing a blank for each text entry.
+func (n *xmlNode) text(skip ...string) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			switch {
+			case c.Name == "":
+				sb.WriteString(c.Text)
+			case c.Name == "textEntryInteraction":
+				sb.WriteString(blankMarker)
+			case c.Name == "p" || c.Name == "div" || c.Name == "br":
+				sb.WriteString(" ")
+				walk(c)
+				sb.WriteString(" ")
+			default:
+				skipped := false
+				for _, s := range skip {
+					skipped = skipped || c.Name == s
+				}
+				if !skipped {
+					walk(c)
+				}
+			}
+		}
+	}
+	walk(n)
+	// Markup is elements, so any tag left in the text is part of it
+	return collapseSpaces(sb.String())
+}
+
+// parseQTI reads the questions of a QTI 2.1 package, or of a single
+// assessmentItem file.
+func parseQTI(data []byte) ([]QuizQuestion, []string, error) {
+	var items [][]byte
+	if bytes.HasPrefix(data, []byte("PK")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid QTI package: %w", err)
+		}
+		files := map[string]*zip.File{}
+		var order []string
+		for _, f := range zr.File {
+			files[f.Name] = f
+			if strings.EqualFold(path.Ext(f.Name), ".xml") {
+				order = append(order, f.Name)
+			}
+		}
+		// The manifest gives the order of the items
+		if f, ok := files["imsmanifest.xml"]; ok {
+			if manifest, err := readZipFile(f); err == nil {
+				if tree, err := parseXMLTree(manifest); err == nil {
+					var listed []string
+					for _, res := range tree.all("resource") {
+						if strings.Contains(res.Attrs["type"], "imsqti_item") && files[res.Attrs["href"]] != nil {
+							listed = append(listed, res.Attrs["href"])
+						}
+					}
+					if len(listed) > 0 {
+						order = listed
+					}
+				}
+			}
+		}
+		for _, name := range order {
+			item, err := readZipFile(files[name])
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+	} else {
+		items = [][]byte{data}
+	}
+
+	var questions []QuizQuestion
+	var skipped []string
+	n := 0
+	for _, item := range items {
+		tree, err := parseXMLTree(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid QTI XML: %w", err)
+		}
+		if tree.Name != "assessmentItem" {
+			continue
+		}
+		n++
+		q, err := parseQTIItem(tree)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("question %d: %v", n, err))
+			continue
+		}
+		questions = append(questions, q)
+	}
+	return questions, skipped, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, 10<<20))
+}
+
+var qtiInteractions = []string{"choiceInteraction", "orderInteraction", "textEntryInteraction", "extendedTextInteraction"}
+
+func parseQTIItem(item *xmlNode) (QuizQuestion, error) {
+	var q QuizQuestion
+	body := item.first("itemBody")
+	if body == nil {
+		return q, fmt.Errorf("item has no body")
+	}
+	var interaction *xmlNode
+	for _, name := range qtiInteractions {
+		if found := body.all(name); len(found) == 1 {
+			interaction = found[0]
+			break
+		} else if len(found) > 1 {
+			return q, fmt.Errorf("items with several interactions aren't supported")
+		}
+	}
+	if interaction == nil {
+		return q, fmt.Errorf("unsupported interaction")
+	}
+
+	var decl *xmlNode
+	for _, d := range item.all("responseDeclaration") {
+		if d.Attrs["identifier"] == interaction.Attrs["responseIdentifier"] {
+			decl = d
+		}
+	}
+	if decl == nil {
+		return q, fmt.Errorf("no response declaration")
+	}
+	var correct []string
+	if c := decl.first("correctResponse"); c != nil {
+		for _, v := range c.all("value") {
+			correct = append(correct, v.text())
+		}
+	}
+
+	// The question is the body around the interaction plus its prompt
+	q.Question = strings.TrimSpace(body.text(append(qtiInteractions[:2:2], "extendedTextInteraction", "rubricBlock", "prompt")...) + " " + interaction.first("prompt").text())
+
+	switch interaction.Name {
+	case "choiceInteraction", "orderInteraction":
+		labels := map[string]string{}
+		for _, choice := range interaction.all("simpleChoice") {
+			label := choice.text()
+			labels[choice.Attrs["identifier"]] = label
+			q.Options = append(q.Options, label)
+		}
+		var answers []string
+		for _, id := range correct {
+			answers = append(answers, labels[id])
+		}
+		switch {
+		case interaction.Name == "orderInteraction":
+			q.Type, q.Answers = questionOrdering, answers
+		case decl.Attrs["cardinality"] == "multiple":
+			q.Type, q.Answers = questionMultiSelect, answers
+		case len(answers) != 1:
+			return q, fmt.Errorf("no correct choice")
+		default:
+			q.Type, q.Answer = questionMultipleChoice, answers[0]
+			if len(q.Options) == 2 {
+				_, ok1 := parseBool(q.Options[0])
+				_, ok2 := parseBool(q.Options[1])
+				if ok1 && ok2 {
+					q.Type, q.Options = questionTrueFalse, nil
+				}
+			}
+		}
+	case "textEntryInteraction":
+		switch decl.Attrs["baseType"] {
+		case "float", "integer":
+			q.Type = questionNumeric
+			q.Question = strings.TrimSpace(strings.ReplaceAll(q.Question, blankMarker, ""))
+			if len(correct) > 0 {
+				if v, err := strconv.ParseFloat(correct[0], 64); err == nil {
+					q.Value = &v
+				}
+			}
+			if eq := item.first("equal"); eq != nil && eq.Attrs["toleranceMode"] == "absolute" {
+				q.Tolerance, _ = strconv.ParseFloat(strings.Fields(eq.Attrs["tolerance"] + " 0")[0], 64)
+			}
+		default:
+			q.Type = questionFillBlank
+			seen := map[string]bool{}
+			for _, entry := range decl.all("mapEntry") {
+				correct = append(correct, entry.Attrs["mapKey"])
+			}
+			for _, a := range correct {
+				if !seen[a] {
+					q.Answers = append(q.Answers, a)
+					seen[a] = true
+				}
+			}
+		}
+	case "extendedTextInteraction":
+		q.Type = questionShortAnswer
+		q.Rubric = item.first("rubricBlock").text()
+		if len(correct) > 0 {
+			q.Answer = correct[0]
+		} else {
+			q.Answer = q.Rubric
+		}
+	}
+	return q, nil
+}
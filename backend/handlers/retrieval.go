@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// embedder indexes the user's documents for retrieval. It is injected from
+// main with UseEmbedder; without one answers are simply not grounded.
+var embedder llm.Embedder
+
+func UseEmbedder(e llm.Embedder) {
+	embedder = e
+}
+
+var errNoEmbedder = errors.New("embedding provider not configured")
+
+const (
+	passageSize       = 1000 // Characters per indexed passage
+	passageOverlap    = 150  // Characters repeated from the end of the previous passage
+	embedBatchSize    = 64
+	retrievalTopK     = 5
+	retrievalMinScore = 0.25 // Passages less similar than this are left out
+	excerptLength     = 300
+)
+
+// splitPassages cuts text into passages of about passageSize characters at
+// word boundaries, each starting with the tail of the one before.
+func splitPassages(text string) []string {
+	words := strings.Fields(text)
+	var passages []string
+	for start := 0; start < len(words); {
+		end, length := start, 0
+		for end < len(words) && (end == start || length+len(words[end])+1 <= passageSize) {
+			length += len(words[end]) + 1
+			end++
+		}
+		passages = append(passages, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+
+		next, overlap := end, 0
+		for next > start+1 && overlap+len(words[next-1])+1 <= passageOverlap {
+			overlap += len(words[next-1]) + 1
+			next--
+		}
+		start = next
+	}
+	return passages
+}
+
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+// indexDocument splits a document into passages, page by page when it has
+// pages, embeds them and replaces whatever was indexed for it before.
+func indexDocument(ctx context.Context, docID uint) (int, error) {
+	if embedder == nil {
+		return 0, errNoEmbedder
+	}
+	var doc models.Document
+	if err := db.DB.Preload("Pages", orderBy("number")).First(&doc, docID).Error; err != nil {
+		return 0, err
+	}
+
+	var passages []models.DocumentPassage
+	add := func(page int, text string) {
+		for _, p := range splitPassages(text) {
+			passages = append(passages, models.DocumentPassage{
+				DocumentID:     doc.ID,
+				UserEmail:      doc.UserEmail,
+				Page:           page,
+				Position:       len(passages),
+				Text:           p,
+				EmbeddingModel: embedder.Model(),
+			})
+		}
+	}
+	if len(doc.Pages) > 0 {
+		for _, page := range doc.Pages {
+			add(page.Number, page.Text)
+		}
+	} else {
+		add(0, doc.Text)
+	}
+
+	for start := 0; start < len(passages); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(passages))
+		texts := make([]string, 0, end-start)
+		for _, p := range passages[start:end] {
+			texts = append(texts, p.Text)
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return 0, err
+		}
+		for i, v := range vectors {
+			passages[start+i].Embedding = encodeVector(llm.Normalize(v))
+		}
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.DocumentPassage{}).Error; err != nil {
+			return err
+		}
+		if len(passages) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&passages, 100).Error
+	})
+	return len(passages), err
+}
+
+// indexInBackground indexes a document without holding up the request that
+// added it. Failures are only logged; the document can be reindexed later.
+func indexInBackground(docID uint) {
+	if embedder == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if _, err := indexDocument(ctx, docID); err != nil {
+			log.Printf("Failed to index document %d: %v", docID, err)
+		}
+	}()
+}
+
+// Citation points a passage an answer drew on back to its document and page.
+type Citation struct {
+	Ref        int     `json:"ref"` // The n of the [n] markers in the answer
+	DocumentID uint    `json:"document_id"`
+	FileName   string  `json:"file_name"`
+	Page       int     `json:"page,omitempty"`
+	Excerpt    string  `json:"excerpt"`
+	Score      float64 `json:"score"`
+	text       string
+}
+
+type scoredPassage struct {
+	passage *models.DocumentPassage
+	score   float64
+}
+
+// rankPassages scores passages against the normalized query vector q and
+// keeps the retrievalTopK best of those similar enough, best first.
+func rankPassages(q []float32, passages []models.DocumentPassage) []scoredPassage {
+	var hits []scoredPassage
+	for i := range passages {
+		if score := llm.Cosine(q, decodeVector(passages[i].Embedding)); score >= retrievalMinScore {
+			hits = append(hits, scoredPassage{&passages[i], score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > retrievalTopK {
+		hits = hits[:retrievalTopK]
+	}
+	return hits
+}
+
+// retrieve returns the passages of the user's documents most similar to
+// query, best first, limited to documentIDs when any are given. It is a
+// brute-force scan, fine for the size of a personal library.
+func retrieve(ctx context.Context, userEmail, query string, documentIDs []uint) ([]Citation, error) {
+	if embedder == nil || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("asked for 1 embedding, got %d", len(vectors))
+	}
+	q := llm.Normalize(vectors[0])
+
+	var passages []models.DocumentPassage
+	tx := db.DB.Select("id", "document_id", "page", "text", "embedding").
+		Where("user_email = ? AND embedding_model = ?", userEmail, embedder.Model())
+	if len(documentIDs) > 0 {
+		tx = tx.Where("document_id IN ?", documentIDs)
+	}
+	if err := tx.Find(&passages).Error; err != nil {
+		return nil, err
+	}
+
+	hits := rankPassages(q, passages)
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	var ids []uint
+	for _, hit := range hits {
+		ids = append(ids, hit.passage.DocumentID)
+	}
+	var docs []models.Document
+	if err := db.DB.Select("id", "file_name").Find(&docs, ids).Error; err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	for _, doc := range docs {
+		names[doc.ID] = doc.FileName
+	}
+
+	citations := make([]Citation, len(hits))
+	for i, hit := range hits {
+		citations[i] = Citation{
+			Ref:        i + 1,
+			DocumentID: hit.passage.DocumentID,
+			FileName:   names[hit.passage.DocumentID],
+			Page:       hit.passage.Page,
+			Excerpt:    truncate(hit.passage.Text, excerptLength),
+			Score:      hit.score,
+			text:       hit.passage.Text,
+		}
+	}
+	return citations, nil
+}
+
+// groundingPrompt lists the retrieved passages for the model and tells it how
+// to cite them. It is empty when nothing was retrieved.
+func groundingPrompt(sources []Citation) string {
+	if len(sources) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Passages from the student's own documents:\n\n")
+	for _, src := range sources {
+		name := src.FileName
+		if name == "" {
+			name = "untitled document"
+		}
+		if src.Page > 0 {
+			fmt.Fprintf(&sb, "[%d] (%s, page %d)\n%s\n\n", src.Ref, name, src.Page, src.text)
+		} else {
+			fmt.Fprintf(&sb, "[%d] (%s)\n%s\n\n", src.Ref, name, src.text)
+		}
+	}
+	sb.WriteString("Where these passages are relevant, base your answer on them and cite them inline by number, like [1] or [2][3]. Only cite passages you actually used and never invent citations.")
+	return sb.String()
+}
+
+var citationRef = regexp.MustCompile(`\[(\d+)\]`)
+
+// citedSources keeps the sources the answer actually cites.
+func citedSources(answer string, sources []Citation) []Citation {
+	cited := map[int]bool{}
+	for _, m := range citationRef.FindAllStringSubmatch(answer, -1) {
+		n, _ := strconv.Atoi(m[1])
+		cited[n] = true
+	}
+	var used []Citation
+	for _, src := range sources {
+		if cited[src.Ref] {
+			used = append(used, src)
+		}
+	}
+	return used
+}
+
+// IndexDocument (re)builds the retrieval index of a document, e.g. after the
+// embedding provider changed.
+func IndexDocument(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var doc models.Document
+	if err := db.DB.Omit("text").First(&doc, "id = ? AND user_email = ?", mux.Vars(r)["id"], claims["email"].(string)).Error; err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	n, err := indexDocument(r.Context(), doc.ID)
+	if errors.Is(err, errNoEmbedder) {
+		http.Error(w, "Document search is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to index document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"document_id": doc.ID, "passages": n})
+}
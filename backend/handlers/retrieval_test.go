@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/llm"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSplitPassages(t *testing.T) {
+	if got := splitPassages("  \n "); got != nil {
+		t.Errorf("blank text gave %q", got)
+	}
+	if got := splitPassages("a short  text"); len(got) != 1 || got[0] != "a short text" {
+		t.Errorf("short text gave %q", got)
+	}
+
+	var words []string
+	for i := 0; i < 1000; i++ {
+		words = append(words, fmt.Sprintf("word%d", i))
+	}
+	passages := splitPassages(strings.Join(words, " "))
+	if len(passages) < 2 {
+		t.Fatalf("got %d passages", len(passages))
+	}
+	prev, next := -1, 0 // Where the previous passage started and the first word not seen yet
+	for i, p := range passages {
+		if len(p) > passageSize {
+			t.Errorf("passage %d is %d characters long", i, len(p))
+		}
+		fields := strings.Fields(p)
+		first := 0
+		fmt.Sscanf(fields[0], "word%d", &first)
+		if i > 0 && (first >= next || first <= prev) {
+			t.Errorf("passage %d starts at word %d, want an overlap with %d-%d", i, first, prev, next-1)
+		}
+		if fields[0] != words[first] || strings.Join(words[first:first+len(fields)], " ") != p {
+			t.Fatalf("passage %d is not a run of the text: %q", i, p)
+		}
+		prev, next = first, first+len(fields)
+	}
+	if next != len(words) {
+		t.Errorf("passages end at word %d of %d", next, len(words))
+	}
+
+	long := strings.Repeat("x", passageSize+10)
+	if got := splitPassages("before " + long + " after"); len(got) != 3 || got[1] != long {
+		t.Errorf("an overlong word was not kept whole: %d passages", len(got))
+	}
+}
+
+func TestRankPassages(t *testing.T) {
+	texts := []string{
+		"Photosynthesis turns light, water and carbon dioxide into glucose in the chloroplast.",
+		"Napoleon crowned himself emperor during 1804.",
+		"Chlorophyll in the chloroplast absorbs the light used by photosynthesis.",
+		"Mitochondria release the energy stored in glucose.",
+	}
+	ctx := context.Background()
+	vectors, err := llm.FakeEmbedder{}.Embed(ctx, texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passages := make([]models.DocumentPassage, len(texts))
+	for i, text := range texts {
+		passages[i] = models.DocumentPassage{Position: i, Text: text, Embedding: encodeVector(vectors[i])}
+	}
+	query, _ := llm.FakeEmbedder{}.Embed(ctx, []string{"How does photosynthesis use light in the chloroplast?"})
+
+	hits := rankPassages(query[0], passages)
+	if len(hits) < 2 {
+		t.Fatalf("got %d hits", len(hits))
+	}
+	for i, hit := range hits {
+		if i > 0 && hit.score > hits[i-1].score {
+			t.Errorf("hit %d scores higher than the one before it", i)
+		}
+		if hit.score < retrievalMinScore {
+			t.Errorf("hit %d scores %f, below the minimum", i, hit.score)
+		}
+		if hit.passage.Position == 1 {
+			t.Errorf("the unrelated passage was retrieved with score %f", hit.score)
+		}
+	}
+	if top := hits[0].passage.Position; top != 0 && top != 2 {
+		t.Errorf("best hit is passage %d", top)
+	}
+
+	many := make([]models.DocumentPassage, retrievalTopK+3)
+	for i := range many {
+		many[i] = passages[0]
+	}
+	if got := len(rankPassages(query[0], many)); got != retrievalTopK {
+		t.Errorf("kept %d hits, want %d", got, retrievalTopK)
+	}
+}
+
+func setupRetrieval(t *testing.T, responses ...string) (*llm.FakeProvider, models.Document, models.Document) {
+	t.Helper()
+	provider := setupHandlers(t, responses...)
+	UseEmbedder(llm.FakeEmbedder{})
+	t.Cleanup(func() { UseEmbedder(nil) })
+
+	add := func(user, name string, pages ...string) models.Document {
+		doc, err := saveDocument(user, strings.Join(pages, "\n\n"), models.Document{FileName: name, PageCount: len(pages)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, text := range pages {
+			db.DB.Create(&models.DocumentPage{DocumentID: doc.ID, Number: i + 1, Text: text})
+		}
+		if _, err := indexDocument(t.Context(), doc.ID); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	biology := add(testUser, "biology.pdf",
+		"Mitochondria release the energy stored in glucose.",
+		"Photosynthesis turns light, water and carbon dioxide into glucose in the chloroplast.")
+	history := add(testUser, "history.pdf", "Napoleon crowned himself emperor during 1804.")
+	add("someone@example.com", "theirs.pdf", "Photosynthesis in the chloroplast uses light to make glucose.")
+	return provider, biology, history
+}
+
+func TestRetrieve(t *testing.T) {
+	_, biology, history := setupRetrieval(t)
+
+	sources, err := retrieve(t.Context(), testUser, "How does photosynthesis use light in the chloroplast?", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("nothing retrieved")
+	}
+	top := sources[0]
+	if top.Ref != 1 || top.DocumentID != biology.ID || top.FileName != "biology.pdf" || top.Page != 2 || !strings.Contains(top.Excerpt, "chloroplast") {
+		t.Errorf("best source %+v", top)
+	}
+	for i, src := range sources {
+		if src.DocumentID != biology.ID {
+			t.Errorf("source %d is from document %d", i, src.DocumentID)
+		}
+		if i > 0 && src.Score > sources[i-1].Score {
+			t.Errorf("source %d scores higher than the one before it", i)
+		}
+	}
+
+	// Limited to other documents, the unrelated one scores too low to be used
+	if sources, _ := retrieve(t.Context(), testUser, "How does photosynthesis use light in the chloroplast?", []uint{history.ID}); len(sources) != 0 {
+		t.Errorf("retrieved %+v", sources)
+	}
+
+	UseEmbedder(nil)
+	if sources, err := retrieve(t.Context(), testUser, "photosynthesis", nil); sources != nil || err != nil {
+		t.Errorf("without an embedder: %v, %v", sources, err)
+	}
+}
+
+func TestIndexDocument(t *testing.T) {
+	_, biology, history := setupRetrieval(t)
+	vars := map[string]string{"id": itoa(biology.ID)}
+
+	// Reindexing replaces the passages
+	var indexed map[string]int
+	decode(t, serve(IndexDocument, mux.SetURLVars(request(t, nil), vars)), &indexed)
+	var count int64
+	db.DB.Model(&models.DocumentPassage{}).Where("document_id = ?", biology.ID).Count(&count)
+	if indexed["passages"] != 2 || count != 2 {
+		t.Errorf("indexed %v, %d passages stored", indexed, count)
+	}
+
+	theirs := models.Document{}
+	db.DB.Where("user_email <> ?", testUser).First(&theirs)
+	if w := serve(IndexDocument, mux.SetURLVars(request(t, nil), map[string]string{"id": itoa(theirs.ID)})); w.Code != http.StatusNotFound {
+		t.Errorf("their document: status %d", w.Code)
+	}
+
+	// Deleting the document drops its passages
+	var deleted map[string]string
+	decode(t, onDocument(t, DeleteDocument, http.MethodDelete, biology.ID), &deleted)
+	db.DB.Unscoped().Model(&models.DocumentPassage{}).Where("document_id = ?", biology.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d passages left", count)
+	}
+
+	UseEmbedder(nil)
+	if w := serve(IndexDocument, mux.SetURLVars(request(t, nil), vars)); w.Code != http.StatusNotFound {
+		t.Errorf("deleted document: status %d", w.Code)
+	}
+	vars["id"] = itoa(history.ID)
+	if w := serve(IndexDocument, mux.SetURLVars(request(t, nil), vars)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without an embedder: status %d", w.Code)
+	}
+}
+
+func TestCitedSources(t *testing.T) {
+	sources := []Citation{
+		{Ref: 1, FileName: "biology.pdf", Page: 2, text: "Photosynthesis makes glucose."},
+		{Ref: 2, text: "Chlorophyll absorbs light."},
+		{Ref: 3, FileName: "history.pdf", text: "Napoleon."},
+	}
+	prompt := groundingPrompt(sources)
+	for _, want := range []string{"[1] (biology.pdf, page 2)\nPhotosynthesis makes glucose.", "[2] (untitled document)\nChlorophyll absorbs light.", "cite them inline"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+	if groundingPrompt(nil) != "" {
+		t.Error("a prompt without sources")
+	}
+
+	used := citedSources("Plants make glucose [1][2], as [2] says, unlike [7].", sources)
+	if len(used) != 2 || used[0].Ref != 1 || used[1].Ref != 2 {
+		t.Errorf("cited %+v", used)
+	}
+	if citedSources("No citations here.", sources) != nil {
+		t.Error("uncited sources kept")
+	}
+}
+
+func TestExplainGrounded(t *testing.T) {
+	provider, biology, _ := setupRetrieval(t, "Plants make glucose from light [1].")
+
+	var explained ExplainTopicResponse
+	decode(t, post(t, ExplainTopicHandler, ExplainTopicRequest{Topic: "Photosynthesis in the chloroplast"}), &explained)
+	if !strings.Contains(provider.Calls()[0][0].Content, "Photosynthesis turns light") {
+		t.Errorf("the passage wasn't in the prompt")
+	}
+	if len(explained.Sources) != 1 || explained.Sources[0].DocumentID != biology.ID || explained.Sources[0].Page != 2 {
+		t.Errorf("sources %+v", explained.Sources)
+	}
+
+	// The cited sources are cached with the explanation
+	var cached ExplainTopicResponse
+	decode(t, post(t, ExplainTopicHandler, ExplainTopicRequest{Topic: "Photosynthesis in the chloroplast"}), &cached)
+	if len(provider.Calls()) != 1 || len(cached.Sources) != 1 || cached.Sources[0].Excerpt != explained.Sources[0].Excerpt {
+		t.Errorf("cached %+v", cached)
+	}
+}
+
+func TestChatbotGrounded(t *testing.T) {
+	provider, biology, _ := setupRetrieval(t, "In the chloroplast [1].")
+	conn := dialChat(t, "?token="+testToken(t))
+
+	sendFrame(t, conn, frameMessage, "m1", chatMessage("Where does photosynthesis use light?", "Photosynthesis"))
+	frames := readUntil(t, conn, frameDone)
+	var done DonePayload
+	decodeEvent(t, string(frames[len(frames)-1].Payload), &done)
+	if len(done.Sources) != 1 || done.Sources[0].DocumentID != biology.ID {
+		t.Errorf("sources %+v", done.Sources)
+	}
+	if !strings.Contains(provider.Calls()[0][0].Content, "Photosynthesis turns light") {
+		t.Error("the passage wasn't in the system prompt")
+	}
+}
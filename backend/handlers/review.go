@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/srs"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultDueLimit = 100
+
+// DueCard is a card in the review queue together with its scheduling state.
+// DueAt is nil for cards that have never been reviewed. Cloze cards are
+// rendered, with their cloze text in Text.
+type DueCard struct {
+	CardID         uint       `json:"card_id"`
+	FlashcardSetID uint       `json:"flashcard_set_id"`
+	DeckTitle      string     `json:"deck_title"`
+	Type           string     `json:"type,omitempty"`
+	Cloze          int        `json:"cloze,omitempty"`
+	Front          string     `json:"front"`
+	Back           string     `json:"back"`
+	Text           string     `json:"text,omitempty"`
+	DueAt          *time.Time `json:"due_at"`
+	IntervalDays   int        `json:"interval_days"`
+	Repetitions    int        `json:"repetitions"`
+	Lapses         int        `json:"lapses"`
+}
+
+type ReviewRequest struct {
+	CardID uint `json:"card_id"`
+	Grade  *int `json:"grade"` // 0 (blackout) to 5 (perfect recall), required
+	// Answers typed for the deletions of a cloze card, in order. A wrong one
+	// makes the review a lapse whatever the grade.
+	Answers []string `json:"answers,omitempty"`
+}
+
+// ReviewResponse is the card's new scheduling state and, for typed cloze
+// answers, whether they were right.
+type ReviewResponse struct {
+	models.CardReview
+	Correct  *bool    `json:"correct,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+}
+
+// GetDueFlashcards returns every card across the user's decks that is due by
+// the end of today, previously reviewed cards first, then new ones. With
+// ?set_id= only the cards of that deck (e.g. a chapter's) are returned.
+func GetDueFlashcards(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	limit := defaultDueLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	query := db.DB.Table("cards")
+	if setID := r.URL.Query().Get("set_id"); setID != "" {
+		id, err := strconv.ParseUint(setID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid set_id", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("cards.flashcard_set_id = ?", id)
+	}
+
+	now := time.Now()
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+
+	due := []DueCard{}
+	err := query.
+		Select(`cards.id AS card_id, cards.flashcard_set_id, flashcard_sets.title AS deck_title, cards.type, cards.cloze, cards.front, cards.back,
+			card_reviews.due_at, COALESCE(card_reviews.interval_days, 0) AS interval_days,
+			COALESCE(card_reviews.repetitions, 0) AS repetitions, COALESCE(card_reviews.lapses, 0) AS lapses`).
+		Joins("JOIN flashcard_sets ON flashcard_sets.id = cards.flashcard_set_id AND flashcard_sets.deleted_at IS NULL").
+		Joins("LEFT JOIN card_reviews ON card_reviews.card_id = cards.id AND card_reviews.user_email = ? AND card_reviews.deleted_at IS NULL", userEmail).
+		Where("cards.deleted_at IS NULL AND flashcard_sets.user_email = ?", userEmail).
+		Where("card_reviews.id IS NULL OR card_reviews.due_at < ?", endOfToday).
+		Order("card_reviews.due_at IS NULL, card_reviews.due_at, cards.flashcard_set_id, cards.position").
+		Limit(limit).
+		Scan(&due).Error
+	if err != nil {
+		http.Error(w, "Failed to fetch due cards", http.StatusInternalServerError)
+		return
+	}
+	for i, card := range due {
+		if card.Type == clozeCard {
+			due[i].Text = card.Front
+			due[i].Front, due[i].Back = renderCloze(card.Front, card.Back, card.Cloze)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(due)
+}
+
+// ReviewFlashcard records a recall grade for a card and schedules its next review.
+func ReviewFlashcard(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CardID == 0 || req.Grade == nil {
+		http.Error(w, "Invalid request: card_id and grade are required", http.StatusBadRequest)
+		return
+	}
+
+	// The card must belong to one of the user's decks
+	var card models.Card
+	if err := db.DB.
+		Joins("JOIN flashcard_sets ON flashcard_sets.id = cards.flashcard_set_id AND flashcard_sets.deleted_at IS NULL").
+		Where("cards.id = ? AND flashcard_sets.user_email = ?", req.CardID, userEmail).
+		First(&card).Error; err != nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+
+	grade := *req.Grade
+	response := ReviewResponse{}
+	if card.Type == clozeCard && len(req.Answers) > 0 {
+		correct := checkClozeAnswers(clozeAnswers(card.Front, card.Cloze), req.Answers)
+		response.Correct = &correct
+		response.Expected = clozeAnswers(card.Front, card.Cloze)
+		if !correct && grade >= srs.Pass && grade <= srs.MaxGrade {
+			grade = srs.Pass - 1
+		}
+	}
+
+	now := time.Now()
+	var review models.CardReview
+	err := db.DB.Where("user_email = ? AND card_id = ?", userEmail, card.ID).First(&review).Error
+	if err == gorm.ErrRecordNotFound {
+		initial := srs.New(now)
+		review = models.CardReview{UserEmail: userEmail, CardID: card.ID, EaseFactor: initial.Ease, DueAt: initial.Due}
+	} else if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	next, err := srs.Review(srs.State{
+		Ease:        review.EaseFactor,
+		Interval:    review.IntervalDays,
+		Repetitions: review.Repetitions,
+		Lapses:      review.Lapses,
+		Due:         review.DueAt,
+	}, grade, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review.EaseFactor = next.Ease
+	review.IntervalDays = next.Interval
+	review.Repetitions = next.Repetitions
+	review.Lapses = next.Lapses
+	review.DueAt = next.Due
+	review.LastReviewedAt = &now
+	// An upsert rather than Save, so two first reviews of a card at once
+	// can't both insert it
+	review.ID = 0
+	err = db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_email"}, {Name: "card_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ease_factor", "interval_days", "repetitions", "lapses", "due_at", "last_reviewed_at", "updated_at", "deleted_at"}),
+	}).Create(&review).Error
+	if err != nil {
+		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		return
+	}
+
+	response.CardReview = review
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
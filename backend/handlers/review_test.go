@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"gorm.io/gorm"
+)
+
+// createDeck saves a deck of cards for owner, fronts in order.
+func createDeck(t *testing.T, owner string, fronts ...string) models.FlashcardSet {
+	t.Helper()
+	set := models.FlashcardSet{UserEmail: owner, Title: "Deck"}
+	for i, front := range fronts {
+		set.Cards = append(set.Cards, models.Card{Position: i, Front: front, Back: front + " back"})
+	}
+	if err := db.DB.Create(&set).Error; err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func grade(n int) *int { return &n }
+
+func TestReviewFlashcard(t *testing.T) {
+	setupHandlers(t)
+	deck := createDeck(t, testUser, "one", "two")
+	createDeck(t, "someone@example.com", "theirs")
+
+	var due []DueCard
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due")), &due)
+	if len(due) != 2 || due[0].Front != "one" || due[0].DueAt != nil {
+		t.Fatalf("due %+v", due)
+	}
+
+	var review models.CardReview
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: deck.Cards[0].ID, Grade: grade(4)}), &review)
+	if review.Repetitions != 1 || review.IntervalDays != 1 || review.LastReviewedAt == nil {
+		t.Errorf("first review %+v", review)
+	}
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: deck.Cards[0].ID, Grade: grade(4)}), &review)
+	if review.Repetitions != 2 || review.IntervalDays != 6 || review.DueAt.Before(time.Now().AddDate(0, 0, 5)) {
+		t.Errorf("second review %+v", review)
+	}
+	var count int64
+	db.DB.Model(&models.CardReview{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d review rows for one card", count)
+	}
+
+	// The reviewed card is no longer due today
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due")), &due)
+	if len(due) != 1 || due[0].Front != "two" {
+		t.Errorf("due after reviewing %+v", due)
+	}
+	decode(t, serve(GetDueFlashcards, get(t, "/flashcards/due?limit=1")), &due)
+	if len(due) != 1 {
+		t.Errorf("limit 1: %d cards", len(due))
+	}
+
+	// A first review that fails is a lapse
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: deck.Cards[1].ID, Grade: grade(1)}), &review)
+	if review.Lapses != 1 || review.Repetitions != 0 || review.IntervalDays != 1 {
+		t.Errorf("failed first review %+v", review)
+	}
+}
+
+func TestReviewFlashcardRace(t *testing.T) {
+	setupHandlers(t)
+	card := createDeck(t, testUser, "one").Cards[0].ID
+
+	// Another first review of the card is saved right after this one looks
+	// for the card's review row
+	raced := false
+	db.DB.Callback().Query().After("gorm:query").Register("test:other_review", func(tx *gorm.DB) {
+		if tx.Statement.Table == "card_reviews" && !raced {
+			raced = true
+			if err := db.DB.Create(&models.CardReview{UserEmail: testUser, CardID: card, EaseFactor: 2.5, IntervalDays: 1, Repetitions: 1}).Error; err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	var review models.CardReview
+	decode(t, post(t, ReviewFlashcard, ReviewRequest{CardID: card, Grade: grade(4)}), &review)
+	var reviews []models.CardReview
+	db.DB.Find(&reviews)
+	if !raced || len(reviews) != 1 || reviews[0].ID != review.ID || reviews[0].LastReviewedAt == nil {
+		t.Errorf("reviews %+v, got %+v", reviews, review)
+	}
+}
+
+func TestReviewFlashcardErrors(t *testing.T) {
+	setupHandlers(t)
+	mine := createDeck(t, testUser, "one")
+	theirs := createDeck(t, "someone@example.com", "theirs")
+
+	for name, tt := range map[string]struct {
+		req  ReviewRequest
+		code int
+	}{
+		"no card":        {ReviewRequest{Grade: grade(3)}, http.StatusBadRequest},
+		"no grade":       {ReviewRequest{CardID: mine.Cards[0].ID}, http.StatusBadRequest},
+		"grade too high": {ReviewRequest{CardID: mine.Cards[0].ID, Grade: grade(6)}, http.StatusBadRequest},
+		"someone else's": {ReviewRequest{CardID: theirs.Cards[0].ID, Grade: grade(3)}, http.StatusNotFound},
+	} {
+		if w := post(t, ReviewFlashcard, tt.req); w.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", name, w.Code, tt.code)
+		}
+	}
+	if w := serve(GetDueFlashcards, get(t, "/flashcards/due?limit=0")); w.Code != http.StatusBadRequest {
+		t.Errorf("limit 0: status %d", w.Code)
+	}
+}
@@ -3,16 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 	"tutor_genX/db"
+	"tutor_genX/llm"
 	"tutor_genX/models"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
-	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
@@ -27,11 +29,44 @@ type RoadmapWeek struct {
 	Topics []string `json:"topics"`
 }
 
+// RoadmapPlan is the week-by-week roadmap returned by the model.
+type RoadmapPlan []RoadmapWeek
+
+// Validate checks the plan has weeks numbered 1..n, each with a title and topics.
+func (p RoadmapPlan) Validate() error {
+	var problems llm.ValidationError
+	if len(p) == 0 {
+		problems.Addf("the roadmap must contain at least one week")
+	}
+	for i, week := range p {
+		if week.Week != i+1 {
+			problems.Addf("entry %d has \"week\": %d, weeks must be numbered 1, 2, 3... in order", i+1, week.Week)
+		}
+		if strings.TrimSpace(week.Title) == "" {
+			problems.Addf("week %d has an empty \"title\"", i+1)
+		}
+		if len(week.Topics) == 0 {
+			problems.Addf("week %d has no topics", i+1)
+		}
+		for _, topic := range week.Topics {
+			if strings.TrimSpace(topic) == "" {
+				problems.Addf("week %d has an empty topic", i+1)
+				break
+			}
+		}
+	}
+	return problems.Err()
+}
+
 type MarkAsCompletedRequest struct {
-	RoadmapID  uint `json:"roadmap_id"`
-	WeekID     uint `json:"week_id"`
-	TopicIndex int  `json:"topic_index"`
-	Value      bool `json:"value"` // true to mark complete, false to mark incomplete
+	TopicID uint    `json:"topic_id"`
+	Value   bool    `json:"value"`           // true to mark complete, false to mark incomplete
+	Notes   *string `json:"notes,omitempty"` // optional, replaces the topic's notes
+}
+
+// preloadTopics orders a week's topics for every roadmap query.
+func preloadTopics(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order ASC")
 }
 
 func HandleMarkAsCompleted(w http.ResponseWriter, r *http.Request) {
@@ -42,54 +77,61 @@ func HandleMarkAsCompleted(w http.ResponseWriter, r *http.Request) {
 	}
 	userEmail := claims["email"].(string)
 	var req MarkAsCompletedRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TopicID == 0 {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	// ✅ Get the roadmap week belonging to this user
-	var week models.RoadmapWeek
-	if err := db.DB.
-		Joins("JOIN roadmaps ON roadmaps.id = roadmap_weeks.roadmap_id").
-		Where("roadmap_weeks.id = ? AND roadmaps.user_email = ?", req.WeekID, userEmail).
-		First(&week).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.Error(w, "Week not found", http.StatusNotFound)
-			return
+	// ✅ Get the topic, making sure its roadmap belongs to this user, and
+	// save the change with a version of the roadmap so a rollback restores it
+	var topic models.RoadmapTopic
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var roadmap models.Roadmap
+		if err := tx.
+			Joins("JOIN roadmap_weeks ON roadmap_weeks.roadmap_id = roadmaps.id AND roadmap_weeks.deleted_at IS NULL").
+			Joins("JOIN roadmap_topics ON roadmap_topics.week_id = roadmap_weeks.id AND roadmap_topics.deleted_at IS NULL").
+			Where("roadmap_topics.id = ? AND roadmaps.user_email = ?", req.TopicID, userEmail).
+			First(&roadmap).Error; err != nil {
+			return err
 		}
-		http.Error(w, "Error fetching roadmap week", http.StatusInternalServerError)
-		return
-	}
-
-	// ✅ Decode JSON progress (stored as string in DB)
-	var progress []bool
-	if week.Progress != "" {
-		if err := json.Unmarshal([]byte(week.Progress), &progress); err != nil {
-			http.Error(w, "Failed to parse progress", http.StatusInternalServerError)
-			return
+		if err := lockRoadmap(tx, roadmap.ID); err != nil {
+			return err
+		}
+		if err := ensureBaseVersion(tx, &roadmap); err != nil {
+			return err
+		}
+		if err := tx.First(&topic, req.TopicID).Error; err != nil {
+			return err
 		}
-	}
-
-	// ✅ Ensure progress slice is long enough
-	if req.TopicIndex >= len(progress) {
-		newProgress := make([]bool, req.TopicIndex+1)
-		copy(newProgress, progress)
-		progress = newProgress
-	}
 
-	// ✅ Set topic completion status based on the value sent from frontend
-	progress[req.TopicIndex] = req.Value
+		// ✅ Set completion status based on the value sent from frontend
+		completed, notes := topic.CompletedAt != nil, topic.Notes
+		if req.Value {
+			if topic.CompletedAt == nil {
+				now := time.Now()
+				topic.CompletedAt = &now
+			}
+		} else {
+			topic.CompletedAt = nil
+		}
+		if req.Notes != nil {
+			topic.Notes = *req.Notes
+		}
+		if completed == req.Value && notes == topic.Notes {
+			return nil // Nothing changed, no new version
+		}
 
-	// ✅ Convert back to JSON string
-	progressJSON, err := json.Marshal(progress)
+		// ✅ Save update
+		if err := tx.Select("completed_at", "notes").Save(&topic).Error; err != nil {
+			return err
+		}
+		return recordRoadmapVersion(tx, roadmap.ID, userEmail, "progress")
+	})
 	if err != nil {
-		http.Error(w, "Failed to encode progress", http.StatusInternalServerError)
-		return
-	}
-	week.Progress = string(progressJSON)
-
-	// ✅ Save update
-	if err := db.DB.Save(&week).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Topic not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Error updating progress", http.StatusInternalServerError)
 		return
 	}
@@ -97,7 +139,7 @@ func HandleMarkAsCompleted(w http.ResponseWriter, r *http.Request) {
 	// ✅ Respond with success message
 	response := map[string]interface{}{
 		"message": "Progress updated successfully",
-		"week":    week,
+		"topic":   topic,
 		"status":  req.Value,
 	}
 
@@ -126,8 +168,13 @@ func DeleteAllRoadmaps(w http.ResponseWriter, r *http.Request) {
 		roadmapIDs = append(roadmapIDs, roadmap.ID)
 	}
 
-	// Step 4: Delete all associated weeks first
+	// Step 4: Delete all associated topics and weeks first
 	if len(roadmapIDs) > 0 {
+		weekIDs := db.DB.Model(&models.RoadmapWeek{}).Select("id").Where("roadmap_id IN ?", roadmapIDs)
+		if err := db.DB.Where("week_id IN (?)", weekIDs).Delete(&models.RoadmapTopic{}).Error; err != nil {
+			http.Error(w, "Failed to delete roadmap topics", http.StatusInternalServerError)
+			return
+		}
 		if err := db.DB.Where("roadmap_id IN ?", roadmapIDs).Delete(&models.RoadmapWeek{}).Error; err != nil {
 			http.Error(w, "Failed to delete roadmap weeks", http.StatusInternalServerError)
 			return
@@ -190,16 +237,6 @@ func HandleRoadmap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Setup Groq
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set in .env", http.StatusInternalServerError)
-		return
-	}
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
 	prompt := fmt.Sprintf(`You are an expert curriculum designer. Create a personalized learning roadmap based on the user's goal and preferences.
 
 	**User Goal:** "%s"
@@ -224,26 +261,13 @@ func HandleRoadmap(w http.ResponseWriter, r *http.Request) {
 	  }
 	]`, req.Goal, req.Motivation, req.LearningStyle)
 
-	// Call Groq with the specialized prompt
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleUser, Content: prompt},
-			},
-		},
-	)
-	if err != nil {
-		http.Error(w, "Failed to generate roadmap: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	content := resp.Choices[0].Message.Content
-
-	// Try parsing roadmap
-	var roadmap []RoadmapWeek
-	if err := json.Unmarshal([]byte(content), &roadmap); err != nil || len(roadmap) == 0 {
+	// Call the model with the specialized prompt
+	var roadmap RoadmapPlan
+	if err := completeJSON(context.Background(), prompt, &roadmap); err != nil {
+		if errors.Is(err, llm.ErrNotConfigured) {
+			http.Error(w, "Failed to generate roadmap: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 		http.Error(w, "Failed to parse roadmap. Please try a different goal.", http.StatusBadRequest)
 		return
 	}
@@ -288,25 +312,22 @@ func SaveRoadmap(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, week := range req.Roadmap {
-		topicsJSON, err := json.Marshal(week.Topics)
-		if err != nil {
-			http.Error(w, "Failed to serialize topics", http.StatusInternalServerError)
-			return
-		}
-		progress := make([]bool, len(week.Topics))
-		progressJSON, err := json.Marshal(progress)
-		if err != nil {
-			http.Error(w, "Failed to serialize progress", http.StatusInternalServerError)
-			return
-		}
-
-		db.DB.Create(&models.RoadmapWeek{
+		newWeek := models.RoadmapWeek{
 			RoadmapID: newRoadmap.ID,
 			Week:      week.Week,
 			Title:     week.Title,
-			Topics:    string(topicsJSON),
-			Progress:  string(progressJSON),
-		})
+		}
+		for i, title := range week.Topics {
+			newWeek.Topics = append(newWeek.Topics, models.RoadmapTopic{Order: i, Title: title})
+		}
+		if err := db.DB.Create(&newWeek).Error; err != nil {
+			http.Error(w, "Failed to save roadmap week", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := recordRoadmapVersion(db.DB, newRoadmap.ID, userEmail, "created"); err != nil {
+		http.Error(w, "Failed to save roadmap version", http.StatusInternalServerError)
+		return
 	}
 
 	// Optional: Send success response with the created roadmap ID
@@ -331,6 +352,7 @@ func GetUsersRoadmap(w http.ResponseWriter, r *http.Request) {
 		Preload("Weeks", func(db *gorm.DB) *gorm.DB {
 			return db.Order("week ASC")
 		}).
+		Preload("Weeks.Topics", preloadTopics).
 		Where("user_email = ?", userEmail).
 		Order("created_at desc").
 		Find(&roadmaps)
@@ -352,7 +374,7 @@ func GetSingleRoadmap(w http.ResponseWriter, r *http.Request) {
 	email := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)["email"].(string)
 
 	var roadmap models.Roadmap
-	err := db.DB.Preload("Weeks").Where("id = ? AND user_email = ?", roadmapID, email).First(&roadmap).Error
+	err := db.DB.Preload("Weeks").Preload("Weeks.Topics", preloadTopics).Where("id = ? AND user_email = ?", roadmapID, email).First(&roadmap).Error
 	if err != nil {
 		http.Error(w, "Roadmap not found", http.StatusNotFound)
 		return
@@ -376,17 +398,6 @@ func GoalNameHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request: topic is required", http.StatusBadRequest)
 		return
 	}
-	// Groq API setup
-	apiKey := os.Getenv("GROQ_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GROQ_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-
-	cfg := openai.DefaultConfig(apiKey)
-	cfg.BaseURL = "https://api.groq.com/openai/v1"
-	client := openai.NewClientWithConfig(cfg)
-
 	//prompt
 	prompt := fmt.Sprintf(`You are an AI assistant that generates professional, engaging, and descriptive names for learning roadmaps based on user input.
 Task
@@ -422,21 +433,12 @@ Your Task
 Generate a single, well-formatted roadmap title based on the user's input. Return only the title, nothing else.
 User Input: %s`, req.GoalReq)
 
-	// Call Groq
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "llama-3.3-70b-versatile",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleUser, Content: prompt},
-			},
-		},
-	)
+	// Call the model
+	title, err := complete(context.Background(), prompt)
 	if err != nil {
 		http.Error(w, "Failed to fetch explanation: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	title := resp.Choices[0].Message.Content
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -448,7 +450,7 @@ User Input: %s`, req.GoalReq)
 func TestPreload(w http.ResponseWriter, r *http.Request) {
 	var roadmap models.Roadmap
 
-	err := db.DB.Preload("Weeks").First(&roadmap).Error
+	err := db.DB.Preload("Weeks").Preload("Weeks.Topics", preloadTopics).First(&roadmap).Error
 	if err != nil {
 		fmt.Println("Preload error:", err)
 		http.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// TopicInput is a topic in an edit request. ID refers to an existing topic of
+// the same roadmap whose progress and notes should be kept; 0 means a new topic.
+type TopicInput struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+type UpdateWeekRequest struct {
+	Title  *string       `json:"title"`
+	Topics *[]TopicInput `json:"topics"` // full, ordered list of the week's topics
+}
+
+type AddWeekRequest struct {
+	Title    string   `json:"title"`
+	Topics   []string `json:"topics"`
+	Position int      `json:"position"` // 1-based week number to insert at, 0 appends
+}
+
+type ReorderWeeksRequest struct {
+	WeekIDs []uint `json:"week_ids"`
+}
+
+type RegenerateWeeksRequest struct {
+	FromWeek    int    `json:"from_week"`
+	ToWeek      int    `json:"to_week"`
+	Instruction string `json:"instruction"` // e.g. "make these weeks harder"
+}
+
+// RegeneratedWeeks is the model's replacement for a range of weeks.
+type RegeneratedWeeks struct {
+	Weeks []RoadmapWeek `json:"weeks"`
+}
+
+// Validate checks there is at least one week and each has a title and topics.
+func (g RegeneratedWeeks) Validate() error {
+	if len(g.Weeks) == 0 {
+		return errors.New(`"weeks" must contain at least one week`)
+	}
+	plan := make(RoadmapPlan, len(g.Weeks))
+	for i, week := range g.Weeks {
+		// Week numbers are assigned on save, only check the content here
+		week.Week = i + 1
+		plan[i] = week
+	}
+	return plan.Validate()
+}
+
+// errBadEdit marks errors caused by the request rather than the server.
+var errBadEdit = errors.New("invalid edit")
+
+func badEdit(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errBadEdit, fmt.Sprintf(format, args...))
+}
+
+// loadRoadmap fetches a user's roadmap with its weeks and topics in order.
+func loadRoadmap(tx *gorm.DB, id, userEmail string) (models.Roadmap, error) {
+	var roadmap models.Roadmap
+	err := tx.Preload("Weeks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("week ASC")
+	}).
+		Preload("Weeks.Topics", preloadTopics).
+		Where("id = ? AND user_email = ?", id, userEmail).
+		First(&roadmap).Error
+	return roadmap, err
+}
+
+// mutateRoadmap runs edit inside a transaction on the caller's roadmap and
+// responds with the updated roadmap.
+func mutateRoadmap(w http.ResponseWriter, r *http.Request, reason string, edit func(tx *gorm.DB, roadmap *models.Roadmap) error) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+	roadmapID := mux.Vars(r)["id"]
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockRoadmap(tx, roadmapID); err != nil {
+			return err
+		}
+		roadmap, err := loadRoadmap(tx, roadmapID, userEmail)
+		if err != nil {
+			return err
+		}
+		if err := ensureBaseVersion(tx, &roadmap); err != nil {
+			return err
+		}
+		if err := edit(tx, &roadmap); err != nil {
+			return err
+		}
+		return recordRoadmapVersion(tx, roadmap.ID, userEmail, reason)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			http.Error(w, "Roadmap not found", http.StatusNotFound)
+		case errors.Is(err, errBadEdit):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to update roadmap: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	roadmap, err := loadRoadmap(db.DB, roadmapID, userEmail)
+	if err != nil {
+		http.Error(w, "Failed to fetch roadmap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roadmap)
+}
+
+// findWeek returns the week with the given ID from a loaded roadmap.
+func findWeek(roadmap *models.Roadmap, weekIDStr string) (*models.RoadmapWeek, error) {
+	weekID, err := strconv.ParseUint(weekIDStr, 10, 64)
+	if err != nil {
+		return nil, badEdit("invalid week id")
+	}
+	for i := range roadmap.Weeks {
+		if roadmap.Weeks[i].ID == uint(weekID) {
+			return &roadmap.Weeks[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// roadmapTopics indexes every topic of a roadmap by ID.
+func roadmapTopics(roadmap *models.Roadmap) map[uint]models.RoadmapTopic {
+	topics := make(map[uint]models.RoadmapTopic)
+	for _, week := range roadmap.Weeks {
+		for _, topic := range week.Topics {
+			topics[topic.ID] = topic
+		}
+	}
+	return topics
+}
+
+// saveTopics makes inputs the ordered topics of weekID. Topics referenced by
+// ID are moved/renamed in place so they keep their progress; the rest are
+// created. It returns the IDs of every topic now in the week.
+func saveTopics(tx *gorm.DB, weekID uint, inputs []TopicInput, existing map[uint]models.RoadmapTopic) ([]uint, error) {
+	var kept []uint
+	for i, input := range inputs {
+		title := strings.TrimSpace(input.Title)
+		if title == "" {
+			return nil, badEdit("topic %d has an empty title", i+1)
+		}
+		if input.ID == 0 {
+			topic := models.RoadmapTopic{WeekID: weekID, Order: i, Title: title}
+			if err := tx.Create(&topic).Error; err != nil {
+				return nil, err
+			}
+			kept = append(kept, topic.ID)
+			continue
+		}
+		if _, ok := existing[input.ID]; !ok {
+			return nil, badEdit("topic %d does not belong to this roadmap", input.ID)
+		}
+		err := tx.Model(&models.RoadmapTopic{}).Where("id = ?", input.ID).
+			Updates(map[string]interface{}{"week_id": weekID, "sort_order": i, "title": title}).Error
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, input.ID)
+	}
+	return kept, nil
+}
+
+// pruneTopics deletes the topics of weekIDs that are not in keep.
+func pruneTopics(tx *gorm.DB, weekIDs []uint, keep []uint) error {
+	query := tx.Where("week_id IN ?", weekIDs)
+	if len(keep) > 0 {
+		query = query.Where("id NOT IN ?", keep)
+	}
+	return query.Delete(&models.RoadmapTopic{}).Error
+}
+
+// renumberWeeks numbers weeks 1..n in the given order.
+func renumberWeeks(tx *gorm.DB, weeks []models.RoadmapWeek) error {
+	for i, week := range weeks {
+		if week.Week == i+1 {
+			continue
+		}
+		if err := tx.Model(&models.RoadmapWeek{}).Where("id = ?", week.ID).Update("week", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateRoadmapWeek renames a week and/or replaces its ordered topic list.
+func UpdateRoadmapWeek(w http.ResponseWriter, r *http.Request) {
+	var req UpdateWeekRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	mutateRoadmap(w, r, "edit week", func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		week, err := findWeek(roadmap, mux.Vars(r)["weekId"])
+		if err != nil {
+			return err
+		}
+		if req.Title != nil {
+			title := strings.TrimSpace(*req.Title)
+			if title == "" {
+				return badEdit("week title cannot be empty")
+			}
+			if err := tx.Model(week).Update("title", title).Error; err != nil {
+				return err
+			}
+		}
+		if req.Topics != nil {
+			kept, err := saveTopics(tx, week.ID, *req.Topics, roadmapTopics(roadmap))
+			if err != nil {
+				return err
+			}
+			return pruneTopics(tx, []uint{week.ID}, kept)
+		}
+		return nil
+	})
+}
+
+// AddRoadmapWeek inserts a new week, shifting the following weeks down.
+func AddRoadmapWeek(w http.ResponseWriter, r *http.Request) {
+	var req AddWeekRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+		http.Error(w, "Invalid request: title is required", http.StatusBadRequest)
+		return
+	}
+
+	mutateRoadmap(w, r, "add week", func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		position := req.Position
+		if position == 0 {
+			position = len(roadmap.Weeks) + 1
+		}
+		if position < 1 || position > len(roadmap.Weeks)+1 {
+			return badEdit("position must be between 1 and %d", len(roadmap.Weeks)+1)
+		}
+
+		week := models.RoadmapWeek{RoadmapID: roadmap.ID, Week: position, Title: strings.TrimSpace(req.Title)}
+		if err := tx.Create(&week).Error; err != nil {
+			return err
+		}
+		inputs := make([]TopicInput, 0, len(req.Topics))
+		for _, title := range req.Topics {
+			inputs = append(inputs, TopicInput{Title: title})
+		}
+		if _, err := saveTopics(tx, week.ID, inputs, nil); err != nil {
+			return err
+		}
+
+		weeks := append([]models.RoadmapWeek{}, roadmap.Weeks[:position-1]...)
+		weeks = append(weeks, week)
+		weeks = append(weeks, roadmap.Weeks[position-1:]...)
+		return renumberWeeks(tx, weeks)
+	})
+}
+
+// DeleteRoadmapWeek removes a week and its topics and renumbers the rest.
+func DeleteRoadmapWeek(w http.ResponseWriter, r *http.Request) {
+	mutateRoadmap(w, r, "delete week", func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		week, err := findWeek(roadmap, mux.Vars(r)["weekId"])
+		if err != nil {
+			return err
+		}
+		if err := pruneTopics(tx, []uint{week.ID}, nil); err != nil {
+			return err
+		}
+		if err := tx.Delete(week).Error; err != nil {
+			return err
+		}
+
+		var remaining []models.RoadmapWeek
+		for _, other := range roadmap.Weeks {
+			if other.ID != week.ID {
+				remaining = append(remaining, other)
+			}
+		}
+		return renumberWeeks(tx, remaining)
+	})
+}
+
+// ReorderRoadmapWeeks renumbers the weeks in the order given by week_ids,
+// which must list every week of the roadmap exactly once.
+func ReorderRoadmapWeeks(w http.ResponseWriter, r *http.Request) {
+	var req ReorderWeeksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	mutateRoadmap(w, r, "reorder weeks", func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		if len(req.WeekIDs) != len(roadmap.Weeks) {
+			return badEdit("week_ids must list all %d weeks", len(roadmap.Weeks))
+		}
+		byID := make(map[uint]models.RoadmapWeek)
+		for _, week := range roadmap.Weeks {
+			byID[week.ID] = week
+		}
+		ordered := make([]models.RoadmapWeek, 0, len(req.WeekIDs))
+		for _, id := range req.WeekIDs {
+			week, ok := byID[id]
+			if !ok {
+				return badEdit("week %d is missing or listed twice", id)
+			}
+			delete(byID, id)
+			ordered = append(ordered, week)
+		}
+		return renumberWeeks(tx, ordered)
+	})
+}
+
+// RegenerateRoadmapWeeks asks the model to rewrite weeks from_week..to_week,
+// showing it the rest of the roadmap as context. Topics whose title survives
+// the rewrite keep their progress and notes.
+func RegenerateRoadmapWeeks(w http.ResponseWriter, r *http.Request) {
+	var req RegenerateWeeksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.ToWeek == 0 {
+		req.ToWeek = req.FromWeek
+	}
+
+	// Generate outside the transaction, the model can take a while
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, err := loadRoadmap(db.DB, mux.Vars(r)["id"], claims["email"].(string))
+	if err != nil {
+		http.Error(w, "Roadmap not found", http.StatusNotFound)
+		return
+	}
+	if req.FromWeek < 1 || req.ToWeek < req.FromWeek || req.ToWeek > len(current.Weeks) {
+		http.Error(w, fmt.Sprintf("weeks must be a range within 1-%d", len(current.Weeks)), http.StatusBadRequest)
+		return
+	}
+	var generated RegeneratedWeeks
+	if err := completeJSON(context.Background(), regeneratePrompt(&current, req), &generated); err != nil {
+		http.Error(w, "Failed to regenerate weeks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mutateRoadmap(w, r, fmt.Sprintf("regenerate weeks %d-%d", req.FromWeek, req.ToWeek), func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		if req.ToWeek > len(roadmap.Weeks) {
+			return badEdit("the roadmap changed while regenerating, please retry")
+		}
+		target := roadmap.Weeks[req.FromWeek-1 : req.ToWeek]
+
+		// Surviving topics are matched by title so their progress carries over
+		existing := make(map[uint]models.RoadmapTopic)
+		byTitle := make(map[string]uint)
+		var targetIDs []uint
+		for _, week := range target {
+			targetIDs = append(targetIDs, week.ID)
+			for _, topic := range week.Topics {
+				existing[topic.ID] = topic
+				byTitle[normalizeTitle(topic.Title)] = topic.ID
+			}
+		}
+
+		var kept []uint
+		var newWeeks []models.RoadmapWeek
+		for i, gen := range generated.Weeks {
+			var week models.RoadmapWeek
+			if i < len(target) {
+				// Reuse the existing week rows where possible
+				week = target[i]
+				if err := tx.Model(&week).Update("title", strings.TrimSpace(gen.Title)).Error; err != nil {
+					return err
+				}
+			} else {
+				week = models.RoadmapWeek{RoadmapID: roadmap.ID, Title: strings.TrimSpace(gen.Title)}
+				if err := tx.Create(&week).Error; err != nil {
+					return err
+				}
+			}
+
+			inputs := make([]TopicInput, 0, len(gen.Topics))
+			for _, title := range gen.Topics {
+				key := normalizeTitle(title)
+				inputs = append(inputs, TopicInput{ID: byTitle[key], Title: title})
+				delete(byTitle, key) // a topic can only survive once
+			}
+			ids, err := saveTopics(tx, week.ID, inputs, existing)
+			if err != nil {
+				return err
+			}
+			kept = append(kept, ids...)
+			newWeeks = append(newWeeks, week)
+		}
+
+		if err := pruneTopics(tx, targetIDs, kept); err != nil {
+			return err
+		}
+		if len(target) > len(newWeeks) {
+			for _, week := range target[len(newWeeks):] {
+				if err := tx.Delete(&week).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		weeks := append([]models.RoadmapWeek{}, roadmap.Weeks[:req.FromWeek-1]...)
+		weeks = append(weeks, newWeeks...)
+		weeks = append(weeks, roadmap.Weeks[req.ToWeek:]...)
+		return renumberWeeks(tx, weeks)
+	})
+}
+
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+func regeneratePrompt(roadmap *models.Roadmap, req RegenerateWeeksRequest) string {
+	var current strings.Builder
+	for _, week := range roadmap.Weeks {
+		marker := ""
+		if week.Week >= req.FromWeek && week.Week <= req.ToWeek {
+			marker = " [REWRITE]"
+		}
+		titles := make([]string, 0, len(week.Topics))
+		for _, topic := range week.Topics {
+			titles = append(titles, topic.Title)
+		}
+		fmt.Fprintf(&current, "Week %d%s: %s\n  Topics: %s\n", week.Week, marker, week.Title, strings.Join(titles, "; "))
+	}
+
+	instruction := strings.TrimSpace(req.Instruction)
+	if instruction == "" {
+		instruction = "Improve these weeks while keeping them consistent with the rest of the roadmap."
+	}
+
+	return fmt.Sprintf(`You are an expert curriculum designer revising part of an existing learning roadmap.
+
+**Roadmap Goal:** "%s"
+**Roadmap Title:** "%s"
+
+**Current Roadmap:**
+%s
+**Task:** Rewrite ONLY the weeks marked [REWRITE] (weeks %d-%d). %s
+
+**Instructions:**
+1.  Keep the rewritten weeks consistent with the weeks before and after them; do not repeat topics covered elsewhere.
+2.  Each week must have a clear title and 3-5 specific, actionable topics.
+3.  Keep a topic's exact wording if it should stay, so the learner's progress on it is preserved.
+
+**Output Format (Strict JSON object, no other text):**
+{
+  "weeks": [
+    {
+      "week": %d,
+      "title": "Week Title",
+      "topics": ["Topic 1", "Topic 2", "Topic 3"]
+    }
+  ]
+}`, roadmap.Goal, roadmap.Title, current.String(), req.FromWeek, req.ToWeek, instruction, req.FromWeek)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+)
+
+// editRoadmap sends body to handler as testUser, with the route's vars set.
+func editRoadmap(t *testing.T, handler http.HandlerFunc, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(handler, mux.SetURLVars(request(t, body), vars))
+}
+
+// weekTitles lists each week as "title: topic, topic".
+func weekTitles(roadmap models.Roadmap) []string {
+	var out []string
+	for _, week := range roadmap.Weeks {
+		var topics []string
+		for _, topic := range week.Topics {
+			topics = append(topics, topic.Title)
+		}
+		out = append(out, week.Title+": "+strings.Join(topics, ", "))
+	}
+	return out
+}
+
+func checkWeeks(t *testing.T, roadmap models.Roadmap, want ...string) {
+	t.Helper()
+	got := weekTitles(roadmap)
+	if strings.Join(got, " | ") != strings.Join(want, " | ") {
+		t.Errorf("weeks\n got %q\nwant %q", got, want)
+	}
+	for i, week := range roadmap.Weeks {
+		if week.Week != i+1 {
+			t.Errorf("week %q is numbered %d, want %d", week.Title, week.Week, i+1)
+		}
+	}
+}
+
+func TestUpdateRoadmapWeek(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	week := getRoadmap(t, id).Weeks[0]
+	syntax, types := week.Topics[0], week.Topics[1]
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: types.ID, Value: true})
+
+	vars := map[string]string{"id": itoa(id), "weekId": itoa(week.ID)}
+	title := "Foundations"
+	var roadmap models.Roadmap
+	decode(t, editRoadmap(t, UpdateRoadmapWeek, vars, UpdateWeekRequest{
+		Title:  &title,
+		Topics: &[]TopicInput{{ID: types.ID, Title: "Types and values"}, {Title: "Packages"}, {ID: syntax.ID, Title: "Syntax"}},
+	}), &roadmap)
+	checkWeeks(t, roadmap, "Foundations: Types and values, Packages, Syntax", "Concurrency: Goroutines")
+
+	// The moved topic keeps its row and its progress, the dropped one is gone
+	topics := roadmap.Weeks[0].Topics
+	if topics[0].ID != types.ID || topics[0].CompletedAt == nil || topics[2].ID != syntax.ID {
+		t.Errorf("topics %+v", topics)
+	}
+	var count int64
+	db.DB.Model(&models.RoadmapTopic{}).Where("title = ?", "Functions").Count(&count)
+	if count != 0 {
+		t.Error("the dropped topic is still there")
+	}
+
+	other := getRoadmap(t, id).Weeks[1].Topics[0]
+	empty := " "
+	for name, req := range map[string]UpdateWeekRequest{
+		"empty title":   {Title: &empty},
+		"empty topic":   {Topics: &[]TopicInput{{Title: " "}}},
+		"unknown topic": {Topics: &[]TopicInput{{ID: 999, Title: "Nope"}}},
+	} {
+		if w := editRoadmap(t, UpdateRoadmapWeek, vars, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", name, w.Code)
+		}
+	}
+	// Topics can be moved between weeks of the same roadmap
+	decode(t, editRoadmap(t, UpdateRoadmapWeek, vars, UpdateWeekRequest{Topics: &[]TopicInput{{ID: other.ID, Title: other.Title}}}), &roadmap)
+	checkWeeks(t, roadmap, "Foundations: Goroutines", "Concurrency: ")
+}
+
+func TestAddDeleteAndReorderWeeks(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	vars := map[string]string{"id": itoa(id)}
+
+	var roadmap models.Roadmap
+	decode(t, editRoadmap(t, AddRoadmapWeek, vars, AddWeekRequest{Title: "Tooling", Topics: []string{"go vet"}, Position: 2}), &roadmap)
+	checkWeeks(t, roadmap, "Basics: Syntax, Types, Functions", "Tooling: go vet", "Concurrency: Goroutines")
+	decode(t, editRoadmap(t, AddRoadmapWeek, vars, AddWeekRequest{Title: "Project"}), &roadmap)
+	checkWeeks(t, roadmap, "Basics: Syntax, Types, Functions", "Tooling: go vet", "Concurrency: Goroutines", "Project: ")
+
+	ids := []uint{roadmap.Weeks[3].ID, roadmap.Weeks[0].ID, roadmap.Weeks[2].ID, roadmap.Weeks[1].ID}
+	decode(t, editRoadmap(t, ReorderRoadmapWeeks, vars, ReorderWeeksRequest{WeekIDs: ids}), &roadmap)
+	checkWeeks(t, roadmap, "Project: ", "Basics: Syntax, Types, Functions", "Concurrency: Goroutines", "Tooling: go vet")
+
+	deleted := roadmap.Weeks[1]
+	decode(t, editRoadmap(t, DeleteRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(deleted.ID)}, nil), &roadmap)
+	checkWeeks(t, roadmap, "Project: ", "Concurrency: Goroutines", "Tooling: go vet")
+	var count int64
+	db.DB.Model(&models.RoadmapTopic{}).Where("week_id = ?", deleted.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d topics of the deleted week left", count)
+	}
+
+	for name, tt := range map[string]struct {
+		handler http.HandlerFunc
+		body    interface{}
+	}{
+		"position out of range": {AddRoadmapWeek, AddWeekRequest{Title: "Late", Position: 9}},
+		"no title":              {AddRoadmapWeek, AddWeekRequest{}},
+		"week missing":          {ReorderRoadmapWeeks, ReorderWeeksRequest{WeekIDs: ids[:2]}},
+		"week twice":            {ReorderRoadmapWeeks, ReorderWeeksRequest{WeekIDs: []uint{ids[0], ids[0], ids[2]}}},
+	} {
+		if w := editRoadmap(t, tt.handler, vars, tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", name, w.Code)
+		}
+	}
+}
+
+func TestRegenerateRoadmapWeeks(t *testing.T) {
+	provider := setupHandlers(t, `{"weeks": [
+		{"week": 2, "title": "Concurrency in depth", "topics": ["goroutines", "Channels"]},
+		{"week": 3, "title": "Patterns", "topics": ["Pipelines"]}
+	]}`)
+	id := saveRoadmap(t, goPlan)
+	goroutines := getRoadmap(t, id).Weeks[1].Topics[0]
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: goroutines.ID, Value: true})
+
+	var roadmap models.Roadmap
+	decode(t, editRoadmap(t, RegenerateRoadmapWeeks, map[string]string{"id": itoa(id)}, RegenerateWeeksRequest{FromWeek: 2, Instruction: "go deeper"}), &roadmap)
+	checkWeeks(t, roadmap, "Basics: Syntax, Types, Functions", "Concurrency in depth: goroutines, Channels", "Patterns: Pipelines")
+
+	// A topic that survives the rewrite keeps its progress
+	if kept := roadmap.Weeks[1].Topics[0]; kept.ID != goroutines.ID || kept.CompletedAt == nil {
+		t.Errorf("surviving topic %+v", kept)
+	}
+	prompt := provider.Calls()[0][0].Content
+	if !strings.Contains(prompt, "Week 2 [REWRITE]: Concurrency") || strings.Contains(prompt, "Week 1 [REWRITE]") || !strings.Contains(prompt, "go deeper") {
+		t.Errorf("prompt:\n%s", prompt)
+	}
+
+	if w := editRoadmap(t, RegenerateRoadmapWeeks, map[string]string{"id": itoa(id)}, RegenerateWeeksRequest{FromWeek: 2, ToWeek: 9}); w.Code != http.StatusBadRequest {
+		t.Errorf("range past the end: status %d", w.Code)
+	}
+}
+
+func TestRoadmapEditsNeedOwner(t *testing.T) {
+	setupHandlers(t)
+	theirs := models.Roadmap{UserEmail: "someone@example.com", Goal: "Theirs", Weeks: []models.RoadmapWeek{
+		{Week: 1, Title: "Week", Topics: []models.RoadmapTopic{{Title: "Topic"}}},
+	}}
+	db.DB.Create(&theirs)
+	vars := map[string]string{"id": itoa(theirs.ID), "weekId": itoa(theirs.Weeks[0].ID)}
+	title := "Mine now"
+
+	for name, tt := range map[string]struct {
+		handler http.HandlerFunc
+		body    interface{}
+	}{
+		"update":     {UpdateRoadmapWeek, UpdateWeekRequest{Title: &title}},
+		"add":        {AddRoadmapWeek, AddWeekRequest{Title: "Extra"}},
+		"delete":     {DeleteRoadmapWeek, nil},
+		"reorder":    {ReorderRoadmapWeeks, ReorderWeeksRequest{WeekIDs: []uint{theirs.Weeks[0].ID}}},
+		"regenerate": {RegenerateRoadmapWeeks, RegenerateWeeksRequest{FromWeek: 1}},
+	} {
+		if w := editRoadmap(t, tt.handler, vars, tt.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d", name, w.Code)
+		}
+	}
+	var week models.RoadmapWeek
+	db.DB.First(&week, theirs.Weeks[0].ID)
+	if week.Title != "Week" {
+		t.Errorf("their week was renamed to %q", week.Title)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+)
+
+// saveRoadmap saves plan as a roadmap of testUser and returns its ID.
+func saveRoadmap(t *testing.T, plan []RoadmapWeek) uint {
+	t.Helper()
+	var saved struct {
+		ID uint `json:"id"`
+	}
+	decode(t, post(t, SaveRoadmap, map[string]interface{}{"goal": "Learn Go", "title": "Go", "roadmap": plan}), &saved)
+	return saved.ID
+}
+
+// getRoadmap loads roadmap id as testUser.
+func getRoadmap(t *testing.T, id uint) models.Roadmap {
+	t.Helper()
+	r := mux.SetURLVars(get(t, "/roadmap/"+itoa(id)), map[string]string{"id": itoa(id)})
+	var roadmap models.Roadmap
+	decode(t, serve(GetSingleRoadmap, r), &roadmap)
+	return roadmap
+}
+
+var goPlan = []RoadmapWeek{
+	{Week: 1, Title: "Basics", Topics: []string{"Syntax", "Types", "Functions"}},
+	{Week: 2, Title: "Concurrency", Topics: []string{"Goroutines"}},
+}
+
+func TestSaveRoadmapTopics(t *testing.T) {
+	setupHandlers(t)
+	roadmap := getRoadmap(t, saveRoadmap(t, goPlan))
+	if len(roadmap.Weeks) != 2 {
+		t.Fatalf("weeks %+v", roadmap.Weeks)
+	}
+	topics := roadmap.Weeks[0].Topics
+	if len(topics) != 3 || topics[0].Title != "Syntax" || topics[2].Title != "Functions" || topics[2].Order != 2 || topics[0].CompletedAt != nil {
+		t.Errorf("topics %+v", topics)
+	}
+}
+
+func TestMarkAsCompleted(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	topic := getRoadmap(t, id).Weeks[0].Topics[1]
+
+	notes := "Read the spec"
+	if w := post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: topic.ID, Value: true, Notes: &notes}); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	done := getRoadmap(t, id).Weeks[0].Topics[1]
+	if done.CompletedAt == nil || done.Notes != notes {
+		t.Fatalf("after marking: %+v", done)
+	}
+
+	// Marking again keeps the first completion time, and notes are optional
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: topic.ID, Value: true})
+	again := getRoadmap(t, id).Weeks[0].Topics[1]
+	if again.CompletedAt == nil || !again.CompletedAt.Equal(*done.CompletedAt) || again.Notes != notes {
+		t.Errorf("after marking again: %+v", again)
+	}
+
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: topic.ID, Value: false})
+	if undone := getRoadmap(t, id).Weeks[0].Topics[1]; undone.CompletedAt != nil {
+		t.Errorf("after unmarking: %+v", undone)
+	}
+
+	if w := post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{Value: true}); w.Code != http.StatusBadRequest {
+		t.Errorf("no topic: status %d", w.Code)
+	}
+	if w := post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: 999, Value: true}); w.Code != http.StatusNotFound {
+		t.Errorf("unknown topic: status %d", w.Code)
+	}
+	theirs := models.Roadmap{UserEmail: "someone@example.com", Goal: "Theirs", Weeks: []models.RoadmapWeek{
+		{Week: 1, Title: "Week", Topics: []models.RoadmapTopic{{Title: "Topic"}}},
+	}}
+	db.DB.Create(&theirs)
+	if w := post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: theirs.Weeks[0].Topics[0].ID, Value: true}); w.Code != http.StatusNotFound {
+		t.Errorf("someone else's topic: status %d", w.Code)
+	}
+}
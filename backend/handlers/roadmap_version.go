@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RoadmapSnapshot is a roadmap at one version: its structure and the
+// progress (completed topics, notes) on it. IDs are kept so versions can be
+// diffed and topics matched back to their rows. Progress is false for
+// versions saved before progress was versioned, which hold the structure only.
+type RoadmapSnapshot struct {
+	Goal     string         `json:"goal"`
+	Title    string         `json:"title"`
+	Progress bool           `json:"progress,omitempty"`
+	Weeks    []SnapshotWeek `json:"weeks"`
+}
+
+type SnapshotWeek struct {
+	ID     uint            `json:"id"`
+	Week   int             `json:"week"`
+	Title  string          `json:"title"`
+	Topics []SnapshotTopic `json:"topics"`
+}
+
+type SnapshotTopic struct {
+	ID          uint       `json:"id"`
+	Order       int        `json:"order"`
+	Title       string     `json:"title"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+}
+
+// RoadmapDiff describes what changed between two versions.
+type RoadmapDiff struct {
+	From          int           `json:"from"`
+	To            int           `json:"to"`
+	TitleChange   *TextChange   `json:"title_change,omitempty"`
+	WeeksAdded    []SnapshotRef `json:"weeks_added"`
+	WeeksRemoved  []SnapshotRef `json:"weeks_removed"`
+	WeeksRenamed  []RenameRef   `json:"weeks_renamed"`
+	WeeksMoved    []MoveRef     `json:"weeks_moved"`
+	TopicsAdded   []SnapshotRef `json:"topics_added"`
+	TopicsRemoved []SnapshotRef `json:"topics_removed"`
+	TopicsRenamed []RenameRef   `json:"topics_renamed"`
+	TopicsMoved   []MoveRef     `json:"topics_moved"`
+	// Topics marked complete or incomplete, when both versions hold progress
+	TopicsCompleted []SnapshotRef `json:"topics_completed"`
+	TopicsReopened  []SnapshotRef `json:"topics_reopened"`
+}
+
+type TextChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SnapshotRef points at a week or topic; Week is the week number it is in.
+type SnapshotRef struct {
+	ID    uint   `json:"id"`
+	Week  int    `json:"week"`
+	Title string `json:"title"`
+}
+
+type RenameRef struct {
+	ID   uint   `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MoveRef is a week whose number changed, or a topic that changed week.
+type MoveRef struct {
+	ID       uint   `json:"id"`
+	Title    string `json:"title"`
+	FromWeek int    `json:"from_week"`
+	ToWeek   int    `json:"to_week"`
+}
+
+func snapshotOf(roadmap *models.Roadmap) RoadmapSnapshot {
+	snap := RoadmapSnapshot{Goal: roadmap.Goal, Title: roadmap.Title, Progress: true, Weeks: []SnapshotWeek{}}
+	for _, week := range roadmap.Weeks {
+		sw := SnapshotWeek{ID: week.ID, Week: week.Week, Title: week.Title, Topics: []SnapshotTopic{}}
+		for _, topic := range week.Topics {
+			sw.Topics = append(sw.Topics, SnapshotTopic{ID: topic.ID, Order: topic.Order, Title: topic.Title, CompletedAt: topic.CompletedAt, Notes: topic.Notes})
+		}
+		snap.Weeks = append(snap.Weeks, sw)
+	}
+	return snap
+}
+
+// lockRoadmap locks a roadmap's row until the end of the transaction, so
+// concurrent edits take turns and can't number two versions the same.
+func lockRoadmap(tx *gorm.DB, roadmapID interface{}) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Roadmap{}, "id = ?", roadmapID).Error
+}
+
+// recordRoadmapVersion stores the current structure of a roadmap as its next version.
+func recordRoadmapVersion(tx *gorm.DB, roadmapID uint, userEmail, reason string) error {
+	if err := lockRoadmap(tx, roadmapID); err != nil {
+		return err
+	}
+	roadmap, err := loadRoadmap(tx, strconv.FormatUint(uint64(roadmapID), 10), userEmail)
+	if err != nil {
+		return err
+	}
+	snapshotJSON, err := json.Marshal(snapshotOf(&roadmap))
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	if err := tx.Model(&models.RoadmapVersion{}).Where("roadmap_id = ?", roadmapID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.RoadmapVersion{
+		RoadmapID: roadmapID,
+		Version:   latest + 1,
+		Reason:    reason,
+		Snapshot:  string(snapshotJSON),
+	}).Error
+}
+
+// ensureBaseVersion snapshots roadmaps saved before versioning existed so
+// their original structure is not lost on the first edit.
+func ensureBaseVersion(tx *gorm.DB, roadmap *models.Roadmap) error {
+	var count int64
+	if err := tx.Model(&models.RoadmapVersion{}).Where("roadmap_id = ?", roadmap.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return recordRoadmapVersion(tx, roadmap.ID, roadmap.UserEmail, "initial")
+}
+
+// loadVersion fetches one version of a roadmap the user owns and decodes it.
+func loadVersion(tx *gorm.DB, roadmapID, userEmail string, version int) (models.RoadmapVersion, RoadmapSnapshot, error) {
+	var v models.RoadmapVersion
+	var snap RoadmapSnapshot
+	err := tx.Joins("JOIN roadmaps ON roadmaps.id = roadmap_versions.roadmap_id AND roadmaps.deleted_at IS NULL").
+		Where("roadmap_versions.roadmap_id = ? AND roadmap_versions.version = ? AND roadmaps.user_email = ?", roadmapID, version, userEmail).
+		First(&v).Error
+	if err != nil {
+		return v, snap, err
+	}
+	err = json.Unmarshal([]byte(v.Snapshot), &snap)
+	return v, snap, err
+}
+
+// GetRoadmapVersions lists the versions of a roadmap, newest first, without their snapshots.
+func GetRoadmapVersions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+
+	var roadmap models.Roadmap
+	if err := db.DB.First(&roadmap, "id = ? AND user_email = ?", mux.Vars(r)["id"], userEmail).Error; err != nil {
+		http.Error(w, "Roadmap not found", http.StatusNotFound)
+		return
+	}
+
+	versions := []models.RoadmapVersion{}
+	if err := db.DB.Omit("snapshot").Where("roadmap_id = ?", roadmap.ID).Order("version desc").Find(&versions).Error; err != nil {
+		http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GetRoadmapVersion returns a single version with its snapshot.
+func GetRoadmapVersion(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	vars := mux.Vars(r)
+	version, _ := strconv.Atoi(vars["version"])
+
+	v, snap, err := loadVersion(db.DB, vars["id"], claims["email"].(string), version)
+	if err != nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":    v.Version,
+		"reason":     v.Reason,
+		"created_at": v.CreatedAt,
+		"roadmap":    snap,
+	})
+}
+
+// DiffRoadmapVersions compares version ?from= with version ?to= (latest by default).
+func DiffRoadmapVersions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userEmail := claims["email"].(string)
+	roadmapID := mux.Vars(r)["id"]
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from version is required", http.StatusBadRequest)
+		return
+	}
+	// to defaults to the latest version
+	var to int
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		if to, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "Invalid to version", http.StatusBadRequest)
+			return
+		}
+	} else if err := db.DB.Model(&models.RoadmapVersion{}).Where("roadmap_id = ?", roadmapID).
+		Select("COALESCE(MAX(version), 0)").Scan(&to).Error; err != nil {
+		http.Error(w, "Failed to fetch versions", http.StatusInternalServerError)
+		return
+	}
+
+	_, fromSnap, err := loadVersion(db.DB, roadmapID, userEmail, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Version %d not found", from), http.StatusNotFound)
+		return
+	}
+	_, toSnap, err := loadVersion(db.DB, roadmapID, userEmail, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Version %d not found", to), http.StatusNotFound)
+		return
+	}
+
+	diff := diffSnapshots(fromSnap, toSnap)
+	diff.From, diff.To = from, to
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+func diffSnapshots(a, b RoadmapSnapshot) RoadmapDiff {
+	diff := RoadmapDiff{
+		WeeksAdded: []SnapshotRef{}, WeeksRemoved: []SnapshotRef{}, WeeksRenamed: []RenameRef{}, WeeksMoved: []MoveRef{},
+		TopicsAdded: []SnapshotRef{}, TopicsRemoved: []SnapshotRef{}, TopicsRenamed: []RenameRef{}, TopicsMoved: []MoveRef{},
+		TopicsCompleted: []SnapshotRef{}, TopicsReopened: []SnapshotRef{},
+	}
+	if a.Title != b.Title {
+		diff.TitleChange = &TextChange{From: a.Title, To: b.Title}
+	}
+
+	type placedTopic struct {
+		SnapshotTopic
+		week int
+	}
+	index := func(s RoadmapSnapshot) (map[uint]SnapshotWeek, map[uint]placedTopic) {
+		weeks := make(map[uint]SnapshotWeek)
+		topics := make(map[uint]placedTopic)
+		for _, week := range s.Weeks {
+			weeks[week.ID] = week
+			for _, topic := range week.Topics {
+				topics[topic.ID] = placedTopic{topic, week.Week}
+			}
+		}
+		return weeks, topics
+	}
+	oldWeeks, oldTopics := index(a)
+	newWeeks, newTopics := index(b)
+
+	for _, week := range b.Weeks {
+		old, ok := oldWeeks[week.ID]
+		if !ok {
+			diff.WeeksAdded = append(diff.WeeksAdded, SnapshotRef{ID: week.ID, Week: week.Week, Title: week.Title})
+			continue
+		}
+		if old.Title != week.Title {
+			diff.WeeksRenamed = append(diff.WeeksRenamed, RenameRef{ID: week.ID, From: old.Title, To: week.Title})
+		}
+		if old.Week != week.Week {
+			diff.WeeksMoved = append(diff.WeeksMoved, MoveRef{ID: week.ID, Title: week.Title, FromWeek: old.Week, ToWeek: week.Week})
+		}
+	}
+	for _, week := range a.Weeks {
+		if _, ok := newWeeks[week.ID]; !ok {
+			diff.WeeksRemoved = append(diff.WeeksRemoved, SnapshotRef{ID: week.ID, Week: week.Week, Title: week.Title})
+		}
+	}
+
+	for _, week := range b.Weeks {
+		for _, topic := range week.Topics {
+			old, ok := oldTopics[topic.ID]
+			if !ok {
+				diff.TopicsAdded = append(diff.TopicsAdded, SnapshotRef{ID: topic.ID, Week: week.Week, Title: topic.Title})
+				continue
+			}
+			if old.Title != topic.Title {
+				diff.TopicsRenamed = append(diff.TopicsRenamed, RenameRef{ID: topic.ID, From: old.Title, To: topic.Title})
+			}
+			if old.week != week.Week {
+				diff.TopicsMoved = append(diff.TopicsMoved, MoveRef{ID: topic.ID, Title: topic.Title, FromWeek: old.week, ToWeek: week.Week})
+			}
+			if a.Progress && b.Progress && (old.CompletedAt == nil) != (topic.CompletedAt == nil) {
+				ref := SnapshotRef{ID: topic.ID, Week: week.Week, Title: topic.Title}
+				if topic.CompletedAt != nil {
+					diff.TopicsCompleted = append(diff.TopicsCompleted, ref)
+				} else {
+					diff.TopicsReopened = append(diff.TopicsReopened, ref)
+				}
+			}
+		}
+	}
+	for _, week := range a.Weeks {
+		for _, topic := range week.Topics {
+			if _, ok := newTopics[topic.ID]; !ok {
+				diff.TopicsRemoved = append(diff.TopicsRemoved, SnapshotRef{ID: topic.ID, Week: week.Week, Title: topic.Title})
+			}
+		}
+	}
+	return diff
+}
+
+// RollbackRoadmap restores an earlier version, progress included, as a new
+// version. Weeks and topics are soft deleted, so restored topics are the same
+// rows. Versions without progress restore the structure and leave progress
+// as it is.
+func RollbackRoadmap(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	mutateRoadmap(w, r, fmt.Sprintf("rollback to v%d", version), func(tx *gorm.DB, roadmap *models.Roadmap) error {
+		_, snap, err := loadVersion(tx, vars["id"], roadmap.UserEmail, version)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return badEdit("version %d not found", version)
+			}
+			return err
+		}
+		return restoreSnapshot(tx, roadmap, snap)
+	})
+}
+
+func restoreSnapshot(tx *gorm.DB, roadmap *models.Roadmap, snap RoadmapSnapshot) error {
+	if err := tx.Model(roadmap).Updates(map[string]interface{}{"goal": snap.Goal, "title": snap.Title}).Error; err != nil {
+		return err
+	}
+
+	// Every week the roadmap has ever had, including soft deleted ones
+	roadmapWeeks := tx.Unscoped().Model(&models.RoadmapWeek{}).Select("id").Where("roadmap_id = ?", roadmap.ID)
+
+	var keepWeeks, keepTopics []uint
+	for _, sw := range snap.Weeks {
+		week := models.RoadmapWeek{RoadmapID: roadmap.ID, Week: sw.Week, Title: sw.Title}
+		res := tx.Unscoped().Model(&models.RoadmapWeek{}).
+			Where("id = ? AND roadmap_id = ?", sw.ID, roadmap.ID).
+			Updates(map[string]interface{}{"deleted_at": nil, "week": sw.Week, "title": sw.Title})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if err := tx.Create(&week).Error; err != nil {
+				return err
+			}
+		} else {
+			week.ID = sw.ID
+		}
+		keepWeeks = append(keepWeeks, week.ID)
+
+		for _, st := range sw.Topics {
+			restored := map[string]interface{}{"deleted_at": nil, "week_id": week.ID, "sort_order": st.Order, "title": st.Title}
+			if snap.Progress {
+				restored["completed_at"], restored["notes"] = st.CompletedAt, st.Notes
+			}
+			res := tx.Unscoped().Model(&models.RoadmapTopic{}).
+				Where("id = ? AND week_id IN (?)", st.ID, roadmapWeeks).
+				Updates(restored)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				keepTopics = append(keepTopics, st.ID)
+				continue
+			}
+			topic := models.RoadmapTopic{WeekID: week.ID, Order: st.Order, Title: st.Title, CompletedAt: st.CompletedAt, Notes: st.Notes}
+			if err := tx.Create(&topic).Error; err != nil {
+				return err
+			}
+			keepTopics = append(keepTopics, topic.ID)
+		}
+	}
+
+	// Anything not in the snapshot goes away (softly)
+	topics := tx.Where("week_id IN (?)", roadmapWeeks)
+	if len(keepTopics) > 0 {
+		topics = topics.Where("id NOT IN ?", keepTopics)
+	}
+	if err := topics.Delete(&models.RoadmapTopic{}).Error; err != nil {
+		return err
+	}
+	weeks := tx.Where("roadmap_id = ?", roadmap.ID)
+	if len(keepWeeks) > 0 {
+		weeks = weeks.Where("id NOT IN ?", keepWeeks)
+	}
+	return weeks.Delete(&models.RoadmapWeek{}).Error
+}
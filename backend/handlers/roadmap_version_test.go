@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"github.com/gorilla/mux"
+)
+
+// listVersions returns the version numbers and reasons of a roadmap, newest first.
+func listVersions(t *testing.T, id uint) []models.RoadmapVersion {
+	t.Helper()
+	var versions []models.RoadmapVersion
+	decode(t, serve(GetRoadmapVersions, mux.SetURLVars(get(t, "/"), map[string]string{"id": itoa(id)})), &versions)
+	return versions
+}
+
+func TestRoadmapVersionPerEdit(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	vars := map[string]string{"id": itoa(id)}
+	week := getRoadmap(t, id).Weeks[0]
+	title := "Foundations"
+
+	editRoadmap(t, UpdateRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(week.ID)}, UpdateWeekRequest{Title: &title})
+	editRoadmap(t, AddRoadmapWeek, vars, AddWeekRequest{Title: "Project"})
+	// A rejected edit doesn't make a version
+	editRoadmap(t, AddRoadmapWeek, vars, AddWeekRequest{Title: "Late", Position: 9})
+	// Progress makes one, unless nothing changes
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: week.Topics[0].ID, Value: true})
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: week.Topics[0].ID, Value: true})
+
+	versions := listVersions(t, id)
+	var reasons []string
+	for i, v := range versions {
+		if v.Version != len(versions)-i || v.Snapshot != "" {
+			t.Errorf("version %+v at %d", v, i)
+		}
+		reasons = append(reasons, v.Reason)
+	}
+	if len(reasons) != 4 || reasons[0] != "progress" || reasons[1] != "add week" || reasons[2] != "edit week" || reasons[3] != "created" {
+		t.Errorf("reasons %q", reasons)
+	}
+
+	var diff RoadmapDiff
+	decode(t, serve(DiffRoadmapVersions, mux.SetURLVars(get(t, "/?from=3&to=4"), vars)), &diff)
+	if len(diff.TopicsCompleted) != 1 || diff.TopicsCompleted[0].ID != week.Topics[0].ID || len(diff.TopicsReopened) != 0 || len(diff.TopicsAdded) != 0 {
+		t.Errorf("diff of the progress %+v", diff)
+	}
+
+	var got struct {
+		Version int             `json:"version"`
+		Roadmap RoadmapSnapshot `json:"roadmap"`
+	}
+	r := mux.SetURLVars(get(t, "/"), map[string]string{"id": itoa(id), "version": "2"})
+	decode(t, serve(GetRoadmapVersion, r), &got)
+	if got.Version != 2 || len(got.Roadmap.Weeks) != 2 || got.Roadmap.Weeks[0].Title != "Foundations" || len(got.Roadmap.Weeks[0].Topics) != 3 {
+		t.Errorf("version 2: %+v", got)
+	}
+}
+
+func TestDiffRoadmapVersions(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	roadmap := getRoadmap(t, id)
+	basics, concurrency := roadmap.Weeks[0], roadmap.Weeks[1]
+	syntax, types, goroutines := basics.Topics[0], basics.Topics[1], concurrency.Topics[0]
+
+	// v2: rename a topic, drop one, pull goroutines into week 1 and add one
+	editRoadmap(t, UpdateRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(basics.ID)}, UpdateWeekRequest{
+		Topics: &[]TopicInput{{ID: syntax.ID, Title: "Syntax and style"}, {ID: types.ID, Title: types.Title}, {ID: goroutines.ID, Title: goroutines.Title}, {Title: "Errors"}},
+	})
+	// v3: swap the weeks and rename one
+	editRoadmap(t, ReorderRoadmapWeeks, map[string]string{"id": itoa(id)}, ReorderWeeksRequest{WeekIDs: []uint{concurrency.ID, basics.ID}})
+	title := "Go in parallel"
+	editRoadmap(t, UpdateRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(concurrency.ID)}, UpdateWeekRequest{Title: &title})
+
+	var diff RoadmapDiff
+	r := mux.SetURLVars(get(t, "/?from=1&to=2"), map[string]string{"id": itoa(id)})
+	decode(t, serve(DiffRoadmapVersions, r), &diff)
+	if len(diff.TopicsRenamed) != 1 || diff.TopicsRenamed[0].From != "Syntax" || diff.TopicsRenamed[0].To != "Syntax and style" {
+		t.Errorf("renamed %+v", diff.TopicsRenamed)
+	}
+	if len(diff.TopicsRemoved) != 1 || diff.TopicsRemoved[0].Title != "Functions" {
+		t.Errorf("removed %+v", diff.TopicsRemoved)
+	}
+	if len(diff.TopicsAdded) != 1 || diff.TopicsAdded[0].Title != "Errors" || diff.TopicsAdded[0].Week != 1 {
+		t.Errorf("added %+v", diff.TopicsAdded)
+	}
+	if len(diff.TopicsMoved) != 1 || diff.TopicsMoved[0].ID != goroutines.ID || diff.TopicsMoved[0].FromWeek != 2 || diff.TopicsMoved[0].ToWeek != 1 {
+		t.Errorf("moved %+v", diff.TopicsMoved)
+	}
+	if len(diff.WeeksMoved) != 0 || len(diff.WeeksRenamed) != 0 {
+		t.Errorf("weeks changed in v2: %+v", diff)
+	}
+
+	// Without to, the diff is against the latest version
+	r = mux.SetURLVars(get(t, "/?from=2"), map[string]string{"id": itoa(id)})
+	decode(t, serve(DiffRoadmapVersions, r), &diff)
+	if diff.To != 4 || len(diff.WeeksMoved) != 2 || len(diff.WeeksRenamed) != 1 || diff.WeeksRenamed[0].To != title || len(diff.TopicsAdded) != 0 {
+		t.Errorf("diff from 2 to the latest %+v", diff)
+	}
+
+	for _, query := range []string{"/", "/?from=9", "/?from=1&to=x"} {
+		r := mux.SetURLVars(get(t, query), map[string]string{"id": itoa(id)})
+		if w := serve(DiffRoadmapVersions, r); w.Code == http.StatusOK {
+			t.Errorf("%s: status %d", query, w.Code)
+		}
+	}
+}
+
+func TestRollbackRoadmap(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	week := getRoadmap(t, id).Weeks[0]
+	functions, types := week.Topics[2], week.Topics[1]
+	notes := "Closures too"
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: functions.ID, Value: true, Notes: &notes})
+
+	// Drop a completed topic and a whole week, and mark another topic, then
+	// roll back to when only the first was done
+	editRoadmap(t, UpdateRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(week.ID)}, UpdateWeekRequest{
+		Topics: &[]TopicInput{{ID: types.ID, Title: "Types"}, {Title: "Generics"}},
+	})
+	editRoadmap(t, DeleteRoadmapWeek, map[string]string{"id": itoa(id), "weekId": itoa(getRoadmap(t, id).Weeks[1].ID)}, nil)
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: types.ID, Value: true})
+	checkWeeks(t, getRoadmap(t, id), "Basics: Types, Generics")
+
+	var roadmap models.Roadmap
+	decode(t, editRoadmap(t, RollbackRoadmap, map[string]string{"id": itoa(id), "version": "2"}, nil), &roadmap)
+	checkWeeks(t, roadmap, "Basics: Syntax, Types, Functions", "Concurrency: Goroutines")
+
+	// The restored topic is the same row, with the progress it had, and the
+	// progress made since is undone
+	restored := roadmap.Weeks[0].Topics[2]
+	if restored.ID != functions.ID || restored.CompletedAt == nil || restored.Notes != notes {
+		t.Errorf("restored topic %+v", restored)
+	}
+	if got := roadmap.Weeks[0].Topics[1]; got.ID != types.ID || got.CompletedAt != nil {
+		t.Errorf("topic marked after version 2 %+v", got)
+	}
+	var count int64
+	db.DB.Model(&models.RoadmapTopic{}).Where("title = ?", "Generics").Count(&count)
+	if count != 0 {
+		t.Error("the topic added after version 2 survived the rollback")
+	}
+
+	versions := listVersions(t, id)
+	if len(versions) != 6 || versions[0].Reason != "rollback to v2" || versions[4].Reason != "progress" {
+		t.Errorf("versions %+v", versions)
+	}
+
+	// Back to the start, before anything was done
+	decode(t, editRoadmap(t, RollbackRoadmap, map[string]string{"id": itoa(id), "version": "1"}, nil), &roadmap)
+	if got := roadmap.Weeks[0].Topics[2]; got.CompletedAt != nil || got.Notes != "" {
+		t.Errorf("topic after rolling back to version 1 %+v", got)
+	}
+	if w := editRoadmap(t, RollbackRoadmap, map[string]string{"id": itoa(id), "version": "9"}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown version: status %d", w.Code)
+	}
+}
+
+func TestRollbackStructureOnlyVersion(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	topic := getRoadmap(t, id).Weeks[0].Topics[0]
+	post(t, HandleMarkAsCompleted, MarkAsCompletedRequest{TopicID: topic.ID, Value: true})
+
+	// A version saved before progress was versioned has none to restore, so
+	// the progress stays
+	var v models.RoadmapVersion
+	db.DB.First(&v, "roadmap_id = ? AND version = 1", id)
+	db.DB.Model(&v).Update("snapshot", strings.Replace(v.Snapshot, `"progress":true,`, "", 1))
+
+	var roadmap models.Roadmap
+	decode(t, editRoadmap(t, RollbackRoadmap, map[string]string{"id": itoa(id), "version": "1"}, nil), &roadmap)
+	if got := roadmap.Weeks[0].Topics[0]; got.CompletedAt == nil {
+		t.Errorf("progress lost %+v", got)
+	}
+}
+
+func TestRoadmapVersionsNeedOwner(t *testing.T) {
+	setupHandlers(t)
+	id := saveRoadmap(t, goPlan)
+	// The same roadmap ID, asked for by someone else
+	db.DB.Model(&models.Roadmap{}).Where("id = ?", id).Update("user_email", "someone@example.com")
+
+	vars := map[string]string{"id": itoa(id), "version": "1"}
+	for name, handler := range map[string]http.HandlerFunc{
+		"list":     GetRoadmapVersions,
+		"get":      GetRoadmapVersion,
+		"diff":     DiffRoadmapVersions,
+		"rollback": RollbackRoadmap,
+	} {
+		r := mux.SetURLVars(get(t, "/?from=1&to=1"), vars)
+		if w := serve(handler, r); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"tutor_genX/llm"
+)
+
+// wantsStream reports whether the client asked for server-sent events, with
+// an Accept: text/event-stream header or ?stream=true.
+func wantsStream(r *http.Request) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return true
+	}
+	stream := r.URL.Query().Get("stream")
+	return stream == "true" || stream == "1"
+}
+
+// eventStream writes server-sent events. Every event carries a JSON payload.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming unsupported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	return &eventStream{w: w, flusher: flusher}, nil
+}
+
+func (s *eventStream) send(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// DeltaEvent is one piece of a streamed reply.
+type DeltaEvent struct {
+	Text string `json:"text"`
+}
+
+// ErrorEvent ends a stream that failed.
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+// streamCompletion streams the reply to prompt as "delta" events and returns
+// the full text. ok is false when the model failed (an "error" event has
+// been sent) or the client went away; the partial reply must not be cached then.
+func streamCompletion(ctx context.Context, s *eventStream, prompt string) (string, bool) {
+	reply, err := llm.Stream(ctx, llmProvider, []llm.Message{llm.User(prompt)}, func(delta string) error {
+		return s.send("delta", DeltaEvent{Text: delta})
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			s.send("error", ErrorEvent{Error: err.Error()})
+		}
+		return "", false
+	}
+	return reply, true
+}
+
+// sendStreamed answers a streaming request with a final "done" event, for
+// replies that were cached and so have nothing to stream.
+func sendStreamed(w http.ResponseWriter, done interface{}) {
+	s, err := newEventStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.send("done", done)
+}
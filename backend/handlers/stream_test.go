@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+	"tutor_genX/utils"
+)
+
+type sseEvent struct {
+	name, data string
+}
+
+// events splits a server-sent event stream.
+func events(t *testing.T, w *httptest.ResponseRecorder) []sseEvent {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q: %s", ct, w.Body)
+	}
+	var out []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				e.name = name
+			} else {
+				e.data = line
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// streamed runs handler asking for server-sent events, and returns the text
+// of the delta events and the last event.
+func streamed(t *testing.T, handler http.HandlerFunc, body interface{}) (string, sseEvent) {
+	t.Helper()
+	r := request(t, body)
+	r.Header.Set("Accept", "text/event-stream")
+	all := events(t, serve(handler, r))
+	var text strings.Builder
+	for _, e := range all[:len(all)-1] {
+		if e.name != "delta" {
+			t.Fatalf("%s event before the end", e.name)
+		}
+		var delta DeltaEvent
+		decodeEvent(t, e.data, &delta)
+		text.WriteString(delta.Text)
+	}
+	return text.String(), all[len(all)-1]
+}
+
+func TestExplainStream(t *testing.T) {
+	setupHandlers(t, "Goroutines are cheap threads.")
+
+	text, last := streamed(t, ExplainTopicHandler, ExplainTopicRequest{Topic: "Goroutines"})
+	var done ExplainTopicResponse
+	decodeEvent(t, last.data, &done)
+	if text != "Goroutines are cheap threads." || last.name != "done" || done.Explanation != text {
+		t.Errorf("streamed %q, then %s %+v", text, last.name, done)
+	}
+
+	// The full reply was cached, so the next request is only a done event
+	var content models.Content
+	db.DB.Where("user_id = ? AND topic = ?", testUser, "Goroutines").First(&content)
+	if content.Explanation != "Goroutines are cheap threads." {
+		t.Errorf("cached %q", content.Explanation)
+	}
+	if text, last := streamed(t, ExplainTopicHandler, ExplainTopicRequest{Topic: "Goroutines"}); text != "" || last.name != "done" {
+		t.Errorf("from the cache: %q, %s", text, last.name)
+	}
+
+	// ?stream=true works as well as the Accept header
+	r := request(t, SimplifyRequest{Topic: "Goroutines", Explanation: "Goroutines are cheap threads."})
+	r.URL.RawQuery = "stream=true"
+	if all := events(t, serve(Simplify, r)); all[len(all)-1].name != "done" {
+		t.Errorf("simplify ended with %+v", all[len(all)-1])
+	}
+}
+
+// cancelOnWrite cancels the request after the first event is written, as a
+// client closing the page would.
+type cancelOnWrite struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (c cancelOnWrite) Write(p []byte) (int, error) {
+	defer c.cancel()
+	return c.ResponseRecorder.Write(p)
+}
+
+func TestExplainStreamCancelled(t *testing.T) {
+	setupHandlers(t, "Goroutines are cheap threads.")
+	ctx, cancel := context.WithCancel(context.Background())
+	r := request(t, ExplainTopicRequest{Topic: "Goroutines"}).WithContext(ctx)
+	r.Header.Set("Accept", "text/event-stream")
+	w := cancelOnWrite{httptest.NewRecorder(), cancel}
+	utils.ValidateToken(http.HandlerFunc(ExplainTopicHandler)).ServeHTTP(w, r)
+
+	all := events(t, w.ResponseRecorder)
+	if len(all) != 1 || all[0].name != "delta" {
+		t.Errorf("events %+v", all)
+	}
+	var count int64
+	db.DB.Model(&models.Content{}).Where("explanation <> ''").Count(&count)
+	if count != 0 {
+		t.Error("the partial reply was cached")
+	}
+}
+
+func TestExamplesStream(t *testing.T) {
+	// The streamed reply isn't valid, so the done event has the repaired one
+	provider := setupHandlers(t, "Here are some examples!", `{"examples": [{"title": "Leaf", "explanation": "Leaves make glucose."}]}`)
+	text, last := streamed(t, GenerateExamples, ExampleRequest{Topic: "Photosynthesis", Explanation: "Plants make glucose."})
+	var done ExamplesResponse
+	decodeEvent(t, last.data, &done)
+	if text != "Here are some examples!" || last.name != "done" || len(done.Examples) != 1 || done.Examples[0].Title != "Leaf" {
+		t.Errorf("streamed %q, then %s %+v", text, last.name, done)
+	}
+	if calls := provider.Calls(); len(calls) != 2 {
+		t.Errorf("%d calls", len(calls))
+	}
+}
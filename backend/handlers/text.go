@@ -0,0 +1,15 @@
+package handlers
+
+import "unicode/utf8"
+
+// truncate shortens s to at most n bytes plus "...", cutting on a rune
+// boundary so no character is split in half.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
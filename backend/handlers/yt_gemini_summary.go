@@ -6,14 +6,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"regexp"
 	"strings"
+	"tutor_genX/llm"
 	"tutor_genX/utils"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/generative-ai-go/genai"
 	"github.com/horiagug/youtube-transcript-api-go/pkg/yt_transcript"
-	"google.golang.org/api/option"
 )
 
 type VideoSummaryRequest struct {
@@ -29,14 +28,23 @@ type VideoSummaryResponse struct {
 	Summary []SummaryItem `json:"summary"`
 }
 
-// NEW: Helper function to clean the Gemini response
-func cleanJSON(s string) string {
-	// Remove markdown code fences and any leading/trailing whitespace
-	s = strings.TrimSpace(s)
-	s = strings.TrimPrefix(s, "```json")
-	s = strings.TrimPrefix(s, "```")
-	s = strings.TrimSuffix(s, "```")
-	return strings.TrimSpace(s)
+var summaryTimestamp = regexp.MustCompile(`^\d{2,}:\d{2}$`)
+
+// Validate checks the summary has key points with MM:SS timestamps and text.
+func (v VideoSummaryResponse) Validate() error {
+	var problems llm.ValidationError
+	if len(v.Summary) == 0 {
+		problems.Addf("\"summary\" must contain at least one key point")
+	}
+	for i, item := range v.Summary {
+		if !summaryTimestamp.MatchString(item.Timestamp) {
+			problems.Addf("key point %d has timestamp %q, expected MM:SS", i+1, item.Timestamp)
+		}
+		if strings.TrimSpace(item.SummaryText) == "" {
+			problems.Addf("key point %d has an empty \"summaryText\"", i+1)
+		}
+	}
+	return problems.Err()
 }
 
 // GetYouTubeVideoSummaryGemini handles summarization using a two-step process.
@@ -80,26 +88,14 @@ func GetYouTubeVideoSummaryGemini(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 2: Set up the Gemini API client and summarize the text
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "GEMINI_API_KEY not set", http.StatusInternalServerError)
-		return
-	}
-
-	ctx := context.Background()
-	geminiClient, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		log.Println("Error creating Gemini client:", err)
-		http.Error(w, "Failed to create Gemini client", http.StatusInternalServerError)
+	// Step 2: Ask the summary provider for a timestamped summary
+	if summaryProvider == nil {
+		http.Error(w, "Summary provider not configured", http.StatusInternalServerError)
 		return
 	}
-	defer geminiClient.Close()
 
 	// New prompt to request a timestamped summary in JSON format
-	model := geminiClient.GenerativeModel("gemini-1.5-flash-latest")
-	prompt := []genai.Part{
-		genai.Text(fmt.Sprintf(`Create a timestamped summary for the following video transcript. The summary should be a JSON object containing an array of key points, each with a timestamp and a summary text.
+	prompt := fmt.Sprintf(`Create a timestamped summary for the following video transcript. The summary should be a JSON object containing an array of key points, each with a timestamp and a summary text.
 
 STRICT REQUIREMENTS:
 1. The output must be a single JSON object.
@@ -124,30 +120,12 @@ Example of desired JSON output:
 
 Video Transcript:
 %s
-`, formattedTranscript)),
-	}
-
-	resp, err := model.GenerateContent(ctx, prompt...)
-	if err != nil {
-		log.Println("Error generating content from Gemini:", err)
-		http.Error(w, "Failed to generate summary from Gemini", http.StatusInternalServerError)
-		return
-	}
+`, formattedTranscript)
 
 	var summaryResponse VideoSummaryResponse
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-		if text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text); ok {
-			// Clean the response before unmarshaling
-			cleanText := cleanJSON(string(text))
-			if err := json.Unmarshal([]byte(cleanText), &summaryResponse); err != nil {
-				log.Println("Error unmarshaling Gemini response:", err)
-				http.Error(w, "Failed to parse AI-generated summary", http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
-	if len(summaryResponse.Summary) == 0 {
+	messages := []llm.Message{llm.User(prompt)}
+	if err := llm.CompleteJSON(context.Background(), summaryProvider, messages, &summaryResponse, llm.DefaultRepairs); err != nil {
+		log.Println("Error generating summary:", err)
 		http.Error(w, "Summary could not be generated", http.StatusInternalServerError)
 		return
 	}
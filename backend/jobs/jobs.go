@@ -0,0 +1,374 @@
+// Package jobs runs long generation work (flashcards and quizzes from large
+// PDFs) in the background. A job's input is split into chunks that a worker
+// pool processes concurrently, with a cap on how many chunks of one user run
+// at once. Jobs and chunk outputs are stored in the database, so unfinished
+// jobs are resumed after a restart.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownKind is returned when submitting a job of a kind nobody registered.
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// Kind is the work a type of job does.
+type Kind struct {
+	// Chunk processes one chunk of input and returns its encoded output and
+	// how many items (cards, questions) it produced.
+	Chunk func(ctx context.Context, job *models.Job, chunk models.JobChunk) (output string, items int, err error)
+	// Finish combines the outputs of the successful chunks, in order, and
+	// returns the ID of the saved result.
+	Finish func(job *models.Job, outputs []string) (resultID uint, err error)
+}
+
+// Config sizes the worker pool.
+type Config struct {
+	Workers int // Chunks processed at once across all users
+	PerUser int // Chunks processed at once for a single user
+}
+
+// ConfigFromEnv reads JOB_WORKERS and JOB_USER_CONCURRENCY, defaulting to 4 and 2.
+func ConfigFromEnv() Config {
+	return Config{
+		Workers: envInt("JOB_WORKERS", 4),
+		PerUser: envInt("JOB_USER_CONCURRENCY", 2),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+type task struct {
+	jobID uint
+	chunk models.JobChunk
+}
+
+// active is the in-memory state of a job that still has chunks to run.
+type active struct {
+	userEmail string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	remaining int
+}
+
+// Manager owns the worker pool and the jobs it is running.
+type Manager struct {
+	cfg   Config
+	kinds map[string]Kind
+
+	mu      sync.Mutex
+	wake    *sync.Cond
+	queue   []task
+	running map[string]int // chunks in flight per user
+	jobs    map[uint]*active
+	subs    map[uint]map[chan struct{}]struct{}
+}
+
+func NewManager(cfg Config) *Manager {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PerUser < 1 {
+		cfg.PerUser = 1
+	}
+	m := &Manager{
+		cfg:     cfg,
+		kinds:   make(map[string]Kind),
+		running: make(map[string]int),
+		jobs:    make(map[uint]*active),
+		subs:    make(map[uint]map[chan struct{}]struct{}),
+	}
+	m.wake = sync.NewCond(&m.mu)
+	return m
+}
+
+// Register adds a kind of job. Call it before Start.
+func (m *Manager) Register(name string, kind Kind) {
+	m.kinds[name] = kind
+}
+
+// Start launches the workers and resumes jobs left unfinished by the last run.
+func (m *Manager) Start() error {
+	for i := 0; i < m.cfg.Workers; i++ {
+		go m.work()
+	}
+
+	var unfinished []models.Job
+	if err := db.DB.Where("status IN ?", []string{models.JobQueued, models.JobRunning}).Order("id ASC").Find(&unfinished).Error; err != nil {
+		return err
+	}
+	for i := range unfinished {
+		if err := m.enqueue(&unfinished[i]); err != nil {
+			return err
+		}
+	}
+	if len(unfinished) > 0 {
+		log.Printf("Resumed %d unfinished jobs", len(unfinished))
+	}
+	return nil
+}
+
+// Submit stores a new job with its chunks and queues it.
+func (m *Manager) Submit(job *models.Job, chunks []string) error {
+	if _, ok := m.kinds[job.Kind]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, job.Kind)
+	}
+	job.Status = models.JobQueued
+	job.ChunksTotal = len(chunks)
+	job.Chunks = nil
+	for i, text := range chunks {
+		job.Chunks = append(job.Chunks, models.JobChunk{Index: i, Text: text, Status: models.ChunkPending})
+	}
+	if err := db.DB.Create(job).Error; err != nil {
+		return err
+	}
+	return m.enqueue(job)
+}
+
+// enqueue queues the pending chunks of a stored job.
+func (m *Manager) enqueue(job *models.Job) error {
+	var pending []models.JobChunk
+	if err := db.DB.Where("job_id = ? AND status = ?", job.ID, models.ChunkPending).Order("chunk_index ASC").Find(&pending).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.jobs[job.ID] = &active{userEmail: job.UserEmail, ctx: ctx, cancel: cancel, remaining: len(pending)}
+	for _, chunk := range pending {
+		m.queue = append(m.queue, task{jobID: job.ID, chunk: chunk})
+	}
+	m.mu.Unlock()
+	m.wake.Broadcast()
+
+	// Every chunk already ran before a restart, only the result is missing
+	if len(pending) == 0 {
+		go m.finish(job.ID)
+	}
+	return nil
+}
+
+// Cancel stops a user's job. Chunks in flight are interrupted and partial
+// output is discarded.
+func (m *Manager) Cancel(jobID uint, userEmail string) error {
+	res := db.DB.Model(&models.Job{}).
+		Where("id = ? AND user_email = ? AND status IN ?", jobID, userEmail, []string{models.JobQueued, models.JobRunning}).
+		Update("status", models.JobCancelled)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	m.mu.Lock()
+	if job, ok := m.jobs[jobID]; ok {
+		job.cancel()
+		delete(m.jobs, jobID)
+	}
+	queue := m.queue[:0]
+	for _, t := range m.queue {
+		if t.jobID != jobID {
+			queue = append(queue, t)
+		}
+	}
+	m.queue = queue
+	m.mu.Unlock()
+
+	m.notify(jobID)
+	return nil
+}
+
+// Subscribe returns a channel that receives a signal whenever the job changes.
+// Signals are coalesced, so readers should reload the job from the database.
+func (m *Manager) Subscribe(jobID uint) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	if m.subs[jobID] == nil {
+		m.subs[jobID] = make(map[chan struct{}]struct{})
+	}
+	m.subs[jobID][ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subs[jobID], ch)
+		if len(m.subs[jobID]) == 0 {
+			delete(m.subs, jobID)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) notify(jobID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Wait blocks until the job finishes. If ctx ends first the job is cancelled,
+// which is how synchronous callers stop work when the client goes away.
+func (m *Manager) Wait(ctx context.Context, jobID uint, userEmail string) (models.Job, error) {
+	updates, unsubscribe := m.Subscribe(jobID)
+	defer unsubscribe()
+
+	for {
+		var job models.Job
+		if err := db.DB.First(&job, "id = ? AND user_email = ?", jobID, userEmail).Error; err != nil {
+			return job, err
+		}
+		if job.Finished() {
+			return job, nil
+		}
+		select {
+		case <-updates:
+		case <-ctx.Done():
+			m.Cancel(jobID, userEmail)
+			return job, ctx.Err()
+		}
+	}
+}
+
+// next blocks until there is a chunk whose user is under the concurrency cap.
+func (m *Manager) next() (task, *active) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		for i, t := range m.queue {
+			job := m.jobs[t.jobID]
+			if job == nil {
+				continue
+			}
+			if m.running[job.userEmail] >= m.cfg.PerUser {
+				continue
+			}
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			m.running[job.userEmail]++
+			return t, job
+		}
+		m.wake.Wait()
+	}
+}
+
+func (m *Manager) work() {
+	for {
+		t, job := m.next()
+		m.run(t, job)
+
+		m.mu.Lock()
+		m.running[job.userEmail]--
+		if m.running[job.userEmail] == 0 {
+			delete(m.running, job.userEmail)
+		}
+		job.remaining--
+		done := job.remaining == 0 && job.ctx.Err() == nil
+		m.mu.Unlock()
+		m.wake.Broadcast()
+
+		if done {
+			m.finish(t.jobID)
+		}
+	}
+}
+
+// run processes one chunk and records its outcome.
+func (m *Manager) run(t task, job *active) {
+	if job.ctx.Err() != nil {
+		return
+	}
+	var record models.Job
+	if err := db.DB.First(&record, t.jobID).Error; err != nil {
+		log.Printf("Job %d: %v", t.jobID, err)
+		return
+	}
+	if record.Status == models.JobQueued {
+		db.DB.Model(&record).Update("status", models.JobRunning)
+		m.notify(t.jobID)
+	}
+
+	output, items, err := m.kinds[record.Kind].Chunk(job.ctx, &record, t.chunk)
+	if job.ctx.Err() != nil {
+		// Cancelled: the chunk stays pending and its output is dropped
+		return
+	}
+
+	update := map[string]interface{}{"status": models.ChunkDone, "output": output, "items": items}
+	if err != nil {
+		update = map[string]interface{}{"status": models.ChunkFailed, "error": err.Error()}
+		items = 0
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JobChunk{}).Where("id = ?", t.chunk.ID).Updates(update).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Job{}).Where("id = ?", t.jobID).Updates(map[string]interface{}{
+			"chunks_done":    gorm.Expr("chunks_done + 1"),
+			"items_produced": gorm.Expr("items_produced + ?", items),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Job %d: failed to record chunk %d: %v", t.jobID, t.chunk.Index, err)
+	}
+	m.notify(t.jobID)
+}
+
+// finish builds the job's result from its chunk outputs.
+func (m *Manager) finish(jobID uint) {
+	m.mu.Lock()
+	if job, ok := m.jobs[jobID]; ok {
+		job.cancel()
+		delete(m.jobs, jobID)
+	}
+	m.mu.Unlock()
+	defer m.notify(jobID)
+
+	var job models.Job
+	err := db.DB.Preload("Chunks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("chunk_index ASC")
+	}).First(&job, jobID).Error
+	if err != nil {
+		log.Printf("Job %d: %v", jobID, err)
+		return
+	}
+	if job.Finished() {
+		return
+	}
+
+	var outputs []string
+	for _, chunk := range job.Chunks {
+		if chunk.Status == models.ChunkDone {
+			outputs = append(outputs, chunk.Output)
+		}
+	}
+
+	update := map[string]interface{}{"status": models.JobSucceeded}
+	resultID, err := m.kinds[job.Kind].Finish(&job, outputs)
+	if err != nil {
+		update = map[string]interface{}{"status": models.JobFailed, "error": err.Error()}
+	} else {
+		update["result_id"] = resultID
+	}
+	// A cancel that raced with the last chunk wins
+	db.DB.Model(&models.Job{}).Where("id = ? AND status IN ?", jobID, []string{models.JobQueued, models.JobRunning}).Updates(update)
+}
@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tutor_genX/db"
+	"tutor_genX/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB points db.DB at a new SQLite database.
+func setupDB(t *testing.T) {
+	t.Helper()
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	db.DB = database
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// gate is a job kind whose chunks block until released, and which records
+// how many chunks of each user run at once.
+type gate struct {
+	release chan struct{}
+	started chan string // the user of every chunk that starts
+
+	mu       sync.Mutex
+	running  map[string]int
+	peak     map[string]int
+	finished [][]string
+}
+
+func newGate() *gate {
+	return &gate{
+		release: make(chan struct{}),
+		started: make(chan string, 100),
+		running: make(map[string]int),
+		peak:    make(map[string]int),
+	}
+}
+
+func (g *gate) kind() Kind {
+	return Kind{
+		Chunk: func(ctx context.Context, job *models.Job, chunk models.JobChunk) (string, int, error) {
+			g.mu.Lock()
+			g.running[job.UserEmail]++
+			if g.running[job.UserEmail] > g.peak[job.UserEmail] {
+				g.peak[job.UserEmail] = g.running[job.UserEmail]
+			}
+			g.mu.Unlock()
+			defer func() {
+				g.mu.Lock()
+				g.running[job.UserEmail]--
+				g.mu.Unlock()
+			}()
+
+			g.started <- job.UserEmail
+			select {
+			case <-g.release:
+			case <-ctx.Done():
+				return "", 0, ctx.Err()
+			}
+			if strings.HasPrefix(chunk.Text, "bad") {
+				return "", 0, errors.New("the model refused")
+			}
+			return strings.ToUpper(chunk.Text), 1, nil
+		},
+		Finish: func(job *models.Job, outputs []string) (uint, error) {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.finished = append(g.finished, outputs)
+			if len(outputs) == 0 {
+				return 0, errors.New("nothing to save")
+			}
+			return 42, nil
+		},
+	}
+}
+
+func startManager(t *testing.T, cfg Config, g *gate) *Manager {
+	t.Helper()
+	m := NewManager(cfg)
+	m.Register("test", g.kind())
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func submit(t *testing.T, m *Manager, user string, chunks ...string) models.Job {
+	t.Helper()
+	job := models.Job{UserEmail: user, Kind: "test", Title: "Test"}
+	if err := m.Submit(&job, chunks); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func wait(t *testing.T, m *Manager, job models.Job) models.Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done, err := m.Wait(ctx, job.ID, job.UserEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return done
+}
+
+func waitStarted(t *testing.T, g *gate, n int) map[string]int {
+	t.Helper()
+	users := make(map[string]int)
+	for i := 0; i < n; i++ {
+		select {
+		case user := <-g.started:
+			users[user]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d chunks started", i, n)
+		}
+	}
+	return users
+}
+
+func TestPerUserCap(t *testing.T) {
+	setupDB(t)
+	g := newGate()
+	m := startManager(t, Config{Workers: 4, PerUser: 2}, g)
+
+	busy := submit(t, m, "busy@example.com", "a", "b", "c", "d", "e")
+	other := submit(t, m, "other@example.com", "x", "y")
+
+	// The busy user's queued chunks don't hold up the other user
+	started := waitStarted(t, g, 4)
+	if started["busy@example.com"] != 2 || started["other@example.com"] != 2 {
+		t.Errorf("started %v", started)
+	}
+	select {
+	case user := <-g.started:
+		t.Errorf("a fifth chunk started for %s", user)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(g.release)
+	busy, other = wait(t, m, busy), wait(t, m, other)
+	if busy.Status != models.JobSucceeded || busy.ChunksDone != 5 || busy.ItemsProduced != 5 || busy.ResultID == nil || *busy.ResultID != 42 {
+		t.Errorf("busy job %+v", busy)
+	}
+	if other.Status != models.JobSucceeded {
+		t.Errorf("other job %+v", other)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.peak["busy@example.com"] != 2 {
+		t.Errorf("peak %v", g.peak)
+	}
+	// Outputs reach Finish in chunk order, whatever order they ran in
+	for _, outputs := range g.finished {
+		if len(outputs) == 5 && strings.Join(outputs, "") != "ABCDE" {
+			t.Errorf("outputs %q", outputs)
+		}
+	}
+}
+
+func TestFailedChunks(t *testing.T) {
+	setupDB(t)
+	g := newGate()
+	close(g.release)
+	m := startManager(t, Config{Workers: 2, PerUser: 2}, g)
+
+	job := wait(t, m, submit(t, m, "a@example.com", "one", "bad two", "three"))
+	if job.Status != models.JobSucceeded || job.ChunksDone != 3 || job.ItemsProduced != 2 {
+		t.Errorf("job %+v", job)
+	}
+	var failed models.JobChunk
+	db.DB.First(&failed, "job_id = ? AND chunk_index = 1", job.ID)
+	if failed.Status != models.ChunkFailed || failed.Error != "the model refused" {
+		t.Errorf("failed chunk %+v", failed)
+	}
+
+	// With nothing to save the job fails with Finish's error
+	job = wait(t, m, submit(t, m, "a@example.com", "bad"))
+	if job.Status != models.JobFailed || job.Error != "nothing to save" {
+		t.Errorf("all chunks failed: %+v", job)
+	}
+
+	if err := m.Submit(&models.Job{Kind: "nope"}, []string{"a"}); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("unknown kind: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	setupDB(t)
+	g := newGate()
+	m := startManager(t, Config{Workers: 2, PerUser: 1}, g)
+
+	job := submit(t, m, "a@example.com", "one", "two", "three")
+	waitStarted(t, g, 1)
+
+	if err := m.Cancel(job.ID, "someone@example.com"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("cancel by someone else: %v", err)
+	}
+	if err := m.Cancel(job.ID, job.UserEmail); err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, m, job)
+	if job.Status != models.JobCancelled || job.ChunksDone != 0 {
+		t.Errorf("job %+v", job)
+	}
+	if err := m.Cancel(job.ID, job.UserEmail); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("cancelling twice: %v", err)
+	}
+
+	// The queued chunks never run and nothing is finished
+	select {
+	case <-g.started:
+		t.Error("a chunk started after the job was cancelled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.finished) != 0 {
+		t.Errorf("finished %q", g.finished)
+	}
+
+	var pending int64
+	db.DB.Model(&models.JobChunk{}).Where("job_id = ? AND status = ?", job.ID, models.ChunkPending).Count(&pending)
+	if pending != 3 {
+		t.Errorf("%d chunks still pending", pending)
+	}
+}
+
+func TestWaitCancelsWhenTheCallerGoesAway(t *testing.T) {
+	setupDB(t)
+	g := newGate()
+	m := startManager(t, Config{Workers: 1, PerUser: 1}, g)
+
+	job := submit(t, m, "a@example.com", "one")
+	waitStarted(t, g, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Wait(ctx, job.ID, job.UserEmail); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait: %v", err)
+	}
+	db.DB.First(&job, job.ID)
+	if job.Status != models.JobCancelled {
+		t.Errorf("status %q", job.Status)
+	}
+}
+
+func TestResumeAfterRestart(t *testing.T) {
+	setupDB(t)
+	// A job the last run was part way through: one chunk done, one pending,
+	// and one that had finished all its chunks but not its result
+	partial := models.Job{UserEmail: "a@example.com", Kind: "test", Status: models.JobRunning, ChunksTotal: 2, ChunksDone: 1, Chunks: []models.JobChunk{
+		{Index: 0, Text: "one", Status: models.ChunkDone, Output: "ONE", Items: 1},
+		{Index: 1, Text: "two", Status: models.ChunkPending},
+	}}
+	ready := models.Job{UserEmail: "b@example.com", Kind: "test", Status: models.JobRunning, ChunksTotal: 1, ChunksDone: 1, Chunks: []models.JobChunk{
+		{Index: 0, Text: "x", Status: models.ChunkDone, Output: "X", Items: 1},
+	}}
+	finished := models.Job{UserEmail: "c@example.com", Kind: "test", Status: models.JobSucceeded, Chunks: []models.JobChunk{
+		{Index: 0, Text: "y", Status: models.ChunkPending},
+	}}
+	for _, job := range []*models.Job{&partial, &ready, &finished} {
+		if err := db.DB.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := newGate()
+	close(g.release)
+	m := startManager(t, Config{Workers: 2, PerUser: 2}, g)
+
+	if job := wait(t, m, partial); job.Status != models.JobSucceeded || job.ChunksDone != 2 {
+		t.Errorf("partial job %+v", job)
+	}
+	if job := wait(t, m, ready); job.Status != models.JobSucceeded || job.ResultID == nil {
+		t.Errorf("ready job %+v", job)
+	}
+	if started := len(g.started); started != 1 {
+		t.Errorf("%d chunks ran, want only the pending one", started)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var got []string
+	for _, outputs := range g.finished {
+		got = append(got, strings.Join(outputs, ","))
+	}
+	if len(got) != 2 || !(got[0] == "ONE,TWO" || got[1] == "ONE,TWO") {
+		t.Errorf("finished with %q", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	setupDB(t)
+	g := newGate()
+	m := startManager(t, Config{Workers: 1, PerUser: 1}, g)
+
+	job := submit(t, m, "a@example.com", "one", "two")
+	updates, unsubscribe := m.Subscribe(job.ID)
+	waitStarted(t, g, 1)
+
+	// Every change signals, and signals are coalesced rather than queued
+	g.release <- struct{}{}
+	g.release <- struct{}{}
+	wait(t, m, job)
+	select {
+	case <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal")
+	}
+	select {
+	case <-updates:
+		t.Error("signals were queued")
+	default:
+	}
+
+	unsubscribe()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.subs) != 0 {
+		t.Errorf("subscribers left: %v", m.subs)
+	}
+}
@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/option"
+)
+
+// Embedder turns passages of text into vectors; similar texts get vectors
+// with a high cosine similarity.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model names the embedding space. Vectors from different models can't be compared.
+	Model() string
+}
+
+// NewEmbedder builds the embedder described by cfg. Groq has no embedding
+// models, so only OpenAI (compatible), Gemini and Fake are accepted.
+func NewEmbedder(cfg Config) (Embedder, error) {
+	switch cfg.Provider {
+	case OpenAI:
+		if cfg.Model == "" {
+			cfg.Model = string(openai.SmallEmbedding3)
+		}
+		p, err := newOpenAIProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &openAIEmbedder{client: p.client, model: cfg.Model}, nil
+	case Gemini:
+		if cfg.Model == "" {
+			cfg.Model = "text-embedding-004"
+		}
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("%s: API key not set", cfg.Provider)
+		}
+		return &geminiEmbedder{apiKey: cfg.APIKey, model: cfg.Model}, nil
+	case Fake:
+		return FakeEmbedder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+}
+
+// EmbedderFromEnv is ConfigFromEnv followed by NewEmbedder.
+func EmbedderFromEnv(prefix, defaultProvider string) (Embedder, error) {
+	return NewEmbedder(ConfigFromEnv(prefix, defaultProvider))
+}
+
+type openAIEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+func (e *openAIEmbedder) Model() string { return OpenAI + "/" + e.model }
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("asked for %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+type geminiEmbedder struct {
+	apiKey string
+	model  string
+}
+
+func (e *geminiEmbedder) Model() string { return Gemini + "/" + e.model }
+
+func (e *geminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(e.apiKey))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	model := client.EmbeddingModel(e.model)
+	batch := model.NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+	resp, err := model.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("asked for %d embeddings, got %d", len(texts), len(resp.Embeddings))
+	}
+	vectors := make([][]float32, len(texts))
+	for i, emb := range resp.Embeddings {
+		vectors[i] = emb.Values
+	}
+	return vectors, nil
+}
+
+// fakeDimensions is the size of FakeEmbedder vectors.
+const fakeDimensions = 256
+
+// FakeEmbedder is a deterministic, offline stand-in: each word is hashed into
+// one of a fixed number of buckets, so texts sharing words score as similar.
+type FakeEmbedder struct{}
+
+func (FakeEmbedder) Model() string { return Fake }
+
+func (FakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, fakeDimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			sum := sha256.Sum256([]byte(word))
+			v[binary.BigEndian.Uint32(sum[:4])%fakeDimensions]++
+		}
+		vectors[i] = Normalize(v)
+	}
+	return vectors, nil
+}
+
+// Normalize scales v to unit length in place and returns it, so cosine
+// similarity becomes a dot product.
+func Normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range v {
+		v[i] *= scale
+	}
+	return v
+}
+
+// Cosine is the cosine similarity of two vectors of the same length.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestFakeEmbedder(t *testing.T) {
+	texts := []string{
+		"Photosynthesis makes glucose in the chloroplast.",
+		"The chloroplast makes glucose by photosynthesis!",
+		"Napoleon crowned himself emperor.",
+	}
+	vectors, err := FakeEmbedder{}.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 3 || len(vectors[0]) != fakeDimensions {
+		t.Fatalf("got %d vectors", len(vectors))
+	}
+	again, _ := FakeEmbedder{}.Embed(context.Background(), texts[:1])
+	if Cosine(vectors[0], again[0]) < 0.9999 {
+		t.Error("the same text embedded differently")
+	}
+	if similar, unrelated := Cosine(vectors[0], vectors[1]), Cosine(vectors[0], vectors[2]); similar <= unrelated || similar < 0.5 {
+		t.Errorf("similar texts score %f, unrelated %f", similar, unrelated)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (FakeEmbedder{}).Embed(cancelled, texts); err == nil {
+		t.Error("a cancelled context was ignored")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	v := Normalize([]float32{3, 4})
+	if math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 {
+		t.Errorf("got %v", v)
+	}
+	if v := Normalize([]float32{0, 0}); v[0] != 0 || v[1] != 0 {
+		t.Errorf("zero vector became %v", v)
+	}
+	if Cosine([]float32{1, 0}, []float32{0, 1}) != 0 || Cosine([]float32{1}, []float32{1, 0}) != 0 || Cosine([]float32{0}, []float32{1}) != 0 {
+		t.Error("cosine of orthogonal, mismatched or zero vectors")
+	}
+	if c := Cosine([]float32{2, 0}, []float32{5, 0}); math.Abs(c-1) > 1e-9 {
+		t.Errorf("parallel vectors: %f", c)
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	if e, err := NewEmbedder(Config{Provider: Fake}); err != nil || e.Model() != Fake {
+		t.Errorf("fake: %v", err)
+	}
+	if e, err := NewEmbedder(Config{Provider: OpenAI, APIKey: "key"}); err != nil || e.Model() != "openai/text-embedding-3-small" {
+		t.Errorf("openai: %v", err)
+	}
+	if _, err := NewEmbedder(Config{Provider: Gemini}); err == nil {
+		t.Error("gemini without a key")
+	}
+	if _, err := NewEmbedder(Config{Provider: Groq, APIKey: "key"}); err == nil {
+		t.Error("groq has no embedding models")
+	}
+}
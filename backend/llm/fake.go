@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// FakeProvider is an in-process, deterministic provider for offline use and
+// tests. Responses are returned in order and the last one repeats. With no
+// responses it replies with a stable digest of the final message.
+type FakeProvider struct {
+	Responses []string
+
+	mu    sync.Mutex
+	calls [][]Message
+}
+
+func (f *FakeProvider) Complete(ctx context.Context, messages []Message) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := len(f.calls)
+	f.calls = append(f.calls, messages)
+
+	if len(f.Responses) == 0 {
+		var last string
+		if len(messages) > 0 {
+			last = messages[len(messages)-1].Content
+		}
+		sum := sha256.Sum256([]byte(last))
+		return "fake response " + hex.EncodeToString(sum[:8]), nil
+	}
+	if n >= len(f.Responses) {
+		n = len(f.Responses) - 1
+	}
+	return f.Responses[n], nil
+}
+
+// Stream delivers the reply Complete would give, one word at a time.
+func (f *FakeProvider) Stream(ctx context.Context, messages []Message, onDelta DeltaFunc) (string, error) {
+	reply, err := f.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err := onDelta(word); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
+
+// Calls returns every conversation the provider has been asked to complete.
+func (f *FakeProvider) Calls() [][]Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]Message(nil), f.calls...)
+}
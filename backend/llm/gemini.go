@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// geminiProvider talks to Google's Gemini API. A client is opened per call
+// because the genai client holds a gRPC connection that must be closed.
+type geminiProvider struct {
+	apiKey string
+	model  string
+}
+
+func newGeminiProvider(cfg Config) (*geminiProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("%s: API key not set", cfg.Provider)
+	}
+	return &geminiProvider{apiKey: cfg.APIKey, model: cfg.Model}, nil
+}
+
+// chat opens a client and a chat session holding every message but the last,
+// which is returned for the caller to send. The client must be closed.
+func (p *geminiProvider) chat(ctx context.Context, messages []Message) (*genai.Client, *genai.ChatSession, Message, error) {
+	if len(messages) == 0 {
+		return nil, nil, Message{}, errors.New("no messages to send")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(p.apiKey))
+	if err != nil {
+		return nil, nil, Message{}, err
+	}
+
+	model := client.GenerativeModel(p.model)
+	session := model.StartChat()
+
+	var system []genai.Part
+	last := messages[len(messages)-1]
+	for _, m := range messages[:len(messages)-1] {
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, genai.Text(m.Content))
+		case RoleAssistant:
+			session.History = append(session.History, &genai.Content{Role: "model", Parts: []genai.Part{genai.Text(m.Content)}})
+		default:
+			session.History = append(session.History, &genai.Content{Role: "user", Parts: []genai.Part{genai.Text(m.Content)}})
+		}
+	}
+	if len(system) > 0 {
+		model.SystemInstruction = &genai.Content{Parts: system}
+	}
+	return client, session, last, nil
+}
+
+func (p *geminiProvider) Complete(ctx context.Context, messages []Message) (string, error) {
+	client, session, last, err := p.chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	resp, err := session.SendMessage(ctx, genai.Text(last.Content))
+	if err != nil {
+		return "", err
+	}
+	return geminiText(resp), nil
+}
+
+func (p *geminiProvider) Stream(ctx context.Context, messages []Message, onDelta DeltaFunc) (string, error) {
+	client, session, last, err := p.chat(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	reply := collect{onDelta: onDelta}
+	iter := session.SendMessageStream(ctx, genai.Text(last.Content))
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return reply.sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := reply.add(geminiText(resp)); err != nil {
+			return "", err
+		}
+	}
+}
+
+func geminiText(resp *genai.GenerateContentResponse) string {
+	var sb strings.Builder
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			sb.WriteString(string(text))
+		}
+	}
+	return sb.String()
+}
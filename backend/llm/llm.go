@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Supported provider names for the LLM_PROVIDER style settings.
+const (
+	Groq   = "groq"
+	Gemini = "gemini"
+	OpenAI = "openai"
+	Fake   = "fake"
+)
+
+// Message roles understood by every provider.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ErrNotConfigured is returned when a handler needs a model but none was set up.
+var ErrNotConfigured = errors.New("LLM provider not configured")
+
+// Message is a single turn in a conversation with the model.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// User is a shorthand for a user message.
+func User(content string) Message {
+	return Message{Role: RoleUser, Content: content}
+}
+
+// Provider is anything that can turn a conversation into the model's next reply.
+type Provider interface {
+	Complete(ctx context.Context, messages []Message) (string, error)
+}
+
+// Config selects and configures a provider.
+type Config struct {
+	Provider string
+	Model    string
+	BaseURL  string
+	APIKey   string
+}
+
+// ConfigFromEnv reads <PREFIX>_PROVIDER, <PREFIX>_MODEL, <PREFIX>_BASE_URL and
+// <PREFIX>_API_KEY. When no API key is given the vendor specific variable
+// (GROQ_API_KEY, GEMINI_API_KEY, OPENAI_API_KEY) is used instead.
+func ConfigFromEnv(prefix, defaultProvider string) Config {
+	cfg := Config{
+		Provider: strings.ToLower(os.Getenv(prefix + "_PROVIDER")),
+		Model:    os.Getenv(prefix + "_MODEL"),
+		BaseURL:  os.Getenv(prefix + "_BASE_URL"),
+		APIKey:   os.Getenv(prefix + "_API_KEY"),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = defaultProvider
+	}
+	if cfg.APIKey == "" {
+		switch cfg.Provider {
+		case Groq:
+			cfg.APIKey = os.Getenv("GROQ_API_KEY")
+		case Gemini:
+			cfg.APIKey = os.Getenv("GEMINI_API_KEY")
+		case OpenAI:
+			cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+	}
+	return cfg
+}
+
+// defaultModels are used when no model is configured.
+var defaultModels = map[string]string{
+	Groq:   "llama-3.3-70b-versatile",
+	OpenAI: "gpt-4o-mini",
+	Gemini: "gemini-1.5-flash-latest",
+}
+
+// ModelName is the model cfg uses, the provider's default if none is set.
+func (cfg Config) ModelName() string {
+	if cfg.Model == "" {
+		return defaultModels[cfg.Provider]
+	}
+	return cfg.Model
+}
+
+// New builds the provider described by cfg.
+func New(cfg Config) (Provider, error) {
+	var (
+		p   Provider
+		err error
+	)
+	cfg.Model = cfg.ModelName()
+	switch cfg.Provider {
+	case Groq:
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = "https://api.groq.com/openai/v1"
+		}
+		p, err = newOpenAIProvider(cfg)
+	case OpenAI:
+		// Any OpenAI compatible server (OpenAI itself, Ollama, vLLM, LM Studio...).
+		p, err = newOpenAIProvider(cfg)
+	case Gemini:
+		p, err = newGeminiProvider(cfg)
+	case Fake:
+		p = &FakeProvider{}
+	default:
+		err = fmt.Errorf("unknown LLM provider %q", cfg.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FromEnv is ConfigFromEnv followed by New.
+func FromEnv(prefix, defaultProvider string) (Provider, error) {
+	return New(ConfigFromEnv(prefix, defaultProvider))
+}
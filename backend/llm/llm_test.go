@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GROQ_API_KEY", "groq key")
+	t.Setenv("QUIZ_PROVIDER", "")
+	t.Setenv("QUIZ_API_KEY", "")
+	if cfg := ConfigFromEnv("QUIZ", Groq); cfg.Provider != Groq || cfg.APIKey != "groq key" {
+		t.Errorf("defaults: %+v", cfg)
+	}
+
+	t.Setenv("QUIZ_PROVIDER", "OpenAI")
+	t.Setenv("QUIZ_MODEL", "llama3")
+	t.Setenv("QUIZ_BASE_URL", "http://localhost:11434/v1")
+	t.Setenv("QUIZ_API_KEY", "local key")
+	cfg := ConfigFromEnv("QUIZ", Groq)
+	if cfg.Provider != OpenAI || cfg.Model != "llama3" || cfg.BaseURL != "http://localhost:11434/v1" || cfg.APIKey != "local key" {
+		t.Errorf("from the environment: %+v", cfg)
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(Config{Provider: Fake})
+	if _, ok := p.(*FakeProvider); !ok || err != nil {
+		t.Errorf("fake: %T, %v", p, err)
+	}
+	if p, err := New(Config{Provider: OpenAI, APIKey: "key"}); p == nil || err != nil {
+		t.Errorf("openai: %v", err)
+	}
+	if _, err := New(Config{Provider: "claude-on-a-toaster"}); err == nil || !strings.Contains(err.Error(), "unknown LLM provider") {
+		t.Errorf("unknown provider: %v", err)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	ctx := context.Background()
+	f := &FakeProvider{Responses: []string{"one", "two"}}
+	for _, want := range []string{"one", "two", "two"} {
+		if got, err := f.Complete(ctx, []Message{User("hi")}); got != want || err != nil {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+	if calls := f.Calls(); len(calls) != 3 || calls[0][0].Content != "hi" {
+		t.Errorf("calls %+v", calls)
+	}
+
+	// Without responses the reply depends only on the last message
+	f = &FakeProvider{}
+	a, _ := f.Complete(ctx, []Message{User("x"), User("same")})
+	b, _ := f.Complete(ctx, []Message{User("same")})
+	c, _ := f.Complete(ctx, []Message{User("other")})
+	if a != b || a == c || !strings.HasPrefix(a, "fake response ") {
+		t.Errorf("digests %q, %q, %q", a, b, c)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := f.Complete(cancelled, []Message{User("hi")}); err == nil {
+		t.Error("a cancelled context still got a reply")
+	}
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// openAIProvider talks to Groq or any other OpenAI compatible endpoint.
+type openAIProvider struct {
+	client *openai.Client
+	model  string
+}
+
+func newOpenAIProvider(cfg Config) (*openAIProvider, error) {
+	if cfg.APIKey == "" && cfg.BaseURL == "" {
+		return nil, fmt.Errorf("%s: API key not set", cfg.Provider)
+	}
+	clientCfg := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientCfg.BaseURL = cfg.BaseURL
+	}
+	return &openAIProvider{
+		client: openai.NewClientWithConfig(clientCfg),
+		model:  cfg.Model,
+	}, nil
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, messages []Message) (string, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: toOpenAIMessages(messages),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (p *openAIProvider) Stream(ctx context.Context, messages []Message, onDelta DeltaFunc) (string, error) {
+	stream, err := p.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:    p.model,
+		Messages: toOpenAIMessages(messages),
+		Stream:   true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	reply := collect{onDelta: onDelta}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return reply.sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		if err := reply.add(resp.Choices[0].Delta.Content); err != nil {
+			return "", err
+		}
+	}
+}
+
+func toOpenAIMessages(messages []Message) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// DeltaFunc receives each piece of a reply as it is generated. Returning an
+// error stops the stream.
+type DeltaFunc func(delta string) error
+
+// Streamer is implemented by providers that can deliver a reply incrementally.
+type Streamer interface {
+	Stream(ctx context.Context, messages []Message, onDelta DeltaFunc) (string, error)
+}
+
+// Stream sends messages to p and calls onDelta as the reply arrives,
+// returning the full reply. Providers that cannot stream deliver the whole
+// reply as a single delta.
+func Stream(ctx context.Context, p Provider, messages []Message, onDelta DeltaFunc) (string, error) {
+	if p == nil {
+		return "", ErrNotConfigured
+	}
+	if s, ok := p.(Streamer); ok {
+		return s.Stream(ctx, messages, onDelta)
+	}
+	reply, err := p.Complete(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	if err := onDelta(reply); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+// collect accumulates deltas into the full reply while passing them on.
+type collect struct {
+	sb      strings.Builder
+	onDelta DeltaFunc
+}
+
+func (c *collect) add(delta string) error {
+	if delta == "" {
+		return nil
+	}
+	c.sb.WriteString(delta)
+	return c.onDelta(delta)
+}
@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// completer hides FakeProvider's Stream method.
+type completer struct{ Provider }
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	var deltas []string
+	record := func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	}
+
+	reply, err := Stream(ctx, &FakeProvider{Responses: []string{"Plants make glucose."}}, []Message{User("hi")}, record)
+	if err != nil || reply != "Plants make glucose." || strings.Join(deltas, "|") != "Plants |make |glucose." {
+		t.Errorf("fake: %q, %v, deltas %q", reply, err, deltas)
+	}
+
+	// Providers that can't stream send the whole reply at once
+	deltas = nil
+	reply, err = Stream(ctx, completer{&FakeProvider{Responses: []string{"Plants make glucose."}}}, []Message{User("hi")}, record)
+	if err != nil || reply != "Plants make glucose." || len(deltas) != 1 || deltas[0] != reply {
+		t.Errorf("completer: %q, %v, deltas %q", reply, err, deltas)
+	}
+
+	if _, err := Stream(ctx, nil, []Message{User("hi")}, record); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("no provider: %v", err)
+	}
+
+	// An error from onDelta stops the stream
+	stop := errors.New("client went away")
+	deltas = nil
+	_, err = Stream(ctx, &FakeProvider{Responses: []string{"one two three"}}, []Message{User("hi")}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return stop
+	})
+	if !errors.Is(err, stop) || len(deltas) != 1 {
+		t.Errorf("stopped: %v after %q", err, deltas)
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			t.Errorf("request %s", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Plants ", "", "make ", "glucose."} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p, err := New(Config{Provider: OpenAI, BaseURL: server.URL, Model: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deltas []string
+	reply, err := Stream(context.Background(), p, []Message{User("hi")}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil || reply != "Plants make glucose." || len(deltas) != 3 {
+		t.Errorf("got %q, %v, deltas %q", reply, err, deltas)
+	}
+}
@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DefaultRepairs is how many times CompleteJSON re-prompts the model after an
+// invalid reply before giving up.
+const DefaultRepairs = 2
+
+// Validator is implemented by response types that can check their own
+// invariants once decoded (e.g. "exactly 4 options").
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError collects every problem found in a response so they can all
+// be sent back to the model in a single repair prompt.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid response: " + strings.Join(e.Problems, "; ")
+}
+
+// Addf records a problem.
+func (e *ValidationError) Addf(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Err returns nil when no problems were recorded.
+func (e *ValidationError) Err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ExtractJSON pulls the first complete JSON object or array out of a model
+// reply, ignoring markdown fences and any prose around it. Brackets in the
+// prose that don't start valid JSON are skipped.
+func ExtractJSON(s string) (string, error) {
+	candidates, err := jsonCandidates(s)
+	if len(candidates) == 0 {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+// jsonCandidates lists the valid JSON objects and arrays in s, in order. The
+// error says why the first opening bracket didn't start one.
+func jsonCandidates(s string) ([]string, error) {
+	var candidates []string
+	var firstErr error
+	for start := 0; start < len(s); start++ {
+		if s[start] != '{' && s[start] != '[' {
+			continue
+		}
+		raw, err := balancedJSON(s, start)
+		if err == nil && !json.Valid([]byte(raw)) {
+			err = fmt.Errorf("invalid JSON at offset %d", start)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		candidates = append(candidates, raw)
+		start += len(raw) - 1
+	}
+	if len(candidates) == 0 && firstErr == nil {
+		firstErr = errors.New("no JSON object or array found")
+	}
+	return candidates, firstErr
+}
+
+// balancedJSON returns the object or array starting at s[start], up to its
+// matching closing bracket.
+func balancedJSON(s string, start int) (string, error) {
+	var (
+		stack    []byte
+		inString bool
+		escaped  bool
+	)
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return "", fmt.Errorf("unbalanced %q at offset %d", c, i)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return s[start : i+1], nil
+			}
+		}
+	}
+	return "", errors.New("JSON is truncated")
+}
+
+// DecodeJSON extracts JSON from a reply, decodes it into out and runs its
+// Validate method when it has one. The first JSON in the reply that fits out
+// is used, so a "[3]" in the prose before it doesn't get in the way.
+func DecodeJSON(reply string, out interface{}) error {
+	candidates, err := jsonCandidates(reply)
+	if len(candidates) == 0 {
+		return err
+	}
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("DecodeJSON needs a non-nil pointer, got %T", out)
+	}
+	err = nil
+	for _, raw := range candidates {
+		decoded := reflect.New(target.Elem().Type())
+		if decodeErr := json.Unmarshal([]byte(raw), decoded.Interface()); decodeErr != nil {
+			if err == nil {
+				err = fmt.Errorf("JSON does not match the expected shape: %v", decodeErr)
+			}
+			continue
+		}
+		target.Elem().Set(decoded.Elem())
+		if v, ok := out.(Validator); ok {
+			return v.Validate()
+		}
+		return nil
+	}
+	return err
+}
+
+// CompleteJSON asks p for a JSON reply and decodes it into out. When the reply
+// can't be parsed or fails validation the model is shown its answer and the
+// problems, and asked to fix them, at most repairs times.
+func CompleteJSON(ctx context.Context, p Provider, messages []Message, out interface{}, repairs int) error {
+	return CompleteJSONChecked(ctx, p, messages, out, repairs, nil)
+}
+
+// CompleteJSONChecked is CompleteJSON with an extra check, for rules that
+// need more than the response itself (e.g. the text it must quote). check
+// gets each decoded candidate after its own Validate passed; its errors are
+// sent back to the model like validation errors.
+func CompleteJSONChecked(ctx context.Context, p Provider, messages []Message, out interface{}, repairs int, check func(candidate interface{}) error) error {
+	if p == nil {
+		return ErrNotConfigured
+	}
+	dst := reflect.ValueOf(out)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return errors.New("CompleteJSON needs a non-nil pointer")
+	}
+	conversation := append([]Message(nil), messages...)
+
+	var lastErr error
+	for attempt := 0; attempt <= repairs; attempt++ {
+		reply, err := p.Complete(ctx, conversation)
+		if err != nil {
+			return err
+		}
+		// Decode into a fresh value so a rejected attempt leaves nothing behind.
+		candidate := reflect.New(dst.Elem().Type())
+		lastErr = DecodeJSON(reply, candidate.Interface())
+		if lastErr == nil && check != nil {
+			lastErr = check(candidate.Interface())
+		}
+		if lastErr == nil {
+			dst.Elem().Set(candidate.Elem())
+			return nil
+		}
+		conversation = append(conversation,
+			Message{Role: RoleAssistant, Content: reply},
+			User(fmt.Sprintf(`Your previous response was rejected: %v
+
+Reply again with ONLY the corrected JSON, in the same format as requested, with no markdown or extra text.`, lastErr)),
+		)
+	}
+	return fmt.Errorf("model did not produce valid JSON after %d attempts: %w", repairs+1, lastErr)
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"```json\n{\"a\": [1, 2]}\n```", `{"a": [1, 2]}`},
+		{`Sure! {"a": "}"} Hope that helps.`, `{"a": "}"}`},
+		{`Here is {what you asked} for: {"a": 1}`, `{"a": 1}`},
+		{`Here are [3] questions: {"quiz": []}`, `[3]`},
+		{`Here is the list: [{"a": "\"]"}]`, `[{"a": "\"]"}]`},
+	}
+	for _, tt := range tests {
+		got, err := ExtractJSON(tt.reply)
+		if err != nil || got != tt.want {
+			t.Errorf("ExtractJSON(%q) = %q, %v, want %q", tt.reply, got, err, tt.want)
+		}
+	}
+
+	for _, reply := range []string{"no json here", `{"a": 1`, `oops ] {`} {
+		if got, err := ExtractJSON(reply); err == nil {
+			t.Errorf("ExtractJSON(%q) = %q, want an error", reply, got)
+		}
+	}
+}
+
+type testQuiz struct {
+	Quiz []struct {
+		Question string `json:"question"`
+	} `json:"quiz"`
+}
+
+func (q testQuiz) Validate() error {
+	var problems ValidationError
+	if len(q.Quiz) == 0 {
+		problems.Addf("no questions")
+	}
+	return problems.Err()
+}
+
+func TestDecodeJSONSkipsProse(t *testing.T) {
+	var quiz testQuiz
+	reply := `Here are [3] questions, as {requested}: {"quiz": [{"question": "a"}, {"question": "b"}, {"question": "c"}]}`
+	if err := DecodeJSON(reply, &quiz); err != nil {
+		t.Fatal(err)
+	}
+	if len(quiz.Quiz) != 3 || quiz.Quiz[2].Question != "c" {
+		t.Errorf("decoded %+v", quiz)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	var quiz testQuiz
+	if err := DecodeJSON(`{"quiz": []}`, &quiz); err == nil || !strings.Contains(err.Error(), "no questions") {
+		t.Errorf("validation error = %v", err)
+	}
+	if err := DecodeJSON(`{"quiz": "nope"}`, &quiz); err == nil || !strings.Contains(err.Error(), "expected shape") {
+		t.Errorf("shape error = %v", err)
+	}
+	if err := DecodeJSON(`{"quiz": [`, &quiz); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("truncated error = %v", err)
+	}
+}
+
+func TestCompleteJSONRepairs(t *testing.T) {
+	f := &FakeProvider{Responses: []string{`{"quiz": []}`, "```json\n{\"quiz\": [{\"question\": \"a\"}]}\n```"}}
+	var quiz testQuiz
+	if err := CompleteJSON(context.Background(), f, []Message{User("make a quiz")}, &quiz, DefaultRepairs); err != nil {
+		t.Fatal(err)
+	}
+	if len(quiz.Quiz) != 1 || quiz.Quiz[0].Question != "a" {
+		t.Errorf("decoded %+v", quiz)
+	}
+
+	// The model is shown its rejected reply and the problems with it
+	calls := f.Calls()
+	if len(calls) != 2 || len(calls[1]) != 3 || calls[1][1].Content != `{"quiz": []}` || !strings.Contains(calls[1][2].Content, "no questions") {
+		t.Errorf("repair prompt %+v", calls)
+	}
+}
+
+func TestCompleteJSONGivesUp(t *testing.T) {
+	f := &FakeProvider{Responses: []string{"I'd rather not."}}
+	quiz := testQuiz{}
+	quiz.Quiz = append(quiz.Quiz, struct {
+		Question string `json:"question"`
+	}{"kept"})
+	err := CompleteJSON(context.Background(), f, []Message{User("make a quiz")}, &quiz, 1)
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("err = %v", err)
+	}
+	if len(f.Calls()) != 2 || quiz.Quiz[0].Question != "kept" {
+		t.Errorf("%d calls, quiz %+v", len(f.Calls()), quiz)
+	}
+
+	if err := CompleteJSON(context.Background(), nil, nil, &quiz, 1); err != ErrNotConfigured {
+		t.Errorf("no provider: %v", err)
+	}
+}
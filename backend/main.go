@@ -7,6 +7,10 @@ import (
 	"net/http"
 	"tutor_genX/db"
 	"tutor_genX/handlers"
+	"tutor_genX/jobs"
+	"tutor_genX/llm"
+	"tutor_genX/segment"
+	"tutor_genX/storage"
 	"tutor_genX/utils"
 
 	"github.com/gorilla/mux"
@@ -33,6 +37,42 @@ func main() {
 	}
 	db.ConnectDB()
 
+	// LLM providers are picked by configuration (LLM_PROVIDER, SUMMARY_LLM_PROVIDER)
+	llmConfig := llm.ConfigFromEnv("LLM", llm.Groq)
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		log.Println("LLM provider unavailable:", err)
+	}
+	summary, err := llm.FromEnv("SUMMARY_LLM", llm.Gemini)
+	if err != nil {
+		log.Println("Summary LLM provider unavailable, using the default provider:", err)
+	}
+	handlers.UseLLM(provider, summary)
+	// Documents are chunked to fit the model (CHUNK_TOKENS, CHUNK_OVERLAP_TOKENS)
+	handlers.UseChunking(segment.OptionsFromEnv(llmConfig.ModelName()))
+
+	// Embeddings for searching the user's documents (EMBEDDING_PROVIDER, EMBEDDING_MODEL)
+	// Without one documents aren't indexed and answers cite nothing
+	embedder, err := llm.EmbedderFromEnv("EMBEDDING", llm.Gemini)
+	if err != nil {
+		log.Println("Embedding provider unavailable, document search is off:", err)
+	}
+	handlers.UseEmbedder(embedder)
+
+	// Uploaded PDFs go to STORAGE_DIR (see storage.FromEnv)
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to set up file storage:", err)
+	}
+	handlers.UseStorage(store)
+
+	// Background generation jobs, sized by JOB_WORKERS and JOB_USER_CONCURRENCY
+	jobManager := jobs.NewManager(jobs.ConfigFromEnv())
+	handlers.UseJobs(jobManager)
+	if err := jobManager.Start(); err != nil {
+		log.Println("Failed to resume unfinished jobs:", err)
+	}
+
 	//create a router
 	router := mux.NewRouter()
 
@@ -55,8 +95,23 @@ func main() {
 	router.Handle("/update-progress", utils.ValidateToken(http.HandlerFunc(handlers.HandleMarkAsCompleted))).Methods("POST")
 	router.Handle("/generateTitle", utils.ValidateToken(http.HandlerFunc(handlers.GoalNameHandler))).Methods("POST")
 	router.Handle("/roadmap/{id}", utils.ValidateToken(http.HandlerFunc(handlers.GetSingleRoadmap))).Methods("GET")
+	router.Handle("/roadmap/{id}/weeks", utils.ValidateToken(http.HandlerFunc(handlers.AddRoadmapWeek))).Methods("POST")
+	router.Handle("/roadmap/{id}/weeks/order", utils.ValidateToken(http.HandlerFunc(handlers.ReorderRoadmapWeeks))).Methods("PUT")
+	router.Handle("/roadmap/{id}/weeks/{weekId:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.UpdateRoadmapWeek))).Methods("PUT")
+	router.Handle("/roadmap/{id}/weeks/{weekId:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.DeleteRoadmapWeek))).Methods("DELETE")
+	router.Handle("/roadmap/{id}/regenerate", utils.ValidateToken(http.HandlerFunc(handlers.RegenerateRoadmapWeeks))).Methods("POST")
+	router.Handle("/roadmap/{id}/versions", utils.ValidateToken(http.HandlerFunc(handlers.GetRoadmapVersions))).Methods("GET")
+	router.Handle("/roadmap/{id}/versions/diff", utils.ValidateToken(http.HandlerFunc(handlers.DiffRoadmapVersions))).Methods("GET")
+	router.Handle("/roadmap/{id}/versions/{version:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.GetRoadmapVersion))).Methods("GET")
+	router.Handle("/roadmap/{id}/versions/{version:[0-9]+}/rollback", utils.ValidateToken(http.HandlerFunc(handlers.RollbackRoadmap))).Methods("POST")
 	router.Handle("/explain-topic", utils.ValidateToken(http.HandlerFunc(handlers.ExplainTopicHandler))).Methods("POST")
 	router.Handle("/quiz", utils.ValidateToken(http.HandlerFunc(handlers.GenerateQuiz))).Methods("POST")
+	router.Handle("/quiz/adaptive", utils.ValidateToken(http.HandlerFunc(handlers.GenerateAdaptiveQuiz))).Methods("POST")
+	router.Handle("/mastery", utils.ValidateToken(http.HandlerFunc(handlers.GetMastery))).Methods("GET")
+	router.Handle("/quiz-attempts", utils.ValidateToken(http.HandlerFunc(handlers.SubmitQuizAttempt))).Methods("POST")
+	router.Handle("/quiz-attempts", utils.ValidateToken(http.HandlerFunc(handlers.GetQuizAttempts))).Methods("GET")
+	router.Handle("/quiz-export", utils.ValidateToken(http.HandlerFunc(handlers.ExportQuiz))).Methods("GET")
+	router.Handle("/quiz-import", utils.ValidateToken(http.HandlerFunc(handlers.ImportQuiz))).Methods("POST")
 	router.Handle("/simplify", utils.ValidateToken(http.HandlerFunc(handlers.Simplify))).Methods("POST")
 	router.Handle("/example", utils.ValidateToken(http.HandlerFunc(handlers.GenerateExamples))).Methods("POST")
 	router.Handle("/booksection", utils.ValidateToken(http.HandlerFunc(handlers.BookHandler))).Methods("POST")
@@ -76,11 +131,38 @@ func main() {
 	router.HandleFunc("/flashcards", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}).Methods("OPTIONS")
+	router.Handle("/flashcards/due", utils.ValidateToken(http.HandlerFunc(handlers.GetDueFlashcards))).Methods("GET")
+	router.Handle("/flashcards/review", utils.ValidateToken(http.HandlerFunc(handlers.ReviewFlashcard))).Methods("POST")
+	router.Handle("/flashcard-sets/merge", utils.ValidateToken(http.HandlerFunc(handlers.MergeFlashcardSets))).Methods("POST")
+	router.Handle("/flashcard-sets/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.GetFlashcardSet))).Methods("GET")
+	router.Handle("/flashcard-sets/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.UpdateFlashcardSet))).Methods("PUT")
+	router.Handle("/flashcard-sets/{id:[0-9]+}/cards", utils.ValidateToken(http.HandlerFunc(handlers.AddCard))).Methods("POST")
+	router.Handle("/flashcard-sets/{id:[0-9]+}/cards/{cardId:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.UpdateCard))).Methods("PUT")
+	router.Handle("/flashcard-sets/{id:[0-9]+}/cards/{cardId:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.DeleteCard))).Methods("DELETE")
+	router.Handle("/flashcard-sets/{id:[0-9]+}/split", utils.ValidateToken(http.HandlerFunc(handlers.SplitFlashcardSet))).Methods("POST")
+	router.Handle("/flashcard-sets/{id:[0-9]+}/generate", utils.ValidateToken(http.HandlerFunc(handlers.GenerateMoreFlashcards))).Methods("POST")
+	router.Handle("/flashcard-export", utils.ValidateToken(http.HandlerFunc(handlers.ExportFlashcards))).Methods("GET")
+	router.Handle("/flashcard-import", utils.ValidateToken(http.HandlerFunc(handlers.ImportFlashcards))).Methods("POST")
 	router.Handle("/my-quizzes", utils.ValidateToken(http.HandlerFunc(handlers.GetUserQuizzesFromPdf))).Methods("GET")
 	router.Handle("/my-flashcards", utils.ValidateToken(http.HandlerFunc(handlers.GetUserFlashcardsFromPdf))).Methods("GET")
+	router.Handle("/documents", utils.ValidateToken(http.HandlerFunc(handlers.UploadDocument))).Methods("POST")
+	router.Handle("/documents", utils.ValidateToken(http.HandlerFunc(handlers.GetDocuments))).Methods("GET")
+	router.Handle("/documents/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.GetDocument))).Methods("GET")
+	router.Handle("/documents/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.DeleteDocument))).Methods("DELETE")
+	router.Handle("/documents/{id:[0-9]+}/chapters", utils.ValidateToken(http.HandlerFunc(handlers.GetDocumentChapters))).Methods("GET")
+	router.Handle("/documents/{id:[0-9]+}/file", utils.ValidateToken(http.HandlerFunc(handlers.GetDocumentFile))).Methods("GET")
+	router.Handle("/jobs", utils.ValidateToken(http.HandlerFunc(handlers.SubmitJob))).Methods("POST")
+	router.Handle("/jobs", utils.ValidateToken(http.HandlerFunc(handlers.GetJobs))).Methods("GET")
+	router.Handle("/jobs/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.GetJob))).Methods("GET")
+	router.Handle("/jobs/{id:[0-9]+}/events", utils.ValidateToken(http.HandlerFunc(handlers.StreamJob))).Methods("GET")
+	router.Handle("/jobs/{id:[0-9]+}/cancel", utils.ValidateToken(http.HandlerFunc(handlers.CancelJob))).Methods("POST")
 	router.Handle("/ytsection", utils.ValidateToken(http.HandlerFunc(handlers.YouTubeHandler))).Methods("POST")
 	router.Handle("/video-summary", utils.ValidateToken(http.HandlerFunc(handlers.GetYouTubeVideoSummaryGemini))).Methods("POST")
+	// The websocket authenticates itself (?token= or an auth frame), browsers can't set headers on it
 	router.HandleFunc("/ws", handlers.HandleChatbot)
+	router.Handle("/chat-sessions", utils.ValidateToken(http.HandlerFunc(handlers.GetChatSessions))).Methods("GET")
+	router.Handle("/chat-sessions/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.GetChatSession))).Methods("GET")
+	router.Handle("/chat-sessions/{id:[0-9]+}", utils.ValidateToken(http.HandlerFunc(handlers.DeleteChatSession))).Methods("DELETE")
 	//Start the server
 	fmt.Println("Server running at http://localhost:8080")
 	handlerWithCORS := utils.CORSMiddleware(router)
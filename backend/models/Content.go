@@ -5,6 +5,7 @@ import (
 )
 
 // Explanation is the model for a user's generated topic explanation.
+// QuizVersion goes up every time the quiz is regenerated.
 type Content struct {
 	gorm.Model
 	UserID string `gorm:"uniqueIndex:idx_user_topic" json:"user_id"`
@@ -14,4 +15,6 @@ type Content struct {
 	SimplifiedExplanation string `gorm:"type:text" json:"simplified_explanation"`
 	Examples              string `gorm:"type:text" json:"examples"`
 	Quiz                  string `gorm:"type:text" json:"quiz"`
+	QuizVersion           int    `gorm:"not null;default:0" json:"quiz_version"`
+	Sources               string `gorm:"type:text" json:"-"` // JSON citations the explanation refers to
 }
@@ -0,0 +1,57 @@
+package models
+
+import "gorm.io/gorm"
+
+// Document is a piece of source text a user generated study material from,
+// identified by the SHA-256 of its normalized text so the same file is only
+// stored (and generated from) once.
+type Document struct {
+	gorm.Model
+	UserEmail   string `gorm:"uniqueIndex:idx_user_document" json:"user_email"`
+	ContentHash string `gorm:"uniqueIndex:idx_user_document" json:"content_hash"`
+	FileName    string `json:"file_name"`
+	PageCount   int    `json:"page_count"`
+	SizeBytes   int64  `json:"size_bytes"` // Size of the uploaded file, or of the text when there was no upload
+	Text        string `gorm:"type:text" json:"-"`
+	// StorageKey locates the original file in the blob store, empty when
+	// only the text was sent. MimeType is the file's type.
+	StorageKey string                 `json:"-"`
+	MimeType   string                 `json:"mime_type,omitempty"`
+	Pages      []DocumentPage         `json:"pages,omitempty" gorm:"foreignKey:DocumentID"`
+	Outline    []DocumentOutlineEntry `json:"outline,omitempty" gorm:"foreignKey:DocumentID"`
+}
+
+// DocumentPage is the extracted text of one page of an uploaded document.
+// Documents without pages are split into sections (or chapters) instead.
+type DocumentPage struct {
+	gorm.Model
+	DocumentID uint   `gorm:"index" json:"document_id"`
+	Number     int    `json:"number"` // 1-based
+	Text       string `gorm:"type:text" json:"text"`
+}
+
+// DocumentOutlineEntry is one bookmark of a PDF's outline (or one heading of
+// another document), flattened in reading order. Page is 0 when the
+// bookmark's target could not be resolved.
+type DocumentOutlineEntry struct {
+	gorm.Model
+	DocumentID uint   `gorm:"index" json:"document_id"`
+	Position   int    `json:"position"`
+	Level      int    `json:"level"` // 1 for top-level entries
+	Title      string `json:"title"`
+	Page       int    `json:"page"`
+}
+
+// DocumentPassage is a slice of a document's text with its embedding, for
+// retrieving the passages relevant to a question. EmbeddingModel names the
+// embedding space the vector belongs to.
+type DocumentPassage struct {
+	gorm.Model
+	DocumentID     uint   `gorm:"index" json:"document_id"`
+	UserEmail      string `gorm:"index" json:"-"`
+	Page           int    `json:"page"` // 1-based, 0 when the document has no pages
+	Position       int    `json:"position"`
+	Text           string `gorm:"type:text" json:"text"`
+	EmbeddingModel string `json:"-"`
+	Embedding      []byte `json:"-"` // little-endian float32s
+}
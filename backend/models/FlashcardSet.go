@@ -1,12 +1,61 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // FlashcardSet is a model for a user's generated flashcards from a PDF.
 type FlashcardSet struct {
 	gorm.Model
-	UserEmail  string `json:"user_email"`
-	Title      string `json:"title"`
-	PDFText    string `gorm:"type:text" json:"pdf_text"`
-	Flashcards string `gorm:"type:text" json:"flashcards"`
+	UserEmail string `json:"user_email"`
+	Title     string `json:"title"`
+	Tags      string `json:"tags,omitempty"` // Space separated, like Card.Tags
+	// DocumentID is the source text the set was generated from.
+	DocumentID *uint `gorm:"index" json:"document_id,omitempty"`
+	// Chapter is the chapter of the document the set was generated from
+	// (1-based), or 0 for the whole document.
+	Chapter int `gorm:"not null;default:0" json:"chapter,omitempty"`
+	// PDFText is the legacy cache key (the first 50 bytes of the text), no
+	// longer written.
+	PDFText string `gorm:"type:text" json:"-"`
+	// Flashcards is the legacy JSON encoding of the cards, kept only so
+	// db.migrateFlashcardCards can move old rows into Cards.
+	Flashcards string `gorm:"type:text" json:"-"`
+	Cards      []Card `json:"cards" gorm:"foreignKey:FlashcardSetID"`
+}
+
+// Card is a single flashcard in a FlashcardSet.
+//
+// A cloze card (Type "cloze") has the cloze text in Front, e.g. "The
+// {{c1::mitochondria}} is the powerhouse of the cell", and any extra notes in
+// Back. Like in Anki, a text with several deletions makes one card per
+// deletion number, each asking for the deletions numbered Cloze.
+type Card struct {
+	gorm.Model
+	FlashcardSetID uint   `gorm:"index" json:"flashcard_set_id"`
+	Position       int    `json:"position"`
+	Type           string `json:"type,omitempty"` // "" for a front/back card or "cloze"
+	Cloze          int    `json:"cloze,omitempty"`
+	Front          string `gorm:"type:text" json:"front"`
+	Back           string `gorm:"type:text" json:"back"`
+	Tags           string `json:"tags,omitempty"` // Space separated
+	// ExternalID and GUID are the card's ID and note GUID in the tool it was
+	// imported from, written back on export.
+	ExternalID string `json:"external_id,omitempty"`
+	GUID       string `json:"guid,omitempty"`
+}
+
+// CardReview is a user's spaced-repetition state for one card.
+type CardReview struct {
+	gorm.Model
+	UserEmail      string     `gorm:"uniqueIndex:idx_user_card" json:"user_email"`
+	CardID         uint       `gorm:"uniqueIndex:idx_user_card" json:"card_id"`
+	EaseFactor     float64    `json:"ease_factor"`
+	IntervalDays   int        `json:"interval_days"`
+	Repetitions    int        `json:"repetitions"`
+	Lapses         int        `json:"lapses"`
+	DueAt          time.Time  `gorm:"index" json:"due_at"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Job statuses. Queued and running jobs are picked up again after a restart.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Chunk statuses.
+const (
+	ChunkPending = "pending"
+	ChunkDone    = "done"
+	ChunkFailed  = "failed"
+)
+
+// Job is a background generation job (flashcards or a quiz from a PDF). The
+// input is split into JobChunks that are processed by the worker pool.
+type Job struct {
+	gorm.Model
+	UserEmail     string     `gorm:"index" json:"user_email"`
+	Kind          string     `json:"kind"`
+	Status        string     `gorm:"index" json:"status"`
+	Title         string     `json:"title"`
+	DocumentID    uint       `gorm:"index" json:"document_id"`
+	Chapter       int        `gorm:"not null;default:0" json:"chapter,omitempty"` // 0 for the whole document
+	ChunksTotal   int        `json:"chunks_total"`
+	ChunksDone    int        `json:"chunks_done"`
+	ItemsProduced int        `json:"items_produced"`
+	ResultID      *uint      `json:"result_id,omitempty"` // FlashcardSet or QuizSet, depending on Kind
+	Error         string     `json:"error,omitempty"`
+	Chunks        []JobChunk `json:"chunks,omitempty" gorm:"foreignKey:JobID"`
+}
+
+// Finished reports whether the job has reached a final status.
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// JobChunk is one piece of a job's input and, once processed, its output.
+type JobChunk struct {
+	gorm.Model
+	JobID  uint   `gorm:"index" json:"-"`
+	Index  int    `gorm:"column:chunk_index" json:"index"`
+	Text   string `gorm:"type:text" json:"-"`
+	Status string `json:"status"`
+	Items  int    `json:"items"`
+	Output string `gorm:"type:text" json:"-"`
+	Error  string `json:"error,omitempty"`
+}
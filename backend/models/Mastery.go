@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Mastery is an Elo-style estimate of how well a user knows a topic, or one
+// concept of it when Concept is set. It moves after every graded answer.
+type Mastery struct {
+	gorm.Model
+	UserEmail string  `gorm:"uniqueIndex:idx_user_mastery" json:"-"`
+	Topic     string  `gorm:"uniqueIndex:idx_user_mastery" json:"topic"`
+	Concept   string  `gorm:"uniqueIndex:idx_user_mastery" json:"concept,omitempty"`
+	Rating    float64 `json:"rating"`
+	Answered  int     `json:"answered"`
+	Correct   int     `json:"correct"`
+}
+
+// BankQuestion is a generated question kept for a user's adaptive quizzes on a topic.
+type BankQuestion struct {
+	gorm.Model
+	UserEmail   string     `gorm:"index:idx_user_bank" json:"-"`
+	Topic       string     `gorm:"index:idx_user_bank" json:"topic"`
+	Type        string     `json:"type"`
+	Question    string     `json:"question"`
+	Options     string     `gorm:"type:text" json:"options"` // JSON array
+	Answer      string     `json:"-"`
+	Details     string     `gorm:"type:text" json:"-"` // JSON of the fields specific to the question type
+	Difficulty  int        `json:"difficulty"`         // 1 (easiest) to 5
+	Concept     string     `json:"concept"`
+	TimesAsked  int        `json:"times_asked"`
+	LastAskedAt *time.Time `json:"last_asked_at,omitempty"`
+}
+
+// AdaptiveQuiz is a set of bank questions picked for the user's level when it was served.
+type AdaptiveQuiz struct {
+	gorm.Model
+	UserEmail string `gorm:"index" json:"user_email"`
+	Topic     string `json:"topic"`
+	Level     int    `json:"level"`
+	Quiz      string `gorm:"type:text" json:"quiz"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QuizAttempt is a user's graded submission of a topic quiz (Content), a PDF
+// quiz (QuizSet) or an adaptive quiz. QuizVersion is the version of a topic
+// quiz the attempt was at.
+type QuizAttempt struct {
+	gorm.Model
+	UserEmail       string              `gorm:"index" json:"user_email"`
+	ContentID       *uint               `gorm:"index" json:"content_id,omitempty"`
+	QuizSetID       *uint               `gorm:"index" json:"quiz_set_id,omitempty"`
+	AdaptiveQuizID  *uint               `gorm:"index" json:"adaptive_quiz_id,omitempty"`
+	QuizVersion     int                 `gorm:"not null;default:0" json:"quiz_version,omitempty"`
+	Score           int                 `json:"score"`  // Questions answered fully right
+	Points          float64             `json:"points"` // Including partial credit
+	Total           int                 `json:"total"`
+	StartedAt       time.Time           `json:"started_at"`
+	SubmittedAt     time.Time           `json:"submitted_at"`
+	DurationSeconds int                 `json:"duration_seconds"`
+	Answers         []QuizAttemptAnswer `json:"answers" gorm:"foreignKey:AttemptID"`
+}
+
+// QuizAttemptAnswer records how a single question of an attempt was answered.
+type QuizAttemptAnswer struct {
+	gorm.Model
+	AttemptID     uint    `gorm:"index" json:"-"`
+	QuestionIndex int     `json:"question_index"`
+	Type          string  `json:"type"`
+	Question      string  `json:"question"`
+	Selected      string  `json:"selected"` // JSON list for multi-select and ordering questions
+	CorrectAnswer string  `json:"correct_answer"`
+	Correct       bool    `json:"correct"`
+	Credit        float64 `json:"credit"`             // 0 to 1
+	Feedback      string  `json:"feedback,omitempty"` // For short answers graded against a rubric
+	Difficulty    int     `json:"difficulty,omitempty"`
+	Concept       string  `json:"concept,omitempty"`
+	Explanation   string  `json:"explanation,omitempty"`  // Why the correct answer is right
+	WhyWrong      string  `json:"why_wrong,omitempty"`    // Why the wrong options picked are wrong
+	SourceQuote   string  `json:"source_quote,omitempty"` // The passage the question came from
+	SourcePage    int     `json:"source_page,omitempty"`
+}
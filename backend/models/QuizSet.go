@@ -5,8 +5,10 @@ import "gorm.io/gorm"
 // QuizSet is a model for a user's generated quiz from a PDF.
 type QuizSet struct {
 	gorm.Model
-	UserEmail string `json:"user_email"`
-	Title     string `json:"title"`
-	PDFText   string `gorm:"type:text" json:"pdf_text"`
-	Quiz      string `gorm:"type:text" json:"quiz"`
+	UserEmail  string `json:"user_email"`
+	Title      string `json:"title"`
+	DocumentID *uint  `gorm:"index" json:"document_id,omitempty"`
+	Chapter    int    `gorm:"not null;default:0" json:"chapter,omitempty"` // See FlashcardSet.Chapter
+	PDFText    string `gorm:"type:text" json:"-"`                          // Legacy cache key, see FlashcardSet.PDFText
+	Quiz       string `gorm:"type:text" json:"quiz"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "gorm.io/gorm"
+
+// ChatSession is a TutorBot conversation about one topic. Turns that no
+// longer fit the context window are folded into Summary.
+type ChatSession struct {
+	gorm.Model
+	UserEmail string `gorm:"index" json:"user_email"`
+	Topic     string `gorm:"index" json:"topic"`
+	Title     string `json:"title"`
+	Summary   string `gorm:"type:text" json:"summary,omitempty"`
+	// SummarizedThrough is the ID of the last message included in Summary.
+	SummarizedThrough uint          `json:"-"`
+	Messages          []ChatMessage `json:"messages,omitempty" gorm:"foreignKey:SessionID"`
+}
+
+// ChatMessage is one turn of a ChatSession.
+type ChatMessage struct {
+	gorm.Model
+	SessionID uint   `gorm:"index" json:"session_id"`
+	Role      string `json:"role"` // "user" or "assistant"
+	Content   string `gorm:"type:text" json:"content"`
+}
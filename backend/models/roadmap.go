@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Roadmap struct {
 	gorm.Model
@@ -12,9 +16,30 @@ type Roadmap struct {
 
 type RoadmapWeek struct {
 	gorm.Model
-	RoadmapID uint   `json:"-"`
-	Week      int    `json:"week"`
-	Title     string `json:"title"`
-	Topics    string `json:"topics"`
-	Progress  string `json:"progress"`
+	RoadmapID uint           `json:"-"`
+	Week      int            `json:"week"`
+	Title     string         `json:"title"`
+	Topics    []RoadmapTopic `json:"topics" gorm:"foreignKey:WeekID"`
+}
+
+// RoadmapTopic is one topic of a roadmap week. CompletedAt is nil until the
+// user marks the topic as done.
+type RoadmapTopic struct {
+	gorm.Model
+	WeekID      uint       `gorm:"index" json:"week_id"`
+	Order       int        `gorm:"column:sort_order" json:"order"`
+	Title       string     `json:"title"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Notes       string     `gorm:"type:text" json:"notes"`
+}
+
+// RoadmapVersion is an immutable snapshot of a roadmap taken after every
+// change, progress included. Snapshot holds the JSON encoded weeks and topics
+// with their completion and notes.
+type RoadmapVersion struct {
+	gorm.Model
+	RoadmapID uint   `gorm:"uniqueIndex:idx_roadmap_version" json:"roadmap_id"`
+	Version   int    `gorm:"uniqueIndex:idx_roadmap_version" json:"version"`
+	Reason    string `json:"reason"`
+	Snapshot  string `gorm:"type:text" json:"snapshot,omitempty"`
 }
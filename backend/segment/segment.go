@@ -0,0 +1,339 @@
+// Package segment splits documents into chunks for prompts. Chunks end at
+// paragraph and sentence boundaries, stay within a token budget and, when the
+// document has pages and headings, follow them.
+package segment
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options sizes chunks, in tokens.
+type Options struct {
+	MaxTokens int
+	// Overlap repeats up to this many tokens of whole sentences from the end
+	// of a chunk at the start of the next one, within a section.
+	Overlap int
+}
+
+const (
+	defaultBudget  = 2500
+	maxBudget      = 3000 // Bigger chunks don't get more out of a prompt, just fewer items per page
+	defaultOverlap = 50
+)
+
+// contextWindows are the context sizes of common models, by name prefix.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4.1", 1000000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5", 16385},
+	{"gemini", 1000000},
+	{"llama-3.3", 128000},
+	{"llama-3.1", 128000},
+	{"llama3-", 8192},
+	{"llama3", 8192}, // Ollama
+	{"mixtral", 32768},
+	{"gemma", 8192},
+	{"mistral", 32768},
+	{"qwen", 32768},
+	{"phi3", 4096},
+}
+
+// Budget is the chunk size for model: a quarter of its context window,
+// leaving room for the instructions and the reply, and at most 3000 tokens.
+func Budget(model string) int {
+	model = strings.ToLower(model)
+	for _, w := range contextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return min(w.tokens/4, maxBudget)
+		}
+	}
+	return defaultBudget
+}
+
+// OptionsFromEnv sizes chunks for model, unless CHUNK_TOKENS or
+// CHUNK_OVERLAP_TOKENS say otherwise.
+func OptionsFromEnv(model string) Options {
+	opts := Options{MaxTokens: Budget(model), Overlap: defaultOverlap}
+	if n, err := strconv.Atoi(os.Getenv("CHUNK_TOKENS")); err == nil && n > 0 {
+		opts.MaxTokens = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CHUNK_OVERLAP_TOKENS")); err == nil && n >= 0 {
+		opts.Overlap = n
+	}
+	return opts
+}
+
+// Tokens estimates how many tokens s is for a BPE tokenizer: about one per
+// four letters of a word, one per punctuation mark and one per CJK character.
+func Tokens(s string) int {
+	tokens, run := 0, 0
+	flush := func() {
+		tokens += (run + 3) / 4
+		run = 0
+	}
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			run++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Section is a part of a document: a page, or the part of one under a heading.
+type Section struct {
+	Text    string
+	Page    int    // 1-based, 0 when unknown
+	Heading string // The heading the text is under, if any
+	// NewHeading marks the start of the text under Heading, where a chunk
+	// should start.
+	NewHeading bool
+}
+
+// Chunk is a piece of a document sized for a prompt.
+type Chunk struct {
+	Text      string
+	FirstPage int // 0 when the document has no pages
+	LastPage  int
+	Heading   string
+	Tokens    int
+}
+
+// unit is a sentence, or a piece of one too long for a chunk.
+type unit struct {
+	text      string
+	tokens    int
+	page      int
+	heading   string
+	paragraph bool // Starts a paragraph
+	glued     bool // Continues the word the unit before was cut in
+	section   bool // Starts a section under a new heading
+	remaining int  // Tokens left in its paragraph, itself included
+}
+
+// Split cuts sections into chunks of at most opts.MaxTokens tokens. Chunks
+// break between sentences, preferably between paragraphs or pages, and a new
+// heading starts a new chunk unless the one before is still small. A sentence
+// longer than a chunk is cut between words, and a word longer than a chunk
+// between characters.
+func Split(sections []Section, opts Options) []Chunk {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = defaultBudget
+	}
+	if opts.Overlap >= opts.MaxTokens/2 {
+		opts.Overlap = opts.MaxTokens / 2
+	}
+
+	var units []unit
+	for _, section := range sections {
+		first := true
+		for _, p := range paragraphs(section.Text) {
+			start := len(units)
+			for _, sentence := range sentences(p) {
+				for _, p := range pieces(sentence, opts.MaxTokens) {
+					units = append(units, unit{text: p.text, tokens: Tokens(p.text), page: section.Page, heading: section.Heading, glued: p.glued})
+				}
+			}
+			if start == len(units) {
+				continue
+			}
+			units[start].paragraph = true
+			units[start].section = first && section.NewHeading
+			first = false
+			remaining := 0
+			for i := len(units) - 1; i >= start; i-- {
+				remaining += units[i].tokens
+				units[i].remaining = remaining
+			}
+		}
+	}
+
+	var chunks []Chunk
+	var current []unit
+	tokens, fresh := 0, 0 // fresh counts the units not repeated from the last chunk
+	flush := func(overlap bool) {
+		if fresh == 0 {
+			return
+		}
+		chunks = append(chunks, build(current, tokens))
+		var kept []unit
+		kept, tokens = nil, 0
+		if overlap {
+			for i := len(current) - 1; i >= 0 && tokens+current[i].tokens <= opts.Overlap; i-- {
+				kept = append([]unit{current[i]}, kept...)
+				tokens += current[i].tokens
+			}
+		}
+		current, fresh = kept, 0
+	}
+	for _, u := range units {
+		switch {
+		case u.section && tokens >= opts.MaxTokens/4:
+			flush(false)
+		case tokens+u.tokens > opts.MaxTokens:
+			flush(true)
+			// Drop the overlap if the next sentence wouldn't fit with it
+			for len(current) > 0 && tokens+u.tokens > opts.MaxTokens {
+				tokens -= current[0].tokens
+				current = current[1:]
+			}
+		case u.paragraph && tokens >= opts.MaxTokens/2 && tokens+u.remaining > opts.MaxTokens:
+			// The paragraph won't fit, start it in the next chunk
+			flush(true)
+		}
+		current = append(current, u)
+		tokens += u.tokens
+		fresh++
+	}
+	flush(false)
+	return chunks
+}
+
+// SplitText cuts a text with no pages or headings into chunks.
+func SplitText(text string, opts Options) []Chunk {
+	return Split([]Section{{Text: text}}, opts)
+}
+
+func build(units []unit, tokens int) Chunk {
+	var sb strings.Builder
+	chunk := Chunk{Tokens: tokens, FirstPage: units[0].page, LastPage: units[0].page, Heading: units[0].heading}
+	for i, u := range units {
+		if i > 0 {
+			switch {
+			case u.paragraph:
+				sb.WriteString("\n\n")
+			case !u.glued:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(u.text)
+		chunk.LastPage = max(chunk.LastPage, u.page)
+		if u.section && chunk.Heading == "" {
+			chunk.Heading = u.heading
+		}
+	}
+	chunk.Text = sb.String()
+	return chunk
+}
+
+// piece is part of a sentence. A glued piece goes on from the piece before
+// without a space, as a word too long for one chunk was cut between them.
+type piece struct {
+	text  string
+	glued bool
+}
+
+// pieces cuts a sentence longer than limit tokens between words, and a word
+// longer than that between characters.
+func pieces(sentence string, limit int) []piece {
+	if Tokens(sentence) <= limit {
+		return []piece{{text: sentence}}
+	}
+	var result []piece
+	var current []string
+	tokens, glued := 0, false
+	for _, word := range strings.Fields(sentence) {
+		n := Tokens(word)
+		if tokens+n > limit && len(current) > 0 {
+			result = append(result, piece{text: strings.Join(current, " "), glued: glued})
+			current, tokens, glued = nil, 0, false
+		}
+		for n > limit {
+			// At least 4 characters a token, so this is always under budget
+			cut := 0
+			for i := 0; i < limit; i++ {
+				_, size := utf8.DecodeRuneInString(word[cut:])
+				cut += size
+			}
+			result = append(result, piece{text: word[:cut], glued: glued})
+			word, glued = word[cut:], true
+			n = Tokens(word)
+		}
+		current = append(current, word)
+		tokens += n
+	}
+	if len(current) > 0 {
+		result = append(result, piece{text: strings.Join(current, " "), glued: glued})
+	}
+	return result
+}
+
+// Page is the text of one page of a document.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Heading is an outline entry of a document.
+type Heading struct {
+	Title string
+	Page  int
+}
+
+// Sections cuts pages into sections at the headings. A heading starts where
+// its title appears on its page. If it doesn't appear it starts at the top of
+// the page, or, after another heading on the same page, at the next page.
+func Sections(pages []Page, headings []Heading) []Section {
+	var sections []Section
+	current, pending := "", ""
+	for _, page := range pages {
+		text, newHeading := page.Text, false
+		if pending != "" {
+			current, newHeading, pending = pending, true, ""
+		}
+		for _, h := range headings {
+			if h.Page != page.Number || strings.TrimSpace(h.Title) == "" {
+				continue
+			}
+			cut := titleIndex(text, h.Title)
+			switch {
+			case cut < 0 && len(text) < len(page.Text):
+				pending = h.Title
+				continue
+			case cut > 0:
+				sections = append(sections, Section{Text: text[:cut], Page: page.Number, Heading: current, NewHeading: newHeading})
+				text = text[cut:]
+			}
+			current, newHeading, pending = h.Title, true, ""
+		}
+		sections = append(sections, Section{Text: text, Page: page.Number, Heading: current, NewHeading: newHeading})
+	}
+	return sections
+}
+
+// titleIndex finds title at the start of a line of text, ignoring case, or
+// returns -1.
+func titleIndex(text, title string) int {
+	title = strings.TrimSpace(title)
+	for start := 0; start < len(text); {
+		line := strings.TrimLeft(text[start:], " \t")
+		at := len(text) - len(line)
+		if len(line) >= len(title) && strings.EqualFold(line[:len(title)], title) {
+			return at
+		}
+		next := strings.IndexByte(line, '\n')
+		if next < 0 {
+			break
+		}
+		start = at + next + 1
+	}
+	return -1
+}
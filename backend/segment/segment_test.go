@@ -0,0 +1,205 @@
+package segment
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	for s, want := range map[string]int{
+		"":                   0,
+		"cat":                1,
+		"hello world":        4,
+		"Hi, there!":         5,
+		"photosynthesis":     4,
+		"植物は光":               4,
+		"  spaced   out  \n": 3,
+	} {
+		if got := Tokens(s); got != want {
+			t.Errorf("Tokens(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	for model, want := range map[string]int{
+		"gpt-4o-mini":             3000,
+		"GPT-4-0613":              2048,
+		"llama3:8b":               2048,
+		"phi3":                    1024,
+		"llama-3.3-70b-versatile": 3000,
+		"something-new":           2500,
+	} {
+		if got := Budget(model); got != want {
+			t.Errorf("Budget(%q) = %d, want %d", model, got, want)
+		}
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	if opts := OptionsFromEnv("phi3"); opts.MaxTokens != 1024 || opts.Overlap != defaultOverlap {
+		t.Errorf("default %+v", opts)
+	}
+	t.Setenv("CHUNK_TOKENS", "500")
+	t.Setenv("CHUNK_OVERLAP_TOKENS", "0")
+	if opts := OptionsFromEnv("phi3"); opts.MaxTokens != 500 || opts.Overlap != 0 {
+		t.Errorf("configured %+v", opts)
+	}
+	t.Setenv("CHUNK_TOKENS", "lots")
+	if opts := OptionsFromEnv("phi3"); opts.MaxTokens != 1024 {
+		t.Errorf("bad setting %+v", opts)
+	}
+}
+
+// numbered is n sentences of 6 tokens each, "Sentence number 1." and so on.
+func numbered(from, n int) string {
+	var s []string
+	for i := from; i < from+n; i++ {
+		s = append(s, fmt.Sprintf("Sentence number %d.", i))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestSplitBudget(t *testing.T) {
+	text := numbered(1, 40)
+	chunks := SplitText(text, Options{MaxTokens: 24})
+	if len(chunks) != 10 {
+		t.Fatalf("%d chunks", len(chunks))
+	}
+	var joined []string
+	for i, c := range chunks {
+		if c.Tokens > 24 || c.Tokens != Tokens(c.Text) {
+			t.Errorf("chunk %d has %d tokens: %q", i, c.Tokens, c.Text)
+		}
+		if !strings.HasPrefix(c.Text, "Sentence") || !strings.HasSuffix(c.Text, ".") {
+			t.Errorf("chunk %d isn't whole sentences: %q", i, c.Text)
+		}
+		joined = append(joined, c.Text)
+	}
+	if strings.Join(joined, " ") != text {
+		t.Error("the chunks don't add up to the text")
+	}
+}
+
+func TestSplitOverlap(t *testing.T) {
+	chunks := SplitText(numbered(1, 8), Options{MaxTokens: 24, Overlap: 6})
+	want := []string{numbered(1, 4), numbered(4, 4), numbered(7, 2)}
+	if len(chunks) != len(want) {
+		t.Fatalf("%d chunks: %+v", len(chunks), chunks)
+	}
+	for i, c := range chunks {
+		if c.Text != want[i] {
+			t.Errorf("chunk %d: %q, want %q", i, c.Text, want[i])
+		}
+	}
+
+	// An overlap of half the budget or more is cut to half
+	chunks = SplitText(numbered(1, 8), Options{MaxTokens: 24, Overlap: 100})
+	if chunks[1].Text != numbered(3, 4) {
+		t.Errorf("chunk 1 with a big overlap: %q", chunks[1].Text)
+	}
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	// The second paragraph doesn't fit after the first, so it starts a chunk
+	// rather than being cut in two
+	text := numbered(1, 3) + "\n\n" + numbered(4, 3) + "\n\n" + numbered(7, 1)
+	chunks := SplitText(text, Options{MaxTokens: 30})
+	if len(chunks) != 2 || chunks[0].Text != numbered(1, 3) || chunks[1].Text != numbered(4, 3)+"\n\n"+numbered(7, 1) {
+		t.Errorf("chunks %+v", chunks)
+	}
+}
+
+func TestSplitLongSentence(t *testing.T) {
+	sentence := strings.TrimSpace(strings.Repeat("word ", 30)) + "."
+	chunks := SplitText(sentence, Options{MaxTokens: 8})
+	var words []string
+	for _, c := range chunks {
+		if c.Tokens > 8 {
+			t.Errorf("chunk of %d tokens: %q", c.Tokens, c.Text)
+		}
+		words = append(words, strings.Fields(c.Text)...)
+	}
+	if strings.Join(words, " ") != sentence {
+		t.Errorf("the sentence was cut inside a word: %+v", chunks)
+	}
+}
+
+func TestSplitLongWord(t *testing.T) {
+	// The pieces of a word too long for a chunk join back without spaces
+	word := strings.Repeat("abcdefghij", 12)
+	chunks := SplitText(word, Options{MaxTokens: 8})
+	if len(chunks) < 2 {
+		t.Fatalf("%d chunks: %+v", len(chunks), chunks)
+	}
+	var joined strings.Builder
+	for i, c := range chunks {
+		if c.Tokens > 8 || strings.Contains(c.Text, " ") {
+			t.Errorf("chunk %d of %d tokens: %q", i, c.Tokens, c.Text)
+		}
+		joined.WriteString(c.Text)
+	}
+	if joined.String() != word {
+		t.Errorf("joined %q", joined.String())
+	}
+
+	// The words around it keep their spaces
+	chunks = SplitText("Take "+word+" apart.", Options{MaxTokens: 8})
+	if first := chunks[0].Text; !strings.HasPrefix(first, "Take abcdefgh") || strings.Count(first, " ") != 1 || chunks[len(chunks)-1].Text != "apart." {
+		t.Errorf("chunks %+v", chunks)
+	}
+}
+
+func TestSections(t *testing.T) {
+	pages := []Page{
+		{1, "Preface text.\nChapter 1\nCells are small."},
+		{2, "More on cells.\nchapter 2: Energy\nATP is energy."},
+		{3, "Appendix is not on this line\nThe end."},
+		{4, "Notes."},
+	}
+	headings := []Heading{
+		{"Chapter 1", 1},
+		{"Chapter 2: Energy", 2},
+		{"Appendix", 3}, // Not at the start of a line, so from the top of page 3
+	}
+	got := Sections(pages, headings)
+	want := []Section{
+		{Text: "Preface text.\n", Page: 1},
+		{Text: "Chapter 1\nCells are small.", Page: 1, Heading: "Chapter 1", NewHeading: true},
+		{Text: "More on cells.\n", Page: 2, Heading: "Chapter 1"},
+		{Text: "chapter 2: Energy\nATP is energy.", Page: 2, Heading: "Chapter 2: Energy", NewHeading: true},
+		{Text: "Appendix is not on this line\nThe end.", Page: 3, Heading: "Appendix", NewHeading: true},
+		{Text: "Notes.", Page: 4, Heading: "Appendix"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// A second heading on a page whose title can't be found starts on the next page
+	got = Sections([]Page{{1, "Intro.\nPart A\nText."}, {2, "More."}}, []Heading{{"Part A", 1}, {"Part B", 1}})
+	if len(got) != 3 || got[1].Heading != "Part A" || got[2].Heading != "Part B" || !got[2].NewHeading {
+		t.Errorf("pending heading: %+v", got)
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	sections := []Section{
+		{Text: numbered(1, 3), Page: 1, Heading: "One", NewHeading: true},
+		{Text: numbered(4, 3), Page: 2, Heading: "One"},
+		{Text: numbered(7, 2), Page: 2, Heading: "Two", NewHeading: true},
+		{Text: numbered(9, 1), Page: 3, Heading: "Three", NewHeading: true},
+	}
+	chunks := Split(sections, Options{MaxTokens: 60, Overlap: 6})
+	// A heading starts a new chunk, without overlap, unless the chunk so far
+	// is under a quarter of the budget
+	if len(chunks) != 2 {
+		t.Fatalf("%d chunks: %+v", len(chunks), chunks)
+	}
+	if c := chunks[0]; c.Text != numbered(1, 3)+"\n\n"+numbered(4, 3) || c.FirstPage != 1 || c.LastPage != 2 || c.Heading != "One" {
+		t.Errorf("chunk 0: %+v", c)
+	}
+	if c := chunks[1]; c.Text != numbered(7, 2)+"\n\n"+numbered(9, 1) || c.FirstPage != 2 || c.LastPage != 3 || c.Heading != "Two" {
+		t.Errorf("chunk 1: %+v", c)
+	}
+}
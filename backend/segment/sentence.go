@@ -0,0 +1,90 @@
+package segment
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var paragraphBreak = regexp.MustCompile(`\n[ \t\r\f\v]*\n\s*`)
+
+// paragraphs splits text at blank lines, joining the lines of each paragraph.
+func paragraphs(text string) []string {
+	var result []string
+	for _, p := range paragraphBreak.Split(text, -1) {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// abbreviations end in a period without ending the sentence.
+var abbreviations = map[string]bool{
+	"e.g": true, "i.e": true, "etc": true, "vs": true, "cf": true, "al": true, "approx": true,
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"fig": true, "figs": true, "eq": true, "eqs": true, "no": true, "vol": true, "ch": true, "sec": true,
+	"p": true, "pp": true, "ed": true, "eds": true, "inc": true, "ltd": true, "co": true, "corp": true,
+}
+
+// sentences splits a paragraph into sentences. A sentence ends at . ! ? or …
+// (with any closing quotes and brackets) followed by a space and something
+// that can start a sentence, unless the period belongs to an abbreviation or
+// an initial. CJK sentence marks end a sentence without the space.
+func sentences(paragraph string) []string {
+	var result []string
+	start := 0
+	for i := 0; i < len(paragraph); {
+		r, size := utf8.DecodeRuneInString(paragraph[i:])
+		i += size
+		switch r {
+		case '。', '！', '？':
+			end := i + closingLength(paragraph[i:])
+			result = append(result, strings.TrimSpace(paragraph[start:end]))
+			start, i = end, end
+		case '.', '!', '?', '…':
+			end := i + closingLength(paragraph[i:])
+			next, _ := utf8.DecodeRuneInString(strings.TrimLeft(paragraph[end:], " "))
+			if end == len(paragraph) || end < len(paragraph) && paragraph[end] != ' ' {
+				continue
+			}
+			if !canStart(next) || r == '.' && abbreviated(paragraph[start:i-size]) {
+				continue
+			}
+			result = append(result, strings.TrimSpace(paragraph[start:end]))
+			start, i = end, end
+		}
+	}
+	if rest := strings.TrimSpace(paragraph[start:]); rest != "" {
+		result = append(result, rest)
+	}
+	return result
+}
+
+// closingLength is the length of the quotes and brackets closing a sentence.
+func closingLength(s string) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !strings.ContainsRune(`"')]’”»」』`, r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func canStart(r rune) bool {
+	return unicode.IsUpper(r) || unicode.IsDigit(r) || unicode.Is(unicode.Han, r) || strings.ContainsRune(`"'([‘“«¿¡`, r) || r == '-' || r == '•'
+}
+
+// abbreviated reports whether text ends with an abbreviation or an initial,
+// so a period after it doesn't end the sentence.
+func abbreviated(text string) bool {
+	word := text[strings.LastIndexAny(text, " ([\"'")+1:]
+	if utf8.RuneCountInString(word) == 1 && unicode.IsUpper([]rune(word)[0]) {
+		return true // J. Smith
+	}
+	return abbreviations[strings.ToLower(word)]
+}
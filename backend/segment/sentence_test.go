@@ -0,0 +1,29 @@
+package segment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParagraphs(t *testing.T) {
+	got := paragraphs("First line\nsame paragraph.\n \n\nSecond\tone.\n\n\n")
+	if want := []string{"First line same paragraph.", "Second one."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSentences(t *testing.T) {
+	for paragraph, want := range map[string][]string{
+		"One. Two! Three? Four":                         {"One.", "Two!", "Three?", "Four"},
+		"Dr. Smith saw it, e.g. in Fig. 3. It was big.": {"Dr. Smith saw it, e.g. in Fig. 3.", "It was big."},
+		"J. R. R. Tolkien wrote it. Then he rested.":    {"J. R. R. Tolkien wrote it.", "Then he rested."},
+		"Version 2.5 is out. 3 bugs were fixed.":        {"Version 2.5 is out.", "3 bugs were fixed."},
+		`He said "stop." Then he left.`:                 {`He said "stop."`, "Then he left."},
+		"(It works.) Wait… really? yes.":                {"(It works.)", "Wait… really? yes."},
+		"植物は光を使う。糖を作る！":                                 {"植物は光を使う。", "糖を作る！"},
+	} {
+		if got := sentences(paragraph); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q:\n got %q\nwant %q", paragraph, got, want)
+		}
+	}
+}
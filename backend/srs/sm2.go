@@ -0,0 +1,72 @@
+// Package srs implements the SM-2 spaced-repetition algorithm used to
+// schedule flashcard reviews.
+package srs
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Recall grades, from complete blackout (0) to perfect recall (5).
+// Anything below Pass counts as a lapse.
+const (
+	MinGrade = 0
+	Pass     = 3
+	MaxGrade = 5
+)
+
+// DefaultEase is the ease factor a new card starts with.
+const DefaultEase = 2.5
+
+const minEase = 1.3
+
+// State is the scheduling state of one card for one learner.
+type State struct {
+	Ease        float64
+	Interval    int // days
+	Repetitions int
+	Lapses      int
+	Due         time.Time
+}
+
+// New returns the state of a card that has never been reviewed. It is due now.
+func New(now time.Time) State {
+	return State{Ease: DefaultEase, Due: now}
+}
+
+// Review applies a recall grade to s and returns the next state.
+func Review(s State, grade int, now time.Time) (State, error) {
+	if grade < MinGrade || grade > MaxGrade {
+		return s, fmt.Errorf("grade must be between %d and %d", MinGrade, MaxGrade)
+	}
+	if s.Ease == 0 {
+		s.Ease = DefaultEase
+	}
+
+	if grade < Pass {
+		// A card failed before it was ever recalled is a lapse too
+		s.Lapses++
+		s.Repetitions = 0
+		s.Interval = 1
+	} else {
+		switch s.Repetitions {
+		case 0:
+			s.Interval = 1
+		case 1:
+			s.Interval = 6
+		default:
+			s.Interval = int(math.Round(float64(s.Interval) * s.Ease))
+		}
+		s.Repetitions++
+	}
+
+	q := float64(MaxGrade - grade)
+	s.Ease += 0.1 - q*(0.08+q*0.02)
+	if s.Ease < minEase {
+		s.Ease = minEase
+	}
+
+	s.Due = now.AddDate(0, 0, s.Interval)
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package srs
+
+import (
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+func TestReviewIntervals(t *testing.T) {
+	s := New(now)
+	if !s.Due.Equal(now) || s.Ease != DefaultEase {
+		t.Fatalf("new card %+v", s)
+	}
+	// Grade 4 leaves the ease at 2.5: 1, 6, then 6*2.5 and so on
+	for i, want := range []int{1, 6, 15, 38, 95} {
+		var err error
+		if s, err = Review(s, 4, now); err != nil {
+			t.Fatal(err)
+		}
+		if s.Interval != want || s.Repetitions != i+1 || s.Ease != DefaultEase {
+			t.Errorf("review %d: %+v, want interval %d", i+1, s, want)
+		}
+		if !s.Due.Equal(now.AddDate(0, 0, want)) {
+			t.Errorf("review %d: due %v", i+1, s.Due)
+		}
+	}
+
+	// A perfect answer raises the ease, a hesitant one lowers it
+	if s, _ := Review(New(now), 5, now); s.Ease != 2.6 {
+		t.Errorf("grade 5: ease %v", s.Ease)
+	}
+	if s, _ := Review(New(now), 3, now); s.Ease != 2.36 {
+		t.Errorf("grade 3: ease %v", s.Ease)
+	}
+}
+
+func TestReviewEaseFloor(t *testing.T) {
+	s := New(now)
+	for i := 0; i < 10; i++ {
+		s, _ = Review(s, 0, now)
+	}
+	if s.Ease != minEase {
+		t.Errorf("ease %v after ten blackouts, want %v", s.Ease, minEase)
+	}
+	if s, _ = Review(s, 3, now); s.Ease != minEase {
+		t.Errorf("ease %v went below the floor", s.Ease)
+	}
+}
+
+func TestReviewLapse(t *testing.T) {
+	s := New(now)
+	for i := 0; i < 3; i++ {
+		s, _ = Review(s, 5, now)
+	}
+	s, _ = Review(s, 2, now)
+	if s.Repetitions != 0 || s.Interval != 1 || s.Lapses != 1 {
+		t.Errorf("after a lapse: %+v", s)
+	}
+	// Relearning starts from the first interval again
+	if s, _ = Review(s, 4, now); s.Interval != 1 || s.Repetitions != 1 {
+		t.Errorf("after relearning: %+v", s)
+	}
+
+	// Failing a new card, and failing it again, count as well
+	s, _ = Review(New(now), 1, now)
+	if s.Lapses != 1 || s.Repetitions != 0 {
+		t.Errorf("failed first review: %+v", s)
+	}
+	if s, _ = Review(s, 0, now); s.Lapses != 2 {
+		t.Errorf("failed again: %+v", s)
+	}
+}
+
+func TestReviewGradeRange(t *testing.T) {
+	s := New(now)
+	for _, grade := range []int{-1, 6} {
+		got, err := Review(s, grade, now)
+		if err == nil || got != s {
+			t.Errorf("grade %d: %+v, %v", grade, got, err)
+		}
+	}
+	// A zero value state gets the default ease
+	if got, err := Review(State{}, 4, now); err != nil || got.Ease != DefaultEase {
+		t.Errorf("zero state: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put("documents/1.pdf", strings.NewReader("%PDF-1.4")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "documents", "1.pdf")); err != nil {
+		t.Errorf("file not under the store's directory: %v", err)
+	}
+	f, err := store.Open("documents/1.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "%PDF-1.4" {
+		t.Errorf("read %q", data)
+	}
+
+	// Putting again replaces the file and leaves no temp files behind
+	if err := store.Put("documents/1.pdf", strings.NewReader("%PDF-1.7")); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "documents"))
+	if len(entries) != 1 {
+		t.Errorf("%d files after replacing one", len(entries))
+	}
+
+	if err := store.Delete("documents/1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open("documents/1.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("open after delete: %v", err)
+	}
+	if err := store.Delete("documents/1.pdf"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+}
+
+func TestLocalRejectsKeysOutsideItsDirectory(t *testing.T) {
+	store, err := NewLocal(filepath.Join(t.TempDir(), "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", ".", "../x.pdf", "documents/../../x.pdf", "/etc/passwd"} {
+		if err := store.Put(key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) was allowed", key)
+		}
+		if _, err := store.Open(key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q): %v", key, err)
+		}
+		if err := store.Delete(key); err == nil {
+			t.Errorf("Delete(%q) was allowed", key)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("STORAGE_DIR", filepath.Join(t.TempDir(), "uploads"))
+	if store, err := FromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := store.(*Local); !ok {
+		t.Errorf("got %T", store)
+	}
+
+	t.Setenv("STORAGE_BACKEND", "s3")
+	if _, err := FromEnv(); err == nil {
+		t.Error("unknown backend accepted")
+	}
+}
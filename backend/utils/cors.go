@@ -4,12 +4,45 @@ package utils
 
 import (
 	"net/http"
+	"os"
+	"strings"
 )
 
+// AllowedOrigins are the browser origins allowed to call the API, from the
+// comma separated ALLOWED_ORIGINS (the React dev server by default).
+func AllowedOrigins() []string {
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		return []string{"http://localhost:5173"}
+	}
+	var allowed []string
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+	return allowed
+}
+
+// OriginAllowed reports whether origin is one of AllowedOrigins.
+func OriginAllowed(origin string) bool {
+	for _, allowed := range AllowedOrigins() {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Allow your React app origin
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
+		origin := AllowedOrigins()[0]
+		if OriginAllowed(r.Header.Get("Origin")) {
+			origin = r.Header.Get("Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
@@ -15,6 +15,32 @@ type contextKey string
 
 const UserContextKey = contextKey("user")
 
+// ParseToken checks a JWT signed with JWT_SECRET and returns its claims.
+func ParseToken(tokenStr string) (jwt.MapClaims, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET not set")
+	}
+
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected  signing method")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("failed to parse token claims")
+	}
+	if _, ok := claims["email"].(string); !ok {
+		return nil, errors.New("token has no email claim")
+	}
+	return claims, nil
+}
+
 func ValidateToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -23,28 +49,17 @@ func ValidateToken(next http.Handler) http.Handler {
 			return
 		}
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
+		if os.Getenv("JWT_SECRET") == "" {
 			http.Error(w, "JWT_SECRET not set", http.StatusInternalServerError)
 			return
 		}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected  signing method")
-			}
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenStr)
+		if err != nil {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			ctx := context.WithValue(r.Context(), UserContextKey, claims)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-		http.Error(w, "Failed to parse token claims", http.StatusUnauthorized)
+		ctx := context.WithValue(r.Context(), UserContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -1,5 +1,5 @@
 // frontend/src/components/Chatbot.jsx
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useRef } from 'react';
 import Chatbot, { createChatBotMessage } from 'react-chatbot-kit';
 import 'react-chatbot-kit/build/main.css';
 import './Chatbot.css';
@@ -25,19 +25,54 @@ const MyMessageParser = ({ children, actions }) => {
 const MyActionProvider = ({ createChatBotMessage, setState, children }) => {
     const { learningContext } = useChatbotContext(); // Get the learning context
     const [socket, setSocket] = useState(null);
+    const streamingId = useRef(null); // id of the bot message being streamed
+    const sessionId = useRef(null); // server-side conversation, so follow-ups have context
+    const sessionTopic = useRef(null);
 
     useEffect(() => {
-        const newSocket = new WebSocket("ws://localhost:8080/ws");
+        const token = localStorage.getItem("token");
+        const newSocket = new WebSocket(`ws://localhost:8080/ws?token=${encodeURIComponent(token || "")}`);
         newSocket.onopen = () => console.log("WebSocket connected");
         newSocket.onclose = () => console.log("WebSocket disconnected");
         newSocket.onerror = (error) => console.error("WebSocket error:", error);
 
+        // Every frame is an envelope {v, type, id, payload}. Replies arrive as
+        // "delta" frames, then a "done" frame with the full text.
         newSocket.onmessage = (event) => {
-            const botMessage = createChatBotMessage(event.data);
-            setState((prev) => ({
-                ...prev,
-                messages: [...prev.messages, botMessage],
-            }));
+            const frame = JSON.parse(event.data);
+            const payload = frame.payload || {};
+            if (frame.type === "session") {
+                sessionId.current = payload.session_id;
+                return;
+            }
+            if (frame.type === "typing") {
+                return;
+            }
+            if (frame.type === "delta") {
+                setState((prev) => {
+                    const last = prev.messages[prev.messages.length - 1];
+                    if (last && last.id === streamingId.current) {
+                        const updated = { ...last, message: last.message + payload.text };
+                        return { ...prev, messages: [...prev.messages.slice(0, -1), updated] };
+                    }
+                    const botMessage = createChatBotMessage(payload.text);
+                    streamingId.current = botMessage.id;
+                    return { ...prev, messages: [...prev.messages, botMessage] };
+                });
+                return;
+            }
+
+            const id = streamingId.current;
+            streamingId.current = null;
+            const text = frame.type === "error" ? payload.message : payload.text;
+            setState((prev) => {
+                const last = prev.messages[prev.messages.length - 1];
+                if (last && last.id === id) {
+                    const updated = { ...last, message: text };
+                    return { ...prev, messages: [...prev.messages.slice(0, -1), updated] };
+                }
+                return { ...prev, messages: [...prev.messages, createChatBotMessage(text)] };
+            });
         };
 
         setSocket(newSocket);
@@ -47,11 +82,23 @@ const MyActionProvider = ({ createChatBotMessage, setState, children }) => {
 
     const sendMessage = (message) => {
         if (socket && socket.readyState === WebSocket.OPEN) {
-            const payload = JSON.stringify({
-                message: message,
-                context: learningContext, // Include the context
+            // A new topic starts a new conversation
+            const topic = learningContext?.topic || "";
+            if (sessionTopic.current !== topic) {
+                sessionId.current = null;
+                sessionTopic.current = topic;
+            }
+            const frame = JSON.stringify({
+                v: 1,
+                type: "message",
+                id: String(Date.now()),
+                payload: {
+                    text: message,
+                    session_id: sessionId.current || undefined,
+                    context: learningContext, // Include the context
+                },
             });
-            socket.send(payload);
+            socket.send(frame);
         }
     };
 
@@ -748,8 +748,8 @@ function Courses() {
                     let topics = [];
                     let progress = [];
                     try {
-                      topics = JSON.parse(week.topics || "[]");
-                      progress = JSON.parse(week.progress || "[]");
+                      topics = (week.topics || []).map((t) => t.title);
+                      progress = (week.topics || []).map((t) => Boolean(t.completed_at));
                     } catch (err) {
                       console.error("JSON parse error:", err);
                     }
@@ -880,8 +880,8 @@ function Courses() {
                             let topics = [];
                             let progress = [];
                             try {
-                              topics = JSON.parse(week.topics || "[]");
-                              progress = JSON.parse(week.progress || "[]");
+                              topics = (week.topics || []).map((t) => t.title);
+                              progress = (week.topics || []).map((t) => Boolean(t.completed_at));
                             } catch (err) {
                               return null;
                             }
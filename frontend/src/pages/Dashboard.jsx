@@ -447,13 +447,7 @@ const FlashcardModal = ({ isOpen, onClose, flashcardData }) => {
   const [currentCard, setCurrentCard] = useState(0);
   const [showAnswer, setShowAnswer] = useState(false);
 
-  let flashcards = [];
-  try {
-    const parsed = JSON.parse(flashcardData?.flashcards || "{}");
-    flashcards = parsed.flashcards || [];
-  } catch (err) {
-    console.error("Flashcards parse error:", err);
-  }
+  const flashcards = flashcardData?.cards || [];
 
   const nextCard = () => {
     setCurrentCard((prev) => (prev + 1) % flashcards.length);
@@ -582,6 +576,8 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
   const [selectedAnswers, setSelectedAnswers] = useState({});
   const [showResults, setShowResults] = useState(false);
   const [score, setScore] = useState(0);
+  const [results, setResults] = useState([]);
+  const [startedAt, setStartedAt] = useState(new Date());
 
   let questions = [];
   try {
@@ -596,6 +592,8 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
     setSelectedAnswers({});
     setShowResults(false);
     setScore(0);
+    setResults([]);
+    setStartedAt(new Date());
   };
 
   const handleAnswerSelect = (questionIndex, answer) => {
@@ -605,15 +603,28 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
     }));
   };
 
-  const calculateScore = () => {
-    let correct = 0;
-    questions.forEach((q, index) => {
-      if (selectedAnswers[index] === q.answer) {
-        correct++;
-      }
-    });
-    setScore(correct);
-    setShowResults(true);
+  // Answers are graded on the server
+  const calculateScore = async () => {
+    try {
+      const res = await axios.post(
+        "http://localhost:8080/quiz-attempts",
+        {
+          quiz_set_id: quizData?.ID,
+          answers: questions.map((_, index) => selectedAnswers[index] || ""),
+          started_at: startedAt.toISOString(),
+        },
+        {
+          headers: {
+            Authorization: `Bearer ${localStorage.getItem("token")}`,
+          },
+        }
+      );
+      setResults(res.data.answers || []);
+      setScore(res.data.score);
+      setShowResults(true);
+    } catch (err) {
+      console.error("Quiz submission failed:", err);
+    }
   };
 
   const nextQuestion = () => {
@@ -682,7 +693,7 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
             <div className="space-y-4">
               {questions.map((q, index) => {
                 const userAnswer = selectedAnswers[index];
-                const isCorrect = userAnswer === q.answer;
+                const isCorrect = Boolean(results[index]?.correct);
 
                 return (
                   <div
@@ -713,7 +724,7 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
                       </p>
                       {!isCorrect && (
                         <p className="text-green-700">
-                          Correct answer: {q.answer}
+                          Correct answer: {results[index]?.correct_answer}
                         </p>
                       )}
                     </div>
@@ -1341,8 +1352,8 @@ const handleBooksClick = async (goal) => { // from courseTitle to goal
                         let topics = [];
                         let progress = [];
                         try {
-                          topics = JSON.parse(week.topics || "[]");
-                          progress = JSON.parse(week.progress || "[]");
+                          topics = (week.topics || []).map((t) => t.title);
+                          progress = (week.topics || []).map((t) => Boolean(t.completed_at));
                         } catch (err) {
                           console.error("JSON parse error:", err);
                         }
@@ -1473,8 +1484,8 @@ const handleBooksClick = async (goal) => { // from courseTitle to goal
                                 let topics = [];
                                 let progress = [];
                                 try {
-                                  topics = JSON.parse(week.topics || "[]");
-                                  progress = JSON.parse(week.progress || "[]");
+                                  topics = (week.topics || []).map((t) => t.title);
+                                  progress = (week.topics || []).map((t) => Boolean(t.completed_at));
                                 } catch (err) {
                                   return null;
                                 }
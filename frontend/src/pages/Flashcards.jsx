@@ -131,7 +131,7 @@ const FlashcardFromPDF = () => {
           <div className="space-y-4">
             <input
               type="file"
-              accept="application/pdf"
+              accept=".pdf,.epub,.docx,.md,.markdown,.html,.htm,.txt"
               onChange={handleFileChange}
               className="block w-full text-sm text-gray-600
                 file:mr-4 file:py-2 file:px-4
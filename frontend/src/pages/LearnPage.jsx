@@ -72,7 +72,7 @@ function LearnPage() {
     ) {
       const sortedWeeks = [...roadmap.weeks].sort((a, b) => a.week - b.week);
       const firstWeek = sortedWeeks[0];
-      const topics = JSON.parse(firstWeek.topics);
+      const topics = (firstWeek.topics || []).map((t) => t.title);
       if (topics.length > 0) {
         handleExplainTopic(topics[0], 0, 0);
         setOpenWeek(0);
@@ -242,11 +242,11 @@ function LearnPage() {
       if (prevWeekIndex < 0) {
         return;
       }
-      const prevWeekTopics = JSON.parse(sortedWeeks[prevWeekIndex].topics);
+      const prevWeekTopics = (sortedWeeks[prevWeekIndex].topics || []).map((t) => t.title);
       prevTopicIndex = prevWeekTopics.length - 1;
     }
     const prevWeek = sortedWeeks[prevWeekIndex];
-    const prevTopics = JSON.parse(prevWeek.topics);
+    const prevTopics = (prevWeek.topics || []).map((t) => t.title);
     const prevTopic = prevTopics[prevTopicIndex];
     if (!prevTopic) {
       console.warn("Previous topic not found");
@@ -264,14 +264,7 @@ function LearnPage() {
 
     if (!week) return false;
 
-    let progress = [];
-    try {
-      progress = JSON.parse(week.progress || "[]");
-    } catch {
-      progress = [];
-    }
-
-    return progress[currentTopicIndex] === true;
+    return Boolean((week.topics || [])[currentTopicIndex]?.completed_at);
   };
 
   const handleMarkAsCompletedButton = async () => {
@@ -294,9 +287,7 @@ function LearnPage() {
       await axios.post(
         "http://localhost:8080/update-progress",
         {
-          roadmap_id: roadmap.ID,
-          week_id: currentWeek.ID,
-          topic_index: currentTopicIndex,
+          topic_id: (currentWeek.topics || [])[currentTopicIndex]?.ID,
           value: !currentlyCompleted,
         },
         {
@@ -329,7 +320,7 @@ function LearnPage() {
       return;
     }
 
-    const topics = JSON.parse(currentWeek.topics);
+    const topics = (currentWeek.topics || []).map((t) => t.title);
 
     if (nextTopicIndex >= topics.length) {
       nextWeekIndex++;
@@ -342,7 +333,7 @@ function LearnPage() {
     }
 
     const nextWeek = sortedWeeks[nextWeekIndex];
-    const nextTopics = JSON.parse(nextWeek.topics);
+    const nextTopics = (nextWeek.topics || []).map((t) => t.title);
     const nextTopic = nextTopics[nextTopicIndex];
 
     if (!nextTopic) {
@@ -479,8 +470,8 @@ function LearnPage() {
               .slice()
               .sort((a, b) => a.week - b.week)
               .map((week, idx) => {
-                const topics = JSON.parse(week.topics);
-                const progress = JSON.parse(week.progress);
+                const topics = (week.topics || []).map((t) => t.title);
+                const progress = (week.topics || []).map((t) => Boolean(t.completed_at));
                 const isOpen = openWeek === idx;
                 const completedTopics = progress.filter(Boolean).length;
                 const progressPercentage =
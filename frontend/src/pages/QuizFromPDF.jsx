@@ -62,6 +62,8 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
   const [selectedAnswers, setSelectedAnswers] = useState({});
   const [showResults, setShowResults] = useState(false);
   const [score, setScore] = useState(0);
+  const [results, setResults] = useState([]);
+  const [startedAt, setStartedAt] = useState(new Date());
 
   let questions = [];
   try {
@@ -77,6 +79,8 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
     setSelectedAnswers({});
     setShowResults(false);
     setScore(0);
+    setResults([]);
+    setStartedAt(new Date());
   };
 
   const handleAnswerSelect = (questionIndex, answer) => {
@@ -86,15 +90,28 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
     }));
   };
 
-  const calculateScore = () => {
-    let correct = 0;
-    questions.forEach((q, index) => {
-      if (selectedAnswers[index] === q.answer) {
-        correct++;
-      }
-    });
-    setScore(correct);
-    setShowResults(true);
+  // Answers are graded on the server
+  const calculateScore = async () => {
+    try {
+      const res = await axios.post(
+        "http://localhost:8080/quiz-attempts",
+        {
+          quiz_set_id: quizData?.quizSetId,
+          answers: questions.map((_, index) => selectedAnswers[index] || ""),
+          started_at: startedAt.toISOString(),
+        },
+        {
+          headers: {
+            Authorization: `Bearer ${localStorage.getItem("token")}`,
+          },
+        }
+      );
+      setResults(res.data.answers || []);
+      setScore(res.data.score);
+      setShowResults(true);
+    } catch (err) {
+      console.error("Quiz submission failed:", err);
+    }
   };
 
   const nextQuestion = () => {
@@ -161,7 +178,7 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
             <div className="space-y-4 max-h-96 overflow-y-auto pr-2">
               {questions.map((q, index) => {
                 const userAnswer = selectedAnswers[index];
-                const isCorrect = userAnswer === q.answer;
+                const isCorrect = Boolean(results[index]?.correct);
 
                 return (
                   <div
@@ -192,7 +209,7 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
                       </p>
                       {!isCorrect && (
                         <p className="text-green-700">
-                          Correct answer: {q.answer}
+                          Correct answer: {results[index]?.correct_answer}
                         </p>
                       )}
                     </div>
@@ -294,6 +311,7 @@ const QuizModal = ({ isOpen, onClose, quizData }) => {
 const QuizFromPDF = () => {
   const [file, setFile] = useState(null);
   const [quiz, setQuiz] = useState([]);
+  const [quizSetId, setQuizSetId] = useState(null);
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState(null);
   const [isQuizModalOpen, setIsQuizModalOpen] = useState(false);
@@ -339,6 +357,7 @@ const QuizFromPDF = () => {
         }
       );
       setQuiz(quizRes.data.quiz || []);
+      setQuizSetId(quizRes.data.quiz_set_id);
       if (quizRes.data.quiz && quizRes.data.quiz.length > 0) {
         setIsQuizModalOpen(true);
       } else {
@@ -368,7 +387,7 @@ const QuizFromPDF = () => {
         <QuizModal
             isOpen={isQuizModalOpen}
             onClose={() => setIsQuizModalOpen(false)}
-            quizData={{ quiz: quiz }}
+            quizData={{ quiz: quiz, quizSetId: quizSetId }}
         />
 
       {/* Header */}
@@ -398,7 +417,7 @@ const QuizFromPDF = () => {
           <div className="space-y-4">
             <input
               type="file"
-              accept="application/pdf"
+              accept=".pdf,.epub,.docx,.md,.markdown,.html,.htm,.txt"
               onChange={handleFileChange}
               className="block w-full text-sm text-gray-600
                 file:mr-4 file:py-2 file:px-4
@@ -7,6 +7,9 @@ import { motion, AnimatePresence } from "framer-motion"
 const QuizSection = React.memo(({ selectedTopic, explanation, isVisible, currentWeekIndex, currentTopicIndex }) => {
   const [quizCache, setQuizCache] = useState({})
   const [quiz, setQuiz] = useState([])
+  const [contentId, setContentId] = useState(null)
+  const [results, setResults] = useState([])
+  const startedAtRef = useRef(new Date())
   // Helper function to generate cache key
   const getCacheKey = (topic, weekIndex, topicIndex) => {
     return `${weekIndex}-${topicIndex}-${topic}`
@@ -44,7 +47,9 @@ const QuizSection = React.memo(({ selectedTopic, explanation, isVisible, current
       // Check if quiz is already cached
       if (quizCache[cacheKey]) {
         console.log("Loading quiz from cache for:", selectedTopic)
-        setQuiz(quizCache[cacheKey])
+        setQuiz(quizCache[cacheKey].quiz)
+        setContentId(quizCache[cacheKey].contentId)
+        startedAtRef.current = new Date()
         setIsLoading(false)
         return
       }
@@ -73,11 +78,13 @@ const QuizSection = React.memo(({ selectedTopic, explanation, isVisible, current
         )
         const quizData = res.data.quiz
         setQuiz(quizData)
+        setContentId(res.data.content_id)
+        startedAtRef.current = new Date()
 
         // ADD THIS: Cache the quiz data
         setQuizCache((prev) => ({
           ...prev,
-          [cacheKey]: quizData,
+          [cacheKey]: { quiz: quizData, contentId: res.data.content_id },
         }))
       } catch (err) {
         console.error("Quiz generation failed:", err)
@@ -107,36 +114,42 @@ const QuizSection = React.memo(({ selectedTopic, explanation, isVisible, current
     restoreScrollPosition()
   }
 
-  const handleSubmitQuiz = () => {
-    let total = 0
-
-    quiz.forEach((q, idx) => {
+  const handleSubmitQuiz = async () => {
+    // Answers are graded on the server, send the selected option text per question
+    const answers = quiz.map((q, idx) => {
       const selectedLetter = selectedAnswers[idx]
-      if (!selectedLetter) return
-
+      if (!selectedLetter) return ""
       const optionIndex = selectedLetter.charCodeAt(0) - 65 // A=0, B=1, ...
-      const selectedText = q.options?.[optionIndex]
-
-      const answer = q.answer
-      const matchesByLetter =
-        typeof answer === "string" && /^[A-Z]$/.test(answer.trim()) && answer.trim().toUpperCase() === selectedLetter
-
-      const matchesByText =
-        (typeof answer === "string" || typeof answer === "number") &&
-        String(answer).trim() === String(selectedText).trim()
-
-      if (matchesByLetter || matchesByText) {
-        total++
-      }
+      return q.options?.[optionIndex] ?? ""
     })
 
-    setScore(total)
-    setQuizSubmitted(true)
-    setShowPopup(true)
+    try {
+      const res = await axios.post(
+        "http://localhost:8080/quiz-attempts",
+        {
+          content_id: contentId,
+          answers,
+          started_at: startedAtRef.current.toISOString(),
+        },
+        {
+          headers: {
+            Authorization: `Bearer ${localStorage.getItem("token")}`,
+          },
+        },
+      )
+      setResults(res.data.answers || [])
+      setScore(res.data.score)
+      setQuizSubmitted(true)
+      setShowPopup(true)
+    } catch (err) {
+      console.error("Quiz submission failed:", err)
+    }
   }
 
   const handleRetryQuiz = () => {
     setSelectedAnswers({})
+    setResults([])
+    startedAtRef.current = new Date()
     setScore(0)
     setQuizSubmitted(false)
     setShowPopup(false)
@@ -192,15 +205,8 @@ const QuizSection = React.memo(({ selectedTopic, explanation, isVisible, current
               <ul className="space-y-2 sm:space-y-3">
                 {q.options.map((opt, i) => {
                   const optionLetter = String.fromCharCode(65 + i)
-                  const answer = q.answer
-                  const matchesByLetter =
-                    typeof answer === "string" &&
-                    /^[A-Z]$/.test(answer.trim()) &&
-                    answer.trim().toUpperCase() === optionLetter
-                  const matchesByText =
-                    (typeof answer === "string" || typeof answer === "number") &&
-                    String(answer).trim() === String(opt).trim()
-                  const isCorrect = matchesByLetter || matchesByText
+                  const answer = results[idx]?.correct_answer
+                  const isCorrect = answer !== undefined && String(answer).trim() === String(opt).trim()
 
                   const isSelected = selectedAnswers[idx] === optionLetter
 